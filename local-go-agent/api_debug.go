@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 调试日志中请求体和响应体最多记录的字节数
+const apiDebugBodyLimit = 2048
+
+const redactedValue = "[已隐藏]"
+
+// 含有凭据的请求头、查询参数和JSON字段，不区分大小写
+var sensitiveAPIKeys = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+	"api-key":             true,
+	"api_key":             true,
+	"apikey":              true,
+	"token":               true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// apiDebugger 记录与AI服务之间的请求和响应，用于排查服务接入问题。
+// 请求头、查询参数和JSON中的凭据会被隐藏，过长的内容会被截断
+type apiDebugger struct {
+	logger *logrus.Entry
+}
+
+// newAPIDebugger 在开启 log.debug_api 且日志级别为 debug 时返回记录器，否则返回 nil
+func newAPIDebugger(cfg LogConfig, logger *logrus.Logger, service string) *apiDebugger {
+	if !cfg.DebugAPI {
+		return nil
+	}
+	if !logger.IsLevelEnabled(logrus.DebugLevel) {
+		logger.Warnf("log.debug_api 只在日志级别为 debug 时生效，不记录%s的请求", service)
+		return nil
+	}
+	return &apiDebugger{logger: logger.WithField("service", service)}
+}
+
+// httpClient 返回记录每个请求和响应的HTTP客户端
+func (d *apiDebugger) httpClient() *http.Client {
+	return &http.Client{Transport: &debugTransport{next: http.DefaultTransport, debugger: d}}
+}
+
+// logDial 记录建立websocket连接的地址
+func (d *apiDebugger) logDial(endpoint string) {
+	if d == nil {
+		return
+	}
+	d.logger.Debugf("API连接 websocket %s", redactURL(endpoint))
+}
+
+// logMessage 记录websocket上发送的JSON消息
+func (d *apiDebugger) logMessage(message interface{}) {
+	if d == nil {
+		return
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	d.logger.Debugf("API发送 websocket 消息: %s", redactBody(data, "application/json"))
+}
+
+// debugTransport 在 next 之外记录请求和响应。响应体边读边记录，流式响应不会被提前读完
+type debugTransport struct {
+	next     http.RoundTripper
+	debugger *apiDebugger
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	logger := t.debugger.logger
+	var body []byte
+	contentType := req.Header.Get("Content-Type")
+	// 上传音频等二进制请求体不读取，保持流式发送
+	if !isTextContent(contentType) {
+		logger.Debugf("API请求 %s %s 请求头: %s 请求体: (%s)",
+			req.Method, redactURL(req.URL.String()), redactHeader(req.Header), contentType)
+	} else if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = data
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	if isTextContent(contentType) {
+		logger.Debugf("API请求 %s %s 请求头: %s 请求体: %s",
+			req.Method, redactURL(req.URL.String()), redactHeader(req.Header), redactBody(body, contentType))
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		logger.Debugf("API请求 %s %s 失败 (%v): %v", req.Method, redactURL(req.URL.String()), time.Since(start), err)
+		return nil, err
+	}
+	resp.Body = &debugBody{
+		ReadCloser: resp.Body,
+		onClose: func(head []byte, total int) {
+			logger.Debugf("API响应 %s %s 状态 %d (%v) 响应头: %s 响应体 (%d 字节): %s",
+				req.Method, redactURL(req.URL.String()), resp.StatusCode, time.Since(start),
+				redactHeader(resp.Header), total, redactBody(head, resp.Header.Get("Content-Type")))
+		},
+	}
+	return resp, nil
+}
+
+// debugBody 保留响应体开头的 apiDebugBodyLimit 字节，关闭时记录
+type debugBody struct {
+	io.ReadCloser
+	head    []byte
+	total   int
+	onClose func(head []byte, total int)
+	closed  bool
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.total += n
+	if room := apiDebugBodyLimit - len(b.head); room > 0 {
+		b.head = append(b.head, p[:min(n, room)]...)
+	}
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	if !b.closed {
+		b.closed = true
+		b.onClose(b.head, b.total)
+	}
+	return b.ReadCloser.Close()
+}
+
+func redactHeader(header http.Header) string {
+	redacted := make([]string, 0, len(header))
+	for name, values := range header {
+		value := strings.Join(values, ",")
+		if sensitiveAPIKeys[strings.ToLower(name)] {
+			value = redactedValue
+		}
+		redacted = append(redacted, name+"="+value)
+	}
+	// 请求头是 map，排序后日志才稳定
+	sort.Strings(redacted)
+	return strings.Join(redacted, " ")
+}
+
+func redactURL(raw string) string {
+	endpoint, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	query := endpoint.Query()
+	for name := range query {
+		if sensitiveAPIKeys[strings.ToLower(name)] {
+			query.Set(name, redactedValue)
+		}
+	}
+	endpoint.RawQuery = query.Encode()
+	return strings.ReplaceAll(endpoint.String(), url.QueryEscape(redactedValue), redactedValue)
+}
+
+// redactBody 隐藏JSON中的凭据并截断，非文本内容只记录长度
+func redactBody(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return "(空)"
+	}
+	if !isTextContent(contentType) {
+		return fmt.Sprintf("(%d 字节 %s)", len(body), contentType)
+	}
+	var value interface{}
+	if json.Unmarshal(body, &value) == nil {
+		if data, err := json.Marshal(redactJSON(value)); err == nil {
+			body = data
+		}
+	}
+	if len(body) > apiDebugBodyLimit {
+		return strings.ToValidUTF8(string(body[:apiDebugBodyLimit]), "") + "...(已截断)"
+	}
+	return strings.ToValidUTF8(string(body), "")
+}
+
+func isTextContent(contentType string) bool {
+	return contentType == "" || strings.Contains(contentType, "json") || strings.HasPrefix(contentType, "text/")
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if sensitiveAPIKeys[strings.ToLower(key)] {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAPIDebuggerRedactsCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":"rate limited"}`)
+	}))
+	defer server.Close()
+
+	var output bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&output)
+	logger.SetLevel(logrus.DebugLevel)
+	debugger := newAPIDebugger(LogConfig{DebugAPI: true}, logger, "Cartesia")
+	if debugger == nil {
+		t.Fatal("debugger should be enabled at debug level")
+	}
+
+	body := `{"model_id":"sonic","transcript":"你好","api_key":"secret-body"}`
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/tts/bytes?api_key=secret-query", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "secret-header")
+	resp, err := debugger.httpClient().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != `{"error":"rate limited"}` {
+		t.Errorf("response body = %q, logging must not consume it", data)
+	}
+
+	logged := output.String()
+	if strings.Contains(logged, "secret") {
+		t.Errorf("credentials leaked into the log:\n%s", logged)
+	}
+	for _, want := range []string{"你好", "api_key=[已隐藏]", "状态 429", "rate limited", "service=Cartesia"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log does not contain %q:\n%s", want, logged)
+		}
+	}
+}
+
+func TestAPIDebuggerRequiresDebugLevel(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.InfoLevel)
+	if newAPIDebugger(LogConfig{DebugAPI: true}, logger, "OpenAI") != nil {
+		t.Error("debug_api should have no effect below debug level")
+	}
+	logger.SetLevel(logrus.DebugLevel)
+	if newAPIDebugger(LogConfig{}, logger, "OpenAI") != nil {
+		t.Error("debugger should be disabled without debug_api")
+	}
+}
+
+func TestRedactBodyTruncates(t *testing.T) {
+	long := `{"text":"` + strings.Repeat("好", apiDebugBodyLimit) + `"}`
+	got := redactBody([]byte(long), "application/json")
+	if !strings.HasSuffix(got, "...(已截断)") || len(got) > apiDebugBodyLimit+len("...(已截断)") {
+		t.Errorf("body was not truncated: %d bytes", len(got))
+	}
+	if got := redactBody(make([]byte, 100), "audio/wav"); got != "(100 字节 audio/wav)" {
+		t.Errorf("binary body = %q", got)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AssemblyAI/assemblyai-go-sdk"
+)
+
+const (
+	// AssemblyAI 对 word_boost 的限制：最多1000项，每项最多6个词
+	maxWordBoost      = 1000
+	maxWordBoostWords = 6
+)
+
+// TranscribeOptions 是批量转录的可选参数，未设置的字段使用AssemblyAI的默认值
+// （加标点、格式化文本，不保留语气词，不过滤脏话）。参与者也可以在元数据中设置，与配置中的选项合并
+type TranscribeOptions struct {
+	Punctuate  *bool `yaml:"punctuate" json:"punctuate"`
+	FormatText *bool `yaml:"format_text" json:"format_text"`
+	// 保留 "嗯"、"um" 等语气词
+	Disfluencies *bool `yaml:"disfluencies" json:"disfluencies"`
+	// 用星号替换脏话
+	FilterProfanity *bool `yaml:"filter_profanity" json:"filter_profanity"`
+	// 提高识别概率的词或短语，用于专业术语、产品名和人名
+	WordBoost []string `yaml:"word_boost" json:"word_boost"`
+	// word_boost 的强度: low、default 或 high
+	BoostParam string `yaml:"boost_param" json:"boost_param"`
+}
+
+func (o TranscribeOptions) validate() error {
+	if len(o.WordBoost) > maxWordBoost {
+		return fmt.Errorf("word_boost 最多 %d 项", maxWordBoost)
+	}
+	for _, phrase := range o.WordBoost {
+		if strings.TrimSpace(phrase) == "" {
+			return fmt.Errorf("word_boost 不能包含空字符串")
+		}
+		if len(strings.Fields(phrase)) > maxWordBoostWords {
+			return fmt.Errorf("word_boost 中的 %q 超过 %d 个词", phrase, maxWordBoostWords)
+		}
+	}
+	switch o.BoostParam {
+	case "", "low", "default", "high":
+		return nil
+	default:
+		return fmt.Errorf("未知的 boost_param %q，可选 low、default 或 high", o.BoostParam)
+	}
+}
+
+// merge 用 override 中设置了的字段覆盖当前选项，word_boost 合并两者并去重
+func (o TranscribeOptions) merge(override TranscribeOptions) TranscribeOptions {
+	if override.Punctuate != nil {
+		o.Punctuate = override.Punctuate
+	}
+	if override.FormatText != nil {
+		o.FormatText = override.FormatText
+	}
+	if override.Disfluencies != nil {
+		o.Disfluencies = override.Disfluencies
+	}
+	if override.FilterProfanity != nil {
+		o.FilterProfanity = override.FilterProfanity
+	}
+	if override.BoostParam != "" {
+		o.BoostParam = override.BoostParam
+	}
+	if len(override.WordBoost) > 0 {
+		seen := make(map[string]bool, len(o.WordBoost)+len(override.WordBoost))
+		var words []string
+		for _, word := range append(append([]string(nil), o.WordBoost...), override.WordBoost...) {
+			if !seen[word] {
+				seen[word] = true
+				words = append(words, word)
+			}
+		}
+		o.WordBoost = words
+	}
+	return o
+}
+
+// apply 把选项写入转录请求的参数
+func (o TranscribeOptions) apply(params *assemblyai.TranscriptOptionalParams) {
+	if o.Punctuate != nil {
+		params.Punctuate = assemblyai.Bool(*o.Punctuate)
+	}
+	if o.FormatText != nil {
+		params.FormatText = assemblyai.Bool(*o.FormatText)
+	}
+	if o.Disfluencies != nil {
+		params.Disfluencies = assemblyai.Bool(*o.Disfluencies)
+	}
+	if o.FilterProfanity != nil {
+		params.FilterProfanity = assemblyai.Bool(*o.FilterProfanity)
+	}
+	if len(o.WordBoost) > 0 {
+		params.WordBoost = append([]string(nil), o.WordBoost...)
+		if o.BoostParam != "" {
+			params.BoostParam = assemblyai.TranscriptBoostParam(o.BoostParam)
+		}
+	}
+}
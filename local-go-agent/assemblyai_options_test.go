@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/AssemblyAI/assemblyai-go-sdk"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"gopkg.in/yaml.v3"
+)
+
+func TestTranscribeOptionsReachRequest(t *testing.T) {
+	var submitted map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v2/upload":
+			fmt.Fprint(w, `{"upload_url":"https://cdn.example/audio"}`)
+		case "/v2/transcript":
+			json.NewDecoder(r.Body).Decode(&submitted)
+			fmt.Fprint(w, `{"id":"t1","status":"completed","text":"LiveKit and Cartesia"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var cfg AssemblyAIConfig
+	if err := yaml.Unmarshal([]byte("word_boost: [LiveKit]\nboost_param: high\nformat_text: false\n"), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	service := &AssemblyAIService{
+		client:       assemblyai.NewClientWithOptions(assemblyai.WithAPIKey("key"), assemblyai.WithBaseURL(server.URL)),
+		languageCode: "en",
+		options:      cfg.TranscribeOptions,
+	}
+
+	disfluencies := true
+	opts := TranscribeOptions{WordBoost: []string{"Cartesia", "LiveKit"}, Disfluencies: &disfluencies}
+	if _, err := service.TranscribeWithOptions(context.Background(), make([]byte, 320), "", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := submitted["word_boost"]; !reflect.DeepEqual(got, []any{"LiveKit", "Cartesia"}) {
+		t.Errorf("word_boost = %v", got)
+	}
+	if submitted["boost_param"] != "high" || submitted["format_text"] != false || submitted["disfluencies"] != true {
+		t.Errorf("request = %v", submitted)
+	}
+	if _, ok := submitted["punctuate"]; ok {
+		t.Errorf("punctuate should use the service default: %v", submitted)
+	}
+}
+
+func TestTranscribeOptionsValidation(t *testing.T) {
+	for _, opts := range []TranscribeOptions{
+		{WordBoost: []string{" "}},
+		{WordBoost: []string{"one two three four five six seven"}},
+		{BoostParam: "extreme"},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("%+v should be rejected", opts)
+		}
+	}
+}
+
+// optionsSTT 记录每次识别带上的转录选项
+type optionsSTT struct {
+	fakeSTT
+	opts []TranscribeOptions
+}
+
+func (s *optionsSTT) TranscribeWithOptions(ctx context.Context, pcm []byte, lang string, opts TranscribeOptions) (Transcript, error) {
+	s.opts = append(s.opts, opts)
+	return s.Transcribe(ctx, pcm, lang)
+}
+
+func TestParticipantTranscribeOptions(t *testing.T) {
+	stt := &optionsSTT{fakeSTT: fakeSTT{result: Transcript{Text: "你好", Confidence: 0.9, Final: true}}}
+	agent, _ := newTestAgent(&AIServices{STT: stt, LLM: &fakeLLM{reply: "好的。"}})
+	settings, err := parseParticipantSettings(`{"transcribe":{"word_boost":["LiveKit"],"boost_param":"high"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.settings[""] = settings
+
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: make([]int16, sttSampleRate/10)}, &lksdk.RemoteParticipant{})
+	want := []TranscribeOptions{{WordBoost: []string{"LiveKit"}, BoostParam: "high"}}
+	if !reflect.DeepEqual(stt.opts, want) {
+		t.Errorf("transcribed with %+v, want %+v", stt.opts, want)
+	}
+
+	if _, err := parseParticipantSettings(`{"transcribe":{"boost_param":"extreme"}}`); err == nil {
+		t.Error("invalid transcribe options in metadata were accepted")
+	}
+}
@@ -1,15 +1,101 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/AssemblyAI/assemblyai-go-sdk"
 )
 
 type AssemblyAIService struct {
-	client *assemblyai.Client
+	client       *assemblyai.Client
+	apiKey       string
+	languageCode string
+	// 开启后未指定语言的请求由AssemblyAI自动检测语言
+	languageDetection bool
+	// 检测置信度低于该值时回退到默认语言
+	languageConfidenceThreshold float64
+	// 开启说话人分离，适用于只有一条混音轨道的场景，会增加延迟和费用
+	speakerLabels    bool
+	speakersExpected int
+	// 批量转录的默认选项，单次请求可以通过 TranscribeWithOptions 覆盖
+	options TranscribeOptions
+	// 上传、提交和查询遇到网络抖动时的重试次数
+	retries int
+	// 转录任务状态变化时调用，为空时不通知
+	onProgress func(TranscriptionProgress)
+
+	// 识别接口，见 assemblyAIEndpointBatch 和 assemblyAIEndpointStreaming
+	endpoint     string
+	streamingURL string
+	// 流式识别的轮次检测参数，0 表示使用服务端默认值
+	endOfTurnConfidence float64
+	maxTurnSilence      time.Duration
+
+	// 记录请求和响应，未开启调试时为 nil
+	debug *apiDebugger
+}
+
+// TranscriptionStatus 是一次转录的进度，queued、processing、completed 和 error 对应AssemblyAI异步任务的状态
+type TranscriptionStatus string
+
+const (
+	TranscriptionUploading  TranscriptionStatus = "uploading"
+	TranscriptionQueued     TranscriptionStatus = "queued"
+	TranscriptionProcessing TranscriptionStatus = "processing"
+	TranscriptionCompleted  TranscriptionStatus = "completed"
+	TranscriptionError      TranscriptionStatus = "error"
+)
+
+// TranscriptionProgress 是转录任务的一次状态变化，上传阶段还没有任务ID
+type TranscriptionProgress struct {
+	TranscriptID string
+	Status       TranscriptionStatus
+}
+
+const (
+	// 上传时每次写出的数据量，请求体以分块传输编码流式发送
+	uploadChunkSize = 256 * 1024
+	// 单次上传的超时时间为基础时间加上按最低速率估算的传输时间，连接停滞时尽快重试
+	uploadBaseTimeout = 30 * time.Second
+	uploadMinRate     = 64 * 1024
+	// 查询转录状态的间隔，逐渐增加到上限
+	initialPollInterval = 250 * time.Millisecond
+	maxPollInterval     = 3 * time.Second
+)
+
+type Transcript struct {
+	Text string
+	// 转录整体置信度 (0-1)，AssemblyAI未返回时为0
+	Confidence float64
+	// 本次转录实际使用的语言（自动检测的结果或指定的语言）
+	Language string
+	// 自动检测语言的置信度，未开启检测时为0
+	LanguageConfidence float64
+	// 语言来自置信度足够的自动检测结果，而不是指定语言或回退的默认语言
+	LanguageDetected bool
+	// 流式识别中是否为最终结果，批量识别的结果总是最终结果
+	Final bool
+	// 按开始时间排序的逐词时间戳，服务未返回时为空
+	Words []Word
+	// 开启说话人分离时按时间顺序排列的各说话人片段，未开启时为空
+	Speakers []SpeakerTurn
+}
+
+// Word 是转录结果中的一个词及其在音频中的起止时间，用于生成与音频同步的字幕
+type Word struct {
+	Text       string
+	StartMs    int64
+	EndMs      int64
+	Confidence float64
+	// 开启说话人分离时的说话人标签
+	Speaker string
 }
 
 func NewAssemblyAIService(apiKey string) (*AssemblyAIService, error) {
@@ -18,30 +104,340 @@ func NewAssemblyAIService(apiKey string) (*AssemblyAIService, error) {
 	}
 
 	client := assemblyai.NewClient(apiKey)
-	return &AssemblyAIService{client: client}, nil
+	return &AssemblyAIService{
+		client:       client,
+		apiKey:       apiKey,
+		languageCode: "zh",
+		retries:      defaultMaxRetries,
+		endpoint:     assemblyAIEndpointBatch,
+		streamingURL: defaultAssemblyAIStreamingURL,
+	}, nil
+}
+
+// setDebugger 开启请求和响应的调试日志，debugger 为 nil 时不做改变
+func (s *AssemblyAIService) setDebugger(debugger *apiDebugger) {
+	if debugger == nil {
+		return
+	}
+	s.debug = debugger
+	s.client = assemblyai.NewClientWithOptions(assemblyai.WithAPIKey(s.apiKey), assemblyai.WithHTTPClient(debugger.httpClient()))
+}
+
+func NewAssemblyAIServiceFromConfig(cfg AssemblyAIConfig) (*AssemblyAIService, error) {
+	service, err := NewAssemblyAIService(cfg.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.LanguageCode != "" {
+		service.languageCode = cfg.LanguageCode
+	}
+	service.languageDetection = cfg.LanguageDetection
+	service.languageConfidenceThreshold = cfg.LanguageConfidenceThreshold
+	service.speakerLabels = cfg.SpeakerLabels
+	service.speakersExpected = cfg.SpeakersExpected
+	service.options = cfg.TranscribeOptions
+	service.retries = max(cfg.Retries, 0)
+	if cfg.Endpoint != "" {
+		service.endpoint = cfg.Endpoint
+	}
+	if cfg.StreamingURL != "" {
+		service.streamingURL = cfg.StreamingURL
+	}
+	service.endOfTurnConfidence = cfg.EndOfTurnConfidence
+	service.maxTurnSilence = cfg.MaxTurnSilence
+	return service, nil
+}
+
+// SetProgressHandler 设置转录进度的回调，会在转录所在的协程中同步调用
+func (s *AssemblyAIService) SetProgressHandler(handler func(TranscriptionProgress)) {
+	s.onProgress = handler
+}
+
+func (s *AssemblyAIService) reportProgress(id string, status TranscriptionStatus) {
+	if s.onProgress != nil {
+		s.onProgress(TranscriptionProgress{TranscriptID: id, Status: status})
+	}
+}
+
+func (s *AssemblyAIService) DetectsLanguage() bool {
+	return s.languageDetection
+}
+
+func (s *AssemblyAIService) DefaultLanguage() string {
+	return s.languageCode
+}
+
+// Preflight 查询最近的一条转录，检查API密钥和网络是否可用，不产生转录费用
+func (s *AssemblyAIService) Preflight(ctx context.Context) error {
+	if _, err := s.client.Transcripts.List(ctx, assemblyai.ListTranscriptParams{Limit: assemblyai.Int64(1)}); err != nil {
+		return assemblyAIError(fmt.Errorf("查询转录列表失败: %w", err))
+	}
+	return nil
 }
 
 func (s *AssemblyAIService) TranscribeAudio(audioURL string) (string, error) {
-	transcript, err := s.client.Transcripts.TranscribeFromURL(context.Background(), audioURL, &assemblyai.TranscriptOptionalParams{
-		LanguageCode: assemblyai.TranscriptLanguageCode("zh"),
+	ctx := context.Background()
+	var transcript assemblyai.Transcript
+	err := retryTransient(ctx, s.retries, isTransientAssemblyAIError, func() error {
+		var err error
+		transcript, err = s.client.Transcripts.SubmitFromURL(ctx, audioURL, s.params(s.languageCode))
+		return err
 	})
 	if err != nil {
-		return "", fmt.Errorf("转录失败: %v", err)
+		return "", fmt.Errorf("提交转录失败: %w", assemblyAIError(err))
 	}
 
-	return *transcript.Text, nil
+	transcript, err = s.wait(ctx, transcript)
+	if err != nil {
+		return "", fmt.Errorf("转录失败: %w", assemblyAIError(err))
+	}
+	return assemblyai.ToString(transcript.Text), nil
 }
 
 func (s *AssemblyAIService) TranscribeAudioBytes(audioData []byte) (string, error) {
-	reader := bytes.NewReader(audioData)
-	params := &assemblyai.TranscriptOptionalParams{
-		LanguageCode: assemblyai.TranscriptLanguageCode("zh"),
+	result, err := s.transcribeFile(context.Background(), audioData, s.languageCode)
+	if err != nil {
+		return "", err
 	}
+	return result.Text, nil
+}
 
-	transcript, err := s.client.Transcripts.TranscribeFromReader(context.Background(), reader, params)
+// TranscribeWithWords 转录完整的音频文件，结果中包含逐词时间戳
+func (s *AssemblyAIService) TranscribeWithWords(ctx context.Context, audioData []byte) (Transcript, error) {
+	return s.transcribeFile(ctx, audioData, s.languageCode)
+}
+
+// Transcribe 实现 SpeechToText，将PCM封装为WAV后上传转录
+func (s *AssemblyAIService) Transcribe(ctx context.Context, pcm []byte, language string) (Transcript, error) {
+	return s.transcribeFile(ctx, encodeWAV(bytesToInt16(pcm), sttSampleRate), language)
+}
+
+// TranscribeWithOptions 按本次请求的选项转录PCM。opts 中设置了的字段覆盖配置中的默认选项，
+// word_boost 与配置中的合并，例如按会议主题追加专业术语
+func (s *AssemblyAIService) TranscribeWithOptions(ctx context.Context, pcm []byte, language string, opts TranscribeOptions) (Transcript, error) {
+	if err := opts.validate(); err != nil {
+		return Transcript{}, err
+	}
+	params := s.paramsWith(language, s.options.merge(opts))
+	return s.submitFile(ctx, encodeWAV(bytesToInt16(pcm), sttSampleRate), params, language)
+}
+
+// TranscribeAccurate 实现 accurateTranscriber，使用最准确的识别模型并格式化文本，比 Transcribe 慢
+func (s *AssemblyAIService) TranscribeAccurate(ctx context.Context, pcm []byte, language string) (Transcript, error) {
+	params := s.params(language)
+	params.SpeechModel = assemblyai.SpeechModelBest
+	params.Punctuate = assemblyai.Bool(true)
+	params.FormatText = assemblyai.Bool(true)
+	return s.submitFile(ctx, encodeWAV(bytesToInt16(pcm), sttSampleRate), params, language)
+}
+
+// transcribeFile 转录完整的音频文件内容。language 为空且开启了自动检测时由AssemblyAI检测语言，
+// 检测置信度不足时回退到默认语言。上传、提交和查询状态各自在网络抖动时重试
+func (s *AssemblyAIService) transcribeFile(ctx context.Context, audioData []byte, language string) (Transcript, error) {
+	return s.submitFile(ctx, audioData, s.params(language), language)
+}
+
+func (s *AssemblyAIService) submitFile(ctx context.Context, audioData []byte, params *assemblyai.TranscriptOptionalParams, language string) (Transcript, error) {
+	uploadURL, err := s.upload(ctx, audioData)
 	if err != nil {
-		return "", fmt.Errorf("转录失败: %v", err)
+		return Transcript{}, fmt.Errorf("上传音频失败: %w", assemblyAIError(err))
 	}
 
-	return *transcript.Text, nil
+	var transcript assemblyai.Transcript
+	err = retryTransient(ctx, s.retries, isTransientAssemblyAIError, func() error {
+		transcript, err = s.client.Transcripts.SubmitFromURL(ctx, uploadURL, params)
+		return err
+	})
+	if err != nil {
+		return Transcript{}, fmt.Errorf("提交转录失败: %w", assemblyAIError(err))
+	}
+
+	transcript, err = s.wait(ctx, transcript)
+	if err != nil {
+		return Transcript{}, fmt.Errorf("转录失败: %w", assemblyAIError(err))
+	}
+	return s.transcriptResult(transcript, language), nil
+}
+
+// upload 上传音频并返回只能由AssemblyAI访问的地址。上传接口不支持断点续传，失败后整个文件重新上传，
+// 每次上传都有按文件大小估算的超时，连接停滞时不会一直等待
+func (s *AssemblyAIService) upload(ctx context.Context, audioData []byte) (string, error) {
+	s.reportProgress("", TranscriptionUploading)
+
+	timeout := uploadBaseTimeout + time.Duration(len(audioData)/uploadMinRate)*time.Second
+	var uploadURL string
+	err := retryTransient(ctx, s.retries, isTransientAssemblyAIError, func() error {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		var err error
+		uploadURL, err = s.client.Upload(attemptCtx, &chunkedReader{data: audioData, chunkSize: uploadChunkSize})
+		return err
+	})
+	return uploadURL, err
+}
+
+// wait 轮询转录任务直到完成或失败，状态变化时通知进度
+func (s *AssemblyAIService) wait(ctx context.Context, transcript assemblyai.Transcript) (assemblyai.Transcript, error) {
+	id := assemblyai.ToString(transcript.ID)
+	status := transcript.Status
+	s.reportProgress(id, TranscriptionStatus(status))
+
+	interval := initialPollInterval
+	for status != assemblyai.TranscriptStatusCompleted && status != assemblyai.TranscriptStatusError {
+		select {
+		case <-ctx.Done():
+			return assemblyai.Transcript{}, ctx.Err()
+		case <-time.After(interval):
+		}
+		interval = min(interval*2, maxPollInterval)
+
+		err := retryTransient(ctx, s.retries, isTransientAssemblyAIError, func() error {
+			var err error
+			transcript, err = s.client.Transcripts.Get(ctx, id)
+			return err
+		})
+		if err != nil {
+			return assemblyai.Transcript{}, err
+		}
+		if transcript.Status != status {
+			status = transcript.Status
+			s.reportProgress(id, TranscriptionStatus(status))
+		}
+	}
+
+	if status == assemblyai.TranscriptStatusError {
+		message := assemblyai.ToString(transcript.Error)
+		if message == "" {
+			message = "未返回错误信息"
+		}
+		return assemblyai.Transcript{}, fmt.Errorf("转录任务 %s 出错: %s", id, message)
+	}
+	return transcript, nil
+}
+
+// isTransientAssemblyAIError 判断是否值得重试：网络错误、限流和服务端错误
+func isTransientAssemblyAIError(err error) bool {
+	var apiErr assemblyai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= http.StatusInternalServerError
+	}
+	return isTransientNetworkError(err)
+}
+
+// chunkedReader 每次最多读出 chunkSize 字节。它不是 *bytes.Reader，HTTP客户端不会预先设置长度，
+// 而是以分块传输编码边读边发送
+type chunkedReader struct {
+	data      []byte
+	chunkSize int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p[:min(len(p), r.chunkSize)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// transcriptResult 将AssemblyAI的转录结果转换为 Transcript
+func (s *AssemblyAIService) transcriptResult(transcript assemblyai.Transcript, language string) Transcript {
+	result := Transcript{
+		Text:     assemblyai.ToString(transcript.Text),
+		Language: language,
+		Final:    true,
+		Words:    transcriptWords(transcript.Words),
+		Speakers: speakerTurns(transcript.Utterances),
+	}
+	if transcript.Confidence != nil {
+		result.Confidence = *transcript.Confidence
+	}
+	if language == "" {
+		result.Language, result.LanguageDetected = s.resolveDetectedLanguage(transcript)
+		if transcript.LanguageConfidence != nil {
+			result.LanguageConfidence = *transcript.LanguageConfidence
+		}
+	}
+	return result
+}
+
+// transcriptWords 转换逐词时间戳并按开始时间排序
+func transcriptWords(words []assemblyai.TranscriptWord) []Word {
+	if len(words) == 0 {
+		return nil
+	}
+	result := make([]Word, 0, len(words))
+	for _, word := range words {
+		result = append(result, Word{
+			Text:       assemblyai.ToString(word.Text),
+			StartMs:    assemblyai.ToInt64(word.Start),
+			EndMs:      assemblyai.ToInt64(word.End),
+			Confidence: assemblyai.ToFloat64(word.Confidence),
+			Speaker:    assemblyai.ToString(word.Speaker),
+		})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].StartMs < result[j].StartMs
+	})
+	return result
+}
+
+func (s *AssemblyAIService) params(language string) *assemblyai.TranscriptOptionalParams {
+	return s.paramsWith(language, s.options)
+}
+
+// paramsWith 与 params 相同，转录选项使用 options 代替配置中的选项
+func (s *AssemblyAIService) paramsWith(language string, options TranscribeOptions) *assemblyai.TranscriptOptionalParams {
+	params := &assemblyai.TranscriptOptionalParams{}
+	if language == "" && s.languageDetection {
+		// 置信度阈值在本地判断，交给AssemblyAI判断会导致低置信度的转录直接失败
+		params.LanguageDetection = assemblyai.Bool(true)
+	} else {
+		if language == "" {
+			language = s.languageCode
+		}
+		params.LanguageCode = assemblyai.TranscriptLanguageCode(language)
+	}
+
+	if s.speakerLabels {
+		params.SpeakerLabels = assemblyai.Bool(true)
+		if s.speakersExpected > 0 {
+			params.SpeakersExpected = assemblyai.Int64(int64(s.speakersExpected))
+		}
+	}
+	options.apply(params)
+	return params
+}
+
+// resolveDetectedLanguage 读取自动检测的语言，结果缺失或置信度不足时回退到默认语言
+func (s *AssemblyAIService) resolveDetectedLanguage(transcript assemblyai.Transcript) (string, bool) {
+	if !s.languageDetection || transcript.LanguageCode == "" {
+		return s.languageCode, false
+	}
+	if transcript.LanguageConfidence != nil && *transcript.LanguageConfidence < s.languageConfidenceThreshold {
+		return s.languageCode, false
+	}
+	return string(transcript.LanguageCode), true
+}
+
+// speakerTurns 转换说话人分离的结果，未开启说话人分离时返回 nil
+func speakerTurns(utterances []assemblyai.TranscriptUtterance) []SpeakerTurn {
+	var turns []SpeakerTurn
+	for _, utterance := range utterances {
+		text := strings.TrimSpace(assemblyai.ToString(utterance.Text))
+		if text == "" {
+			continue
+		}
+		turns = append(turns, SpeakerTurn{
+			Speaker: assemblyai.ToString(utterance.Speaker),
+			Text:    text,
+			StartMs: assemblyai.ToInt64(utterance.Start),
+			EndMs:   assemblyai.ToInt64(utterance.End),
+		})
+	}
+	sort.SliceStable(turns, func(i, j int) bool {
+		return turns[i].StartMs < turns[j].StartMs
+	})
+	return turns
 }
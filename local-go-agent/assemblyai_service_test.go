@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AssemblyAI/assemblyai-go-sdk"
+)
+
+func TestTranscriptResultWords(t *testing.T) {
+	service := &AssemblyAIService{languageCode: "en"}
+
+	// AssemblyAI 返回的顺序不作保证，结果按开始时间排序
+	transcript := assemblyai.Transcript{
+		Text: assemblyai.String("hello big world"),
+		Words: []assemblyai.TranscriptWord{
+			{Text: assemblyai.String("world"), Start: assemblyai.Int64(900), End: assemblyai.Int64(1300), Confidence: assemblyai.Float64(0.8)},
+			{Text: assemblyai.String("hello"), Start: assemblyai.Int64(100), End: assemblyai.Int64(450), Confidence: assemblyai.Float64(0.95)},
+			{Text: assemblyai.String("big"), Start: assemblyai.Int64(500), End: assemblyai.Int64(800), Confidence: assemblyai.Float64(0.9)},
+		},
+	}
+
+	result := service.transcriptResult(transcript, "en")
+	want := []Word{
+		{Text: "hello", StartMs: 100, EndMs: 450, Confidence: 0.95},
+		{Text: "big", StartMs: 500, EndMs: 800, Confidence: 0.9},
+		{Text: "world", StartMs: 900, EndMs: 1300, Confidence: 0.8},
+	}
+	if len(result.Words) != len(want) {
+		t.Fatalf("got %d words, want %d", len(result.Words), len(want))
+	}
+	for i, word := range result.Words {
+		if word != want[i] {
+			t.Errorf("word %d = %+v, want %+v", i, word, want[i])
+		}
+		if word.EndMs < word.StartMs {
+			t.Errorf("word %d ends before it starts: %+v", i, word)
+		}
+	}
+}
+
+func TestTranscriptResultWithoutWords(t *testing.T) {
+	service := &AssemblyAIService{languageCode: "en"}
+
+	result := service.transcriptResult(assemblyai.Transcript{Text: assemblyai.String("hi")}, "en")
+	if result.Text != "hi" || result.Words != nil {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestTranscribeRetriesFlakyUpload(t *testing.T) {
+	var uploads, polls atomic.Int32
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v2/upload":
+			// 第一次上传时断开连接，模拟网络抖动
+			if uploads.Add(1) == 1 {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			uploaded, _ = io.ReadAll(r.Body)
+			fmt.Fprint(w, `{"upload_url":"https://cdn.example/audio"}`)
+		case r.URL.Path == "/v2/transcript" && r.Method == http.MethodPost:
+			fmt.Fprint(w, `{"id":"t1","status":"queued"}`)
+		case r.URL.Path == "/v2/transcript/t1":
+			switch polls.Add(1) {
+			case 1:
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, `{"error":"unavailable"}`)
+			case 2:
+				fmt.Fprint(w, `{"id":"t1","status":"processing"}`)
+			default:
+				fmt.Fprint(w, `{"id":"t1","status":"completed","text":"hello"}`)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	service := &AssemblyAIService{
+		client:       assemblyai.NewClientWithOptions(assemblyai.WithAPIKey("key"), assemblyai.WithBaseURL(server.URL)),
+		languageCode: "en",
+		retries:      2,
+	}
+	var statuses []TranscriptionStatus
+	service.SetProgressHandler(func(progress TranscriptionProgress) {
+		statuses = append(statuses, progress.Status)
+	})
+
+	audio := bytes.Repeat([]byte{1, 2, 3, 4}, uploadChunkSize)
+	text, err := service.TranscribeAudioBytes(audio)
+	if err != nil {
+		t.Fatalf("transcribe failed: %v", err)
+	}
+	if text != "hello" {
+		t.Errorf("text = %q, want hello", text)
+	}
+	if !bytes.Equal(uploaded, audio) {
+		t.Errorf("uploaded %d bytes, want %d", len(uploaded), len(audio))
+	}
+
+	want := []TranscriptionStatus{TranscriptionUploading, TranscriptionQueued, TranscriptionProcessing, TranscriptionCompleted}
+	if fmt.Sprint(statuses) != fmt.Sprint(want) {
+		t.Errorf("progress = %v, want %v", statuses, want)
+	}
+}
+
+func TestTranscribeDoesNotRetryClientErrors(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"invalid api key"}`)
+	}))
+	defer server.Close()
+
+	service := &AssemblyAIService{
+		client:  assemblyai.NewClientWithOptions(assemblyai.WithAPIKey("bad"), assemblyai.WithBaseURL(server.URL)),
+		retries: 3,
+	}
+	if _, err := service.TranscribeAudioBytes([]byte{1, 2}); err == nil {
+		t.Fatal("expected an error for an invalid api key")
+	}
+	if n := uploads.Load(); n != 1 {
+		t.Errorf("uploaded %d times, want 1", n)
+	}
+}
+
+// 空白或识别失败的音频返回的转录结果可能没有 text 字段
+func TestTranscribeHandlesMissingTextAndErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v2/upload":
+			fmt.Fprint(w, `{"upload_url":"https://cdn.example/audio"}`)
+		case "/v2/transcript":
+			var body struct {
+				AudioURL string `json:"audio_url"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.AudioURL == "https://cdn.example/broken" {
+				fmt.Fprint(w, `{"id":"t2","status":"error","error":"audio file is corrupt"}`)
+				return
+			}
+			fmt.Fprint(w, `{"id":"t1","status":"completed","text":null}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	service := &AssemblyAIService{
+		client: assemblyai.NewClientWithOptions(assemblyai.WithAPIKey("key"), assemblyai.WithBaseURL(server.URL)),
+	}
+	text, err := service.TranscribeAudioBytes([]byte{1, 2})
+	if err != nil || text != "" {
+		t.Errorf("transcript without text = %q, %v, want empty", text, err)
+	}
+
+	_, err = service.TranscribeAudio("https://cdn.example/broken")
+	if err == nil || !strings.Contains(err.Error(), "audio file is corrupt") {
+		t.Errorf("err = %v, want the transcript error message", err)
+	}
+}
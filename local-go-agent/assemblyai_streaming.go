@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// AssemblyAI 识别接口：batch 上传整段发言后异步转录，streaming 使用 Universal Streaming 实时识别，
+// 由服务端判断一轮发言何时结束
+const (
+	assemblyAIEndpointBatch     = "batch"
+	assemblyAIEndpointStreaming = "streaming"
+)
+
+const (
+	defaultAssemblyAIStreamingURL = "wss://streaming.assemblyai.com/v3/ws"
+	// 每条音频消息必须在50ms到1000ms之间，20ms的音频帧凑够50ms再发送
+	assemblyAIMinChunkBytes = sttSampleRate * 2 / 20
+	// 断线重连后补发音频时每条消息的大小
+	assemblyAIReplayChunkBytes = sttSampleRate * 2 / 2
+	// 断线重连后最多补发的音频时长
+	assemblyAIMaxReplay = 30 * time.Second
+	// 等待读取的识别结果数量，读取跟不上时丢弃中间结果，最终结果会等待
+	assemblyAIStreamResults = 64
+)
+
+var errTranscriptStreamClosed = errors.New("流式识别会话已关闭")
+
+// assemblyAIStreamMessage 是 Universal Streaming 返回的消息，Begin 表示会话开始，
+// Turn 是一轮发言的识别结果，Termination 表示会话结束
+type assemblyAIStreamMessage struct {
+	Type                string  `json:"type"`
+	Transcript          string  `json:"transcript"`
+	EndOfTurn           bool    `json:"end_of_turn"`
+	TurnIsFormatted     bool    `json:"turn_is_formatted"`
+	LanguageCode        string  `json:"language_code"`
+	LanguageConfidence  float64 `json:"language_confidence"`
+	EndOfTurnConfidence float64 `json:"end_of_turn_confidence"`
+	Words               []struct {
+		Text       string  `json:"text"`
+		Start      int64   `json:"start"`
+		End        int64   `json:"end"`
+		Confidence float64 `json:"confidence"`
+	} `json:"words"`
+	Error string `json:"error"`
+}
+
+// DetectsTurns 返回是否由识别服务判断发言何时结束，此时不需要本地切分发言
+func (s *AssemblyAIService) DetectsTurns() bool {
+	return s.endpoint == assemblyAIEndpointStreaming
+}
+
+// StartStream 实现 StreamingSpeechToText，打开一次 Universal Streaming 会话。
+// 中间结果的 Final 为 false，一轮发言结束时给出格式化后的最终结果。
+// 连接在后台建立，不阻塞调用方，连接建立前写入的音频在连接后补发；连接失败后 Write 返回错误。
+// 连接意外断开时自动重连，并补发最终结果尚未覆盖的音频，进行中的发言不会丢失
+func (s *AssemblyAIService) StartStream(ctx context.Context, lang string) (TranscriptStream, error) {
+	if _, err := s.streamingEndpoint(lang); err != nil {
+		return nil, err
+	}
+	stream := &assemblyAIStream{
+		service:  s,
+		language: lang,
+		results:  make(chan Transcript, assemblyAIStreamResults),
+		closed:   make(chan struct{}),
+	}
+	stop := context.AfterFunc(ctx, func() { stream.Close() })
+	started := goTracked(ctx, func() {
+		defer stop()
+		stream.receive(ctx)
+	})
+	if !started {
+		stop()
+		return nil, errSupervisorClosed
+	}
+	return stream, nil
+}
+
+func (s *AssemblyAIService) streamingEndpoint(lang string) (string, error) {
+	endpoint, err := url.Parse(s.streamingURL)
+	if err != nil {
+		return "", fmt.Errorf("AssemblyAI流式识别地址错误: %v", err)
+	}
+	query := endpoint.Query()
+	query.Set("sample_rate", strconv.Itoa(sttSampleRate))
+	query.Set("encoding", "pcm_s16le")
+	query.Set("format_turns", "true")
+	if s.endOfTurnConfidence > 0 {
+		query.Set("end_of_turn_confidence_threshold", strconv.FormatFloat(s.endOfTurnConfidence, 'f', -1, 64))
+	}
+	if s.maxTurnSilence > 0 {
+		query.Set("max_turn_silence", strconv.FormatInt(s.maxTurnSilence.Milliseconds(), 10))
+	}
+	if lang == "" && s.languageDetection {
+		query.Set("language_detection", "true")
+	}
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// assemblyAIStream 是一次 Universal Streaming 会话，实现 TranscriptStream
+type assemblyAIStream struct {
+	service  *AssemblyAIService
+	language string
+	results  chan Transcript
+
+	mu sync.Mutex
+	// 连接建立前和重连期间为 nil，写入的音频只保存在 replay 中
+	conn *websocket.Conn
+	// 还不够一条消息的音频
+	chunk []byte
+	// 最终结果尚未覆盖的音频，重连后补发
+	replay []byte
+	// 会话开始以来写入 replay 的字节数，以及当前连接的第一个字节在其中的位置。
+	// 识别结果的时间戳相对连接开始，据此换算出最终结果覆盖到哪里
+	remembered  int64
+	connectedAt int64
+	// 重连失败等无法恢复的错误
+	err error
+
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (s *assemblyAIStream) dial(ctx context.Context) (*websocket.Conn, error) {
+	endpoint, err := s.service.streamingEndpoint(s.language)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Authorization", s.service.apiKey)
+	s.service.debug.logDial(endpoint)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		if resp != nil {
+			return nil, classifyServiceError("AssemblyAI", resp.StatusCode, fmt.Errorf("连接AssemblyAI流式识别失败，状态 %d: %w", resp.StatusCode, err))
+		}
+		return nil, classifyServiceError("AssemblyAI", 0, fmt.Errorf("连接AssemblyAI流式识别失败: %w", err))
+	}
+	return conn, nil
+}
+
+// Write 发送一段PCM，凑够50ms才实际发送。连接断开重连期间只缓存音频，不返回错误
+func (s *assemblyAIStream) Write(pcm []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	select {
+	case <-s.closed:
+		return errTranscriptStreamClosed
+	default:
+	}
+
+	s.chunk = append(s.chunk, pcm...)
+	if len(s.chunk) < assemblyAIMinChunkBytes {
+		return nil
+	}
+	data := s.chunk
+	s.chunk = nil
+	s.remember(data)
+	if s.conn != nil {
+		// 发送失败说明连接已断开，接收协程会发现并重连，之后补发这段音频
+		s.conn.WriteMessage(websocket.BinaryMessage, data)
+	}
+	return nil
+}
+
+// remember 记录已发送的音频，只保留最近 assemblyAIMaxReplay，调用方需持有 mu
+func (s *assemblyAIStream) remember(data []byte) {
+	s.replay = append(s.replay, data...)
+	s.remembered += int64(len(data))
+	limit := int(assemblyAIMaxReplay*sttSampleRate/time.Second) * 2
+	if overflow := len(s.replay) - limit; overflow > 0 {
+		s.replay = append([]byte(nil), s.replay[overflow:]...)
+	}
+}
+
+func (s *assemblyAIStream) Results() <-chan Transcript {
+	return s.results
+}
+
+// Close 通知服务端结束会话并关闭连接
+func (s *assemblyAIStream) Close() error {
+	var err error
+	s.once.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		close(s.closed)
+		if s.conn != nil {
+			s.conn.WriteJSON(map[string]string{"type": "Terminate"})
+			err = s.conn.Close()
+		}
+	})
+	return err
+}
+
+func (s *assemblyAIStream) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// receive 建立连接并读取识别结果，连接意外断开时重连，直到会话关闭或无法恢复
+func (s *assemblyAIStream) receive(ctx context.Context) {
+	defer close(s.results)
+
+	if err := s.connect(ctx); err != nil {
+		s.fail(err)
+		return
+	}
+	for {
+		s.mu.Lock()
+		conn := s.conn
+		s.mu.Unlock()
+		if conn == nil {
+			// 连接建立之前会话已经关闭
+			return
+		}
+
+		err := s.read(conn)
+		if s.isClosed() || ctx.Err() != nil {
+			return
+		}
+		if !isTransientStreamError(err) {
+			s.fail(fmt.Errorf("AssemblyAI流式识别失败: %w", err))
+			return
+		}
+		if err := s.reconnect(ctx, err); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// read 读取一条连接上的消息直到出错
+func (s *assemblyAIStream) read(conn *websocket.Conn) error {
+	for {
+		var message assemblyAIStreamMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			return err
+		}
+		switch message.Type {
+		case "Turn":
+			// 开启格式化后一轮结束时先收到未格式化的结果，只使用随后的格式化结果
+			if message.EndOfTurn && !message.TurnIsFormatted {
+				continue
+			}
+			s.emit(message)
+		case "Termination":
+			// 会话达到时长上限等原因被服务端结束，重新打开会话继续识别
+			return errAssemblyAISessionTerminated
+		case "Error":
+			return fmt.Errorf("%s", message.Error)
+		}
+	}
+}
+
+var errAssemblyAISessionTerminated = errors.New("服务端结束了会话")
+
+func (s *assemblyAIStream) emit(message assemblyAIStreamMessage) {
+	transcript := Transcript{
+		Text:               message.Transcript,
+		Final:              message.EndOfTurn,
+		Language:           s.language,
+		LanguageConfidence: message.LanguageConfidence,
+	}
+	if message.LanguageCode != "" {
+		transcript.Language = message.LanguageCode
+		transcript.LanguageDetected = message.LanguageConfidence >= s.service.languageConfidenceThreshold
+	}
+	if transcript.Language == "" {
+		transcript.Language = s.service.languageCode
+	}
+	var total float64
+	for _, word := range message.Words {
+		transcript.Words = append(transcript.Words, Word{Text: word.Text, StartMs: word.Start, EndMs: word.End, Confidence: word.Confidence})
+		total += word.Confidence
+	}
+	if len(message.Words) > 0 {
+		transcript.Confidence = total / float64(len(message.Words))
+	}
+
+	if !transcript.Final {
+		// 中间结果只用于实时显示，读取跟不上时丢弃
+		select {
+		case s.results <- transcript:
+		default:
+		}
+		return
+	}
+
+	// 这一轮已经识别完成，重连后只补发最后一个词之后的音频
+	if n := len(message.Words); n > 0 {
+		s.mu.Lock()
+		s.forget(message.Words[n-1].End)
+		s.mu.Unlock()
+	}
+	select {
+	case s.results <- transcript:
+	case <-s.closed:
+	}
+}
+
+// forget 从 replay 中去掉最终结果已覆盖的音频，endMs 是最后一个词相对当前连接开始的结束时间，
+// 调用方需持有 mu
+func (s *assemblyAIStream) forget(endMs int64) {
+	covered := s.connectedAt + endMs*sttSampleRate/1000*2
+	start := s.remembered - int64(len(s.replay))
+	drop := min(max(covered-start, 0), int64(len(s.replay)))
+	s.replay = append([]byte(nil), s.replay[drop:]...)
+}
+
+// connect 建立连接并补发缓存的音频
+func (s *assemblyAIStream) connect(ctx context.Context) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isClosed() {
+		conn.Close()
+		return nil
+	}
+	if err := s.resend(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// reconnect 重新建立连接并补发最终结果尚未覆盖的音频
+func (s *assemblyAIStream) reconnect(ctx context.Context, cause error) error {
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.mu.Unlock()
+
+	err := retryTransient(ctx, s.service.retries, isTransientDialError, func() error {
+		return s.connect(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("AssemblyAI流式识别断开后重连失败 (%v): %w", cause, err)
+	}
+	return nil
+}
+
+// resend 在新连接上补发缓存的音频，不足一条消息的尾部并入待发送的音频，调用方需持有 mu
+func (s *assemblyAIStream) resend(conn *websocket.Conn) error {
+	replay := s.replay
+	s.connectedAt = s.remembered - int64(len(replay))
+	if len(replay) < assemblyAIMinChunkBytes {
+		// 这部分音频发送时会重新记入 replay
+		s.chunk = append(replay, s.chunk...)
+		s.replay = nil
+		s.remembered = s.connectedAt
+		return nil
+	}
+	for start := 0; start < len(replay); start += assemblyAIReplayChunkBytes {
+		end := min(start+assemblyAIReplayChunkBytes, len(replay))
+		// 最后一段太短时并入前一段
+		if len(replay)-end < assemblyAIMinChunkBytes {
+			end = len(replay)
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, replay[start:end]); err != nil {
+			return err
+		}
+		if end == len(replay) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *assemblyAIStream) fail(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	s.Close()
+}
+
+// isTransientStreamError 判断连接断开是否值得重连：认证失败、参数错误等服务端主动拒绝的关闭不重连
+func isTransientStreamError(err error) bool {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code != websocket.ClosePolicyViolation && closeErr.Code != websocket.CloseUnsupportedData && closeErr.Code < 4000
+	}
+	return true
+}
+
+// isTransientDialError 判断重连失败是否值得重试：限流、服务端错误和网络抖动
+func isTransientDialError(err error) bool {
+	var rateLimited *ErrRateLimited
+	var unavailable *ErrProviderUnavailable
+	var timeout *ErrTimeout
+	return errors.As(err, &rateLimited) || errors.As(err, &unavailable) || errors.As(err, &timeout) || isTransientNetworkError(err)
+}
+
+func (c AssemblyAIConfig) validate() error {
+	switch c.Endpoint {
+	case "", assemblyAIEndpointBatch, assemblyAIEndpointStreaming:
+	default:
+		return fmt.Errorf("未知的识别接口 %q，可选 %s 或 %s", c.Endpoint, assemblyAIEndpointBatch, assemblyAIEndpointStreaming)
+	}
+	if c.EndOfTurnConfidence < 0 || c.EndOfTurnConfidence > 1 {
+		return fmt.Errorf("end_of_turn_confidence 范围为 0 到 1")
+	}
+	if c.MaxTurnSilence < 0 {
+		return fmt.Errorf("max_turn_silence 不能为负数")
+	}
+	return c.TranscribeOptions.validate()
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func newTestStreamingService(t *testing.T, handler func(conn *websocket.Conn, r *http.Request)) *AssemblyAIService {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+		handler(conn, r)
+	}))
+	t.Cleanup(server.Close)
+
+	service, err := NewAssemblyAIServiceFromConfig(AssemblyAIConfig{
+		APIKey:       "test-key",
+		LanguageCode: "en",
+		Retries:      1,
+		Endpoint:     assemblyAIEndpointStreaming,
+		StreamingURL: "ws" + strings.TrimPrefix(server.URL, "http"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+// readAudio 读取音频消息直到收到 n 字节，检查每条消息不短于服务端要求的50ms
+func readAudio(t *testing.T, conn *websocket.Conn, n int) []byte {
+	var audio []byte
+	for len(audio) < n {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			return audio
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		if len(data) < assemblyAIMinChunkBytes {
+			t.Errorf("audio message of %d bytes is shorter than 50ms", len(data))
+		}
+		audio = append(audio, data...)
+	}
+	return audio
+}
+
+func writeFrames(t *testing.T, stream TranscriptStream, frames [][]byte) {
+	t.Helper()
+	for _, frame := range frames {
+		if err := stream.Write(frame); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+}
+
+// testFrames 生成 n 帧 size 字节的PCM，每帧内容不同，便于检查补发的顺序
+func testFrames(n, size int) [][]byte {
+	frames := make([][]byte, n)
+	for i := range frames {
+		frames[i] = bytes.Repeat([]byte{byte(i + 1)}, size)
+	}
+	return frames
+}
+
+func TestAssemblyAIStreamingTurns(t *testing.T) {
+	service := newTestStreamingService(t, func(conn *websocket.Conn, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.URL.Query().Get("format_turns"); got != "true" {
+			t.Errorf("format_turns = %q", got)
+		}
+		// 20ms的帧凑够50ms才发送
+		if audio := readAudio(t, conn, 1); len(audio) != 3*640 {
+			t.Errorf("first audio message = %d bytes, want 3 frames", len(audio))
+		}
+		conn.WriteJSON(map[string]any{"type": "Begin"})
+		conn.WriteJSON(map[string]any{"type": "Turn", "transcript": "hello wor", "end_of_turn": false})
+		conn.WriteJSON(map[string]any{"type": "Turn", "transcript": "hello world", "end_of_turn": true, "turn_is_formatted": false})
+		conn.WriteJSON(map[string]any{"type": "Turn", "transcript": "Hello world.", "end_of_turn": true, "turn_is_formatted": true,
+			"words": []map[string]any{{"text": "Hello", "confidence": 0.8}, {"text": "world.", "confidence": 0.6}}})
+		conn.ReadMessage()
+	})
+	if !service.DetectsTurns() {
+		t.Fatal("streaming endpoint does not detect turns")
+	}
+
+	stream, err := service.StartStream(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	writeFrames(t, stream, testFrames(4, 640))
+
+	var results []Transcript
+	for result := range stream.Results() {
+		results = append(results, result)
+		if result.Final {
+			break
+		}
+	}
+	if len(results) != 2 || results[0].Final || results[0].Text != "hello wor" {
+		t.Fatalf("results = %+v, want a partial then the formatted final", results)
+	}
+	final := results[1]
+	if final.Text != "Hello world." || final.Language != "en" {
+		t.Errorf("final = %+v", final)
+	}
+	if final.Confidence < 0.69 || final.Confidence > 0.71 {
+		t.Errorf("confidence = %v, want the average word confidence", final.Confidence)
+	}
+}
+
+func TestAssemblyAIStreamingReplaysAudioAfterDrop(t *testing.T) {
+	frames := testFrames(10, assemblyAIMinChunkBytes)
+	var mu sync.Mutex
+	connections := 0
+	replayed := make(chan struct{})
+	received := make(chan []byte, 1)
+
+	service := newTestStreamingService(t, func(conn *websocket.Conn, r *http.Request) {
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+
+		if n == 1 {
+			// 收到一半音频后连接意外断开
+			readAudio(t, conn, 5*assemblyAIMinChunkBytes)
+			conn.UnderlyingConn().Close()
+			return
+		}
+		audio := readAudio(t, conn, 5*assemblyAIMinChunkBytes)
+		close(replayed)
+		audio = append(audio, readAudio(t, conn, 5*assemblyAIMinChunkBytes)...)
+		received <- audio
+		conn.WriteJSON(map[string]any{"type": "Turn", "transcript": "Done.", "end_of_turn": true, "turn_is_formatted": true})
+		conn.ReadMessage()
+	})
+
+	stream, err := service.StartStream(context.Background(), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	writeFrames(t, stream, frames[:5])
+	select {
+	case <-replayed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not reconnect and replay")
+	}
+	writeFrames(t, stream, frames[5:])
+
+	audio := <-received
+	if want := bytes.Join(frames, nil); !bytes.Equal(audio, want) {
+		t.Errorf("server received %d bytes after reconnecting, want all %d bytes in order", len(audio), len(want))
+	}
+	result, ok := <-stream.Results()
+	if !ok || result.Text != "Done." {
+		t.Errorf("result = %+v, %v", result, ok)
+	}
+}
+
+func TestAssemblyAIStreamingReplaysAudioAfterFinal(t *testing.T) {
+	frames := testFrames(6, assemblyAIMinChunkBytes)
+	var mu sync.Mutex
+	connections := 0
+	received := make(chan []byte, 1)
+
+	service := newTestStreamingService(t, func(conn *websocket.Conn, r *http.Request) {
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+
+		if n == 1 {
+			// 最终结果只覆盖前100ms，之后的音频还没有识别结果时连接断开
+			readAudio(t, conn, 4*assemblyAIMinChunkBytes)
+			conn.WriteJSON(map[string]any{"type": "Turn", "transcript": "Hi.", "end_of_turn": true, "turn_is_formatted": true,
+				"words": []map[string]any{{"text": "Hi.", "start": 0, "end": 100}}})
+			readAudio(t, conn, 2*assemblyAIMinChunkBytes)
+			conn.UnderlyingConn().Close()
+			return
+		}
+		received <- readAudio(t, conn, 4*assemblyAIMinChunkBytes)
+		conn.ReadMessage()
+	})
+
+	stream, err := service.StartStream(context.Background(), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	writeFrames(t, stream, frames[:4])
+	if result := <-stream.Results(); result.Text != "Hi." {
+		t.Fatalf("result = %+v", result)
+	}
+	writeFrames(t, stream, frames[4:])
+
+	select {
+	case audio := <-received:
+		if want := bytes.Join(frames[2:], nil); !bytes.Equal(audio, want) {
+			t.Errorf("replayed %d bytes, want the %d bytes after the final result", len(audio), len(want))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not reconnect and replay")
+	}
+}
+
+// turnDetectingSTT 是由服务端检测发言结束的流式识别，结果由测试写入 results
+type turnDetectingSTT struct {
+	fakeSTT
+	results chan Transcript
+	writes  chan []byte
+}
+
+func (f *turnDetectingSTT) DetectsTurns() bool { return true }
+
+func (f *turnDetectingSTT) StartStream(ctx context.Context, lang string) (TranscriptStream, error) {
+	return f, nil
+}
+
+func (f *turnDetectingSTT) Write(pcm []byte) error {
+	f.writes <- pcm
+	return nil
+}
+
+func (f *turnDetectingSTT) Results() <-chan Transcript { return f.results }
+
+func (f *turnDetectingSTT) Close() error { return nil }
+
+func TestServerDetectedTurnSkipsLocalSegmentation(t *testing.T) {
+	stt := &turnDetectingSTT{
+		fakeSTT: fakeSTT{err: errors.New("batch transcription should not be used")},
+		results: make(chan Transcript, 2),
+		writes:  make(chan []byte, 100),
+	}
+	llm := &fakeLLM{reply: "好的。"}
+	agent, _ := newTestAgent(&AIServices{STT: stt, LLM: llm, TTS: &fakeTTS{}})
+	agent.config.Audio.ListeningMode = ListeningModeVAD
+	agent.config.Audio.VADSilence = 40 * time.Millisecond
+
+	participant := &lksdk.RemoteParticipant{}
+	ingest := agent.newAudioIngest(participant, "track")
+	defer ingest.Close()
+	ctx := context.Background()
+
+	// 说话后静音，本地VAD不会结束发言，音频全部送入流式识别
+	for i := 0; i < 20; i++ {
+		frame := toneFrame(8000)
+		if i >= 10 {
+			frame = toneFrame(0)
+		}
+		if ingest.Push(ctx, frame) {
+			t.Fatalf("frame %d was segmented locally", i)
+		}
+	}
+	if len(stt.writes) != 20 {
+		t.Errorf("stream received %d frames, want 20", len(stt.writes))
+	}
+
+	stt.results <- Transcript{Text: "明天天", Final: false}
+	stt.results <- Transcript{Text: "明天天气怎么样？", Confidence: 0.9, Final: true}
+	deadline := time.Now().Add(5 * time.Second)
+	for llm.Calls() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	agent.turns.Wait()
+
+	history := agent.conversation(participant.Identity()).Messages()
+	if len(history) == 0 || history[0].Content != "明天天气怎么样？" {
+		t.Errorf("history = %+v, want the server-detected turn", history)
+	}
+}
+
+func TestAssemblyAIStreamingClosedBeforeConnecting(t *testing.T) {
+	accepted := make(chan struct{})
+	service := newTestStreamingService(t, func(conn *websocket.Conn, r *http.Request) {
+		close(accepted)
+		conn.ReadMessage()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var tasks supervisor
+	stream, err := service.StartStream(withSupervisor(ctx, &tasks), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 连接还没建立时关闭，接收协程连上后发现会话已关闭并退出
+	stream.Close()
+	<-accepted
+	tasks.Wait()
+	if _, ok := <-stream.Results(); ok {
+		t.Error("results were not closed")
+	}
+}
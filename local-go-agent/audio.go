@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/pion/opus"
+)
+
+// 解码后送去转录和录音的PCM采样率
+const sttSampleRate = 16000
+
+// WebRTC/Opus 使用的采样率，发布的语音回复需要重采样到该采样率
+const webrtcSampleRate = 48000
+
+// 单个Opus包最长120ms，按48kHz双声道预留解码缓冲
+const maxOpusFrameSamples = 5760 * 2
+
+// opusDecoder 将RTP中的Opus负载解码为单声道16位PCM
+type opusDecoder struct {
+	decoder opus.Decoder
+	buf     []int16
+	// 上一帧的采样数，丢包时按该长度补静音
+	frameSamples int
+}
+
+func newOpusDecoder(sampleRate int) (*opusDecoder, error) {
+	decoder, err := opus.NewDecoderWithOutput(sampleRate, 1)
+	if err != nil {
+		return nil, fmt.Errorf("创建Opus解码器失败: %w", err)
+	}
+	return &opusDecoder{
+		decoder:      decoder,
+		buf:          make([]int16, maxOpusFrameSamples),
+		frameSamples: sampleRate / 50, // 默认20ms一帧
+	}, nil
+}
+
+// Decode 解码一个Opus包，返回的切片在下一次调用前有效
+func (d *opusDecoder) Decode(payload []byte) ([]int16, error) {
+	samples, err := d.decoder.DecodeToInt16(payload, d.buf)
+	if err != nil {
+		return nil, fmt.Errorf("Opus解码失败: %w", err)
+	}
+	d.frameSamples = samples
+	return d.buf[:samples], nil
+}
+
+// Conceal 为一个丢失的包生成与上一帧等长的静音
+func (d *opusDecoder) Conceal() []int16 {
+	return make([]int16, d.frameSamples)
+}
+
+// f32leToFloat32 解析 pcm_f32le 字节流
+func f32leToFloat32(data []byte) []float32 {
+	pcm := make([]float32, len(data)/4)
+	for i := range pcm {
+		pcm[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return pcm
+}
+
+// s16leToFloat32 将16位小端PCM字节流转换为 [-1, 1) 范围的浮点采样
+func s16leToFloat32(data []byte) []float32 {
+	pcm := make([]float32, len(data)/2)
+	for i := range pcm {
+		pcm[i] = float32(int16(binary.LittleEndian.Uint16(data[i*2:]))) / 32768
+	}
+	return pcm
+}
+
+// downmix 把交错排列的多声道采样平均为单声道
+func downmix(samples []float32, channels int) []float32 {
+	if channels <= 1 {
+		return samples
+	}
+	mono := make([]float32, len(samples)/channels)
+	for i := range mono {
+		var sum float32
+		for _, sample := range samples[i*channels : (i+1)*channels] {
+			sum += sample
+		}
+		mono[i] = sum / float32(channels)
+	}
+	return mono
+}
+
+// float32ToInt16 将浮点采样转换为16位PCM，超出 [-1, 1] 的采样会被截断
+func float32ToInt16(pcm []float32) []int16 {
+	out := make([]int16, len(pcm))
+	for i, sample := range pcm {
+		if sample > 1 {
+			sample = 1
+		} else if sample < -1 {
+			sample = -1
+		}
+		out[i] = int16(sample * math.MaxInt16)
+	}
+	return out
+}
+
+// resample 使用线性插值转换采样率。线性插值没有抗混叠滤波，适合TTS输出升采样到
+// 48kHz 这样的场景，大幅降采样时高频会产生混叠
+func resample(pcm []float32, from, to int) []float32 {
+	if from == to || len(pcm) == 0 {
+		return pcm
+	}
+
+	n := int(int64(len(pcm)) * int64(to) / int64(from))
+	out := make([]float32, n)
+	step := float64(from) / float64(to)
+	for i := range out {
+		pos := float64(i) * step
+		index := int(pos)
+		if index >= len(pcm)-1 {
+			out[i] = pcm[len(pcm)-1]
+			continue
+		}
+		frac := float32(pos - float64(index))
+		out[i] = pcm[index]*(1-frac) + pcm[index+1]*frac
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// G.711 的采样率
+const g711SampleRate = 8000
+
+// audioDecoder 把一个RTP负载解码为 sttSampleRate 的单声道16位PCM
+type audioDecoder interface {
+	// Decode 解码一个包，返回的切片在下一次调用前有效
+	Decode(payload []byte) ([]int16, error)
+	// Conceal 为一个丢失的包生成与上一帧等长的静音
+	Conceal() []int16
+}
+
+// audioDecoders 按小写的MIME类型登记可以解码的音频编码，协商出的编码不在其中时不处理该轨道
+var audioDecoders = map[string]func() (audioDecoder, error){
+	strings.ToLower(webrtc.MimeTypeOpus): func() (audioDecoder, error) { return newOpusDecoder(sttSampleRate) },
+	strings.ToLower(webrtc.MimeTypePCMU): func() (audioDecoder, error) { return newG711Decoder(mulawToLinear), nil },
+	strings.ToLower(webrtc.MimeTypePCMA): func() (audioDecoder, error) { return newG711Decoder(alawToLinear), nil },
+}
+
+// newAudioDecoder 按轨道协商出的编码创建解码器，不支持的编码返回错误，避免把无法解析的数据送去识别
+func newAudioDecoder(codec webrtc.RTPCodecParameters) (audioDecoder, error) {
+	factory, ok := audioDecoders[strings.ToLower(codec.MimeType)]
+	if !ok {
+		return nil, fmt.Errorf("不支持的音频编码 %q（负载类型 %d），支持的编码: %s",
+			codec.MimeType, codec.PayloadType, strings.Join(supportedAudioCodecs(), ", "))
+	}
+	return factory()
+}
+
+func supportedAudioCodecs() []string {
+	codecs := make([]string, 0, len(audioDecoders))
+	for mimeType := range audioDecoders {
+		codecs = append(codecs, mimeType)
+	}
+	sort.Strings(codecs)
+	return codecs
+}
+
+// g711Decoder 把8kHz的G.711负载（每个字节一个采样）展开为线性PCM并重采样到 sttSampleRate
+type g711Decoder struct {
+	expand       func(byte) int16
+	frameSamples int
+}
+
+func newG711Decoder(expand func(byte) int16) *g711Decoder {
+	return &g711Decoder{expand: expand, frameSamples: sttSampleRate / 50}
+}
+
+func (d *g711Decoder) Decode(payload []byte) ([]int16, error) {
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("G.711负载为空")
+	}
+	samples := make([]float32, len(payload))
+	for i, b := range payload {
+		samples[i] = float32(d.expand(b)) / 32768
+	}
+	pcm := float32ToInt16(resample(samples, g711SampleRate, sttSampleRate))
+	d.frameSamples = len(pcm)
+	return pcm, nil
+}
+
+func (d *g711Decoder) Conceal() []int16 {
+	return make([]int16, d.frameSamples)
+}
+
+// mulawToLinear 按G.711把8位 μ-law 展开为16位线性PCM，是 linearToMulaw 的逆运算
+func mulawToLinear(b byte) int16 {
+	const bias = 0x84
+
+	b = ^b
+	exponent := int(b>>4) & 0x07
+	mantissa := int(b) & 0x0f
+	sample := ((mantissa << 3) + bias) << exponent
+	sample -= bias
+	if b&0x80 != 0 {
+		sample = -sample
+	}
+	return int16(sample)
+}
+
+// alawToLinear 按G.711把8位 A-law 展开为16位线性PCM
+func alawToLinear(b byte) int16 {
+	b ^= 0x55
+	exponent := int(b>>4) & 0x07
+	mantissa := int(b) & 0x0f
+	sample := mantissa<<4 + 8
+	if exponent > 0 {
+		sample = (sample + 0x100) << (exponent - 1)
+	}
+	// A-law 的符号位为1表示正数
+	if b&0x80 == 0 {
+		sample = -sample
+	}
+	return int16(sample)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestNewAudioDecoderPicksDecoderByMimeType(t *testing.T) {
+	for _, mimeType := range []string{webrtc.MimeTypeOpus, "AUDIO/OPUS", webrtc.MimeTypePCMU, webrtc.MimeTypePCMA} {
+		decoder, err := newAudioDecoder(webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeType}})
+		if err != nil || decoder == nil {
+			t.Fatalf("%s 应有对应的解码器: %v", mimeType, err)
+		}
+	}
+}
+
+func TestNewAudioDecoderRejectsUnsupportedCodec(t *testing.T) {
+	codec := webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeG722}, PayloadType: 9}
+	_, err := newAudioDecoder(codec)
+	if err == nil {
+		t.Fatal("不支持的编码应返回错误")
+	}
+	if !strings.Contains(err.Error(), webrtc.MimeTypeG722) || !strings.Contains(err.Error(), "audio/opus") {
+		t.Fatalf("错误信息应包含编码和支持的编码: %v", err)
+	}
+}
+
+func TestMulawRoundTrip(t *testing.T) {
+	for _, sample := range []int16{0, 100, -100, 1000, -1000, 12345, -12345, 32000, -32000} {
+		got := mulawToLinear(linearToMulaw(sample))
+		// μ-law 的量化误差随幅度增大，约为幅度的1/16
+		tolerance := int(max(abs16(sample)/16, 8))
+		if diff := int(got) - int(sample); diff > tolerance || diff < -tolerance {
+			t.Fatalf("μ-law 往返 %d 得到 %d", sample, got)
+		}
+	}
+}
+
+func TestAlawDecode(t *testing.T) {
+	// 0xd5 和 0x55 是 A-law 中最接近0的正负值
+	if got := alawToLinear(0xd5); got != 8 {
+		t.Fatalf("0xd5 应解码为 8，得到 %d", got)
+	}
+	if got := alawToLinear(0x55); got != -8 {
+		t.Fatalf("0x55 应解码为 -8，得到 %d", got)
+	}
+	if got := alawToLinear(0xaa); got != 32256 {
+		t.Fatalf("0xaa 应解码为 32256，得到 %d", got)
+	}
+}
+
+func TestG711DecoderResamplesTo16kHz(t *testing.T) {
+	decoder := newG711Decoder(mulawToLinear)
+	if got := len(decoder.Conceal()); got != sttSampleRate/50 {
+		t.Fatalf("解码前补的静音应为20ms，得到 %d 个采样", got)
+	}
+	// 20ms 的8kHz负载
+	pcm, err := decoder.Decode(make([]byte, 160))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pcm) != 320 {
+		t.Fatalf("应重采样为 320 个采样，得到 %d", len(pcm))
+	}
+	if _, err := decoder.Decode(nil); err == nil {
+		t.Fatal("空负载应返回错误")
+	}
+}
+
+func abs16(v int16) int16 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// audioIngest 是解码后的PCM进入对话的处理链：写入录音、预处理、按收听模式切分为发言，
+// 再送入参与者的对话队列。实时轨道和离线模拟共用这条处理链
+type audioIngest struct {
+	agent       *AIAgent
+	participant *lksdk.RemoteParticipant
+	trackSID    string
+
+	// 预处理在录音之后进行，录音保留原始音频
+	preprocessor *audioPreprocessor
+	segmenter    *utteranceSegmenter
+	// 去掉相邻两段发言重叠部分重复识别出的文字
+	stitcher *segmentStitcher
+	// 只回应主讲人时，其他人的发言先缓冲在这里
+	held *heldAudio
+	// 计量预处理前的原始音量，未开启上报时为 nil
+	meter *levelMeter
+	// 检测结束短语，未配置短语或识别服务不支持流式识别时为 nil
+	endpoint *endpointStream
+	// 由识别服务检测发言结束，不支持时为 nil
+	turns *turnStream
+	// pipeline 为 realtime 时由 Realtime 会话完成对话，否则为 nil
+	realtime *realtimeTurns
+	// 检测插话，未开启 barge_in 时为 nil
+	bargeIn *bargeInDetector
+}
+
+func (a *AIAgent) newAudioIngest(participant *lksdk.RemoteParticipant, trackSID string) *audioIngest {
+	return &audioIngest{
+		agent:        a,
+		participant:  participant,
+		trackSID:     trackSID,
+		preprocessor: newAudioPreprocessor(a.config.Audio.Preprocess),
+		segmenter:    a.newUtteranceSegmenter(participant.Identity()),
+		stitcher:     &segmentStitcher{},
+		held:         &heldAudio{capacity: bufferCapacity(a.config.Audio.MaxBufferDuration)},
+		meter:        newLevelMeter(a.config.Audio.LevelInterval),
+		endpoint:     a.newEndpointStream(participant.Identity()),
+		turns:        a.newTurnStream(participant, trackSID),
+		realtime:     a.newRealtimeTurns(participant),
+		bargeIn:      newBargeInDetector(a.config.BargeIn),
+	}
+}
+
+// Push 处理一帧 sttSampleRate 的PCM，返回是否有发言进入了对话队列
+func (in *audioIngest) Push(ctx context.Context, pcm []int16) bool {
+	if recorder := in.agent.currentRecorder(); recorder != nil {
+		if err := recorder.WriteIncoming(in.participant.Identity(), pcm, sttSampleRate); err != nil {
+			in.agent.logger.Errorf("写入录音失败: %v", err)
+		}
+	}
+	if level, ok := in.meter.Push(pcm); ok {
+		in.agent.reportLevel(in.participant.Identity(), level)
+	}
+	// 用预处理前的音量判断插话，自动增益会放大背景噪声
+	if in.bargeIn.Push(pcm) {
+		in.agent.bargeIn(in.participant.Identity())
+	}
+	processed := in.preprocessor.Process(pcm)
+	// Realtime 会话自己检测发言、回复和处理插话
+	if in.realtime.Write(ctx, processed) {
+		return false
+	}
+	// 识别服务检测到发言结束时会直接把转录结果送入对话队列。本地正在切分的发言（如等待唤醒时开始的发言）
+	// 先按本地切分处理完
+	if !in.segmenter.Buffered() && in.turns.Write(ctx, processed) {
+		return false
+	}
+	utterance := in.segmenter.Push(processed)
+	if utterance == nil && in.segmenter.Buffered() && in.endpoint.Write(ctx, processed) {
+		in.agent.logger.Infof("识别到 %s 的结束短语，结束发言", in.participant.Identity())
+		utterance = in.segmenter.Flush()
+	}
+	if utterance != nil {
+		in.endpoint.Reset()
+	}
+	return in.deliver(ctx, utterance)
+}
+
+// Flush 立即结束当前发言，把已缓冲的音频送入对话队列
+func (in *audioIngest) Flush(ctx context.Context) bool {
+	in.endpoint.Reset()
+	return in.deliver(ctx, in.segmenter.Flush())
+}
+
+// Close 结束轨道的流式识别会话和 Realtime 会话
+func (in *audioIngest) Close() {
+	in.turns.Close()
+	in.realtime.Close()
+	in.endpoint.Reset()
+}
+
+func (in *audioIngest) deliver(ctx context.Context, utterance []int16) bool {
+	if utterance == nil {
+		return false
+	}
+	if in.agent.belowNoiseFloor(utterance) {
+		in.agent.logger.Debugf("%s 的发言低于噪声底，跳过识别", in.participant.Identity())
+		return false
+	}
+	request := turnRequest{ctx: ctx, pcm: utterance, overlap: in.segmenter.Overlap(), stitcher: in.stitcher, trackSID: in.trackSID}
+	return in.agent.deliverUtterance(request, in.participant, in.held)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// 每次写入轨道的音频帧时长
+	audioFrameDuration = 20 * time.Millisecond
+	audioTrackName     = "agent-voice"
+)
+
+// audioEncoder 把固定时长的PCM帧编码为RTP负载
+type audioEncoder interface {
+	Codec() webrtc.RTPCodecCapability
+	SampleRate() int
+	Encode(pcm []int16) []byte
+}
+
+// pcmuEncoder 使用G.711 μ-law 编码，纯Go实现，不需要cgo。用于电话网关，
+// 以及未启用Opus编码的构建中的语音轨道，码率固定为64kbps
+type pcmuEncoder struct{}
+
+func (pcmuEncoder) Codec() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMU, ClockRate: 8000}
+}
+
+func (pcmuEncoder) SampleRate() int {
+	return 8000
+}
+
+func (pcmuEncoder) Encode(pcm []int16) []byte {
+	out := make([]byte, len(pcm))
+	for i, sample := range pcm {
+		out[i] = linearToMulaw(sample)
+	}
+	return out
+}
+
+// linearToMulaw 按G.711把16位线性PCM压缩为8位 μ-law
+func linearToMulaw(sample int16) byte {
+	const (
+		bias = 0x84
+		clip = 32635
+	)
+
+	value := int(sample)
+	sign := 0
+	if value < 0 {
+		sign = 0x80
+		value = -value
+	}
+	value = min(value, clip) + bias
+
+	exponent := 7
+	for mask := 0x4000; value&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (value >> (exponent + 3)) & 0x0f
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+// sampleWriter 接收编码后的音频帧，由 *lksdk.LocalTrack 实现
+type sampleWriter interface {
+	WriteSample(sample media.Sample, opts *lksdk.SampleWriteOptions) error
+}
+
+// pacedWriter 以实时速度每20ms向轨道写入一帧音频。待播放的音频不足一帧时用静音补齐，
+// 没有音频时持续写入静音，使接收端的时间戳保持连续，不会出现加速或卡顿
+type pacedWriter struct {
+	track     sampleWriter
+	encoder   audioEncoder
+	logger    *logrus.Entry
+	frameSize int
+	// 同时写入的其他输出（如电话网关），每一帧降采样到各自编码器的采样率
+	mirrors []outputMirror
+
+	mu      sync.Mutex
+	pending []int16
+	// 填充音只在没有待播放的回复时播放，回复到达后淡出并丢弃
+	filler []int16
+	// 当前正在播放的回复，旧回复的音频写入时被丢弃，见 Begin
+	generation uint64
+	// pending 是被打断的回复淡出的尾音，新回复的开头与之交叉淡入淡出
+	crossfade bool
+}
+
+func newPacedWriter(track sampleWriter, encoder audioEncoder, logger *logrus.Entry) *pacedWriter {
+	return &pacedWriter{
+		track:     track,
+		encoder:   encoder,
+		logger:    logger,
+		frameSize: int(time.Duration(encoder.SampleRate()) * audioFrameDuration / time.Second),
+	}
+}
+
+// outputMirror 是 pacedWriter 额外写入的一路输出，每一帧降采样后用自己的编码器编码
+type outputMirror struct {
+	track   sampleWriter
+	encoder audioEncoder
+	// 主输出与该输出的采样率之比
+	factor int
+}
+
+// Mirror 把每一帧音频同时写入 track，编码器的采样率需能整除主输出的采样率，
+// 如48kHz的Opus语音轨道同时以8kHz发送给电话网关
+func (w *pacedWriter) Mirror(track sampleWriter, encoder audioEncoder) error {
+	if encoder.SampleRate() > w.encoder.SampleRate() || w.encoder.SampleRate()%encoder.SampleRate() != 0 {
+		return fmt.Errorf("输出的采样率 %d 不能整除语音轨道的 %d", encoder.SampleRate(), w.encoder.SampleRate())
+	}
+	w.mirrors = append(w.mirrors, outputMirror{
+		track:   track,
+		encoder: encoder,
+		factor:  w.encoder.SampleRate() / encoder.SampleRate(),
+	})
+	return nil
+}
+
+// decimate 把每 factor 个采样平均为一个，平均起到简单的低通作用，减轻降采样的混叠
+func decimate(pcm []int16, factor int) []int16 {
+	if factor <= 1 {
+		return pcm
+	}
+	out := make([]int16, len(pcm)/factor)
+	for i := range out {
+		sum := 0
+		for _, sample := range pcm[i*factor : (i+1)*factor] {
+			sum += int(sample)
+		}
+		out[i] = int16(sum / factor)
+	}
+	return out
+}
+
+// Write 把音频重采样到编码器的采样率后排队等待播放，不会阻塞
+func (w *pacedWriter) Write(samples []float32, sampleRate int) {
+	pcm := float32ToInt16(resample(samples, sampleRate, w.encoder.SampleRate()))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.enqueue(pcm)
+}
+
+// Begin 开始播放一段新的回复并返回它的编号。还没播完的回复淡出，与新回复的开头交叉淡入淡出，
+// 之后旧回复再写入的音频都被丢弃
+func (w *pacedWriter) Begin() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.generation++
+	w.cut()
+	return w.generation
+}
+
+// WriteGeneration 排队播放回复 generation 的音频，回复已被新的回复取代或已停止时丢弃并返回 false
+func (w *pacedWriter) WriteGeneration(generation uint64, samples []float32, sampleRate int) bool {
+	pcm := float32ToInt16(resample(samples, sampleRate, w.encoder.SampleRate()))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if generation != w.generation {
+		return false
+	}
+	w.enqueue(pcm)
+	return true
+}
+
+// Stop 停止播放回复 generation，未播完的音频淡出。回复已被取代时什么也不做
+func (w *pacedWriter) Stop(generation uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if generation != w.generation {
+		return
+	}
+	w.generation++
+	w.cut()
+	w.crossfade = false
+}
+
+// Interrupt 停止播放当前的回复，未播完的音频淡出，之后这段回复再写入的音频都被丢弃
+func (w *pacedWriter) Interrupt() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.generation++
+	w.cut()
+	w.crossfade = false
+}
+
+// cut 把待播放的音频截短为淡出的尾音，避免突然中断产生爆音，调用方需持有 mu
+func (w *pacedWriter) cut() {
+	if len(w.pending) == 0 {
+		return
+	}
+	w.pending = fadeOut(w.pending[:min(len(w.pending), w.fadeSamples())])
+	w.crossfade = true
+}
+
+// enqueue 追加待播放的音频，调用方需持有 mu
+func (w *pacedWriter) enqueue(pcm []int16) {
+	// 回复在填充音播完之前到达时，填充音淡出后立即接上回复
+	if len(w.filler) > 0 {
+		w.pending = append(w.pending, fadeOut(w.filler[:min(len(w.filler), w.fadeSamples())])...)
+		w.filler = nil
+	}
+	// 新回复淡入，叠加在被打断的回复还没播完的尾音上
+	if w.crossfade {
+		w.crossfade = false
+		pcm = fadeIn(pcm, w.fadeSamples())
+		n := min(len(w.pending), len(pcm))
+		for i := 0; i < n; i++ {
+			w.pending[i] = clampInt16(int(w.pending[i]) + int(pcm[i]))
+		}
+		pcm = pcm[n:]
+	}
+	w.pending = append(w.pending, pcm...)
+}
+
+// fadeIn 返回开头 length 个采样线性淡入的副本
+func fadeIn(pcm []int16, length int) []int16 {
+	out := append([]int16(nil), pcm...)
+	for i := 0; i < min(length, len(out)); i++ {
+		out[i] = int16(int(out[i]) * i / length)
+	}
+	return out
+}
+
+func clampInt16(sample int) int16 {
+	return int16(max(min(sample, math.MaxInt16), math.MinInt16))
+}
+
+// WriteFiller 排队播放一段填充音，替换还未播完的填充音。已有待播放的回复时忽略
+func (w *pacedWriter) WriteFiller(samples []float32, sampleRate int) {
+	pcm := float32ToInt16(resample(samples, sampleRate, w.encoder.SampleRate()))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) > 0 {
+		return
+	}
+	w.filler = pcm
+}
+
+func (w *pacedWriter) fadeSamples() int {
+	return int(time.Duration(w.encoder.SampleRate()) * fillerFadeDuration / time.Second)
+}
+
+// Buffered 返回还未播放的音频时长
+func (w *pacedWriter) Buffered() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return time.Duration(len(w.pending)) * time.Second / time.Duration(w.encoder.SampleRate())
+}
+
+// Run 按帧间隔写入音频，直到 ctx 结束
+func (w *pacedWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(audioFrameDuration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		frame := w.nextFrame()
+		sample := media.Sample{Data: w.encoder.Encode(frame), Duration: audioFrameDuration}
+		if err := w.track.WriteSample(sample, nil); err != nil {
+			w.logger.Debugf("写入音频帧失败: %v", err)
+		}
+		for _, mirror := range w.mirrors {
+			sample := media.Sample{Data: mirror.encoder.Encode(decimate(frame, mirror.factor)), Duration: audioFrameDuration}
+			if err := mirror.track.WriteSample(sample, nil); err != nil {
+				w.logger.Debugf("写入音频帧失败: %v", err)
+			}
+		}
+	}
+}
+
+// nextFrame 取出一帧待播放的音频，不足一帧的部分补静音
+func (w *pacedWriter) nextFrame() []int16 {
+	frame := make([]int16, w.frameSize)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) == 0 && len(w.filler) > 0 {
+		n := copy(frame, w.filler)
+		w.filler = w.filler[n:]
+		return frame
+	}
+
+	n := copy(frame, w.pending)
+	if n > 0 && n < w.frameSize {
+		w.logger.Debugf("待播放的音频不足一帧，补 %d 个静音采样", w.frameSize-n)
+	}
+	w.pending = w.pending[n:]
+	if len(w.pending) == 0 {
+		// 释放已播放音频占用的底层数组
+		w.pending = nil
+	}
+	return frame
+}
+
+// publishAudioTrack 按 output_target 发布代理的语音轨道或连接电话网关，并在会话结束前按实时速度写入音频
+func (a *AIAgent) publishAudioTrack(ctx context.Context, room *lksdk.Room) error {
+	target := a.config.Audio.OutputTarget
+	var writer *pacedWriter
+	var bitrate *bitrateAdapter
+	if target.webrtc() {
+		// 语音轨道以48kHz Opus发布；没有 libopus 的构建退回8kHz PCMU，音质相当于电话
+		encoder, err := newOpusEncoder()
+		if err != nil {
+			a.logger.Warnf("%v，语音轨道改用PCMU编码，音质会明显下降", err)
+			encoder = pcmuEncoder{}
+		}
+		track, err := lksdk.NewLocalSampleTrack(encoder.Codec())
+		if err != nil {
+			return fmt.Errorf("创建音频轨道失败: %w", err)
+		}
+		if _, err := room.LocalParticipant.PublishTrack(track, &lksdk.TrackPublicationOptions{Name: audioTrackName}); err != nil {
+			return fmt.Errorf("发布音频轨道失败: %w", err)
+		}
+		writer = newPacedWriter(track, encoder, a.logger)
+		bitrate = newBitrateAdapter(encoder, a.config.Audio, a.logger)
+		context.AfterFunc(ctx, bitrate.Stop)
+	}
+	if target.telephony() {
+		encoder := a.config.Telephony.encoder()
+		sender, err := newRTPSender(a.config.Telephony.Address, encoder)
+		if err != nil {
+			return err
+		}
+		context.AfterFunc(ctx, func() { sender.Close() })
+		if writer == nil {
+			writer = newPacedWriter(sender, encoder, a.logger)
+		} else if err := writer.Mirror(sender, encoder); err != nil {
+			sender.Close()
+			return fmt.Errorf("无法同时发送给电话网关: %w", err)
+		}
+		a.logger.Infof("语音以 %s 发送给电话网关 %s", encoder.Codec().MimeType, a.config.Telephony.Address)
+	}
+
+	a.audioMu.Lock()
+	a.bitrate.Stop()
+	a.bitrate = bitrate
+	a.audioMu.Unlock()
+	return a.startAudioOutput(ctx, writer)
+}
+
+// startAudioOutput 把 writer 设为会话的语音输出并开始按节奏发送，直到 ctx 结束
+func (a *AIAgent) startAudioOutput(ctx context.Context, writer *pacedWriter) error {
+	if !a.spawn("语音输出", func() { writer.Run(ctx) }) {
+		return errSupervisorClosed
+	}
+	a.audioMu.Lock()
+	a.audioOut = writer
+	a.audioMu.Unlock()
+	return nil
+}
+
+// speechOutput 接收合成的语音，连接房间时由 pacedWriter 实现，离线模拟时写入文件
+type speechOutput interface {
+	Write(samples []float32, sampleRate int)
+}
+
+// audioWriter 返回当前会话的语音输出，未发布音频轨道时返回 nil
+func (a *AIAgent) audioWriter() speechOutput {
+	a.audioMu.Lock()
+	defer a.audioMu.Unlock()
+
+	return a.audioOut
+}
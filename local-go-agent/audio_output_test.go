@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeTrack 记录写入的音频帧
+type fakeTrack struct {
+	mu      sync.Mutex
+	samples []media.Sample
+}
+
+func (f *fakeTrack) WriteSample(sample media.Sample, opts *lksdk.SampleWriteOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.samples = append(f.samples, sample)
+	return nil
+}
+
+func (f *fakeTrack) Samples() []media.Sample {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]media.Sample(nil), f.samples...)
+}
+
+func newTestPacedWriter(track sampleWriter) *pacedWriter {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return newPacedWriter(track, pcmuEncoder{}, logrus.NewEntry(logger))
+}
+
+func TestLinearToMulaw(t *testing.T) {
+	tests := []struct {
+		sample int16
+		want   byte
+	}{
+		{sample: 0, want: 0xff},
+		{sample: 32767, want: 0x80},
+		{sample: -32768, want: 0x00},
+		{sample: 1000, want: 0xce},
+		{sample: -1000, want: 0x4e},
+	}
+
+	for _, tt := range tests {
+		if got := linearToMulaw(tt.sample); got != tt.want {
+			t.Errorf("linearToMulaw(%d) = %#x, want %#x", tt.sample, got, tt.want)
+		}
+	}
+}
+
+func TestPacedWriterPadsUnderrunWithSilence(t *testing.T) {
+	writer := newTestPacedWriter(&fakeTrack{})
+
+	// 30ms 的音频：第一帧完整，第二帧后半段补静音，之后全是静音
+	tone := make([]float32, 240)
+	for i := range tone {
+		tone[i] = 0.5
+	}
+	writer.Write(tone, 8000)
+	if got := writer.Buffered(); got != 30*time.Millisecond {
+		t.Fatalf("buffered = %v, want 30ms", got)
+	}
+
+	first, second, third := writer.nextFrame(), writer.nextFrame(), writer.nextFrame()
+	if len(first) != 160 || first[159] == 0 {
+		t.Errorf("first frame not filled with audio")
+	}
+	if second[79] == 0 || second[80] != 0 || second[159] != 0 {
+		t.Errorf("second frame not padded with silence after 10ms of audio")
+	}
+	if rms(third) != 0 {
+		t.Errorf("third frame not silent")
+	}
+	if writer.Buffered() != 0 {
+		t.Errorf("audio left after all frames were taken")
+	}
+}
+
+func TestPacedWriterPacing(t *testing.T) {
+	track := &fakeTrack{}
+	writer := newTestPacedWriter(track)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		writer.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(210 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("writer did not stop after the context was cancelled")
+	}
+
+	// 按实时速度写入，200ms 大约10帧，不会一次性写出
+	samples := track.Samples()
+	if len(samples) < 7 || len(samples) > 11 {
+		t.Errorf("wrote %d frames in 210ms, want about 10", len(samples))
+	}
+	for _, sample := range samples {
+		if sample.Duration != audioFrameDuration || len(sample.Data) != 160 {
+			t.Fatalf("frame duration %v with %d bytes, want 20ms with 160 bytes", sample.Duration, len(sample.Data))
+		}
+	}
+
+	count := len(samples)
+	time.Sleep(50 * time.Millisecond)
+	if len(track.Samples()) != count {
+		t.Error("writer kept writing after the context was cancelled")
+	}
+}
+
+func TestPacedWriterFillerYieldsToReply(t *testing.T) {
+	writer := newTestPacedWriter(&fakeTrack{})
+	constant := func(n int, value float32) []float32 {
+		samples := make([]float32, n)
+		for i := range samples {
+			samples[i] = value
+		}
+		return samples
+	}
+
+	// 1秒的填充音，播放一帧后回复到达
+	writer.WriteFiller(constant(8000, 0.25), 8000)
+	if frame := writer.nextFrame(); frame[0] == 0 {
+		t.Fatal("filler not played while idle")
+	}
+	writer.Write(constant(160, 0.5), 8000)
+
+	// 填充音在10ms内淡出，随后是回复，不会继续播放剩余的填充音
+	fade := writer.nextFrame()
+	if fade[0] == 0 || fade[79] >= fade[0] || fade[80] != 16383 {
+		t.Errorf("filler did not fade out into the reply: %v", fade[:81])
+	}
+	writer.nextFrame()
+	if rms(writer.nextFrame()) != 0 {
+		t.Error("filler resumed after the reply")
+	}
+
+	// 已有回复在播放时不插入填充音
+	writer.Write(constant(160, 0.5), 8000)
+	writer.WriteFiller(constant(800, 0.25), 8000)
+	writer.nextFrame()
+	if rms(writer.nextFrame()) != 0 {
+		t.Error("filler played after a reply that was already queued")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func sineWave(freq float64, sampleRate int, duration float64) []float32 {
+	pcm := make([]float32, int(float64(sampleRate)*duration))
+	for i := range pcm {
+		pcm[i] = float32(0.5 * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)))
+	}
+	return pcm
+}
+
+// zeroCrossingFrequency 根据上升过零点的数量估计正弦波的频率
+func zeroCrossingFrequency(pcm []float32, sampleRate int) float64 {
+	crossings := 0
+	for i := 1; i < len(pcm); i++ {
+		if pcm[i-1] < 0 && pcm[i] >= 0 {
+			crossings++
+		}
+	}
+	return float64(crossings) * float64(sampleRate) / float64(len(pcm))
+}
+
+func TestResampleLength(t *testing.T) {
+	tests := []struct {
+		from, to int
+		in       int
+		want     int
+	}{
+		{from: 22050, to: 48000, in: 22050, want: 48000},
+		{from: 24000, to: 48000, in: 480, want: 960},
+		{from: 48000, to: 16000, in: 960, want: 320},
+		{from: 44100, to: 48000, in: 441, want: 480},
+		{from: 48000, to: 48000, in: 100, want: 100},
+	}
+
+	for _, tt := range tests {
+		out := resample(make([]float32, tt.in), tt.from, tt.to)
+		if len(out) != tt.want {
+			t.Errorf("resample(%d samples, %d -> %d) length = %d, want %d", tt.in, tt.from, tt.to, len(out), tt.want)
+		}
+	}
+}
+
+func TestResamplePreservesSineFrequency(t *testing.T) {
+	const freq = 440.0
+	in := sineWave(freq, 22050, 1)
+	out := resample(in, 22050, webrtcSampleRate)
+
+	if got := zeroCrossingFrequency(out, webrtcSampleRate); math.Abs(got-freq) > 2 {
+		t.Fatalf("frequency after resampling = %.1f Hz, want %.1f Hz", got, freq)
+	}
+}
+
+func TestFloat32ToInt16Clamps(t *testing.T) {
+	got := float32ToInt16([]float32{0, 1, -1, 1.5, -1.5})
+	want := []int16{0, math.MaxInt16, -math.MaxInt16, math.MaxInt16, -math.MaxInt16}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sample %d = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultBargeInDuration  = 300
+	defaultBargeInThreshold = 0.03
+)
+
+// BargeInConfig 决定参与者插话多久、多响才打断正在播放的回复。持续不够长的声音（咳嗽、关门声）
+// 和低于阈值的背景噪声不会打断
+type BargeInConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// 连续超过能量阈值的音频需要持续的毫秒数
+	MinDurationMs int `yaml:"min_duration_ms"`
+	// 判定为说话的一帧音频的均方根电平 (0-1)
+	EnergyThreshold float64 `yaml:"energy_threshold"`
+}
+
+func (c BargeInConfig) validate() error {
+	if c.MinDurationMs < 0 {
+		return fmt.Errorf("min_duration_ms 不能小于0")
+	}
+	if c.EnergyThreshold < 0 || c.EnergyThreshold >= 1 {
+		return fmt.Errorf("energy_threshold 的范围为 0 到 1")
+	}
+	return nil
+}
+
+// bargeInDetector 检测一条轨道上持续的说话声。连续超过能量阈值的帧累计到 minDuration 时触发一次，
+// 出现低于阈值的帧后重新计数。nil 表示不检测
+type bargeInDetector struct {
+	threshold   float64
+	minDuration time.Duration
+
+	voiced time.Duration
+	fired  bool
+}
+
+func newBargeInDetector(cfg BargeInConfig) *bargeInDetector {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &bargeInDetector{
+		threshold:   cfg.EnergyThreshold,
+		minDuration: time.Duration(cfg.MinDurationMs) * time.Millisecond,
+	}
+}
+
+// Push 处理一帧 sttSampleRate 的PCM，返回是否在这一帧达到了打断的条件
+func (d *bargeInDetector) Push(pcm []int16) bool {
+	if d == nil || len(pcm) == 0 {
+		return false
+	}
+	if rms(pcm) < d.threshold {
+		d.voiced = 0
+		d.fired = false
+		return false
+	}
+	d.voiced += time.Duration(len(pcm)) * time.Second / sttSampleRate
+	if d.fired || d.voiced < d.minDuration {
+		return false
+	}
+	d.fired = true
+	return true
+}
+
+// interruptibleOutput 是能停止正在播放的回复的语音输出，由 pacedWriter 实现
+type interruptibleOutput interface {
+	Buffered() time.Duration
+	Interrupt()
+}
+
+// bargeIn 在参与者插话时打断代理：只有代理正在播放回复时才生效，取消正在播放的那一轮对话并让未播完的语音淡出。
+// 还没有播放过回复时取消插话者自己进行中的对话，其他参与者的对话不受影响。返回是否打断了回复
+func (a *AIAgent) bargeIn(identity string) bool {
+	output, ok := a.audioWriter().(interruptibleOutput)
+	if !ok || output.Buffered() == 0 || !a.respondsTo(identity) {
+		return false
+	}
+
+	a.playbackMu.Lock()
+	owner := a.playbackOwner
+	a.playbackMu.Unlock()
+	if owner == "" {
+		owner = identity
+	}
+	a.queuesMu.Lock()
+	queue := a.queues[owner]
+	a.queuesMu.Unlock()
+	if queue != nil {
+		queue.mu.Lock()
+		if queue.cancel != nil {
+			queue.cancel()
+		}
+		queue.mu.Unlock()
+	}
+	output.Interrupt()
+
+	a.logger.Infof("%s 插话，打断正在播放的回复", identity)
+	a.emit(AgentEvent{Type: EventBargeIn, ParticipantIdentity: identity})
+	return true
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// tone 返回 duration 时长、幅度为 amplitude 的方波，每20ms一帧
+func tone(duration time.Duration, amplitude int16) [][]int16 {
+	frame := sttSampleRate / 50
+	var frames [][]int16
+	for n := int(duration * sttSampleRate / time.Second); n > 0; n -= frame {
+		pcm := make([]int16, min(frame, n))
+		for i := range pcm {
+			pcm[i] = amplitude
+			if i%2 == 1 {
+				pcm[i] = -amplitude
+			}
+		}
+		frames = append(frames, pcm)
+	}
+	return frames
+}
+
+// interruptOutput 模拟正在播放回复的语音输出
+type interruptOutput struct {
+	captureOutput
+
+	mu          sync.Mutex
+	interrupted int
+}
+
+func (o *interruptOutput) Buffered() time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.interrupted > 0 {
+		return 0
+	}
+	return time.Second
+}
+
+func (o *interruptOutput) Interrupt() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.interrupted++
+}
+
+func (o *interruptOutput) Interrupted() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.interrupted
+}
+
+func TestBargeInDetector(t *testing.T) {
+	detector := newBargeInDetector(BargeInConfig{Enabled: true, MinDurationMs: 300, EnergyThreshold: 0.05})
+	loud, quiet := int16(8000), int16(500)
+
+	fired := 0
+	push := func(frames [][]int16) {
+		for _, frame := range frames {
+			if detector.Push(frame) {
+				fired++
+			}
+		}
+	}
+
+	// 咳嗽：短促的响声后安静下来
+	push(tone(120*time.Millisecond, loud))
+	push(tone(100*time.Millisecond, 0))
+	push(tone(120*time.Millisecond, loud))
+	// 持续的背景噪声低于阈值
+	push(tone(time.Second, quiet))
+	if fired != 0 {
+		t.Fatalf("noise bursts triggered barge-in %d times", fired)
+	}
+
+	// 持续说话只触发一次
+	push(tone(time.Second, loud))
+	if fired != 1 {
+		t.Errorf("sustained speech triggered %d times, want 1", fired)
+	}
+
+	if newBargeInDetector(BargeInConfig{MinDurationMs: 300, EnergyThreshold: 0.05}) != nil {
+		t.Error("detector created with barge-in disabled")
+	}
+}
+
+func TestBargeInCancelsReply(t *testing.T) {
+	llm := &fakeLLM{block: true}
+	agent, _ := newTestAgent(&AIServices{LLM: llm, STT: &fakeSTT{}, TTS: &fakeTTS{}})
+	agent.config.BargeIn = BargeInConfig{Enabled: true, MinDurationMs: 300, EnergyThreshold: 0.05}
+	agent.config.Audio.TurnDeadline = 0
+	output := &interruptOutput{}
+	agent.audioOut = output
+	participant := &lksdk.RemoteParticipant{}
+
+	agent.enqueueTurn(participant, transcriptRequest("讲个故事"))
+	for deadline := time.Now().Add(time.Second); llm.Calls() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx := context.Background()
+	ingest := agent.newAudioIngest(participant, "TR_mic")
+	defer ingest.Close()
+	for _, frame := range tone(150*time.Millisecond, 8000) {
+		ingest.Push(ctx, frame)
+	}
+	for _, frame := range tone(100*time.Millisecond, 0) {
+		ingest.Push(ctx, frame)
+	}
+	if output.Interrupted() != 0 || llm.CtxErr() != nil {
+		t.Fatal("a short noise burst interrupted the reply")
+	}
+
+	for _, frame := range tone(400*time.Millisecond, 8000) {
+		ingest.Push(ctx, frame)
+	}
+	agent.turns.Wait()
+	if output.Interrupted() != 1 {
+		t.Errorf("output interrupted %d times, want 1", output.Interrupted())
+	}
+	if err := llm.CtxErr(); !errors.Is(err, context.Canceled) {
+		t.Errorf("reply ended with %v, want canceled", err)
+	}
+	if !hasEvent(agent, EventBargeIn) {
+		t.Error("no barge_in event")
+	}
+}
+
+func TestBargeInCancelsOnlyThePlayingTurn(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	agent.audioOut = &interruptOutput{}
+	playing, cancelPlaying := context.WithCancel(context.Background())
+	defer cancelPlaying()
+	thinking, cancelThinking := context.WithCancel(context.Background())
+	defer cancelThinking()
+	agent.turnQueue("bob").cancel = cancelPlaying
+	agent.turnQueue("carol").cancel = cancelThinking
+	agent.playbackOwner = "bob"
+
+	if !agent.bargeIn("alice") {
+		t.Fatal("barge-in did not interrupt the reply")
+	}
+	if playing.Err() == nil {
+		t.Error("the turn whose reply was playing was not canceled")
+	}
+	if thinking.Err() != nil {
+		t.Error("another participant's turn was canceled")
+	}
+}
+
+func hasEvent(agent *AIAgent, want AgentEventType) bool {
+	for {
+		select {
+		case event := <-agent.events:
+			if event.Type == want {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
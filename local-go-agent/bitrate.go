@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultOutputBitrate    = 32000
+	defaultMinOutputBitrate = 12000
+	// Opus 能编码的最低码率
+	minOpusBitrate = 6000
+	// 连接质量恢复后持续这么久才恢复码率，避免在好坏之间反复切换
+	bitrateRecoveryDelay = 5 * time.Second
+)
+
+// bitrateEncoder 是可以在编码过程中调整码率和复杂度的编码器（如Opus），
+// 实现它的 audioEncoder 可以按连接质量调整码率。PCMU 码率固定，不支持调整
+type bitrateEncoder interface {
+	SetBitrate(bitsPerSecond int) error
+	SetComplexity(complexity int) error
+}
+
+// bitrateLevel 是一档编码参数
+type bitrateLevel struct {
+	bitrate    int
+	complexity int
+}
+
+// bitrateAdapter 按代理自己的连接质量调整语音轨道的编码参数：质量下降时立即降低码率和复杂度，
+// 宁可音质差一些也不要卡顿；质量恢复并保持 recovery 后恢复。nil 表示不调整
+type bitrateAdapter struct {
+	encoder bitrateEncoder
+	logger  *logrus.Entry
+	// 依次为 EXCELLENT、GOOD、POOR 时使用的编码参数
+	levels   [3]bitrateLevel
+	adaptive bool
+	recovery time.Duration
+
+	mu      sync.Mutex
+	level   int
+	restore *time.Timer
+}
+
+// newBitrateAdapter 按配置设置编码器的码率。编码器不支持调整或未配置码率时返回 nil
+func newBitrateAdapter(encoder audioEncoder, cfg AudioConfig, logger *logrus.Entry) *bitrateAdapter {
+	if cfg.OutputBitrate <= 0 {
+		return nil
+	}
+	adjustable, ok := encoder.(bitrateEncoder)
+	if !ok {
+		logger.Infof("语音轨道的编码器 %s 码率固定，忽略 output_bitrate 和 adaptive_bitrate", encoder.Codec().MimeType)
+		return nil
+	}
+
+	minimum := max(cfg.MinOutputBitrate, minOpusBitrate)
+	adapter := &bitrateAdapter{
+		encoder: adjustable,
+		logger:  logger,
+		levels: [3]bitrateLevel{
+			{bitrate: cfg.OutputBitrate, complexity: 10},
+			{bitrate: max((cfg.OutputBitrate+minimum)/2, minimum), complexity: 8},
+			{bitrate: minimum, complexity: 5},
+		},
+		adaptive: cfg.AdaptiveBitrate,
+		recovery: bitrateRecoveryDelay,
+	}
+	adapter.apply(0)
+	return adapter
+}
+
+// Update 根据最新的连接质量调整编码参数
+func (b *bitrateAdapter) Update(quality livekit.ConnectionQuality) {
+	if b == nil || !b.adaptive {
+		return
+	}
+	target := qualityLevel(quality)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.restore != nil {
+		b.restore.Stop()
+		b.restore = nil
+	}
+	switch {
+	case target > b.level:
+		b.logger.Warnf("连接质量下降 (%s)，语音码率降为 %dbps", quality, b.levels[target].bitrate)
+		b.level = target
+		b.apply(target)
+	case target < b.level:
+		b.restore = time.AfterFunc(b.recovery, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if b.level <= target {
+				return
+			}
+			b.logger.Infof("连接质量已恢复 (%s)，语音码率恢复为 %dbps", quality, b.levels[target].bitrate)
+			b.level = target
+			b.apply(target)
+		})
+	}
+}
+
+// Bitrate 返回当前的码率
+func (b *bitrateAdapter) Bitrate() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.levels[b.level].bitrate
+}
+
+// apply 设置编码参数，调用方需持有 mu（创建时除外）
+func (b *bitrateAdapter) apply(level int) {
+	params := b.levels[level]
+	if err := b.encoder.SetBitrate(params.bitrate); err != nil {
+		b.logger.Errorf("设置语音码率失败: %v", err)
+	}
+	if err := b.encoder.SetComplexity(params.complexity); err != nil {
+		b.logger.Errorf("设置编码复杂度失败: %v", err)
+	}
+}
+
+// Stop 取消等待中的码率恢复
+func (b *bitrateAdapter) Stop() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.restore != nil {
+		b.restore.Stop()
+		b.restore = nil
+	}
+}
+
+func qualityLevel(quality livekit.ConnectionQuality) int {
+	switch quality {
+	case livekit.ConnectionQuality_EXCELLENT:
+		return 0
+	case livekit.ConnectionQuality_GOOD:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// validateBitrate 检查语音轨道的码率配置
+func (c AudioConfig) validateBitrate() error {
+	if c.OutputBitrate < 0 || c.MinOutputBitrate < 0 {
+		return fmt.Errorf("output_bitrate 和 min_output_bitrate 不能小于0")
+	}
+	if c.OutputBitrate > 0 && c.OutputBitrate < max(c.MinOutputBitrate, minOpusBitrate) {
+		return fmt.Errorf("output_bitrate 不能小于 min_output_bitrate，也不能小于 %dbps", minOpusBitrate)
+	}
+	return nil
+}
+
+// onConnectionQualityChanged 记录代理自己的连接质量，并据此调整语音轨道的码率
+func (a *AIAgent) onConnectionQualityChanged(update *livekit.ConnectionQualityInfo, p lksdk.Participant) {
+	if _, ok := p.(*lksdk.LocalParticipant); !ok {
+		return
+	}
+	a.logger.Debugf("代理的连接质量: %s", update.Quality)
+	a.audioMu.Lock()
+	bitrate := a.bitrate
+	a.audioMu.Unlock()
+	bitrate.Update(update.Quality)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeOpusEncoder 记录设置的码率和复杂度
+type fakeOpusEncoder struct {
+	pcmuEncoder
+
+	mu         sync.Mutex
+	bitrate    int
+	complexity int
+}
+
+func (e *fakeOpusEncoder) SetBitrate(bitsPerSecond int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.bitrate = bitsPerSecond
+	return nil
+}
+
+func (e *fakeOpusEncoder) SetComplexity(complexity int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.complexity = complexity
+	return nil
+}
+
+func (e *fakeOpusEncoder) settings() (int, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.bitrate, e.complexity
+}
+
+func TestBitrateAdaptsToConnectionQuality(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := DefaultConfig().Audio
+	cfg.AdaptiveBitrate = true
+	encoder := &fakeOpusEncoder{}
+
+	adapter := newBitrateAdapter(encoder, cfg, logrus.NewEntry(logger))
+	adapter.recovery = 20 * time.Millisecond
+	defer adapter.Stop()
+	if bitrate, complexity := encoder.settings(); bitrate != defaultOutputBitrate || complexity != 10 {
+		t.Fatalf("initial settings = %d bps, complexity %d", bitrate, complexity)
+	}
+
+	// 质量下降立即降低码率
+	adapter.Update(livekit.ConnectionQuality_POOR)
+	if bitrate, complexity := encoder.settings(); bitrate != defaultMinOutputBitrate || complexity != 5 {
+		t.Errorf("poor connection = %d bps, complexity %d", bitrate, complexity)
+	}
+
+	// 短暂恢复又变差时不还原
+	adapter.Update(livekit.ConnectionQuality_EXCELLENT)
+	adapter.Update(livekit.ConnectionQuality_POOR)
+	time.Sleep(50 * time.Millisecond)
+	if bitrate, _ := encoder.settings(); bitrate != defaultMinOutputBitrate {
+		t.Errorf("bitrate restored after a brief recovery: %d bps", bitrate)
+	}
+
+	adapter.Update(livekit.ConnectionQuality_EXCELLENT)
+	deadline := time.Now().Add(time.Second)
+	for adapter.Bitrate() != defaultOutputBitrate && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if bitrate, complexity := encoder.settings(); bitrate != defaultOutputBitrate || complexity != 10 {
+		t.Errorf("recovered connection = %d bps, complexity %d", bitrate, complexity)
+	}
+}
+
+func TestFixedRateEncoderIgnoresBitrate(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := DefaultConfig().Audio
+	cfg.AdaptiveBitrate = true
+
+	adapter := newBitrateAdapter(pcmuEncoder{}, cfg, logrus.NewEntry(logger))
+	if adapter != nil {
+		t.Fatal("PCMU encoder should not be adjusted")
+	}
+	// 未调整码率时忽略连接质量的变化
+	adapter.Update(livekit.ConnectionQuality_POOR)
+}
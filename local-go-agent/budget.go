@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 预算用完后的回复
+const budgetExceededReply = "本时段的AI对话额度已用完，请稍后再试。"
+
+// tokenBudget 限制一个时间窗口内消耗的LLM token数量，窗口结束后重新计数，
+// window 为 0 时不重置。nil 表示不限制
+type tokenBudget struct {
+	mu          sync.Mutex
+	limit       int64
+	window      time.Duration
+	used        int64
+	windowStart time.Time
+	now         func() time.Time
+}
+
+// BudgetUsage 是 /status 接口中的token用量
+type BudgetUsage struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"`
+	// 当前窗口的重置时间，不重置时为空
+	ResetAt *time.Time `json:"reset_at,omitempty"`
+}
+
+func newTokenBudget(limit int64, window time.Duration) *tokenBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &tokenBudget{limit: limit, window: window, windowStart: time.Now(), now: time.Now}
+}
+
+// Exceeded 返回当前窗口的用量是否已达到上限
+func (b *tokenBudget) Exceeded() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	return b.used >= b.limit
+}
+
+// Add 记录消耗的token。请求发出前无法知道消耗，最后一次请求可能使用量略微超出上限
+func (b *tokenBudget) Add(tokens int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+	b.used += tokens
+}
+
+func (b *tokenBudget) Usage() *BudgetUsage {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll()
+
+	usage := &BudgetUsage{Used: b.used, Limit: b.limit}
+	if b.window > 0 {
+		resetAt := b.windowStart.Add(b.window)
+		usage.ResetAt = &resetAt
+	}
+	return usage
+}
+
+// roll 在窗口结束后开始新的窗口，调用方需持有 b.mu
+func (b *tokenBudget) roll() {
+	if b.window <= 0 {
+		return
+	}
+	now := b.now()
+	if elapsed := now.Sub(b.windowStart); elapsed >= b.window {
+		b.windowStart = b.windowStart.Add(elapsed / b.window * b.window)
+		b.used = 0
+	}
+}
+
+// budgetExceeded 返回房间或全局的token预算是否已用完
+func (a *AIAgent) budgetExceeded() bool {
+	return a.budget.Exceeded() || a.globalBudget.Exceeded()
+}
+
+func (a *AIAgent) recordUsage(ctx context.Context, usage TokenUsage) {
+	a.budget.Add(usage.Total())
+	a.globalBudget.Add(usage.Total())
+	a.metrics.AddTokens(usage)
+	a.chargeUsage(ctx, TurnCost{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBudgetWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	budget := newTokenBudget(100, time.Hour)
+	budget.windowStart = now
+	budget.now = func() time.Time { return now }
+
+	budget.Add(60)
+	if budget.Exceeded() {
+		t.Fatal("budget exceeded after 60 of 100 tokens")
+	}
+	budget.Add(50)
+	if !budget.Exceeded() {
+		t.Fatal("budget not exceeded after 110 of 100 tokens")
+	}
+
+	// 跨过多个窗口后用量清零，新窗口与原窗口对齐
+	now = now.Add(2*time.Hour + 10*time.Minute)
+	if budget.Exceeded() {
+		t.Fatal("budget still exceeded after the window reset")
+	}
+	usage := budget.Usage()
+	if usage.Used != 0 || !usage.ResetAt.Equal(time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected usage after reset: used %d, reset at %v", usage.Used, usage.ResetAt)
+	}
+}
+
+func TestGenerateReplyBudgetExceeded(t *testing.T) {
+	llm := &fakeLLM{reply: "你好"}
+	agent, _ := newTestAgent(&AIServices{LLM: llm})
+	agent.budget = newTokenBudget(10, time.Hour)
+	agent.budget.Add(10)
+
+	reply := agent.generateReply(t.Context(), nil, "user", "你好", "zh", discardReply{})
+	if reply != budgetExceededReply {
+		t.Errorf("reply = %q, want the budget reply", reply)
+	}
+	if llm.Calls() != 0 {
+		t.Errorf("LLM called %d times after the budget was exceeded", llm.Calls())
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import "time"
+
+// EventHandler 处理代理发出的事件。回调在发出事件的协程中同步调用，不同参与者的事件可能并发回调，
+// 回调应尽快返回，耗时的处理需要自行转到其他协程
+type EventHandler func(AgentEvent)
+
+// TranscriptEvent 是参与者一段发言的转录结果或一条文字消息
+type TranscriptEvent struct {
+	ParticipantIdentity string
+	Text                string
+	Timestamp           time.Time
+}
+
+// ResponseEvent 是代理对参与者的回复
+type ResponseEvent struct {
+	ParticipantIdentity string
+	Text                string
+	Timestamp           time.Time
+}
+
+// ErrorEvent 是处理参与者的音频或对话时发生的错误，与参与者无关的错误 ParticipantIdentity 为空
+type ErrorEvent struct {
+	ParticipantIdentity string
+	Err                 error
+	Timestamp           time.Time
+}
+
+// TurnCompleteEvent 表示参与者的一轮对话处理完毕，没有产生费用时 Cost 为 nil
+type TurnCompleteEvent struct {
+	ParticipantIdentity string
+	Cost                *TurnCost
+	Timestamp           time.Time
+}
+
+// On 注册 eventType 事件的回调，同一事件可以注册多个回调，按注册顺序调用。
+// 回调与 Events 通道互不影响，通道已满时回调仍会收到事件
+func (a *AIAgent) On(eventType AgentEventType, handler EventHandler) {
+	if handler == nil {
+		return
+	}
+	a.handlersMu.Lock()
+	defer a.handlersMu.Unlock()
+
+	if a.handlers == nil {
+		a.handlers = make(map[AgentEventType][]EventHandler)
+	}
+	a.handlers[eventType] = append(a.handlers[eventType], handler)
+}
+
+// OnTranscript 注册转录结果和文字消息的回调
+func (a *AIAgent) OnTranscript(handler func(TranscriptEvent)) {
+	a.On(EventTranscriptReceived, func(event AgentEvent) {
+		handler(TranscriptEvent{ParticipantIdentity: event.ParticipantIdentity, Text: event.Text, Timestamp: event.Timestamp})
+	})
+}
+
+// OnResponse 注册代理回复的回调
+func (a *AIAgent) OnResponse(handler func(ResponseEvent)) {
+	a.On(EventResponseGenerated, func(event AgentEvent) {
+		handler(ResponseEvent{ParticipantIdentity: event.ParticipantIdentity, Text: event.Text, Timestamp: event.Timestamp})
+	})
+}
+
+// OnError 注册错误的回调
+func (a *AIAgent) OnError(handler func(ErrorEvent)) {
+	a.On(EventError, func(event AgentEvent) {
+		handler(ErrorEvent{ParticipantIdentity: event.ParticipantIdentity, Err: event.Err, Timestamp: event.Timestamp})
+	})
+}
+
+// OnTurnComplete 注册一轮对话结束的回调
+func (a *AIAgent) OnTurnComplete(handler func(TurnCompleteEvent)) {
+	a.On(EventTurnComplete, func(event AgentEvent) {
+		handler(TurnCompleteEvent{ParticipantIdentity: event.ParticipantIdentity, Cost: event.Cost, Timestamp: event.Timestamp})
+	})
+}
+
+// dispatch 按注册顺序调用事件的回调，回调中的 panic 只记录日志，不影响音频处理和其他回调
+func (a *AIAgent) dispatch(event AgentEvent) {
+	a.handlersMu.RLock()
+	handlers := a.handlers[event.Type]
+	a.handlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		a.callHandler(handler, event)
+	}
+}
+
+func (a *AIAgent) callHandler(handler EventHandler, event AgentEvent) {
+	defer a.recoverPanic(string(event.Type) + " 事件的回调")
+	handler(event)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestOnCallsHandlersInRegistrationOrder(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	var order []int
+	agent.On(EventWakeWord, func(AgentEvent) { order = append(order, 1) })
+	agent.On(EventWakeWord, func(AgentEvent) { panic("handler failed") })
+	agent.On(EventWakeWord, func(AgentEvent) { order = append(order, 3) })
+	agent.On(EventBargeIn, func(AgentEvent) { order = append(order, 4) })
+
+	agent.emit(AgentEvent{Type: EventWakeWord})
+	if len(order) != 2 || order[0] != 1 || order[1] != 3 {
+		t.Fatalf("handlers called in order %v, want [1 3]", order)
+	}
+}
+
+func TestTypedCallbacksReceiveTurnLifecycle(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{LLM: &fakeLLM{reply: "你好，有什么可以帮你？"}, TTS: &fakeTTS{}})
+	var (
+		mu          sync.Mutex
+		transcripts []TranscriptEvent
+		responses   []ResponseEvent
+		completed   []TurnCompleteEvent
+		failures    []ErrorEvent
+	)
+	agent.OnTranscript(func(event TranscriptEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		transcripts = append(transcripts, event)
+	})
+	agent.OnResponse(func(event ResponseEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		responses = append(responses, event)
+	})
+	agent.OnTurnComplete(func(event TurnCompleteEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		completed = append(completed, event)
+	})
+	agent.OnError(func(event ErrorEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = append(failures, event)
+	})
+
+	agent.enqueueTurn(&lksdk.RemoteParticipant{}, turnRequest{ctx: agent.ctx, text: "你好"})
+	agent.turns.Wait()
+	agent.emitError("alice", errors.New("识别失败"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(transcripts) != 1 || transcripts[0].Text != "你好" || transcripts[0].Timestamp.IsZero() {
+		t.Errorf("transcripts = %+v", transcripts)
+	}
+	if len(responses) != 1 || responses[0].Text != "你好，有什么可以帮你？" {
+		t.Errorf("responses = %+v", responses)
+	}
+	if len(completed) != 1 || completed[0].Cost != nil {
+		t.Errorf("completed turns = %+v, want one without cost", completed)
+	}
+	if len(failures) != 1 || failures[0].ParticipantIdentity != "alice" || failures[0].Err == nil {
+		t.Errorf("errors = %+v", failures)
+	}
+}
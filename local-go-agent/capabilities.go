@@ -0,0 +1,54 @@
+package main
+
+// Capabilities 表示哪些AI服务可用。没有语音识别时代理进入纯文字模式，不订阅音频轨道，
+// 只通过数据通道收发文字消息
+type Capabilities struct {
+	STT bool `json:"stt"`
+	LLM bool `json:"llm"`
+	TTS bool `json:"tts"`
+}
+
+func (s *AIServices) Capabilities() Capabilities {
+	return Capabilities{
+		STT: s.STT != nil,
+		LLM: s.LLM != nil,
+		TTS: s.TTS != nil,
+	}
+}
+
+func (a *AIAgent) Capabilities() Capabilities {
+	return Capabilities{
+		STT: a.stt != nil,
+		LLM: a.llm != nil,
+		TTS: a.tts != nil,
+	}
+}
+
+// TextOnly 表示无法识别语音，只能处理文字消息
+func (c Capabilities) TextOnly() bool {
+	return !c.STT
+}
+
+// logCapabilities 在加入房间时说明缺少的服务，避免每轮对话重复提示
+func (a *AIAgent) logCapabilities() {
+	if !a.config.LiveKit.Publish {
+		a.logger.Info("不发布语音轨道：回复只以文字发送")
+	}
+	if !a.config.LiveKit.Subscribe {
+		a.logger.Info("不订阅轨道：只处理数据通道中的文字消息")
+	}
+	if mode := a.config.Echo.Mode; mode != EchoModeOff {
+		a.logger.Warnf("回声模式 (%s)：不调用语音识别和语言模型，只用于测试连接和音频收发", mode)
+		return
+	}
+	capabilities := a.Capabilities()
+	if capabilities.TextOnly() {
+		a.logger.Warn("语音识别服务不可用，进入纯文字模式：不订阅音频轨道，只处理数据通道中的文字消息")
+	}
+	if !capabilities.LLM {
+		a.logger.Warn("语言模型服务不可用，所有回复都将使用默认文案")
+	}
+	if !capabilities.TTS {
+		a.logger.Warn("语音合成服务不可用，回复只以文字发送")
+	}
+}
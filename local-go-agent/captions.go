@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// 字幕消息发布到的数据通道主题
+const captionTopic = "captions"
+
+// 同一段字幕的中间结果默认最短的发布间隔
+const defaultCaptionInterimInterval = 250 * time.Millisecond
+
+const (
+	captionTypeTranscript = "transcript"
+	captionTypeResponse   = "response"
+)
+
+// CaptionMessage 是发布给客户端渲染实时字幕的数据消息，JSON格式:
+//
+//	{"type":"transcript"|"response","identity":"...","text":"...","final":true}
+//
+// type 为 transcript 时 text 是参与者说的话，为 response 时是助手的回复；
+// identity 都是这一轮对话所属参与者的身份。final 为 false 的中间结果会被
+// 同一轮后续的消息替换，通过不可靠通道发送，可能丢失；最终结果通过可靠通道发送。
+type CaptionMessage struct {
+	Type     string `json:"type"`
+	Identity string `json:"identity"`
+	Text     string `json:"text"`
+	Final    bool   `json:"final"`
+}
+
+// CaptionsConfig 是实时字幕的发布设置
+type CaptionsConfig struct {
+	// 同一参与者同一类字幕的中间结果最短的发布间隔，间隔内的更新合并为最新的一条，0 表示每次更新都发布
+	InterimInterval time.Duration `yaml:"interim_interval"`
+}
+
+// publishCaption 发布一条字幕，中间结果按 captions.interim_interval 节流，最终结果立即发布
+func (a *AIAgent) publishCaption(captionType, identity, text string, final bool) {
+	a.captions.Publish(CaptionMessage{
+		Type:     captionType,
+		Identity: identity,
+		Text:     text,
+		Final:    final,
+	})
+}
+
+// sendCaption 通过数据通道发送一条字幕
+func (a *AIAgent) sendCaption(caption CaptionMessage) {
+	final := caption.Final
+	payload, err := json.Marshal(caption)
+	if err != nil {
+		a.logger.Errorf("序列化字幕消息失败: %v", err)
+		return
+	}
+
+	packet := &lksdk.UserDataPacket{Payload: payload, Topic: captionTopic}
+	if err := a.publisher.PublishDataPacket(packet, lksdk.WithDataPublishReliable(final)); err != nil {
+		a.logger.Errorf("发送字幕消息失败: %v", err)
+	}
+}
+
+// captionKey 区分需要分别节流的字幕：每个参与者的转录和回复各自是一段字幕
+type captionKey struct {
+	captionType string
+	identity    string
+}
+
+// captionStream 是一段字幕的节流状态
+type captionStream struct {
+	// 上次发布中间结果的时间
+	last time.Time
+	// 间隔内还没发布的最新中间结果，定时器到期时发布
+	pending *CaptionMessage
+	timer   *time.Timer
+}
+
+// captionThrottle 限制中间字幕的发布频率。距上次发布不足 interval 的中间结果只保留最新的一条，
+// 间隔到期后再发布；最终结果立即发布，并丢弃这段字幕还没发布的中间结果
+type captionThrottle struct {
+	interval time.Duration
+	send     func(CaptionMessage)
+
+	// 发送也在锁内进行，保证最终结果之后不会再发出同一段字幕的中间结果
+	mu      sync.Mutex
+	streams map[captionKey]*captionStream
+	stopped bool
+}
+
+func newCaptionThrottle(interval time.Duration, send func(CaptionMessage)) *captionThrottle {
+	return &captionThrottle{
+		interval: interval,
+		send:     send,
+		streams:  make(map[captionKey]*captionStream),
+	}
+}
+
+// Publish 发布或暂存一条字幕
+func (t *captionThrottle) Publish(caption CaptionMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped {
+		return
+	}
+	key := captionKey{captionType: caption.Type, identity: caption.Identity}
+	if caption.Final || t.interval <= 0 {
+		if stream, ok := t.streams[key]; ok {
+			if stream.timer != nil {
+				stream.timer.Stop()
+			}
+			delete(t.streams, key)
+		}
+		t.send(caption)
+		return
+	}
+
+	stream, ok := t.streams[key]
+	if !ok {
+		stream = &captionStream{}
+		t.streams[key] = stream
+	}
+	now := time.Now()
+	if stream.timer == nil && now.Sub(stream.last) >= t.interval {
+		stream.last = now
+		t.send(caption)
+		return
+	}
+	stream.pending = &caption
+	if stream.timer == nil {
+		stream.timer = time.AfterFunc(stream.last.Add(t.interval).Sub(now), func() { t.flush(key, stream) })
+	}
+}
+
+// flush 在间隔到期后发布暂存的中间结果，这段字幕已经结束时不再发布
+func (t *captionThrottle) flush(key captionKey, stream *captionStream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped || t.streams[key] != stream || stream.pending == nil {
+		return
+	}
+	caption := *stream.pending
+	stream.pending = nil
+	stream.timer = nil
+	stream.last = time.Now()
+	t.send(caption)
+}
+
+// Stop 丢弃所有暂存的中间结果，之后不再发布字幕
+func (t *captionThrottle) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stopped = true
+	for key, stream := range t.streams {
+		if stream.timer != nil {
+			stream.timer.Stop()
+		}
+		delete(t.streams, key)
+	}
+}
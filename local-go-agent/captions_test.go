@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordedCaptions 记录节流后实际发送的字幕
+type recordedCaptions struct {
+	mu       sync.Mutex
+	captions []CaptionMessage
+}
+
+func (r *recordedCaptions) send(caption CaptionMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.captions = append(r.captions, caption)
+}
+
+func (r *recordedCaptions) Captions() []CaptionMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]CaptionMessage(nil), r.captions...)
+}
+
+func TestCaptionThrottleLimitsInterimFrequency(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	recorded := &recordedCaptions{}
+	throttle := newCaptionThrottle(interval, recorded.send)
+	defer throttle.Stop()
+
+	// 500ms 内每5ms更新一次中间结果，共100次
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		throttle.Publish(CaptionMessage{Type: captionTypeTranscript, Identity: "alice", Text: fmt.Sprint(i)})
+		time.Sleep(5 * time.Millisecond)
+	}
+	elapsed := time.Since(start)
+	throttle.Publish(CaptionMessage{Type: captionTypeTranscript, Identity: "alice", Text: "final", Final: true})
+
+	captions := recorded.Captions()
+	interims := len(captions) - 1
+	if limit := int(elapsed/interval) + 1; interims > limit || interims < limit/2 {
+		t.Errorf("published %d interim captions in %v, want at most %d and no fewer than %d", interims, elapsed, limit, limit/2)
+	}
+	if last := captions[len(captions)-1]; !last.Final || last.Text != "final" {
+		t.Errorf("last caption = %+v, want the final caption", last)
+	}
+
+	// 最终结果之后不再发出被节流的中间结果
+	time.Sleep(2 * interval)
+	if got := len(recorded.Captions()); got != len(captions) {
+		t.Errorf("%d captions published after the final caption", got-len(captions))
+	}
+}
+
+func TestCaptionThrottleCoalescesToLatest(t *testing.T) {
+	const interval = 30 * time.Millisecond
+	recorded := &recordedCaptions{}
+	throttle := newCaptionThrottle(interval, recorded.send)
+	defer throttle.Stop()
+
+	for _, text := range []string{"你", "你好", "你好世"} {
+		throttle.Publish(CaptionMessage{Type: captionTypeTranscript, Identity: "alice", Text: text})
+	}
+	// 另一位参与者的字幕单独节流
+	throttle.Publish(CaptionMessage{Type: captionTypeTranscript, Identity: "bob", Text: "hi"})
+	time.Sleep(3 * interval)
+
+	var texts []string
+	for _, caption := range recorded.Captions() {
+		texts = append(texts, caption.Identity+":"+caption.Text)
+	}
+	if want := []string{"alice:你", "bob:hi", "alice:你好世"}; fmt.Sprint(texts) != fmt.Sprint(want) {
+		t.Errorf("published %v, want %v", texts, want)
+	}
+}
+
+func TestPublishCaptionWithoutThrottle(t *testing.T) {
+	agent, publisher := newTestAgent(&AIServices{})
+	agent.captions = newCaptionThrottle(0, agent.sendCaption)
+
+	for _, text := range []string{"a", "ab", "abc"} {
+		agent.publishCaption(captionTypeResponse, "alice", text, false)
+	}
+	if got := len(publisher.Captions()); got != 3 {
+		t.Errorf("published %d captions with interim_interval 0, want 3", got)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Cartesia 情绪控制支持的情绪和强度，写法为 "情绪" 或 "情绪:强度"
+var (
+	cartesiaEmotions      = map[string]bool{"anger": true, "positivity": true, "surprise": true, "sadness": true, "curiosity": true}
+	cartesiaEmotionLevels = map[string]bool{"lowest": true, "low": true, "high": true, "highest": true}
+)
+
+// speechMarkupPattern 匹配类SSML的语音标记。只匹配已知的标签，文本中普通的尖括号不受影响
+var speechMarkupPattern = regexp.MustCompile(`(?i)</?(?:speak|break|speed|volume|emotion|prosody|emphasis|spell|say-as|phoneme|sub)\b[^>]*>`)
+
+// 流式文本中等待标记闭合的最大长度，超过时视为普通文本
+const maxPendingMarkup = 64
+
+// cartesiaModelFeatures 是模型支持的韵律控制
+type cartesiaModelFeatures struct {
+	// 支持通过 voice.__experimental_controls 设置语速和情绪
+	controls bool
+	// 支持在文本中直接使用 <break>、<speed>、<emotion> 等类SSML标记
+	markup bool
+}
+
+func cartesiaFeatures(modelID string) cartesiaModelFeatures {
+	switch {
+	case strings.HasPrefix(modelID, "sonic-3"):
+		return cartesiaModelFeatures{markup: true}
+	case modelID == "sonic", strings.HasPrefix(modelID, "sonic-english"), strings.HasPrefix(modelID, "sonic-multilingual"),
+		strings.HasPrefix(modelID, "sonic-2"), strings.HasPrefix(modelID, "sonic-turbo"):
+		return cartesiaModelFeatures{controls: true}
+	default:
+		return cartesiaModelFeatures{}
+	}
+}
+
+// validProsody 去掉无效的语速和情绪，语速超出 -1 到 1 时按正常语速处理
+func validProsody(speed float64, emotions []string) (float64, []string) {
+	if speed < -1 || speed > 1 {
+		speed = 0
+	}
+	var valid []string
+	for _, emotion := range emotions {
+		name, level, hasLevel := strings.Cut(emotion, ":")
+		if cartesiaEmotions[name] && (!hasLevel || cartesiaEmotionLevels[level]) {
+			valid = append(valid, emotion)
+		}
+	}
+	return speed, valid
+}
+
+// prosodyControls 生成语速和情绪控制。模型不支持或参数无效时忽略，没有可用的控制时返回 nil
+func prosodyControls(modelID string, speed float64, emotions []string) map[string]interface{} {
+	if !cartesiaFeatures(modelID).controls {
+		return nil
+	}
+	speed, emotions = validProsody(speed, emotions)
+
+	controls := map[string]interface{}{}
+	if speed != 0 {
+		controls["speed"] = speed
+	}
+	if len(emotions) > 0 {
+		controls["emotion"] = emotions
+	}
+	if len(controls) == 0 {
+		return nil
+	}
+	return controls
+}
+
+// stripSpeechMarkup 去掉文本中的语音标记，用于不支持标记的模型
+func stripSpeechMarkup(text string) string {
+	return speechMarkupPattern.ReplaceAllString(text, "")
+}
+
+// markupFilter 在流式发送的文本中去掉语音标记，被拆到两段文本中的标记会等到闭合后再处理
+type markupFilter struct {
+	pending string
+}
+
+func (f *markupFilter) Push(chunk string) string {
+	text := f.pending + chunk
+	f.pending = ""
+	if i := strings.LastIndex(text, "<"); i >= 0 && !strings.Contains(text[i:], ">") && len(text)-i <= maxPendingMarkup {
+		f.pending = text[i:]
+		text = text[:i]
+	}
+	return stripSpeechMarkup(text)
+}
+
+// Flush 返回剩余的未闭合文本，它不是完整的标记，按普通文本处理
+func (f *markupFilter) Flush() string {
+	rest := f.pending
+	f.pending = ""
+	return rest
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProsodyControls(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		speed    float64
+		emotions []string
+		want     map[string]interface{}
+	}{
+		{
+			name:     "supported model",
+			model:    "sonic-english",
+			speed:    0.5,
+			emotions: []string{"positivity:high", "curiosity"},
+			want:     map[string]interface{}{"speed": 0.5, "emotion": []string{"positivity:high", "curiosity"}},
+		},
+		{
+			name:     "invalid values dropped",
+			model:    "sonic-2",
+			speed:    3,
+			emotions: []string{"joy", "sadness:extreme", "surprise:low"},
+			want:     map[string]interface{}{"emotion": []string{"surprise:low"}},
+		},
+		{name: "unsupported model", model: "sonic-3", speed: 0.5, emotions: []string{"anger"}},
+		{name: "nothing to set", model: "sonic-english"},
+	}
+
+	for _, tt := range tests {
+		got := prosodyControls(tt.model, tt.speed, tt.emotions)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: prosodyControls = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSpeechRequestMarkup(t *testing.T) {
+	service := NewCartesiaServiceFromConfig(CartesiaConfig{APIKey: "key", ModelID: "sonic-english"})
+	request := service.speechRequest(`Hello<break time="500ms"/> there, 1 < 2`, SpeechOptions{Speed: -0.5})
+	if request.Transcript != "Hello there, 1 < 2" {
+		t.Errorf("transcript = %q, markup not stripped", request.Transcript)
+	}
+	if controls, ok := request.Voice["__experimental_controls"].(map[string]interface{}); !ok || controls["speed"] != -0.5 {
+		t.Errorf("voice = %v, want speed control", request.Voice)
+	}
+
+	service.modelID = "sonic-3"
+	request = service.speechRequest(`Hello<break time="500ms"/>`, SpeechOptions{Speed: -0.5})
+	if request.Transcript != `Hello<break time="500ms"/>` {
+		t.Errorf("transcript = %q, markup should pass through", request.Transcript)
+	}
+	if _, ok := request.Voice["__experimental_controls"]; ok {
+		t.Errorf("controls sent to a model without control support")
+	}
+}
+
+func TestMarkupFilterSplitTag(t *testing.T) {
+	var filter markupFilter
+	var got string
+	for _, chunk := range []string{"Wait", `<break ti`, `me="1s"/> ok <`, "3"} {
+		got += filter.Push(chunk)
+	}
+	got += filter.Flush()
+	if got != "Wait ok <3" {
+		t.Errorf("filtered = %q, want %q", got, "Wait ok <3")
+	}
+}
@@ -11,89 +11,158 @@ import (
 )
 
 type CartesiaService struct {
-	apiKey  string
-	baseURL string
-	client  *http.Client
+	apiKey     string
+	baseURL    string
+	client     *http.Client
+	modelID    string
+	voiceID    string
+	sampleRate int
+	// 非英语文本使用的多语言模型
+	multilingualModelID string
+	// 默认语速和情绪，单次合成的 SpeechOptions 可以覆盖
+	speed    float64
+	emotions []string
+
+	// 记录请求和响应，未开启调试时为 nil
+	debug *apiDebugger
 }
 
 type CartesiaRequest struct {
-	ModelID    string                 `json:"model_id"`
-	Transcript string                 `json:"transcript"`
-	Voice      map[string]interface{} `json:"voice"`
+	ModelID      string                 `json:"model_id"`
+	Transcript   string                 `json:"transcript"`
+	Voice        map[string]interface{} `json:"voice"`
 	OutputFormat map[string]interface{} `json:"output_format"`
+	Language     string                 `json:"language,omitempty"`
 }
 
 func NewCartesiaService(apiKey string) *CartesiaService {
 	return &CartesiaService{
-		apiKey:  apiKey,
-		baseURL: "https://api.cartesia.ai",
-		client:  &http.Client{},
+		apiKey:              apiKey,
+		baseURL:             "https://api.cartesia.ai",
+		client:              &http.Client{},
+		modelID:             "sonic-english",
+		voiceID:             "a0e99841-438c-4a64-b679-ae501e7d6091",
+		sampleRate:          22050,
+		multilingualModelID: "sonic-multilingual",
 	}
 }
 
-func (s *CartesiaService) TextToSpeech(ctx context.Context, text string) ([]byte, error) {
-	log.Printf("正在使用Cartesia将文字转换为语音: %s", text)
-	
-	// 构建请求数据
-	requestData := CartesiaRequest{
-		ModelID:    "sonic-english", // 使用Sonic模型
-		Transcript: text,
-		Voice: map[string]interface{}{
-			"mode": "id",
-			"id":   "a0e99841-438c-4a64-b679-ae501e7d6091", // 默认声音ID
-		},
-		OutputFormat: map[string]interface{}{
-			"container":   "raw",
-			"encoding":    "pcm_f32le",
-			"sample_rate": 22050,
-		},
+// setDebugger 开启请求和响应的调试日志，debugger 为 nil 时不做改变
+func (s *CartesiaService) setDebugger(debugger *apiDebugger) {
+	if debugger == nil {
+		return
 	}
-	
-	jsonData, err := json.Marshal(requestData)
-	if err != nil {
-		return nil, fmt.Errorf("序列化请求数据失败: %v", err)
+	s.debug = debugger
+	s.client = debugger.httpClient()
+}
+
+func NewCartesiaServiceFromConfig(cfg CartesiaConfig) *CartesiaService {
+	service := NewCartesiaService(cfg.APIKey)
+	if cfg.ModelID != "" {
+		service.modelID = cfg.ModelID
 	}
-	
-	// 创建HTTP请求
-	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/tts/bytes", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("创建HTTP请求失败: %v", err)
+	if cfg.VoiceID != "" {
+		service.voiceID = cfg.VoiceID
 	}
-	
-	// 设置请求头
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", s.apiKey)
-	req.Header.Set("Cartesia-Version", "2024-06-10")
-	
-	// 发送请求
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("发送HTTP请求失败: %v", err)
+	if cfg.SampleRate > 0 {
+		service.sampleRate = cfg.SampleRate
 	}
-	defer resp.Body.Close()
-	
-	// 检查响应状态
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Cartesia API返回错误状态 %d: %s", resp.StatusCode, string(body))
+	if cfg.MultilingualModelID != "" {
+		service.multilingualModelID = cfg.MultilingualModelID
 	}
-	
-	// 读取音频数据
-	audioData, err := io.ReadAll(resp.Body)
+
+	service.speed, service.emotions = validProsody(cfg.Speed, cfg.Emotions)
+	if service.speed != cfg.Speed || len(service.emotions) != len(cfg.Emotions) {
+		log.Printf("Cartesia的语速或情绪配置无效，已忽略无效的部分: speed=%v emotions=%v", cfg.Speed, cfg.Emotions)
+	}
+	if service.speed != 0 || len(service.emotions) > 0 {
+		for _, model := range []string{service.modelID, service.multilingualModelID} {
+			if !cartesiaFeatures(model).controls {
+				log.Printf("Cartesia模型 %s 不支持语速和情绪控制，使用该模型时忽略", model)
+			}
+		}
+	}
+	return service
+}
+
+// SampleRate 返回合成音频（pcm_f32le 单声道）的采样率
+func (s *CartesiaService) SampleRate() int {
+	return s.sampleRate
+}
+
+// Synthesize 实现 TextToSpeech，返回的音频流直接来自HTTP响应体
+func (s *CartesiaService) Synthesize(ctx context.Context, text string) (io.ReadCloser, AudioFormat, error) {
+	return s.SynthesizeWithOptions(ctx, text, SpeechOptions{})
+}
+
+func (s *CartesiaService) SynthesizeWithOptions(ctx context.Context, text string, opts SpeechOptions) (io.ReadCloser, AudioFormat, error) {
+	log.Printf("正在使用Cartesia将文字转换为语音 (语言: %s): %s", opts.Language, text)
+
+	body, err := s.open(ctx, s.speechRequest(text, opts))
 	if err != nil {
-		return nil, fmt.Errorf("读取音频数据失败: %v", err)
+		return nil, AudioFormat{}, err
 	}
-	
-	log.Printf("Cartesia文字转语音完成，音频数据大小: %d bytes", len(audioData))
-	return audioData, nil
+	return body, s.format(), nil
+}
+
+func (s *CartesiaService) format() AudioFormat {
+	return AudioFormat{SampleRate: s.sampleRate, Channels: 1, Encoding: AudioEncodingPCMF32LE}
+}
+
+func (s *CartesiaService) TextToSpeech(ctx context.Context, text string) ([]byte, error) {
+	return s.TextToSpeechWithLanguage(ctx, text, "")
+}
+
+// TextToSpeechWithLanguage 按语言选择模型，language 为空或英语时使用默认模型，其他语言使用多语言模型
+func (s *CartesiaService) TextToSpeechWithLanguage(ctx context.Context, text string, language string) ([]byte, error) {
+	log.Printf("正在使用Cartesia将文字转换为语音 (语言: %s): %s", language, text)
+
+	return s.synthesize(ctx, s.languageRequest(text, language))
+}
+
+// languageRequest 按语言选择模型，language 为空或英语时使用默认模型，其他语言使用多语言模型
+func (s *CartesiaService) languageRequest(text, language string) CartesiaRequest {
+	requestData := s.newRequest(text, s.voiceID)
+	if language != "" && language != "en" {
+		requestData.ModelID = s.multilingualModelID
+		requestData.Language = language
+	}
+	return requestData
+}
+
+// speechRequest 按选项生成合成请求：选择模型和声音，设置模型支持的语速和情绪，
+// 不支持语音标记的模型去掉文本中的标记
+func (s *CartesiaService) speechRequest(text string, opts SpeechOptions) CartesiaRequest {
+	request := s.languageRequest(text, opts.Language)
+	if opts.Voice != "" {
+		request.Voice["id"] = opts.Voice
+	}
+
+	speed, emotions := opts.Speed, opts.Emotions
+	if speed == 0 {
+		speed = s.speed
+	}
+	if emotions == nil {
+		emotions = s.emotions
+	}
+	if controls := prosodyControls(request.ModelID, speed, emotions); controls != nil {
+		request.Voice["__experimental_controls"] = controls
+	}
+	if !cartesiaFeatures(request.ModelID).markup {
+		request.Transcript = stripSpeechMarkup(request.Transcript)
+	}
+	return request
 }
 
 func (s *CartesiaService) TextToSpeechWithVoice(ctx context.Context, text string, voiceID string) ([]byte, error) {
 	log.Printf("正在使用Cartesia将文字转换为语音，声音ID: %s, 文字: %s", voiceID, text)
-	
-	// 构建请求数据
-	requestData := CartesiaRequest{
-		ModelID:    "sonic-english",
+
+	return s.synthesize(ctx, s.newRequest(text, voiceID))
+}
+
+func (s *CartesiaService) newRequest(text string, voiceID string) CartesiaRequest {
+	return CartesiaRequest{
+		ModelID:    s.modelID, // 使用Sonic模型
 		Transcript: text,
 		Voice: map[string]interface{}{
 			"mode": "id",
@@ -102,45 +171,78 @@ func (s *CartesiaService) TextToSpeechWithVoice(ctx context.Context, text string
 		OutputFormat: map[string]interface{}{
 			"container":   "raw",
 			"encoding":    "pcm_f32le",
-			"sample_rate": 22050,
+			"sample_rate": s.sampleRate,
 		},
 	}
-	
+}
+
+func (s *CartesiaService) synthesize(ctx context.Context, requestData CartesiaRequest) ([]byte, error) {
+	body, err := s.open(ctx, requestData)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	// 读取音频数据
+	audioData, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("读取音频数据失败: %v", err)
+	}
+
+	log.Printf("Cartesia文字转语音完成，音频数据大小: %d bytes", len(audioData))
+	return audioData, nil
+}
+
+// open 发送合成请求，返回音频数据的响应体，由调用方关闭
+func (s *CartesiaService) open(ctx context.Context, requestData CartesiaRequest) (io.ReadCloser, error) {
 	jsonData, err := json.Marshal(requestData)
 	if err != nil {
 		return nil, fmt.Errorf("序列化请求数据失败: %v", err)
 	}
-	
+
 	// 创建HTTP请求
 	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/tts/bytes", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("创建HTTP请求失败: %v", err)
 	}
-	
+
 	// 设置请求头
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-API-Key", s.apiKey)
 	req.Header.Set("Cartesia-Version", "2024-06-10")
-	
+
 	// 发送请求
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("发送HTTP请求失败: %v", err)
+		return nil, classifyServiceError("Cartesia", 0, fmt.Errorf("发送HTTP请求失败: %w", err))
 	}
-	defer resp.Body.Close()
-	
+
 	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Cartesia API返回错误状态 %d: %s", resp.StatusCode, string(body))
+		return nil, classifyServiceError("Cartesia", resp.StatusCode, fmt.Errorf("Cartesia API返回错误状态 %d: %s", resp.StatusCode, string(body)))
 	}
-	
-	// 读取音频数据
-	audioData, err := io.ReadAll(resp.Body)
+	return resp.Body, nil
+}
+
+// Preflight 列出声音，检查API密钥和网络是否可用，不产生合成费用
+func (s *CartesiaService) Preflight(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/voices", nil)
 	if err != nil {
-		return nil, fmt.Errorf("读取音频数据失败: %v", err)
+		return fmt.Errorf("创建HTTP请求失败: %v", err)
 	}
-	
-	log.Printf("Cartesia文字转语音完成，音频数据大小: %d bytes", len(audioData))
-	return audioData, nil
-}
\ No newline at end of file
+	req.Header.Set("X-API-Key", s.apiKey)
+	req.Header.Set("Cartesia-Version", "2024-06-10")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return classifyServiceError("Cartesia", 0, fmt.Errorf("发送HTTP请求失败: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return classifyServiceError("Cartesia", resp.StatusCode, fmt.Errorf("Cartesia API返回错误状态 %d: %s", resp.StatusCode, string(body)))
+	}
+	return nil
+}
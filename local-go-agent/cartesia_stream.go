@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// 流式会话缓冲的音频帧数量，播放跟不上时接收方会等待
+const cartesiaFrameQueueSize = 64
+
+// cartesiaStreamRequest 是websocket接口的合成请求，同一 context_id 的请求会接续合成，
+// continue 为 false 表示文本已全部发送
+type cartesiaStreamRequest struct {
+	CartesiaRequest
+	ContextID string `json:"context_id"`
+	Continue  bool   `json:"continue"`
+}
+
+type cartesiaStreamResponse struct {
+	Type      string `json:"type"`
+	Data      string `json:"data"`
+	Done      bool   `json:"done"`
+	Error     string `json:"error"`
+	ContextID string `json:"context_id"`
+}
+
+// CartesiaStreamSession 是Cartesia websocket接口上的一次流式合成，实现 SpeechStream
+type CartesiaStreamSession struct {
+	conn    *websocket.Conn
+	request cartesiaStreamRequest
+	// 模型不支持语音标记时去掉文本中的标记，为 nil 时原样发送
+	filter *markupFilter
+	format AudioFormat
+	frames chan []float32
+	// 记录发送的消息，未开启调试时为 nil
+	debug *apiDebugger
+
+	writeMu sync.Mutex
+	closed  chan struct{}
+	once    sync.Once
+
+	// 由接收协程写入，frames 关闭后读取
+	err error
+}
+
+// StreamSession 建立websocket连接，ctx 取消时会话随之关闭
+func (s *CartesiaService) StreamSession(ctx context.Context, opts SpeechOptions) (SpeechStream, error) {
+	endpoint, err := s.websocketURL()
+	if err != nil {
+		return nil, err
+	}
+	s.debug.logDial(endpoint)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		if resp != nil {
+			return nil, classifyServiceError("Cartesia", resp.StatusCode, fmt.Errorf("连接Cartesia websocket失败，状态 %d: %w", resp.StatusCode, err))
+		}
+		return nil, classifyServiceError("Cartesia", 0, fmt.Errorf("连接Cartesia websocket失败: %w", err))
+	}
+
+	request := s.speechRequest("", opts)
+	var filter *markupFilter
+	if !cartesiaFeatures(request.ModelID).markup {
+		filter = &markupFilter{}
+	}
+	session := &CartesiaStreamSession{
+		conn: conn,
+		request: cartesiaStreamRequest{
+			CartesiaRequest: request,
+			ContextID:       newTurnID(),
+		},
+		filter: filter,
+		format: s.format(),
+		frames: make(chan []float32, cartesiaFrameQueueSize),
+		debug:  s.debug,
+		closed: make(chan struct{}),
+	}
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	started := goTracked(ctx, func() {
+		defer stop()
+		session.receive(ctx)
+	})
+	if !started {
+		stop()
+		conn.Close()
+		return nil, errSupervisorClosed
+	}
+	return session, nil
+}
+
+// websocketURL 由HTTP接口地址换算websocket地址，认证信息通过查询参数传递
+func (s *CartesiaService) websocketURL() (string, error) {
+	endpoint, err := url.Parse(s.baseURL + "/tts/websocket")
+	if err != nil {
+		return "", fmt.Errorf("Cartesia地址错误: %v", err)
+	}
+	endpoint.Scheme = strings.Replace(endpoint.Scheme, "http", "ws", 1)
+	query := endpoint.Query()
+	query.Set("api_key", s.apiKey)
+	query.Set("cartesia_version", "2024-06-10")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+func (c *CartesiaStreamSession) SendText(chunk string) error {
+	if c.filter != nil {
+		chunk = c.filter.Push(chunk)
+	}
+	if chunk == "" {
+		return nil
+	}
+	return c.send(chunk, true)
+}
+
+func (c *CartesiaStreamSession) CloseSend() error {
+	if c.filter != nil {
+		if rest := c.filter.Flush(); rest != "" {
+			if err := c.send(rest, true); err != nil {
+				return err
+			}
+		}
+	}
+	return c.send("", false)
+}
+
+func (c *CartesiaStreamSession) send(transcript string, more bool) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	request := c.request
+	request.Transcript = transcript
+	request.Continue = more
+	c.debug.logMessage(request)
+	if err := c.conn.WriteJSON(request); err != nil {
+		return fmt.Errorf("发送合成文本失败: %v", err)
+	}
+	return nil
+}
+
+func (c *CartesiaStreamSession) Frames() <-chan []float32 {
+	return c.frames
+}
+
+func (c *CartesiaStreamSession) Format() AudioFormat {
+	return c.format
+}
+
+func (c *CartesiaStreamSession) Err() error {
+	return c.err
+}
+
+func (c *CartesiaStreamSession) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// receive 读取合成结果直到收到 done、出错或会话被关闭
+func (c *CartesiaStreamSession) receive(ctx context.Context) {
+	defer close(c.frames)
+	defer c.Close()
+
+	// base64 分块不保证按采样对齐，不足一个采样的字节留到下一块
+	var remainder []byte
+	for {
+		var resp cartesiaStreamResponse
+		if err := c.conn.ReadJSON(&resp); err != nil {
+			c.err = c.closeError(ctx, err)
+			return
+		}
+		if resp.ContextID != "" && resp.ContextID != c.request.ContextID {
+			continue
+		}
+
+		switch resp.Type {
+		case "chunk":
+			data, err := base64.StdEncoding.DecodeString(resp.Data)
+			if err != nil {
+				c.err = fmt.Errorf("解码音频数据失败: %v", err)
+				return
+			}
+			data = append(remainder, data...)
+			aligned := len(data) - len(data)%4
+			remainder = append([]byte(nil), data[aligned:]...)
+			if aligned == 0 {
+				continue
+			}
+			select {
+			case c.frames <- f32leToFloat32(data[:aligned]):
+			case <-c.closed:
+				c.err = c.closeError(ctx, nil)
+				return
+			}
+		case "done":
+			return
+		case "error":
+			c.err = fmt.Errorf("Cartesia合成失败: %s", resp.Error)
+			return
+		}
+		if resp.Done {
+			return
+		}
+	}
+}
+
+// closeError 区分主动关闭和连接异常，上下文取消时返回取消原因
+func (c *CartesiaStreamSession) closeError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	select {
+	case <-c.closed:
+		return errSpeechStreamClosed
+	default:
+	}
+	return fmt.Errorf("读取合成结果失败: %v", err)
+}
+
+var errSpeechStreamClosed = errors.New("流式合成会话已关闭")
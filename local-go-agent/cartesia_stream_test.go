@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestCartesiaServer 模拟Cartesia websocket接口：收到 continue 为 false 的请求后，
+// 把收到的文本长度作为采样数返回，分两块发送且第一块不按采样对齐
+func newTestCartesiaServer(t *testing.T, received chan<- string) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		var text strings.Builder
+		for {
+			var request cartesiaStreamRequest
+			if err := conn.ReadJSON(&request); err != nil {
+				return
+			}
+			text.WriteString(request.Transcript)
+			if request.Continue {
+				continue
+			}
+			received <- text.String()
+
+			audio := make([]byte, 4*len(text.String()))
+			for i := 0; i < len(text.String()); i++ {
+				binary.LittleEndian.PutUint32(audio[i*4:], math.Float32bits(0.5))
+			}
+			for _, chunk := range [][]byte{audio[:3], audio[3:]} {
+				conn.WriteJSON(cartesiaStreamResponse{
+					Type:      "chunk",
+					Data:      base64.StdEncoding.EncodeToString(chunk),
+					ContextID: request.ContextID,
+				})
+			}
+			conn.WriteJSON(cartesiaStreamResponse{Type: "done", Done: true, ContextID: request.ContextID})
+		}
+	}))
+}
+
+func TestCartesiaStreamSession(t *testing.T) {
+	received := make(chan string, 1)
+	server := newTestCartesiaServer(t, received)
+	defer server.Close()
+
+	service := NewCartesiaService("test-key")
+	service.baseURL = server.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := service.StreamSession(ctx, SpeechOptions{})
+	if err != nil {
+		t.Fatalf("StreamSession: %v", err)
+	}
+	defer stream.Close()
+
+	for _, chunk := range []string{"你好", "，", "world"} {
+		if err := stream.SendText(chunk); err != nil {
+			t.Fatalf("SendText: %v", err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend: %v", err)
+	}
+	if text := <-received; text != "你好，world" {
+		t.Errorf("server received %q", text)
+	}
+
+	var samples int
+	for frame := range stream.Frames() {
+		for _, sample := range frame {
+			if sample != 0.5 {
+				t.Fatalf("unexpected sample %v", sample)
+			}
+		}
+		samples += len(frame)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := len("你好，world"); samples != want {
+		t.Errorf("got %d samples, want %d", samples, want)
+	}
+}
+
+func TestCartesiaStreamSessionCancel(t *testing.T) {
+	received := make(chan string, 1)
+	server := newTestCartesiaServer(t, received)
+	defer server.Close()
+
+	service := NewCartesiaService("test-key")
+	service.baseURL = server.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := service.StreamSession(ctx, SpeechOptions{})
+	if err != nil {
+		t.Fatalf("StreamSession: %v", err)
+	}
+	if err := stream.SendText("hello"); err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+	cancel()
+
+	select {
+	case _, ok := <-stream.Frames():
+		if ok {
+			t.Fatal("received audio after the context was cancelled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Frames was not closed after the context was cancelled")
+	}
+	if err := stream.Err(); err != context.Canceled {
+		t.Errorf("Err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// version 在构建时通过 -ldflags "-X main.version=..." 注入
+var version = "dev"
+
+const (
+	commandConnect        = "connect"
+	commandValidateConfig = "validate-config"
+	commandVersion        = "version"
+	commandSimulate       = "simulate"
+	commandReprocess      = "reprocess"
+	commandSubtitles      = "subtitles"
+)
+
+const usage = `用法: livekit-go-agent [命令] [选项]
+
+命令:
+  connect          连接LiveKit房间并运行代理（默认）
+  validate-config  检查配置，不连接服务器，缺少必填项时退出码为1
+  simulate FILE    用WAV文件代替实时音频离线运行对话流程，语音回复写入 FILE 同目录的 .reply.wav
+  reprocess FILE   用识别服务的高精度模式重新转录一段录音，转录结果输出到标准输出
+  subtitles SESSION 把一次会话的对话记录导出为字幕，输出到标准输出，需要配置 transcripts.path
+  version          打印版本号
+
+connect、validate-config、simulate、reprocess 和 subtitles 的选项:
+`
+
+// cliOptions 是命令行选项，优先于配置文件和环境变量
+type cliOptions struct {
+	configPath string
+	url        string
+	rooms      string
+	echo       string
+}
+
+func (o *cliOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.configPath, "config", os.Getenv("CONFIG_FILE"), "配置文件路径，默认读取 CONFIG_FILE 环境变量")
+	flags.StringVar(&o.url, "url", "", "LiveKit服务器地址，多个地址用逗号分隔，覆盖 livekit.url 和 livekit.urls")
+	flags.StringVar(&o.rooms, "room", "", "要加入的房间，多个房间用逗号分隔，覆盖 livekit.room_name 和 livekit.rooms")
+	flags.StringVar(&o.echo, "echo", "", "回声模式: loopback 或 phrase，不调用AI服务，用于测试连接，覆盖 echo.mode")
+}
+
+// loadConfig 加载配置并应用命令行覆盖
+func (o *cliOptions) loadConfig() (*Config, error) {
+	cfg, err := LoadConfig(o.configPath)
+	if err != nil {
+		return nil, err
+	}
+	if o.url != "" {
+		cfg.LiveKit.URL = o.url
+		cfg.LiveKit.URLs = nil
+		if urls := strings.Split(o.url, ","); len(urls) > 1 {
+			cfg.LiveKit.URLs = urls
+		}
+	}
+	if o.rooms != "" {
+		rooms := strings.Split(o.rooms, ",")
+		cfg.LiveKit.RoomName = rooms[0]
+		cfg.LiveKit.Rooms = nil
+		if len(rooms) > 1 {
+			cfg.LiveKit.Rooms = rooms
+		}
+	}
+	if o.echo != "" {
+		mode := EchoMode(o.echo)
+		if err := mode.validate(); err != nil {
+			return nil, err
+		}
+		cfg.Echo.Mode = mode
+	}
+	return cfg, nil
+}
+
+// runCLI 解析命令行参数并执行对应的子命令，返回进程退出码。
+// 第一个参数不是子命令时按 connect 处理，兼容不带参数的启动方式
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	command := commandConnect
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	var options cliOptions
+	if command != commandVersion {
+		options.register(flags)
+	}
+	format := string(SubtitleWebVTT)
+	if command == commandSubtitles {
+		flags.StringVar(&format, "format", format, "字幕格式: vtt 或 srt")
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	// simulate 和 reprocess 需要一个音频文件参数，subtitles 需要一个会话ID
+	wantArgs := 0
+	if command == commandSimulate || command == commandReprocess || command == commandSubtitles {
+		wantArgs = 1
+	}
+	if flags.NArg() != wantArgs {
+		if flags.NArg() > wantArgs {
+			fmt.Fprintf(stderr, "多余的参数: %s\n", strings.Join(flags.Args()[wantArgs:], " "))
+		} else {
+			if command == commandSubtitles {
+				fmt.Fprintln(stderr, "缺少会话ID参数")
+			} else {
+				fmt.Fprintln(stderr, "缺少音频文件参数")
+			}
+		}
+		flags.Usage()
+		return 2
+	}
+
+	switch command {
+	case commandVersion:
+		fmt.Fprintln(stdout, version)
+		return 0
+	case commandValidateConfig:
+		return validateConfig(&options, stdout, stderr)
+	case commandConnect:
+		cfg, err := options.loadConfig()
+		if err != nil {
+			fmt.Fprintf(stderr, "加载配置失败: %v\n", err)
+			return 1
+		}
+		if err := runAgent(cfg); err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 1
+		}
+		return 0
+	case commandSimulate:
+		cfg, err := options.loadConfig()
+		if err != nil {
+			fmt.Fprintf(stderr, "加载配置失败: %v\n", err)
+			return 1
+		}
+		logger := newLogger(cfg.Log)
+		services := NewAIServices(cfg, logger)
+		err = newAIAgent(cfg, services, NewMetrics(), logger).SimulateFromFile(flags.Arg(0))
+		if closeErr := services.Close(); closeErr != nil {
+			fmt.Fprintf(stderr, "保存对话记录失败: %v\n", closeErr)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "模拟失败: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, simulationOutputPath(flags.Arg(0)))
+		return 0
+	case commandReprocess:
+		cfg, err := options.loadConfig()
+		if err != nil {
+			fmt.Fprintf(stderr, "加载配置失败: %v\n", err)
+			return 1
+		}
+		logger := newLogger(cfg.Log)
+		services := NewAIServices(cfg, logger)
+		transcript, err := newAIAgent(cfg, services, NewMetrics(), logger).ReprocessSession(flags.Arg(0), ReprocessOptions{})
+		if closeErr := services.Close(); closeErr != nil {
+			fmt.Fprintf(stderr, "保存对话记录失败: %v\n", closeErr)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%v\n", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, formatMinutes(transcript))
+		return 0
+	case commandSubtitles:
+		cfg, err := options.loadConfig()
+		if err != nil {
+			fmt.Fprintf(stderr, "加载配置失败: %v\n", err)
+			return 1
+		}
+		services := NewAIServices(cfg, newLogger(cfg.Log))
+		subtitles, err := services.ExportSubtitles(flags.Arg(0), SubtitleFormat(format))
+		if closeErr := services.Close(); closeErr != nil {
+			fmt.Fprintf(stderr, "关闭对话记录失败: %v\n", closeErr)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "导出字幕失败: %v\n", err)
+			return 1
+		}
+		stdout.Write(subtitles)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "未知的命令: %s\n", command)
+		flags.Usage()
+		return 2
+	}
+}
+
+func validateConfig(options *cliOptions, stdout, stderr io.Writer) int {
+	cfg, err := options.loadConfig()
+	if err != nil {
+		fmt.Fprintf(stderr, "加载配置失败: %v\n", err)
+		return 1
+	}
+
+	missing := cfg.missingKeys()
+	for _, key := range missing {
+		fmt.Fprintf(stderr, "缺少必填配置: %s\n", key)
+	}
+	if len(missing) > 0 {
+		return 1
+	}
+	fmt.Fprintln(stdout, "配置有效")
+	return 0
+}
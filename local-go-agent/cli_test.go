@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMissingKeys(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LiveKit.APIKey = "key"
+	cfg.Health.RequiredServices = []string{serviceLLM}
+	if missing := strings.Join(cfg.missingKeys(), ","); missing != "livekit.api_secret,openai.api_key" {
+		t.Errorf("missing keys = %s", missing)
+	}
+
+	// 使用令牌服务时不需要API密钥
+	cfg.LiveKit.TokenURL = "http://localhost/token"
+	cfg.OpenAI.APIKey = "key"
+	if missing := cfg.missingKeys(); len(missing) != 0 {
+		t.Errorf("missing keys with a token url = %v", missing)
+	}
+}
+
+func TestValidateConfigCommand(t *testing.T) {
+	t.Setenv("LIVEKIT_URL", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "livekit:\n  url: \"\"\n  api_key: key\n  api_secret: secret\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{commandValidateConfig, "-config", path}, &stdout, &stderr); code != 1 {
+		t.Fatalf("exit code = %d, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), "livekit.url") {
+		t.Errorf("stderr does not report livekit.url: %q", stderr.String())
+	}
+
+	// 命令行参数优先于配置文件
+	stdout.Reset()
+	stderr.Reset()
+	args := []string{commandValidateConfig, "-config", path, "-url", "ws://localhost:7880"}
+	if code := runCLI(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr.String())
+	}
+}
+
+func TestVersionCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{commandVersion}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if strings.TrimSpace(stdout.String()) != version {
+		t.Errorf("stdout = %q, want %q", stdout.String(), version)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"bogus"}, &stdout, &stderr); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
@@ -0,0 +1,921 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	// 语音识别服务: assemblyai 或 whisper_local
+	STTProvider string        `yaml:"stt_provider"`
+	LiveKit     LiveKitConfig `yaml:"livekit"`
+	// 默认人设，Personas 可以按房间名覆盖其中的字段
+	Persona    Persona            `yaml:"persona"`
+	Personas   map[string]Persona `yaml:"personas"`
+	OpenAI     OpenAIConfig       `yaml:"openai"`
+	AssemblyAI AssemblyAIConfig   `yaml:"assemblyai"`
+	Whisper    WhisperConfig      `yaml:"whisper"`
+	// 语音合成服务: cartesia、openai 或 espeak；TTSFallback 是主服务失败时依次尝试的备用服务
+	TTSProvider string            `yaml:"tts_provider"`
+	TTSFallback []string          `yaml:"tts_fallback"`
+	Cartesia    CartesiaConfig    `yaml:"cartesia"`
+	Espeak      EspeakConfig      `yaml:"espeak"`
+	Audio       AudioConfig       `yaml:"audio"`
+	Network     NetworkConfig     `yaml:"network"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Health      HealthConfig      `yaml:"health"`
+	Recording   RecordingConfig   `yaml:"recording"`
+	Egress      EgressConfig      `yaml:"egress"`
+	Moderation  ModerationConfig  `yaml:"moderation"`
+	Log         LogConfig         `yaml:"log"`
+	Greeting    GreetingConfig    `yaml:"greeting"`
+	Budget      BudgetConfig      `yaml:"budget"`
+	Cost        CostConfig        `yaml:"cost"`
+	BargeIn     BargeInConfig     `yaml:"barge_in"`
+	WakeWord    WakeWordConfig    `yaml:"wake_word"`
+	History     HistoryConfig     `yaml:"history"`
+	Echo        EchoConfig        `yaml:"echo"`
+	Transcripts TranscriptsConfig `yaml:"transcripts"`
+	// 按键菜单，键为 0-9、*、#、A-D
+	DTMF map[string]DTMFAction `yaml:"dtmf"`
+	// 参与者可以在对话中按名称切换的人设，只影响切换的参与者
+	PersonaModes map[string]PersonaMode `yaml:"persona_modes"`
+	// 回复中可以按名称选择的声音，名称 -> 语音合成服务的声音ID，例如为故事中不同的角色配音
+	NamedVoices map[string]string `yaml:"named_voices"`
+	// audio.output_target 包含 telephony 时的电话网关
+	Telephony TelephonyConfig `yaml:"telephony"`
+	// 加入房间前自检AI服务的凭据和连通性
+	Preflight PreflightConfig `yaml:"preflight"`
+	// 通过数据通道发布的实时字幕
+	Captions CaptionsConfig `yaml:"captions"`
+	// 语音对话的处理方式: modular（分别调用识别、生成和合成服务）或 realtime（OpenAI Realtime API）
+	Pipeline PipelineMode `yaml:"pipeline"`
+	// pipeline 为 realtime 时的 OpenAI Realtime API 设置
+	Realtime RealtimeConfig `yaml:"realtime"`
+	// 忽略的参与者身份，例如同一房间中的其他代理，不处理其音频和文字消息，也不问候
+	IgnoreParticipants []string `yaml:"ignore_participants"`
+}
+
+type LiveKitConfig struct {
+	URL       string `yaml:"url"`
+	APIKey    string `yaml:"api_key"`
+	APISecret string `yaml:"api_secret"`
+	// 预先生成的访问令牌，设置后不再使用API密钥，令牌中的身份需与 ParticipantIdentity 一致
+	Token string `yaml:"token"`
+	// 签发令牌的服务地址，每次连接时获取新令牌，优先于 Token
+	TokenURL string `yaml:"token_url"`
+	RoomName string `yaml:"room_name"`
+	// 同时加入的多个房间，为空时只加入 RoomName
+	Rooms               []string `yaml:"rooms"`
+	ParticipantIdentity string   `yaml:"participant_identity"`
+	ParticipantName     string   `yaml:"participant_name"`
+	// 房间中没有其他参与者持续这么久后离开房间，0 表示不自动离开
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// 是否发布语音轨道、订阅其他人的轨道。关闭发布即为只转录不说话的代理，关闭订阅即为只播报的代理；
+	// 使用API密钥时写入签发的令牌，使用外部令牌时需与令牌的权限一致。语音轨道使用48kHz Opus编码，见 newOpusEncoder
+	Publish   bool `yaml:"publish"`
+	Subscribe bool `yaml:"subscribe"`
+	// 多个服务器地址，连接和重连时依次尝试，设置后忽略 URL
+	URLs []string `yaml:"urls"`
+	// 多个地址的尝试顺序: ordered（按配置顺序）或 latency（按探测延迟）
+	URLStrategy URLStrategy `yaml:"url_strategy"`
+}
+
+type OpenAIConfig struct {
+	APIKey      string  `yaml:"api_key"`
+	Model       string  `yaml:"model"`
+	MaxTokens   int     `yaml:"max_tokens"`
+	Temperature float64 `yaml:"temperature"`
+	// 单次LLM请求的超时时间
+	Timeout time.Duration `yaml:"timeout"`
+	// 回复发布和合成之前隐藏其中的邮箱、身份证号和手机号，开启后回复不再边生成边播放
+	RedactPII bool `yaml:"redact_pii"`
+	// 设置 endpoint 后改用Azure OpenAI，api_key 为Azure资源的密钥，model 不再生效
+	Azure AzureOpenAIConfig `yaml:"azure"`
+	// tts_provider 或 tts_fallback 中使用 openai 时的语音合成设置
+	TTS OpenAITTSConfig `yaml:"tts"`
+	// 随机种子，模型支持时相同的输入生成相同的回复，便于测试和演示；不设置时每次回复都可能不同
+	Seed *int64 `yaml:"seed"`
+	// 回复格式: text 或 json_object，为空时使用服务端默认值
+	ResponseFormat string `yaml:"response_format"`
+}
+
+type OpenAITTSConfig struct {
+	Model string `yaml:"model"`
+	// OpenAI的声音，如 alloy、nova；人设中的声音不是OpenAI的声音时使用它
+	Voice string `yaml:"voice"`
+	// 控制语气的说明，tts-1 和 tts-1-hd 不支持
+	Instructions string `yaml:"instructions"`
+}
+
+type AzureOpenAIConfig struct {
+	// 资源地址，如 https://my-resource.openai.azure.com
+	Endpoint   string `yaml:"endpoint"`
+	Deployment string `yaml:"deployment"`
+	APIVersion string `yaml:"api_version"`
+}
+
+type AssemblyAIConfig struct {
+	APIKey string `yaml:"api_key"`
+	// 默认语言，关闭自动检测或检测置信度不足时使用
+	LanguageCode                string  `yaml:"language_code"`
+	LanguageDetection           bool    `yaml:"language_detection"`
+	LanguageConfidenceThreshold float64 `yaml:"language_confidence_threshold"`
+	// 说话人分离，只有一条混音轨道时按说话人拆分转录结果，会增加延迟和费用
+	SpeakerLabels bool `yaml:"speaker_labels"`
+	// 预期的说话人数量，0 表示由AssemblyAI判断
+	SpeakersExpected int `yaml:"speakers_expected"`
+	// 上传、提交和查询转录遇到网络抖动或服务端错误时的重试次数，流式识别断线重连的次数
+	Retries int `yaml:"retries"`
+	// 识别接口: batch 按本地切分的发言批量转录，streaming 使用 Universal Streaming 实时识别并由服务端检测发言结束
+	Endpoint string `yaml:"endpoint"`
+	// 流式识别的websocket地址，为空时使用AssemblyAI的默认地址
+	StreamingURL string `yaml:"streaming_url"`
+	// 流式识别判定一轮发言结束的置信度 (0-1) 和最长静音，0 表示使用服务端默认值
+	EndOfTurnConfidence float64       `yaml:"end_of_turn_confidence"`
+	MaxTurnSilence      time.Duration `yaml:"max_turn_silence"`
+	// 批量转录的标点、格式化、语气词、脏话过滤和 word_boost
+	TranscribeOptions `yaml:",inline"`
+}
+
+type WhisperConfig struct {
+	ModelPath string `yaml:"model_path"`
+}
+
+type CartesiaConfig struct {
+	APIKey              string `yaml:"api_key"`
+	ModelID             string `yaml:"model_id"`
+	MultilingualModelID string `yaml:"multilingual_model_id"`
+	VoiceID             string `yaml:"voice_id"`
+	SampleRate          int    `yaml:"sample_rate"`
+	// 语速，-1（最慢）到 1（最快），0 为正常语速；仅 sonic、sonic-2 等支持控制的模型生效
+	Speed float64 `yaml:"speed"`
+	// 情绪，如 "positivity:high"，可选强度为 lowest、low、high、highest
+	Emotions []string `yaml:"emotions"`
+}
+
+type EspeakConfig struct {
+	// espeak-ng 可执行文件，为空时从 PATH 查找
+	Binary string `yaml:"binary"`
+	// 固定使用的声音，为空时按回复语言选择
+	Voice string `yaml:"voice"`
+}
+
+type AudioConfig struct {
+	// 每段送去转录的音频时长
+	BufferDuration time.Duration `yaml:"buffer_duration"`
+	// 每条轨道最多缓冲的音频时长，写满时提前送出已缓冲的音频
+	MaxBufferDuration time.Duration `yaml:"max_buffer_duration"`
+	// 按固定间隔或缓冲区写满切分发言时，上一段末尾带入下一段开头的音频时长，0 表示不重叠
+	SegmentOverlap time.Duration `yaml:"segment_overlap"`
+	// 一段发言最长的时长，持续说话没有静音时到达该时长就送去识别并开始新的一段，0 表示不限制
+	MaxUtteranceDuration time.Duration `yaml:"max_utterance_duration"`
+	// 转录结果少于该字符数时视为噪声，不送入LLM
+	MinTranscriptLength int `yaml:"min_transcript_length"`
+	// 转录置信度低于该值时视为噪声，0 表示不检查
+	MinConfidence float64 `yaml:"min_confidence"`
+	// 只包含这些语气词的转录结果不会送入LLM
+	FillerWords []string `yaml:"filler_words"`
+	// 每个参与者最多排队等待处理的发言数，超过时丢弃最早的发言
+	MaxQueueDepth int `yaml:"max_queue_depth"`
+	// 流式识别出一句话后等待这么久再送入LLM，期间同一轨道识别出的句子合并为一次请求；
+	// 0 表示不等待，只合并上一轮对话期间排队的句子
+	CoalesceWindow time.Duration `yaml:"coalesce_window"`
+	// 所有参与者同时进行的对话数量上限，超过时排队等待，0 表示不限制
+	MaxConcurrentTurns int `yaml:"max_concurrent_turns"`
+	// 抖动缓冲最多缓存的乱序RTP包数量，越大越能容忍乱序，但延迟也越高
+	JitterBufferDepth int `yaml:"jitter_buffer_depth"`
+	// 收听模式: continuous、vad 或 push_to_talk
+	ListeningMode ListeningMode `yaml:"listening_mode"`
+	// vad 模式下判定为说话的均方根电平 (0-1)
+	VADThreshold float64 `yaml:"vad_threshold"`
+	// vad 模式下说话后静音超过该时长视为一段发言结束
+	VADSilence time.Duration `yaml:"vad_silence"`
+	// 以这些短语结尾时结束发言（如 "完了"、"over"），短语不会发送给LLM。
+	// 识别服务支持流式识别时在中间结果中检测，不必等到静音
+	EndPhrases []string `yaml:"end_phrases"`
+	// 一轮对话（STT+LLM+TTS）的截止时间，超时后取消并回复 TurnTimeoutReply，0 表示不限制
+	TurnDeadline time.Duration `yaml:"turn_deadline"`
+	// 对话超时后的简短回复，为空时不回复
+	TurnTimeoutReply string `yaml:"turn_timeout_reply"`
+	// 上报参与者音量的周期，0 表示不上报
+	LevelInterval time.Duration `yaml:"level_interval"`
+	// 噪声底（dBFS），整段发言都低于它时不送去识别，0 表示不检查
+	NoiseFloor float64 `yaml:"noise_floor"`
+	// 客户端附带RTP音量扩展时，音量（dBov）持续低于它的包不解码，0 表示总是解码
+	RTPLevelGate float64 `yaml:"rtp_level_gate"`
+	// 识别出有效发言、开始生成回复时播放的填充音（16位PCM的WAV文件），为空时不播放
+	FillerPath string `yaml:"filler_path"`
+	// 逐句合成时最多同时合成的句子数，合成好的句子仍按原顺序播放
+	TTSConcurrency int `yaml:"tts_concurrency"`
+	// 语音轨道Opus编码的码率（bps），0 表示使用编码器的默认值。PCMU 码率固定，不受影响
+	OutputBitrate int `yaml:"output_bitrate"`
+	// 按代理的连接质量调整码率和编码复杂度，连接变差时降到 MinOutputBitrate，恢复后还原
+	AdaptiveBitrate  bool `yaml:"adaptive_bitrate"`
+	MinOutputBitrate int  `yaml:"min_output_bitrate"`
+	// 回应模式: all 或 active_speaker
+	RespondTo RespondMode `yaml:"respond_to"`
+	// active_speaker 模式下其他人需要持续说话多久才能接替主讲人
+	ActiveSpeakerHold time.Duration `yaml:"active_speaker_hold"`
+	// 送去识别前的音频预处理，默认全部关闭
+	Preprocess PreprocessConfig `yaml:"preprocess"`
+	// 语音输出: webrtc（房间的语音轨道）、telephony（G.711 RTP 发送给电话网关）或 both
+	OutputTarget OutputTarget `yaml:"output_target"`
+	// 一条回复按字数估算的最长朗读时长，提示模型控制回复长度并据此限制 max_tokens，
+	// 超出时在句子边界截断，0 表示不限制
+	MaxReplyDuration time.Duration `yaml:"max_reply_duration"`
+}
+
+// NetworkConfig 是受限网络下的WebRTC连接设置。暂不支持在代理中配置ICE/TURN服务器：
+// server-sdk-go v2.2.0 没有 WithICEServers，只用服务端在加入房间时下发的服务器创建 PeerConnection，
+// 之后通过 GetPublisherPeerConnection 调用 SetConfiguration 也不会重建ICE收集器。
+// 需要在服务端配置 rtc.turn_servers 或内置的 turn
+type NetworkConfig struct {
+	// 只通过TURN中继建立连接，适用于禁止UDP直连的企业网络
+	ForceRelay bool `yaml:"force_relay"`
+}
+
+type MetricsConfig struct {
+	// Prometheus 指标服务监听地址，为空时不启动
+	Addr string `yaml:"addr"`
+}
+
+type HealthConfig struct {
+	// 健康检查服务监听地址，为空时不启动
+	Addr string `yaml:"addr"`
+	// /readyz 要求可用的AI服务: llm、stt、tts
+	RequiredServices []string `yaml:"required_services"`
+}
+
+type RecordingConfig struct {
+	// 录音保存目录，为空时不录音；多房间时每个房间使用以房间名命名的子目录
+	Dir string `yaml:"dir"`
+}
+
+// ModerationConfig 是由语言模型通过工具调用执行的房间管理操作，需要API密钥
+type ModerationConfig struct {
+	// 允许模型静音或移出参与者，只应在管理员人设中开启
+	Enabled bool `yaml:"enabled"`
+}
+
+// EgressConfig 是通过数据通道命令开始和停止的房间录制（LiveKit egress），需要API密钥
+type EgressConfig struct {
+	// 允许参与者发送 {"type":"egress","state":"start"|"stop"} 开始和停止录制
+	Enabled bool `yaml:"enabled"`
+	// 录制文件路径，支持 egress 的 {room_name}、{time} 等模板
+	Filepath string `yaml:"filepath"`
+	// 只录制音频（OGG），否则录制房间画面（MP4）
+	AudioOnly bool `yaml:"audio_only"`
+	// 房间画面的布局，如 grid、speaker，只录音频时无效
+	Layout string `yaml:"layout"`
+}
+
+type GreetingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// 首次加入房间时发送的欢迎消息，为空时不发送；断线重连后不会重复发送
+	Welcome string `yaml:"welcome"`
+	// 参与者加入时发送的问候，{name} 替换为参与者名称，为空时不发送
+	Participant string `yaml:"participant"`
+	// 每个参与者只问候一次，离开后重新加入也不再问候
+	Once bool `yaml:"once"`
+	// 加入房间后等待连接稳定再发送欢迎消息
+	Delay time.Duration `yaml:"delay"`
+}
+
+// BudgetConfig 限制LLM的token用量，0 表示不限制
+type BudgetConfig struct {
+	// 每个房间在一个窗口内的token上限
+	RoomTokens int64 `yaml:"room_tokens"`
+	// 所有房间合计在一个窗口内的token上限
+	GlobalTokens int64 `yaml:"global_tokens"`
+	// 用量重置的周期，0 表示不重置
+	Window time.Duration `yaml:"window"`
+}
+
+// HistoryConfig 控制每位说话人保存的对话历史
+type HistoryConfig struct {
+	// 每位说话人最多保存的对话轮数，超过时丢弃最早的一轮；0 表示不限制
+	MaxTurns int `yaml:"max_turns"`
+	// 说出或发送这些短语时清空自己的对话历史，不区分大小写，忽略首尾的标点
+	ResetPhrases []string `yaml:"reset_phrases"`
+	// 清空对话历史后的确认回复
+	ResetReply string `yaml:"reset_reply"`
+	// 对话历史的存储: memory 保存在进程内，代理重新连接房间后仍可恢复；file 保存到 Path 目录，进程重启后仍可恢复
+	Store string `yaml:"store"`
+	Path  string `yaml:"path"`
+	// 参与者离开后保留对话历史的时长，期间重新加入时继续之前的对话；0 表示一直保留
+	Retention time.Duration `yaml:"retention"`
+	// 对话超过这么多轮时在后台用LLM把较早的对话浓缩成摘要，只保留最近 SummaryKeepTurns 轮原文；0 表示不压缩
+	SummarizeAfter   int `yaml:"summarize_after"`
+	SummaryKeepTurns int `yaml:"summary_keep_turns"`
+	// 摘要的最大token数
+	SummaryMaxTokens int `yaml:"summary_max_tokens"`
+}
+
+// TranscriptsConfig 控制每轮对话的保存，用于分析和看板
+type TranscriptsConfig struct {
+	// 每轮对话追加一行JSON的文件，为空时不保存
+	Path string `yaml:"path"`
+}
+
+// EchoConfig 是测试连通性用的回声模式，见 EchoMode
+type EchoConfig struct {
+	// loopback 回放收到的发言，phrase 回复固定的短语，为空时关闭
+	Mode EchoMode `yaml:"mode"`
+	// phrase 模式下回复的短语
+	Phrase string `yaml:"phrase"`
+}
+
+type LogConfig struct {
+	// 日志级别: debug、info、warn、error
+	Level string `yaml:"level"`
+	// 日志格式: text 或 json
+	Format string `yaml:"format"`
+	// 记录与OpenAI、AssemblyAI和Cartesia之间的请求和响应，凭据会被隐藏。只在 Level 为 debug 时生效
+	DebugAPI bool `yaml:"debug_api"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		STTProvider: sttProviderAssemblyAI,
+		TTSProvider: ttsProviderCartesia,
+		Persona: Persona{
+			SystemPrompt: defaultSystemPrompt,
+			Language:     "zh",
+		},
+		LiveKit: LiveKitConfig{
+			URL:                 defaultLiveKitURL,
+			RoomName:            defaultRoomName,
+			ParticipantIdentity: defaultParticipantID,
+			ParticipantName:     "AI助手",
+			IdleTimeout:         defaultIdleTimeout,
+			Publish:             true,
+			Subscribe:           true,
+		},
+		OpenAI: OpenAIConfig{
+			Model:       "gpt-3.5-turbo",
+			MaxTokens:   150,
+			Temperature: 0.7,
+			Timeout:     defaultLLMTimeout,
+		},
+		AssemblyAI: AssemblyAIConfig{
+			LanguageCode:                "zh",
+			LanguageConfidenceThreshold: 0.5,
+			Retries:                     defaultMaxRetries,
+			Endpoint:                    assemblyAIEndpointBatch,
+		},
+		Cartesia: CartesiaConfig{
+			ModelID:             "sonic-english",
+			MultilingualModelID: "sonic-multilingual",
+			VoiceID:             "a0e99841-438c-4a64-b679-ae501e7d6091",
+			SampleRate:          22050,
+		},
+		Audio: AudioConfig{
+			BufferDuration:      3 * time.Second,
+			MaxBufferDuration:   defaultMaxBufferDuration,
+			SegmentOverlap:      defaultSegmentOverlap,
+			MinTranscriptLength: 1,
+			MinConfidence:       0.5,
+			FillerWords:         defaultFillerWords,
+			MaxQueueDepth:       defaultMaxQueueDepth,
+			MaxConcurrentTurns:  defaultMaxConcurrentTurns,
+			TTSConcurrency:      defaultTTSConcurrency,
+			OutputBitrate:       defaultOutputBitrate,
+			MinOutputBitrate:    defaultMinOutputBitrate,
+			JitterBufferDepth:   defaultJitterBufferDepth,
+			ListeningMode:       ListeningModeContinuous,
+			VADThreshold:        defaultVADThreshold,
+			VADSilence:          defaultVADSilence,
+			TurnDeadline:        defaultTurnDeadline,
+			TurnTimeoutReply:    defaultTurnTimeoutReply,
+			LevelInterval:       defaultLevelInterval,
+			NoiseFloor:          defaultNoiseFloor,
+			RTPLevelGate:        defaultRTPLevelGate,
+			RespondTo:           RespondToAll,
+			ActiveSpeakerHold:   defaultActiveSpeakerHold,
+			Preprocess: PreprocessConfig{
+				HighPassCutoff: defaultHighPassCutoff,
+				TargetRMS:      defaultTargetRMS,
+				MaxGain:        defaultMaxGain,
+				NoiseGateRatio: defaultNoiseGateRatio,
+			},
+			MaxUtteranceDuration: defaultMaxUtteranceDuration,
+			OutputTarget:         OutputTargetWebRTC,
+		},
+		Metrics: MetricsConfig{
+			Addr: ":9090",
+		},
+		Health: HealthConfig{
+			Addr: ":8080",
+		},
+		Egress: EgressConfig{
+			Filepath:  defaultEgressFilepath,
+			AudioOnly: true,
+		},
+		Greeting: GreetingConfig{
+			Enabled:     true,
+			Welcome:     defaultWelcomeMessage,
+			Participant: defaultParticipantGreeting,
+			Once:        true,
+			Delay:       defaultGreetingDelay,
+		},
+		Budget: BudgetConfig{
+			Window: time.Hour,
+		},
+		Preflight: PreflightConfig{
+			Mode:    PreflightModeWarn,
+			Timeout: defaultPreflightTimeout,
+		},
+		Captions: CaptionsConfig{
+			InterimInterval: defaultCaptionInterimInterval,
+		},
+		Pipeline: PipelineModular,
+		Realtime: RealtimeConfig{
+			Model:   defaultRealtimeModel,
+			Voice:   defaultRealtimeVoice,
+			Retries: defaultMaxRetries,
+		},
+		BargeIn: BargeInConfig{
+			MinDurationMs:   defaultBargeInDuration,
+			EnergyThreshold: defaultBargeInThreshold,
+		},
+		WakeWord: WakeWordConfig{
+			Timeout: defaultWakeTimeout,
+			Reply:   defaultWakeReply,
+		},
+		Echo: EchoConfig{
+			Phrase: defaultEchoPhrase,
+		},
+		History: HistoryConfig{
+			MaxTurns:         defaultMaxHistoryTurns,
+			Store:            historyStoreMemory,
+			Retention:        defaultHistoryRetention,
+			ResetPhrases:     defaultResetPhrases,
+			ResetReply:       defaultResetReply,
+			SummaryKeepTurns: defaultSummaryKeepTurns,
+			SummaryMaxTokens: defaultSummaryMaxTokens,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: logFormatText,
+		},
+	}
+}
+
+// LoadConfig 从YAML文件（JSON是YAML的子集，同样支持）加载配置，再用环境变量覆盖。
+// path 为空时只使用默认值和环境变量，与之前纯环境变量的行为保持一致。
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件失败: %w", err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Persona.validate(); err != nil {
+		return nil, fmt.Errorf("persona 配置错误: %w", err)
+	}
+	for roomName, persona := range cfg.Personas {
+		if persona.SystemPrompt == "" {
+			continue
+		}
+		if _, err := ParsePromptTemplate(persona.SystemPrompt); err != nil {
+			return nil, fmt.Errorf("personas.%s 配置错误: %w", roomName, err)
+		}
+	}
+	for name, mode := range cfg.PersonaModes {
+		if err := mode.validate(); err != nil {
+			return nil, fmt.Errorf("persona_modes.%s 配置错误: %w", name, err)
+		}
+	}
+	if err := cfg.LiveKit.validateURLs(); err != nil {
+		return nil, fmt.Errorf("livekit 配置错误: %w", err)
+	}
+	if err := validateTTSProviders(cfg.TTSProvider, cfg.TTSFallback); err != nil {
+		return nil, fmt.Errorf("tts_provider 配置错误: %w", err)
+	}
+	if err := NewVoiceRegistry(cfg.NamedVoices).validate(); err != nil {
+		return nil, fmt.Errorf("named_voices 配置错误: %w", err)
+	}
+	if err := cfg.Audio.ListeningMode.validate(); err != nil {
+		return nil, fmt.Errorf("audio 配置错误: %w", err)
+	}
+	if err := cfg.Audio.RespondTo.validate(); err != nil {
+		return nil, fmt.Errorf("audio 配置错误: %w", err)
+	}
+	if err := cfg.Audio.Preprocess.validate(); err != nil {
+		return nil, fmt.Errorf("audio.preprocess 配置错误: %w", err)
+	}
+	if cfg.Audio.NoiseFloor > 0 {
+		return nil, fmt.Errorf("audio 配置错误: noise_floor 是 dBFS，不能大于0")
+	}
+	if cfg.Audio.RTPLevelGate > 0 || cfg.Audio.RTPLevelGate < -127 {
+		return nil, fmt.Errorf("audio 配置错误: rtp_level_gate 是 dBov，范围为 -127 到 0")
+	}
+	if cfg.Audio.SegmentOverlap < 0 || (cfg.Audio.BufferDuration > 0 && cfg.Audio.SegmentOverlap >= cfg.Audio.BufferDuration) {
+		return nil, fmt.Errorf("audio 配置错误: segment_overlap 不能小于0，且需小于 buffer_duration")
+	}
+	if cfg.Audio.MaxUtteranceDuration < 0 || (cfg.Audio.MaxUtteranceDuration > 0 && cfg.Audio.MaxUtteranceDuration <= cfg.Audio.SegmentOverlap) {
+		return nil, fmt.Errorf("audio 配置错误: max_utterance_duration 不能小于0，且需大于 segment_overlap")
+	}
+	if cfg.Captions.InterimInterval < 0 {
+		return nil, fmt.Errorf("captions 配置错误: interim_interval 不能小于0")
+	}
+	if cfg.Audio.MaxReplyDuration < 0 {
+		return nil, fmt.Errorf("audio 配置错误: max_reply_duration 不能小于0")
+	}
+	if err := cfg.Audio.OutputTarget.validate(); err != nil {
+		return nil, fmt.Errorf("audio 配置错误: %w", err)
+	}
+	if cfg.Audio.OutputTarget.telephony() {
+		if err := cfg.Telephony.validate(); err != nil {
+			return nil, fmt.Errorf("telephony 配置错误: %w", err)
+		}
+	}
+	if err := cfg.Audio.validateBitrate(); err != nil {
+		return nil, fmt.Errorf("audio 配置错误: %w", err)
+	}
+	if cfg.Audio.CoalesceWindow < 0 {
+		return nil, fmt.Errorf("audio 配置错误: coalesce_window 不能小于0")
+	}
+	if cfg.Audio.TTSConcurrency < 1 {
+		return nil, fmt.Errorf("audio 配置错误: tts_concurrency 至少为1")
+	}
+	if err := cfg.AssemblyAI.validate(); err != nil {
+		return nil, fmt.Errorf("assemblyai 配置错误: %w", err)
+	}
+	if err := cfg.Echo.Mode.validate(); err != nil {
+		return nil, fmt.Errorf("echo 配置错误: %w", err)
+	}
+	if err := cfg.Pipeline.validate(); err != nil {
+		return nil, fmt.Errorf("pipeline 配置错误: %w", err)
+	}
+	if err := cfg.Realtime.validate(); err != nil {
+		return nil, fmt.Errorf("realtime 配置错误: %w", err)
+	}
+	switch cfg.OpenAI.ResponseFormat {
+	case "", responseFormatText, responseFormatJSONObject:
+	default:
+		return nil, fmt.Errorf("openai 配置错误: 未知的 response_format %q，可选 text 或 json_object", cfg.OpenAI.ResponseFormat)
+	}
+	if err := cfg.Preflight.validate(); err != nil {
+		return nil, fmt.Errorf("preflight 配置错误: %w", err)
+	}
+	if err := cfg.BargeIn.validate(); err != nil {
+		return nil, fmt.Errorf("barge_in 配置错误: %w", err)
+	}
+	if err := cfg.WakeWord.validate(); err != nil {
+		return nil, fmt.Errorf("wake_word 配置错误: %w", err)
+	}
+	if err := cfg.History.validate(); err != nil {
+		return nil, fmt.Errorf("history 配置错误: %w", err)
+	}
+	if err := DTMFMenu(cfg.DTMF).validate(); err != nil {
+		return nil, fmt.Errorf("dtmf 配置错误: %w", err)
+	}
+	if err := cfg.Log.validate(); err != nil {
+		return nil, fmt.Errorf("log 配置错误: %w", err)
+	}
+	return cfg, nil
+}
+
+// missingKeys 返回缺少的必填配置项。AI服务的密钥只在 health.required_services 要求该服务时才是必填的
+func (c *Config) missingKeys() []string {
+	var missing []string
+	require := func(key, value string) {
+		if value == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(c.LiveKit.URLs) == 0 {
+		require("livekit.url", c.LiveKit.URL)
+	}
+	if c.LiveKit.Token == "" && c.LiveKit.TokenURL == "" {
+		require("livekit.api_key", c.LiveKit.APIKey)
+		require("livekit.api_secret", c.LiveKit.APISecret)
+	}
+	if len(c.LiveKit.Rooms) == 0 {
+		require("livekit.room_name", c.LiveKit.RoomName)
+	}
+	require("livekit.participant_identity", c.LiveKit.ParticipantIdentity)
+	// realtime.api_key 为空时使用 openai.api_key，两者有一个即可
+	if c.Pipeline == PipelineRealtime && c.Echo.Mode == EchoModeOff {
+		require("realtime.api_key", c.Realtime.APIKey+c.OpenAI.APIKey)
+	}
+
+	for _, service := range c.requiredServices() {
+		switch service {
+		case serviceLLM:
+			require("openai.api_key", c.OpenAI.APIKey)
+		case serviceSTT:
+			switch c.STTProvider {
+			case sttProviderAssemblyAI, "":
+				require("assemblyai.api_key", c.AssemblyAI.APIKey)
+			case sttProviderWhisperLocal:
+				require("whisper.model_path", c.Whisper.ModelPath)
+			}
+		case serviceTTS:
+			switch c.TTSProvider {
+			case ttsProviderCartesia, "":
+				require("cartesia.api_key", c.Cartesia.APIKey)
+			case ttsProviderOpenAI:
+				require("openai.api_key", c.OpenAI.APIKey)
+			}
+		}
+	}
+	return missing
+}
+
+// requiredServices 返回就绪前必须可用的AI服务，回声模式不使用AI服务，不要求任何服务
+func (c *Config) requiredServices() []string {
+	if c.Echo.Mode != EchoModeOff {
+		return nil
+	}
+	return c.Health.RequiredServices
+}
+
+func (c *Config) applyEnv() error {
+	overrideString(&c.STTProvider, "STT_PROVIDER")
+	overrideString(&c.LiveKit.URL, "LIVEKIT_URL")
+	if value := os.Getenv("LIVEKIT_URLS"); value != "" {
+		c.LiveKit.URLs = strings.Split(value, ",")
+	}
+	overrideString(&c.Persona.SystemPrompt, "SYSTEM_PROMPT")
+	overrideString(&c.LiveKit.APIKey, "LIVEKIT_API_KEY")
+	overrideString(&c.LiveKit.APISecret, "LIVEKIT_API_SECRET")
+	overrideString(&c.LiveKit.Token, "LIVEKIT_TOKEN")
+	overrideString(&c.LiveKit.TokenURL, "LIVEKIT_TOKEN_URL")
+	overrideString(&c.LiveKit.RoomName, "ROOM_NAME")
+	if value := os.Getenv("ROOM_NAMES"); value != "" {
+		c.LiveKit.Rooms = strings.Split(value, ",")
+	}
+	overrideString(&c.LiveKit.ParticipantIdentity, "PARTICIPANT_NAME")
+	if value := os.Getenv("IDLE_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("IDLE_TIMEOUT 格式错误: %w", err)
+		}
+		c.LiveKit.IdleTimeout = timeout
+	}
+	if value := os.Getenv("LIVEKIT_PUBLISH"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("LIVEKIT_PUBLISH 格式错误: %w", err)
+		}
+		c.LiveKit.Publish = enabled
+	}
+	if value := os.Getenv("LIVEKIT_SUBSCRIBE"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("LIVEKIT_SUBSCRIBE 格式错误: %w", err)
+		}
+		c.LiveKit.Subscribe = enabled
+	}
+
+	overrideString(&c.OpenAI.APIKey, "OPENAI_API_KEY")
+	overrideString(&c.OpenAI.Model, "OPENAI_MODEL")
+	if value := os.Getenv("OPENAI_SEED"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("OPENAI_SEED 格式错误: %w", err)
+		}
+		c.OpenAI.Seed = &seed
+	}
+	overrideString(&c.OpenAI.Azure.Endpoint, "AZURE_OPENAI_ENDPOINT")
+	// 只在使用Azure时替换密钥，否则Azure的密钥会被发送给 api.openai.com
+	if c.OpenAI.Azure.Endpoint != "" {
+		overrideString(&c.OpenAI.APIKey, "AZURE_OPENAI_API_KEY")
+	}
+	overrideString(&c.OpenAI.Azure.Deployment, "AZURE_OPENAI_DEPLOYMENT")
+	overrideString(&c.OpenAI.Azure.APIVersion, "AZURE_OPENAI_API_VERSION")
+	overrideString(&c.AssemblyAI.APIKey, "ASSEMBLYAI_API_KEY")
+	overrideString(&c.AssemblyAI.LanguageCode, "ASSEMBLYAI_LANGUAGE_CODE")
+	if value := os.Getenv("ASSEMBLYAI_LANGUAGE_DETECTION"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("ASSEMBLYAI_LANGUAGE_DETECTION 格式错误: %w", err)
+		}
+		c.AssemblyAI.LanguageDetection = enabled
+	}
+	if value := os.Getenv("ASSEMBLYAI_SPEAKER_LABELS"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("ASSEMBLYAI_SPEAKER_LABELS 格式错误: %w", err)
+		}
+		c.AssemblyAI.SpeakerLabels = enabled
+	}
+	overrideString(&c.AssemblyAI.Endpoint, "ASSEMBLYAI_ENDPOINT")
+	if value := os.Getenv("ASSEMBLYAI_WORD_BOOST"); value != "" {
+		c.AssemblyAI.WordBoost = strings.Split(value, ",")
+	}
+	overrideString(&c.Whisper.ModelPath, "WHISPER_MODEL_PATH")
+	overrideString(&c.TTSProvider, "TTS_PROVIDER")
+	if value := os.Getenv("TTS_FALLBACK"); value != "" {
+		c.TTSFallback = strings.Split(value, ",")
+	}
+	overrideString(&c.Cartesia.APIKey, "CARTESIA_API_KEY")
+	overrideString(&c.Cartesia.ModelID, "CARTESIA_MODEL_ID")
+	overrideString(&c.Cartesia.VoiceID, "CARTESIA_VOICE_ID")
+	if value := os.Getenv("FORCE_RELAY"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("FORCE_RELAY 格式错误: %w", err)
+		}
+		c.Network.ForceRelay = enabled
+	}
+	overrideString(&c.Metrics.Addr, "METRICS_ADDR")
+	overrideString(&c.Health.Addr, "HEALTH_ADDR")
+	overrideString(&c.Recording.Dir, "RECORDING_DIR")
+	if value := os.Getenv("MODERATION_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("MODERATION_ENABLED 格式错误: %w", err)
+		}
+		c.Moderation.Enabled = enabled
+	}
+	if value := os.Getenv("BARGE_IN_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("BARGE_IN_ENABLED 格式错误: %w", err)
+		}
+		c.BargeIn.Enabled = enabled
+	}
+	if value := os.Getenv("GREETING_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("GREETING_ENABLED 格式错误: %w", err)
+		}
+		c.Greeting.Enabled = enabled
+	}
+	if value := os.Getenv("BUDGET_ROOM_TOKENS"); value != "" {
+		tokens, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("BUDGET_ROOM_TOKENS 格式错误: %w", err)
+		}
+		c.Budget.RoomTokens = tokens
+	}
+	if value := os.Getenv("BUDGET_GLOBAL_TOKENS"); value != "" {
+		tokens, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("BUDGET_GLOBAL_TOKENS 格式错误: %w", err)
+		}
+		c.Budget.GlobalTokens = tokens
+	}
+	if value := os.Getenv("HISTORY_MAX_TURNS"); value != "" {
+		turns, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("HISTORY_MAX_TURNS 格式错误: %w", err)
+		}
+		c.History.MaxTurns = turns
+	}
+	if value := os.Getenv("HISTORY_SUMMARIZE_AFTER"); value != "" {
+		turns, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("HISTORY_SUMMARIZE_AFTER 格式错误: %w", err)
+		}
+		c.History.SummarizeAfter = turns
+	}
+	overrideString(&c.History.Store, "HISTORY_STORE")
+	overrideString(&c.History.Path, "HISTORY_PATH")
+	overrideString(&c.Transcripts.Path, "TRANSCRIPTS_PATH")
+	if value := os.Getenv("ECHO_MODE"); value != "" {
+		c.Echo.Mode = EchoMode(value)
+	}
+	if value := os.Getenv("IGNORE_PARTICIPANTS"); value != "" {
+		c.IgnoreParticipants = strings.Split(value, ",")
+	}
+	if value := os.Getenv("PIPELINE"); value != "" {
+		c.Pipeline = PipelineMode(value)
+	}
+	overrideString(&c.Realtime.APIKey, "OPENAI_REALTIME_API_KEY")
+	if value := os.Getenv("END_PHRASES"); value != "" {
+		c.Audio.EndPhrases = strings.Split(value, ",")
+	}
+	if value := os.Getenv("WAKE_WORDS"); value != "" {
+		c.WakeWord.Phrases = strings.Split(value, ",")
+	}
+	overrideString(&c.Log.Level, "LOG_LEVEL")
+	overrideString(&c.Log.Format, "LOG_FORMAT")
+	if value := os.Getenv("LOG_DEBUG_API"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("LOG_DEBUG_API 格式错误: %w", err)
+		}
+		c.Log.DebugAPI = enabled
+	}
+
+	if value := os.Getenv("AUDIO_BUFFER_DURATION"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("AUDIO_BUFFER_DURATION 格式错误: %w", err)
+		}
+		c.Audio.BufferDuration = duration
+	}
+	if value := os.Getenv("SEGMENT_OVERLAP"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("SEGMENT_OVERLAP 格式错误: %w", err)
+		}
+		c.Audio.SegmentOverlap = duration
+	}
+	if value := os.Getenv("CAPTION_INTERIM_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("CAPTION_INTERIM_INTERVAL 格式错误: %w", err)
+		}
+		c.Captions.InterimInterval = interval
+	}
+	if value := os.Getenv("PREFLIGHT"); value != "" {
+		c.Preflight.Mode = PreflightMode(value)
+	}
+	if value := os.Getenv("OUTPUT_TARGET"); value != "" {
+		c.Audio.OutputTarget = OutputTarget(value)
+	}
+	if value := os.Getenv("TELEPHONY_ADDRESS"); value != "" {
+		c.Telephony.Address = value
+	}
+	if value := os.Getenv("MAX_UTTERANCE_DURATION"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("MAX_UTTERANCE_DURATION 格式错误: %w", err)
+		}
+		c.Audio.MaxUtteranceDuration = duration
+	}
+	if value := os.Getenv("MAX_REPLY_DURATION"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("MAX_REPLY_DURATION 格式错误: %w", err)
+		}
+		c.Audio.MaxReplyDuration = duration
+	}
+	if value := os.Getenv("COALESCE_WINDOW"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("COALESCE_WINDOW 格式错误: %w", err)
+		}
+		c.Audio.CoalesceWindow = duration
+	}
+	if value := os.Getenv("MAX_CONCURRENT_TURNS"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MAX_CONCURRENT_TURNS 格式错误: %w", err)
+		}
+		c.Audio.MaxConcurrentTurns = limit
+	}
+	if value := os.Getenv("LISTENING_MODE"); value != "" {
+		c.Audio.ListeningMode = ListeningMode(value)
+	}
+	overrideString(&c.Audio.FillerPath, "FILLER_PATH")
+	if value := os.Getenv("ADAPTIVE_BITRATE"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("ADAPTIVE_BITRATE 格式错误: %w", err)
+		}
+		c.Audio.AdaptiveBitrate = enabled
+	}
+	if value := os.Getenv("TTS_CONCURRENCY"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("TTS_CONCURRENCY 格式错误: %w", err)
+		}
+		c.Audio.TTSConcurrency = limit
+	}
+	if value := os.Getenv("TURN_DEADLINE"); value != "" {
+		deadline, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("TURN_DEADLINE 格式错误: %w", err)
+		}
+		c.Audio.TurnDeadline = deadline
+	}
+	if value := os.Getenv("RESPOND_TO"); value != "" {
+		c.Audio.RespondTo = RespondMode(value)
+	}
+	if value := os.Getenv("MIN_TRANSCRIPT_LENGTH"); value != "" {
+		length, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MIN_TRANSCRIPT_LENGTH 格式错误: %w", err)
+		}
+		c.Audio.MinTranscriptLength = length
+	}
+	return nil
+}
+
+func overrideString(field *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*field = value
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// CostConfig 是估算费用使用的单价（美元），请按服务商当前的价格填写。为0的项不计费，全部为0时不估算
+type CostConfig struct {
+	// 每百万个输入、输出token
+	LLMPromptPerMillion     float64 `yaml:"llm_prompt_per_million"`
+	LLMCompletionPerMillion float64 `yaml:"llm_completion_per_million"`
+	// 每小时送去识别的音频
+	STTPerHour float64 `yaml:"stt_per_hour"`
+	// 每百万个合成的字符
+	TTSPerMillionChars float64 `yaml:"tts_per_million_chars"`
+}
+
+func (c CostConfig) enabled() bool {
+	return c.LLMPromptPerMillion > 0 || c.LLMCompletionPerMillion > 0 || c.STTPerHour > 0 || c.TTSPerMillionChars > 0
+}
+
+// TurnCost 是一轮对话的用量和按单价估算的费用
+type TurnCost struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	AudioSeconds     float64 `json:"audio_seconds"`
+	Characters       int64   `json:"characters"`
+	// 各服务的费用（美元）
+	LLMUSD float64 `json:"llm_usd"`
+	STTUSD float64 `json:"stt_usd"`
+	TTSUSD float64 `json:"tts_usd"`
+}
+
+// USD 返回总费用
+func (c TurnCost) USD() float64 {
+	return c.LLMUSD + c.STTUSD + c.TTSUSD
+}
+
+func (c *TurnCost) add(usage TurnCost) {
+	c.PromptTokens += usage.PromptTokens
+	c.CompletionTokens += usage.CompletionTokens
+	c.AudioSeconds += usage.AudioSeconds
+	c.Characters += usage.Characters
+	c.LLMUSD += usage.LLMUSD
+	c.STTUSD += usage.STTUSD
+	c.TTSUSD += usage.TTSUSD
+}
+
+func (c TurnCost) empty() bool {
+	return c.PromptTokens == 0 && c.CompletionTokens == 0 && c.AudioSeconds == 0 && c.Characters == 0
+}
+
+// price 按单价计算用量的费用
+func (c CostConfig) price(usage TurnCost) TurnCost {
+	usage.LLMUSD = (float64(usage.PromptTokens)*c.LLMPromptPerMillion + float64(usage.CompletionTokens)*c.LLMCompletionPerMillion) / 1e6
+	usage.STTUSD = usage.AudioSeconds / 3600 * c.STTPerHour
+	usage.TTSUSD = float64(usage.Characters) * c.TTSPerMillionChars / 1e6
+	return usage
+}
+
+// turnCost 累计一轮对话中各服务的用量，通过上下文传给各阶段
+type turnCost struct {
+	mu    sync.Mutex
+	usage TurnCost
+}
+
+type turnCostKey struct{}
+
+func withTurnCost(ctx context.Context) context.Context {
+	return context.WithValue(ctx, turnCostKey{}, &turnCost{})
+}
+
+// costTotal 是房间从启动以来的累计费用
+type costTotal struct {
+	mu    sync.Mutex
+	total TurnCost
+}
+
+func (t *costTotal) add(usage TurnCost) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total.add(usage)
+}
+
+// Total 返回累计的用量和费用
+func (t *costTotal) Total() TurnCost {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// chargeUsage 把用量计入当前对话，对话结束时一并估算费用；不在对话中（如问候语）时直接计入房间的费用
+func (a *AIAgent) chargeUsage(ctx context.Context, usage TurnCost) {
+	if !a.config.Cost.enabled() || usage.empty() {
+		return
+	}
+	if cost, ok := ctx.Value(turnCostKey{}).(*turnCost); ok {
+		cost.mu.Lock()
+		cost.usage.add(usage)
+		cost.mu.Unlock()
+		return
+	}
+	a.settleCost(usage)
+}
+
+func (a *AIAgent) chargeAudio(ctx context.Context, audio time.Duration) {
+	a.chargeUsage(ctx, TurnCost{AudioSeconds: audio.Seconds()})
+}
+
+func (a *AIAgent) chargeCharacters(ctx context.Context, text string) {
+	a.chargeUsage(ctx, TurnCost{Characters: int64(utf8.RuneCountInString(text))})
+}
+
+// finishTurnCost 估算一轮对话的费用，计入房间的累计费用并发出 EventTurnCost 事件，没有费用时返回 nil
+func (a *AIAgent) finishTurnCost(ctx context.Context, identity string) *TurnCost {
+	cost, ok := ctx.Value(turnCostKey{}).(*turnCost)
+	if !ok {
+		return nil
+	}
+	cost.mu.Lock()
+	usage := cost.usage
+	cost.usage = TurnCost{}
+	cost.mu.Unlock()
+	if usage.empty() {
+		return nil
+	}
+
+	usage = a.settleCost(usage)
+	a.turnLogger(ctx).Debugf("本轮对话估算费用: $%.6f", usage.USD())
+	a.emit(AgentEvent{Type: EventTurnCost, ParticipantIdentity: identity, Cost: &usage})
+	return &usage
+}
+
+// settleCost 按单价计算费用，计入房间的累计费用和指标
+func (a *AIAgent) settleCost(usage TurnCost) TurnCost {
+	usage = a.config.Cost.price(usage)
+	a.costs.add(usage)
+	a.metrics.AddCost(serviceLLM, usage.LLMUSD)
+	a.metrics.AddCost(serviceSTT, usage.STTUSD)
+	a.metrics.AddCost(serviceTTS, usage.TTSUSD)
+	return usage
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTurnCostEstimate(t *testing.T) {
+	llm := &fakeLLM{reply: "好的。", usage: TokenUsage{PromptTokens: 1000, CompletionTokens: 200}}
+	stt := &fakeSTT{result: Transcript{Text: "今天天气怎么样", Confidence: 0.9, Final: true}}
+	agent, _ := newTestAgent(&AIServices{STT: stt, LLM: llm, TTS: &fakeTTS{}})
+	agent.config.Cost = CostConfig{
+		LLMPromptPerMillion:     1,
+		LLMCompletionPerMillion: 4,
+		STTPerHour:              0.36,
+		TTSPerMillionChars:      50,
+	}
+	participant := &lksdk.RemoteParticipant{}
+
+	// 一秒的发言，回复三个字
+	agent.enqueueTurn(participant, turnRequest{ctx: agent.ctx, pcm: make([]int16, sttSampleRate)})
+	agent.turns.Wait()
+
+	var costs []TurnCost
+	for len(agent.events) > 0 {
+		if event := <-agent.events; event.Type == EventTurnCost {
+			costs = append(costs, *event.Cost)
+		}
+	}
+	if len(costs) != 1 {
+		t.Fatalf("turn cost events = %+v, want one", costs)
+	}
+	cost := costs[0]
+	if cost.PromptTokens != 1000 || cost.CompletionTokens != 200 || cost.AudioSeconds != 1 || cost.Characters != 3 {
+		t.Errorf("usage = %+v", cost)
+	}
+	// 1000*1/1e6 + 200*4/1e6 + 1/3600*0.36 + 3*50/1e6
+	if want := 0.0018 + 0.0001 + 0.00015; math.Abs(cost.USD()-want) > 1e-9 {
+		t.Errorf("cost = $%v, want $%v", cost.USD(), want)
+	}
+
+	total := agent.costs.Total()
+	if math.Abs(total.USD()-cost.USD()) > 1e-9 {
+		t.Errorf("room total = $%v, want $%v", total.USD(), cost.USD())
+	}
+	if got := testutil.ToFloat64(agent.metrics.costUSD.WithLabelValues(serviceLLM)); math.Abs(got-total.LLMUSD) > 1e-9 {
+		t.Errorf("cost_usd_total{service=llm} = %v, want %v", got, total.LLMUSD)
+	}
+}
+
+func TestCostDisabledWithoutPrices(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{LLM: &fakeLLM{reply: "好的。", usage: TokenUsage{PromptTokens: 10}}})
+	agent.enqueueTurn(&lksdk.RemoteParticipant{}, turnRequest{ctx: agent.ctx, text: "你好"})
+	agent.turns.Wait()
+
+	for len(agent.events) > 0 {
+		if event := <-agent.events; event.Type == EventTurnCost {
+			t.Errorf("turn cost emitted without prices: %+v", event.Cost)
+		}
+	}
+	if total := agent.costs.Total(); !total.empty() {
+		t.Errorf("room total = %+v, want nothing charged", total)
+	}
+}
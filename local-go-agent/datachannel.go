@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	dataTypeChat  = "chat"
+	dataTypePTT   = "ptt"
+	dataTypeDTMF  = "dtmf"
+	dataTypeReset = "reset"
+
+	pttStateStart = "start"
+	pttStateStop  = "stop"
+)
+
+// dataPublisher 发布数据通道消息，连接后由房间的本地参与者实现
+type dataPublisher interface {
+	PublishDataPacket(pck lksdk.DataPacket, opts ...lksdk.DataPublishOption) error
+}
+
+// DataMessage 是客户端通过数据通道发送的JSON消息格式，纯文本消息视为 chat 类型。
+// 按键说话模式下客户端发送 {"type":"ptt","state":"start"|"stop"} 控制收听，
+// 按键菜单发送 {"type":"dtmf","digit":"5"}，{"type":"reset"} 清空发送者的对话历史，
+// {"type":"egress","state":"start"|"stop"} 开始或停止房间录制，{"type":"persona","name":"translator"} 切换发送者的人设
+type DataMessage struct {
+	Type  string `json:"type"`
+	Text  string `json:"text,omitempty"`
+	State string `json:"state,omitempty"`
+	Digit string `json:"digit,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// parseDataMessage 解析数据通道消息，支持纯UTF-8文本和 {type, text} JSON信封
+func parseDataMessage(payload []byte) (DataMessage, bool) {
+	if !utf8.Valid(payload) {
+		return DataMessage{}, false
+	}
+
+	content := strings.TrimSpace(string(payload))
+	if content == "" {
+		return DataMessage{}, false
+	}
+
+	if strings.HasPrefix(content, "{") {
+		var message DataMessage
+		if err := json.Unmarshal([]byte(content), &message); err == nil {
+			if message.Type == "" {
+				message.Type = dataTypeChat
+			}
+			message.Text = strings.TrimSpace(message.Text)
+			return message, true
+		}
+	}
+
+	return DataMessage{Type: dataTypeChat, Text: content}, true
+}
+
+func (a *AIAgent) onDataReceived(packet lksdk.DataPacket, params lksdk.DataReceiveParams) {
+	userPacket, ok := packet.(*lksdk.UserDataPacket)
+	if !ok {
+		return
+	}
+
+	// 忽略自己发布的数据，避免自问自答
+	if params.SenderIdentity == "" || params.SenderIdentity == a.connectInfo.ParticipantIdentity {
+		return
+	}
+	if params.Sender == nil {
+		a.logger.Warnf("收到未知参与者 %s 的数据消息，忽略", params.SenderIdentity)
+		return
+	}
+	if a.isIgnored(params.SenderIdentity) {
+		return
+	}
+
+	message, ok := parseDataMessage(userPacket.Payload)
+	if !ok {
+		return
+	}
+
+	switch message.Type {
+	case dataTypeChat:
+		if message.Text == "" {
+			return
+		}
+		a.enqueueTurn(params.Sender, turnRequest{ctx: a.session(), text: message.Text})
+	case dataTypePTT:
+		a.handlePushToTalk(params.SenderIdentity, message.State)
+	case dataTypeDTMF:
+		a.handleDTMF(params.Sender, message.Digit)
+	case dataTypeReset:
+		a.handleReset(params.Sender)
+	case dataTypeEgress:
+		a.handleEgress(params.Sender, message.State)
+	case dataTypePersona:
+		a.handlePersonaMessage(params.Sender, message.Name)
+	default:
+		a.logger.Debugf("忽略未知类型的数据消息: %s", message.Type)
+	}
+}
+
+func (a *AIAgent) handlePushToTalk(identity, state string) {
+	if a.config.Audio.ListeningMode != ListeningModePushToTalk {
+		a.logger.Debugf("未启用按键说话模式，忽略 %s 的 ptt 消息", identity)
+		return
+	}
+	switch state {
+	case pttStateStart:
+		a.setPushToTalk(identity, true)
+	case pttStateStop:
+		a.setPushToTalk(identity, false)
+		// 松开按键后客户端可能不再发送音频（静音、DTX），不等下一帧，立即送出发言
+		a.flushParticipantTracks(identity)
+	default:
+		a.logger.Warnf("未知的 ptt 状态: %s", state)
+		return
+	}
+	a.logger.Debugf("%s 按键说话: %s", identity, state)
+}
+
+// handleChatMessage 将文字消息直接送入LLM（跳过语音识别），回复同时以文本和语音发送
+func (a *AIAgent) handleChatMessage(ctx context.Context, text string, participant *lksdk.RemoteParticipant) {
+	ctx = withTurnTimings(ctx)
+	logger := a.turnLogger(ctx)
+	identity := participant.Identity()
+	logger.Infof("收到 %s 的文字消息: %s", identity, text)
+	turnStart := time.Now()
+
+	if a.isResetPhrase(text) {
+		a.resetConversation(ctx, participant)
+		return
+	}
+	if name, ok := a.personaSwitchRequest(text); ok {
+		a.switchPersona(ctx, participant, name)
+		return
+	}
+
+	a.emit(AgentEvent{Type: EventTranscriptReceived, ParticipantIdentity: identity, Text: text})
+
+	language := a.participantLanguage(identity)
+	if language == "" {
+		language = a.personaFor(identity).Language
+	}
+	speech := a.startSpeech(ctx, participant, language)
+	reply := a.generateReply(ctx, participant, identity, text, language, speech)
+	if ctx.Err() == nil {
+		a.sendTextMessage(stripVoiceTags(reply))
+	}
+	speech.Finish(reply)
+	if ctx.Err() != nil {
+		return
+	}
+	a.saveTurn(ctx, identity, text, stripVoiceTags(reply))
+
+	a.metrics.ObserveTurn(time.Since(turnStart))
+}
@@ -0,0 +1,30 @@
+package main
+
+import "strings"
+
+// 伪身份中参与者身份与说话人标签之间的分隔符
+const speakerSeparator = "#"
+
+// SpeakerTurn 是说话人分离后某位说话人连续说的一段话
+type SpeakerTurn struct {
+	// AssemblyAI 按出现顺序分配的说话人标签，如 "A"、"B"。标签在每次识别中重新分配，
+	// 不同发言中的同一标签不保证是同一个人
+	Speaker string
+	Text    string
+	StartMs int64
+	EndMs   int64
+}
+
+// speakerIdentity 返回混音轨道中某位说话人的伪身份，用于区分字幕和对话历史
+func speakerIdentity(identity, speaker string) string {
+	return identity + speakerSeparator + speaker
+}
+
+// wordSpeaker 返回说出某个词的说话人：词带有说话人标签时为混音轨道中该说话人的伪身份，
+// identity 已经是该伪身份或词没有标签时为 identity
+func wordSpeaker(identity string, word Word) string {
+	if word.Speaker == "" || strings.HasSuffix(identity, speakerSeparator+word.Speaker) {
+		return identity
+	}
+	return speakerIdentity(identity, word.Speaker)
+}
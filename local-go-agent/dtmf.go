@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// 电话键盘上的按键
+const dtmfDigits = "0123456789*#ABCD"
+
+// DTMFEvent 是参与者通过数据通道发送的一次按键，格式为 {"type":"dtmf","digit":"5"}
+type DTMFEvent struct {
+	Participant *lksdk.RemoteParticipant
+	Digit       string
+}
+
+// DTMFHandler 处理参与者的按键，用于不依赖语音的菜单导航
+type DTMFHandler interface {
+	HandleDTMF(ctx context.Context, agent *AIAgent, event DTMFEvent) error
+}
+
+// DTMFAction 是按键菜单中一个按键对应的动作，多项同时设置时依次切换人设、播报、挂断
+type DTMFAction struct {
+	// 切换到的人设，空字段沿用当前人设
+	Persona Persona `yaml:"persona"`
+	// 播报给参与者的文字，同时以文本和语音发送
+	Say string `yaml:"say"`
+	// 把参与者移出房间，需要配置LiveKit API密钥
+	Hangup bool `yaml:"hangup"`
+}
+
+// DTMFMenu 按配置把按键映射为动作，未配置的按键被忽略
+type DTMFMenu map[string]DTMFAction
+
+func (m DTMFMenu) HandleDTMF(ctx context.Context, agent *AIAgent, event DTMFEvent) error {
+	action, ok := m[event.Digit]
+	if !ok {
+		agent.turnLogger(ctx).Debugf("按键 %s 未配置动作，忽略", event.Digit)
+		return nil
+	}
+
+	if !action.Persona.isZero() {
+		agent.setPersona(agent.currentPersona().merge(action.Persona))
+		agent.turnLogger(ctx).Infof("按键 %s 切换了人设", event.Digit)
+	}
+	if action.Say != "" {
+		agent.say(ctx, event.Participant, action.Say)
+	}
+	if action.Hangup {
+		return agent.hangUp(ctx, event.Participant.Identity())
+	}
+	return nil
+}
+
+func (m DTMFMenu) validate() error {
+	for digit, action := range m {
+		if !validDTMFDigit(digit) {
+			return fmt.Errorf("无效的按键: %q", digit)
+		}
+		if action.Persona.SystemPrompt != "" {
+			if _, err := ParsePromptTemplate(action.Persona.SystemPrompt); err != nil {
+				return fmt.Errorf("按键 %s: %w", digit, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validDTMFDigit(digit string) bool {
+	return len(digit) == 1 && strings.Contains(dtmfDigits, digit)
+}
+
+// SetDTMFHandler 设置按键处理器，覆盖配置中的按键菜单
+func (a *AIAgent) SetDTMFHandler(handler DTMFHandler) {
+	a.dtmf = handler
+}
+
+func (a *AIAgent) handleDTMF(participant *lksdk.RemoteParticipant, digit string) {
+	digit = strings.ToUpper(strings.TrimSpace(digit))
+	if !validDTMFDigit(digit) {
+		a.logger.Warnf("收到 %s 的无效按键: %q", participant.Identity(), digit)
+		return
+	}
+	if a.dtmf == nil {
+		a.logger.Debugf("未配置按键菜单，忽略 %s 的按键 %s", participant.Identity(), digit)
+		return
+	}
+
+	ctx := a.withTurn(a.session(), participant.Identity())
+	a.startTurn(func() {
+		a.turnLogger(ctx).Infof("%s 按下了 %s", participant.Identity(), digit)
+		if err := a.dtmf.HandleDTMF(ctx, a, DTMFEvent{Participant: participant, Digit: digit}); err != nil {
+			a.turnLogger(ctx).Errorf("处理按键 %s 失败: %v", digit, err)
+		}
+	})
+}
+
+// say 向参与者播报一段固定的文字，同时发送文本消息
+func (a *AIAgent) say(ctx context.Context, participant *lksdk.RemoteParticipant, text string) {
+	language := a.participantLanguage(participant.Identity())
+	if language == "" {
+		language = a.personaFor(participant.Identity()).Language
+	}
+	a.sendTextMessage(text)
+	a.startSpeech(ctx, participant, language).Finish(text)
+}
+
+// hangUp 通过服务端API把参与者移出房间
+func (a *AIAgent) hangUp(ctx context.Context, identity string) error {
+	if a.connectInfo.APIKey == "" || a.connectInfo.APISecret == "" {
+		return fmt.Errorf("未配置LiveKit API密钥，无法挂断")
+	}
+	client := lksdk.NewRoomServiceClient(a.serverURL(), a.connectInfo.APIKey, a.connectInfo.APISecret)
+	_, err := client.RemoveParticipant(ctx, &livekit.RoomParticipantIdentity{
+		Room:     a.connectInfo.RoomName,
+		Identity: identity,
+	})
+	if err != nil {
+		return fmt.Errorf("移出参与者 %s 失败: %w", identity, err)
+	}
+	a.turnLogger(ctx).Infof("已挂断 %s", identity)
+	return nil
+}
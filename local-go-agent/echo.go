@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// EchoMode 是用于测试连通性的回声模式，开启后不调用语音识别和语言模型，
+// 可以在配置API密钥之前确认LiveKit连接和音频的收发是否正常
+type EchoMode string
+
+const (
+	EchoModeOff EchoMode = ""
+	// EchoModeLoopback 把收到的每段发言原样播放回去，文字消息原样发回，不需要任何API密钥
+	EchoModeLoopback EchoMode = "loopback"
+	// EchoModePhrase 每段发言后回复固定的短语，没有语音合成服务时只以文字回复
+	EchoModePhrase EchoMode = "phrase"
+)
+
+const defaultEchoPhrase = "我听到你了。"
+
+func (m EchoMode) validate() error {
+	switch m {
+	case EchoModeOff, EchoModeLoopback, EchoModePhrase:
+		return nil
+	default:
+		return fmt.Errorf("未知的回声模式: %s", m)
+	}
+}
+
+// listensToAudio 判断是否订阅和处理音频轨道，回声模式和 realtime 流水线下即使没有语音识别服务也处理
+func (a *AIAgent) listensToAudio() bool {
+	return a.config.LiveKit.Subscribe && (!a.Capabilities().TextOnly() || a.config.Echo.Mode != EchoModeOff || a.realtime != nil)
+}
+
+// speaksAudio 判断是否发布语音轨道，回放模式和 realtime 流水线下即使没有语音合成服务也发布
+func (a *AIAgent) speaksAudio() bool {
+	return a.config.LiveKit.Publish && (a.Capabilities().TTS || a.config.Echo.Mode == EchoModeLoopback || a.realtime != nil)
+}
+
+// echo 代替一轮对话：回放收到的发言或回复固定的短语
+func (a *AIAgent) echo(ctx context.Context, request turnRequest, participant *lksdk.RemoteParticipant) {
+	logger := a.turnLogger(ctx)
+	if a.config.Echo.Mode == EchoModePhrase {
+		phrase := a.config.Echo.Phrase
+		if phrase == "" {
+			phrase = defaultEchoPhrase
+		}
+		a.say(ctx, participant, phrase)
+		return
+	}
+
+	if request.text != "" {
+		a.sendTextMessage(request.text)
+		return
+	}
+	logger.Infof("回放 %s 的发言", participant.Identity())
+	a.sendAudioMessage(ctx, s16leToFloat32(int16ToBytes(request.pcm)), sttSampleRate, participant)
+}
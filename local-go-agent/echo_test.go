@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// captureOutput 记录写入的语音
+type captureOutput struct {
+	mu      sync.Mutex
+	samples int
+}
+
+func (c *captureOutput) Write(samples []float32, sampleRate int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples += len(samples) * sttSampleRate / sampleRate
+}
+
+func TestEchoLoopback(t *testing.T) {
+	// 不配置任何AI服务也能回放
+	agent, publisher := newTestAgent(&AIServices{})
+	agent.config.Echo.Mode = EchoModeLoopback
+	output := &captureOutput{}
+	agent.audioOut = output
+
+	pcm := make([]int16, sttSampleRate/2)
+	agent.echo(context.Background(), turnRequest{pcm: pcm}, &lksdk.RemoteParticipant{})
+	if output.samples != len(pcm) {
+		t.Errorf("played %d samples, want %d", output.samples, len(pcm))
+	}
+
+	agent.echo(context.Background(), turnRequest{text: "你好"}, &lksdk.RemoteParticipant{})
+	if messages := publisher.Messages(); !reflect.DeepEqual(messages, []string{"你好"}) {
+		t.Errorf("messages = %q, want the chat message echoed", messages)
+	}
+}
+
+func TestEchoPhrase(t *testing.T) {
+	llm := &fakeLLM{reply: "不应调用"}
+	agent, publisher := newTestAgent(&AIServices{LLM: llm})
+	agent.config.Echo.Mode = EchoModePhrase
+
+	agent.echo(context.Background(), turnRequest{pcm: make([]int16, sttSampleRate/10)}, &lksdk.RemoteParticipant{})
+	if messages := publisher.Messages(); !reflect.DeepEqual(messages, []string{defaultEchoPhrase}) {
+		t.Errorf("messages = %q, want the canned phrase", messages)
+	}
+	if calls := llm.Calls(); calls != 0 {
+		t.Errorf("llm called %d times in echo mode", calls)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	dataTypeEgress = "egress"
+
+	egressStateStart = "start"
+	egressStateStop  = "stop"
+)
+
+const defaultEgressFilepath = "recordings/{room_name}-{time}"
+
+var (
+	errEgressRunning = errors.New("房间录制已在进行中")
+	errNoEgress      = errors.New("没有进行中的房间录制")
+)
+
+// EgressOptions 是房间录制的参数，为空的字段使用egress服务的默认值
+type EgressOptions struct {
+	// 录制文件路径，支持 egress 的 {room_name}、{time} 等模板
+	Filepath string
+	// 只录制音频，保存为 OGG；否则录制房间画面，保存为 MP4
+	AudioOnly bool
+	// 房间画面的布局，如 grid、speaker
+	Layout string
+}
+
+// egressClient 创建LiveKit egress服务的客户端，需要API密钥
+func (a *AIAgent) egressClient() (*lksdk.EgressClient, error) {
+	if a.connectInfo.APIKey == "" || a.connectInfo.APISecret == "" {
+		return nil, fmt.Errorf("未配置LiveKit API密钥，无法录制房间")
+	}
+	return lksdk.NewEgressClient(a.serverURL(), a.connectInfo.APIKey, a.connectInfo.APISecret), nil
+}
+
+// StartEgress 开始录制房间，返回 egress ID。房间已有进行中的录制时（包括代理重启前开始的录制）
+// 返回该录制的ID和 errEgressRunning，并记录该录制以便之后停止
+func (a *AIAgent) StartEgress(ctx context.Context, opts EgressOptions) (string, error) {
+	a.egressMu.Lock()
+	defer a.egressMu.Unlock()
+
+	client, err := a.egressClient()
+	if err != nil {
+		return "", err
+	}
+
+	// 以服务端为准：录制可能因房间清空或达到时长上限自行结束
+	roomName := a.connectInfo.RoomName
+	active, err := client.ListEgress(ctx, &livekit.ListEgressRequest{RoomName: roomName, Active: true})
+	if err != nil {
+		return "", fmt.Errorf("查询房间录制失败: %w", err)
+	}
+	if len(active.Items) > 0 {
+		a.egressID = active.Items[0].EgressId
+		return a.egressID, errEgressRunning
+	}
+	a.egressID = ""
+
+	fileType := livekit.EncodedFileType_MP4
+	if opts.AudioOnly {
+		fileType = livekit.EncodedFileType_OGG
+	}
+	info, err := client.StartRoomCompositeEgress(ctx, &livekit.RoomCompositeEgressRequest{
+		RoomName:    roomName,
+		Layout:      opts.Layout,
+		AudioOnly:   opts.AudioOnly,
+		FileOutputs: []*livekit.EncodedFileOutput{{FileType: fileType, Filepath: opts.Filepath}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("开始房间录制失败: %w", err)
+	}
+	a.egressID = info.EgressId
+	a.logger.Infof("已开始房间录制: %s", a.egressID)
+	return a.egressID, nil
+}
+
+// StopEgress 停止 StartEgress 开始的录制，没有进行中的录制时返回 errNoEgress
+func (a *AIAgent) StopEgress(ctx context.Context) error {
+	a.egressMu.Lock()
+	defer a.egressMu.Unlock()
+
+	if a.egressID == "" {
+		return errNoEgress
+	}
+	client, err := a.egressClient()
+	if err != nil {
+		return err
+	}
+	if _, err := client.StopEgress(ctx, &livekit.StopEgressRequest{EgressId: a.egressID}); err != nil {
+		// 录制已经自行结束时不算失败
+		active, listErr := client.ListEgress(ctx, &livekit.ListEgressRequest{EgressId: a.egressID, Active: true})
+		if listErr == nil && len(active.Items) == 0 {
+			a.egressID = ""
+			return errNoEgress
+		}
+		return fmt.Errorf("停止房间录制 %s 失败: %w", a.egressID, err)
+	}
+	a.logger.Infof("已停止房间录制: %s", a.egressID)
+	a.egressID = ""
+	return nil
+}
+
+// egressOptions 返回配置中的录制参数
+func (a *AIAgent) egressOptions() EgressOptions {
+	cfg := a.config.Egress
+	return EgressOptions{Filepath: cfg.Filepath, AudioOnly: cfg.AudioOnly, Layout: cfg.Layout}
+}
+
+// handleEgress 处理客户端发送的 {"type":"egress","state":"start"|"stop"}，并以文本消息告知结果
+func (a *AIAgent) handleEgress(participant *lksdk.RemoteParticipant, state string) {
+	if !a.config.Egress.Enabled {
+		a.logger.Debugf("未开启房间录制命令，忽略 %s 的 egress 消息", participant.Identity())
+		return
+	}
+	if state != egressStateStart && state != egressStateStop {
+		a.logger.Warnf("未知的 egress 状态: %s", state)
+		return
+	}
+
+	ctx := a.withTurn(a.session(), participant.Identity())
+	a.startTurn(func() {
+		logger := a.turnLogger(ctx)
+		if state == egressStateStart {
+			_, err := a.StartEgress(ctx, a.egressOptions())
+			switch {
+			case errors.Is(err, errEgressRunning):
+				a.sendTextMessage("录制已在进行中。")
+			case err != nil:
+				logger.Errorf("%v", err)
+				a.sendTextMessage("抱歉，无法开始录制。")
+			default:
+				a.sendTextMessage("已开始录制。")
+			}
+			return
+		}
+
+		err := a.StopEgress(ctx)
+		switch {
+		case errors.Is(err, errNoEgress):
+			a.sendTextMessage("当前没有进行中的录制。")
+		case err != nil:
+			logger.Errorf("%v", err)
+			a.sendTextMessage("抱歉，无法停止录制。")
+		default:
+			a.sendTextMessage("已停止录制。")
+		}
+	})
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEgressRequiresCredentials(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+
+	if _, err := agent.StartEgress(context.Background(), agent.egressOptions()); err == nil {
+		t.Error("StartEgress succeeded without API credentials")
+	}
+	if err := agent.StopEgress(context.Background()); !errors.Is(err, errNoEgress) {
+		t.Errorf("StopEgress = %v, want errNoEgress", err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// trimEndPhrase 去掉文本末尾的结束短语，不区分大小写，忽略短语前后的空白和标点。
+// 英文短语必须是完整的单词，例如 "over" 不匹配 "hover"。返回去掉短语后的文本和是否找到了短语
+func trimEndPhrase(text string, phrases []string) (string, bool) {
+	trimmed := strings.TrimRightFunc(text, isSpaceOrPunct)
+	for _, phrase := range phrases {
+		phrase = strings.TrimFunc(phrase, isSpaceOrPunct)
+		if phrase == "" || len(trimmed) < len(phrase) {
+			continue
+		}
+		rest, suffix := trimmed[:len(trimmed)-len(phrase)], trimmed[len(trimmed)-len(phrase):]
+		if !strings.EqualFold(suffix, phrase) {
+			continue
+		}
+		if first := []rune(phrase)[0]; first < unicode.MaxASCII && unicode.IsLetter(first) {
+			if last := []rune(rest); len(last) > 0 && (unicode.IsLetter(last[len(last)-1]) || unicode.IsDigit(last[len(last)-1])) {
+				continue
+			}
+		}
+		return strings.TrimRightFunc(rest, isSpaceOrPunct), true
+	}
+	return text, false
+}
+
+func isSpaceOrPunct(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r)
+}
+
+// 识别会话打开前最多缓冲的音频帧数，约10秒
+const endpointMaxPendingFrames = 500
+
+// endpointStream 把发言中的音频同时送入流式识别，在中间结果中检测结束短语，
+// 不必等到静音就能结束一段较长的口述。每段发言使用一次新的识别会话，会话在后台打开，
+// 不阻塞读取RTP包，打开前的音频先缓冲，打开后补写
+type endpointStream struct {
+	stt     StreamingSpeechToText
+	phrases []string
+	// 打开识别会话时使用的语言
+	language func() string
+	logf     func(format string, args ...interface{})
+	// 在代理的后台协程中运行，Shutdown 时等待
+	spawn func(name string, fn func()) bool
+
+	stream TranscriptStream
+	// 正在后台打开识别会话，打开后从 dialed 取出，失败时取出 nil
+	dialed chan TranscriptStream
+	cancel context.CancelFunc
+	// 识别会话打开前的音频帧
+	pending [][]int16
+	// 本段发言的识别会话出错后不再重试，等下一段发言
+	failed bool
+}
+
+// newEndpointStream 在配置了结束短语且识别服务支持流式识别时返回检测器，否则返回 nil
+func (a *AIAgent) newEndpointStream(identity string) *endpointStream {
+	streaming, ok := a.stt.(StreamingSpeechToText)
+	if !ok || len(a.config.Audio.EndPhrases) == 0 {
+		return nil
+	}
+	return &endpointStream{
+		stt:      streaming,
+		phrases:  a.config.Audio.EndPhrases,
+		language: func() string { return a.participantLanguage(identity) },
+		logf:     a.logger.Warnf,
+		spawn:    a.spawn,
+	}
+}
+
+// Write 把一帧发言中的音频送入识别，返回已收到的中间结果是否以结束短语结尾
+func (e *endpointStream) Write(ctx context.Context, pcm []int16) bool {
+	if e == nil || e.failed {
+		return false
+	}
+	frames := [][]int16{pcm}
+	if e.stream == nil {
+		if e.dialed == nil {
+			e.dial(ctx)
+		}
+		select {
+		case stream := <-e.dialed:
+			e.dialed = nil
+			if stream == nil {
+				e.reset()
+				e.failed = true
+				return false
+			}
+			e.stream = stream
+			frames = append(e.pending, pcm)
+			e.pending = nil
+		default:
+			if len(e.pending) < endpointMaxPendingFrames {
+				e.pending = append(e.pending, pcm)
+			}
+			return false
+		}
+	}
+	for _, frame := range frames {
+		if err := e.stream.Write(int16ToBytes(frame)); err != nil {
+			e.logf("流式识别写入失败，本段发言只按静音结束: %v", err)
+			e.reset()
+			e.failed = true
+			return false
+		}
+	}
+
+	for {
+		select {
+		case result, ok := <-e.stream.Results():
+			if !ok {
+				e.reset()
+				e.failed = true
+				return false
+			}
+			if _, found := trimEndPhrase(result.Text, e.phrases); found {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
+
+// dial 在后台打开本段发言的识别会话
+func (e *endpointStream) dial(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	dialed := make(chan TranscriptStream, 1)
+	e.dialed, e.cancel = dialed, cancel
+	language := e.language()
+	started := e.spawn("结束短语识别", func() {
+		stream, err := e.stt.StartStream(ctx, language)
+		if err != nil {
+			if ctx.Err() == nil {
+				e.logf("打开流式识别失败，本段发言只按静音结束: %v", err)
+			}
+			dialed <- nil
+			return
+		}
+		dialed <- stream
+	})
+	if !started {
+		dialed <- nil
+	}
+}
+
+// Reset 在一段发言结束后关闭识别会话，下一段发言重新打开
+func (e *endpointStream) Reset() {
+	if e == nil {
+		return
+	}
+	e.reset()
+	e.failed = false
+}
+
+// reset 关闭识别会话，还在打开的会话打开后立即关闭
+func (e *endpointStream) reset() {
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+	if e.stream != nil {
+		e.stream.Close()
+		e.stream = nil
+	}
+	if dialed := e.dialed; dialed != nil {
+		e.dialed = nil
+		e.spawn("关闭结束短语识别", func() {
+			if stream := <-dialed; stream != nil {
+				stream.Close()
+			}
+		})
+	}
+	e.pending = nil
+}
+
+// stripEndPhrase 从最终转录结果中去掉结束短语，不发送给LLM。
+// 说话人分离时短语在最后一位说话人的话中
+func (a *AIAgent) stripEndPhrase(transcript Transcript) Transcript {
+	phrases := a.config.Audio.EndPhrases
+	if len(phrases) == 0 {
+		return transcript
+	}
+	transcript.Text, _ = trimEndPhrase(transcript.Text, phrases)
+	if n := len(transcript.Speakers); n > 0 {
+		speakers := append([]SpeakerTurn(nil), transcript.Speakers...)
+		speakers[n-1].Text, _ = trimEndPhrase(speakers[n-1].Text, phrases)
+		transcript.Speakers = speakers
+	}
+	return transcript
+}
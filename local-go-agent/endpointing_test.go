@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestTrimEndPhrase(t *testing.T) {
+	phrases := []string{"完了", "over"}
+	tests := []struct {
+		text  string
+		want  string
+		found bool
+	}{
+		{"今天的会议记录就这些，完了。", "今天的会议记录就这些", true},
+		{"that's all, Over!", "that's all", true},
+		{"please hover", "please hover", false},
+		{"完了", "", true},
+		{"完了以后再说", "完了以后再说", false},
+	}
+	for _, tt := range tests {
+		got, found := trimEndPhrase(tt.text, phrases)
+		if got != tt.want || found != tt.found {
+			t.Errorf("trimEndPhrase(%q) = %q, %v; want %q, %v", tt.text, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+// fakeStreamingSTT 在写入 after 帧后给出一条中间结果
+type fakeStreamingSTT struct {
+	fakeSTT
+	interim string
+	after   int
+
+	mu      sync.Mutex
+	streams []*fakeTranscriptStream
+}
+
+func (f *fakeStreamingSTT) Streams() []*fakeTranscriptStream {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*fakeTranscriptStream(nil), f.streams...)
+}
+
+func (f *fakeStreamingSTT) StartStream(ctx context.Context, lang string) (TranscriptStream, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stream := &fakeTranscriptStream{interim: f.interim, after: f.after, results: make(chan Transcript, 1)}
+	f.streams = append(f.streams, stream)
+	return stream, nil
+}
+
+type fakeTranscriptStream struct {
+	interim string
+	after   int
+	writes  int
+	closed  bool
+	results chan Transcript
+}
+
+func (s *fakeTranscriptStream) Write(pcm []byte) error {
+	s.writes++
+	if s.writes == s.after {
+		s.results <- Transcript{Text: s.interim}
+	}
+	return nil
+}
+
+func (s *fakeTranscriptStream) Results() <-chan Transcript { return s.results }
+
+func (s *fakeTranscriptStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestEndPhraseEndsTurn(t *testing.T) {
+	stt := &fakeStreamingSTT{
+		fakeSTT: fakeSTT{result: Transcript{Text: "第一条，买牛奶。完了。", Confidence: 0.9, Final: true}},
+		interim: "第一条 买牛奶 完了",
+		after:   5,
+	}
+	agent, _ := newTestAgent(&AIServices{STT: stt, LLM: &fakeLLM{reply: "好的。"}, TTS: &fakeTTS{}})
+	agent.config.Audio.ListeningMode = ListeningModeVAD
+	agent.config.Audio.VADSilence = time.Minute
+	agent.config.Audio.EndPhrases = []string{"完了"}
+
+	participant := &lksdk.RemoteParticipant{}
+	ingest := agent.newAudioIngest(participant, "track")
+	ctx := context.Background()
+	// 识别会话在后台打开，打开前的音频先缓冲，不阻塞推送
+	ingest.Push(ctx, toneFrame(8000))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ingest.endpoint.dialed) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 2; i <= 5; i++ {
+		delivered := ingest.Push(ctx, toneFrame(8000))
+		// 一直在说话，只有中间结果中的结束短语能结束发言
+		if delivered != (i == 5) {
+			t.Fatalf("frame %d delivered = %v", i, delivered)
+		}
+	}
+	agent.turns.Wait()
+
+	if streams := stt.Streams(); len(streams) != 1 || !streams[0].closed || streams[0].writes != 5 {
+		t.Errorf("streaming session should receive all 5 frames and be closed after the turn ends")
+	}
+	history := agent.conversation(participant.Identity()).Messages()
+	if len(history) == 0 || history[0].Content != "第一条，买牛奶" {
+		t.Errorf("history = %+v, want the end phrase stripped", history)
+	}
+
+	// 下一段发言重新打开识别会话
+	ingest.Push(ctx, toneFrame(8000))
+	agent.tasks.Wait()
+	if streams := stt.Streams(); len(streams) != 2 {
+		t.Errorf("streams = %d, want a new session for the next utterance", len(streams))
+	}
+}
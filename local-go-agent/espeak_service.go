@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// EspeakService 调用本地 espeak-ng 合成语音，不依赖网络，可在没有云端TTS时作为备用
+type EspeakService struct {
+	binary string
+	voice  string
+}
+
+func NewEspeakService(binary string) (*EspeakService, error) {
+	if binary == "" {
+		binary = "espeak-ng"
+	}
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("找不到 %s: %w", binary, err)
+	}
+	return &EspeakService{binary: path}, nil
+}
+
+func NewEspeakServiceFromConfig(cfg EspeakConfig) (*EspeakService, error) {
+	service, err := NewEspeakService(cfg.Binary)
+	if err != nil {
+		return nil, err
+	}
+	service.voice = cfg.Voice
+	return service, nil
+}
+
+func (s *EspeakService) Synthesize(ctx context.Context, text string) (io.ReadCloser, AudioFormat, error) {
+	return s.SynthesizeWithOptions(ctx, text, SpeechOptions{})
+}
+
+// SynthesizeWithOptions 依次使用指定声音、配置的固定声音、与语言代码同名的 espeak 声音
+func (s *EspeakService) SynthesizeWithOptions(ctx context.Context, text string, opts SpeechOptions) (io.ReadCloser, AudioFormat, error) {
+	args := []string{"--stdout"}
+	if voice := opts.Voice; voice != "" {
+		args = append(args, "-v", voice)
+	} else if voice := s.voice; voice != "" {
+		args = append(args, "-v", voice)
+	} else if opts.Language != "" {
+		args = append(args, "-v", opts.Language)
+	}
+	args = append(args, text)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.binary, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, AudioFormat{}, fmt.Errorf("espeak合成失败: %v: %s", err, stderr.String())
+	}
+
+	pcm, format, err := parseWAV(output)
+	if err != nil {
+		return nil, AudioFormat{}, err
+	}
+	return io.NopCloser(bytes.NewReader(pcm)), format, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import "time"
+
+type AgentEventType string
+
+const (
+	EventParticipantJoined  AgentEventType = "participant_joined"
+	EventTranscriptReceived AgentEventType = "transcript_received"
+	EventResponseGenerated  AgentEventType = "response_generated"
+	// 代理开始/结束播放语音回复
+	EventSpeechStarted AgentEventType = "speech_started"
+	EventSpeechEnded   AgentEventType = "speech_ended"
+	EventError         AgentEventType = "error"
+	// 参与者的音量，按 audio.level_interval 周期上报
+	EventAudioLevel AgentEventType = "audio_level"
+	// 代理静音或移出了参与者，Text 为操作原因
+	EventModeration AgentEventType = "moderation"
+	// 一轮对话结束，携带按 cost 单价估算的费用
+	EventTurnCost AgentEventType = "turn_cost"
+	// 参与者插话打断了正在播放的回复
+	EventBargeIn AgentEventType = "barge_in"
+	// 参与者说出了唤醒词
+	EventWakeWord AgentEventType = "wake_word"
+	// 一轮对话处理完毕，有费用时携带 Cost
+	EventTurnComplete AgentEventType = "turn_complete"
+)
+
+// 事件通道的缓冲大小，缓冲区满时新事件会被丢弃，避免慢消费者阻塞音频处理
+const eventBufferSize = 256
+
+type AgentEvent struct {
+	Type                AgentEventType
+	ParticipantIdentity string
+	Timestamp           time.Time
+	// 转录文本或AI回复文本，取决于事件类型
+	Text string
+	// 仅 EventError 事件携带
+	Err error
+	// 仅 EventAudioLevel 事件携带
+	Level AudioLevel
+	// 仅 EventModeration 事件携带: mute 或 remove
+	Action string
+	// 仅 EventTurnCost 事件携带
+	Cost *TurnCost
+}
+
+// Events 返回代理的事件通道，供外部统计、展示或保存对话使用
+func (a *AIAgent) Events() <-chan AgentEvent {
+	return a.events
+}
+
+func (a *AIAgent) emit(event AgentEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	select {
+	case a.events <- event:
+	default:
+		a.logger.Debugf("事件通道已满，丢弃事件: %s", event.Type)
+	}
+	a.dispatch(event)
+}
+
+func (a *AIAgent) emitError(identity string, err error) {
+	a.emit(AgentEvent{Type: EventError, ParticipantIdentity: identity, Err: err})
+}
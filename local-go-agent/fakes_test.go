@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeSTT 返回固定的转录结果
+type fakeSTT struct {
+	result Transcript
+	err    error
+}
+
+func (f *fakeSTT) Transcribe(ctx context.Context, pcm []byte, lang string) (Transcript, error) {
+	if f.err != nil {
+		return Transcript{}, f.err
+	}
+	return f.result, nil
+}
+
+// fakeLLM 逐字流式返回固定的回复；设置 cancel 时模拟生成过程中用户打断，
+// 设置 block 时一直等到 ctx 结束，模拟响应很慢的服务
+type fakeLLM struct {
+	reply  string
+	err    error
+	cancel context.CancelFunc
+	block  bool
+	// 每次生成上报的token用量
+	usage TokenUsage
+
+	mu      sync.Mutex
+	calls   int
+	prompts []string
+	ctxErr  error
+}
+
+func (f *fakeLLM) Generate(ctx context.Context, system, user string, opts GenOptions) (string, error) {
+	return f.GenerateStream(ctx, system, user, opts, func(string) {})
+}
+
+func (f *fakeLLM) GenerateStream(ctx context.Context, system, user string, opts GenOptions, onDelta func(delta string)) (string, error) {
+	f.mu.Lock()
+	f.calls++
+	f.prompts = append(f.prompts, user)
+	f.mu.Unlock()
+
+	if f.cancel != nil {
+		f.cancel()
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	if f.block {
+		<-ctx.Done()
+		f.mu.Lock()
+		f.ctxErr = ctx.Err()
+		f.mu.Unlock()
+		return "", ctx.Err()
+	}
+	for _, r := range f.reply {
+		onDelta(string(r))
+	}
+	// 同时设置 reply 和 err 时模拟生成到一半失败
+	if f.err != nil {
+		return "", f.err
+	}
+	if opts.OnUsage != nil && f.usage.Total() > 0 {
+		opts.OnUsage(f.usage)
+	}
+	return f.reply, nil
+}
+
+func (f *fakeLLM) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// Prompts 返回每次请求的用户输入
+func (f *fakeLLM) Prompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.prompts...)
+}
+
+// CtxErr 返回 block 时请求被取消的原因
+func (f *fakeLLM) CtxErr() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ctxErr
+}
+
+// discardReply 丢弃流式生成的回复
+type discardReply struct{}
+
+func (discardReply) Write(string) {}
+func (discardReply) Complete()    {}
+
+// fakeTTS 记录要求合成的文本，返回一段静音
+type fakeTTS struct {
+	err error
+
+	mu    sync.Mutex
+	texts []string
+}
+
+func (f *fakeTTS) Synthesize(ctx context.Context, text string) (io.ReadCloser, AudioFormat, error) {
+	f.mu.Lock()
+	f.texts = append(f.texts, text)
+	f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, AudioFormat{}, f.err
+	}
+	silence := make([]byte, 320)
+	return io.NopCloser(bytes.NewReader(silence)), AudioFormat{SampleRate: sttSampleRate, Channels: 1, Encoding: AudioEncodingPCMS16LE}, nil
+}
+
+func (f *fakeTTS) Texts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.texts...)
+}
+
+// fakePublisher 记录发布的数据消息
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages []string
+	captions []string
+}
+
+func (f *fakePublisher) PublishDataPacket(pck lksdk.DataPacket, opts ...lksdk.DataPublishOption) error {
+	packet := pck.(*lksdk.UserDataPacket)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if packet.Topic == captionTopic {
+		f.captions = append(f.captions, string(packet.Payload))
+	} else {
+		f.messages = append(f.messages, string(packet.Payload))
+	}
+	return nil
+}
+
+// Messages 返回发布的普通文本消息，不包括字幕
+func (f *fakePublisher) Messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.messages...)
+}
+
+// Captions 返回发布的字幕消息
+func (f *fakePublisher) Captions() []CaptionMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	captions := make([]CaptionMessage, len(f.captions))
+	for i, payload := range f.captions {
+		json.Unmarshal([]byte(payload), &captions[i])
+	}
+	return captions
+}
+
+// newTestAgent 创建一个不连接房间的代理，nil 的服务保持不可用
+func newTestAgent(services *AIServices) (*AIAgent, *fakePublisher) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	agent := newAIAgent(DefaultConfig(), services, NewMetrics(), logger)
+	publisher := &fakePublisher{}
+	agent.publisher = publisher
+	return agent, publisher
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// 回复打断填充音时的淡出时长，避免直接截断产生爆音
+const fillerFadeDuration = 10 * time.Millisecond
+
+// fillerOutput 是可以播放填充音的语音输出，由 pacedWriter 实现
+type fillerOutput interface {
+	WriteFiller(samples []float32, sampleRate int)
+}
+
+// FillerPlayer 在识别出有效发言、开始生成回复时播放一段预先录制的填充音（如"嗯..."），
+// 掩盖生成回复的延迟。回复的语音到达时填充音淡出，回复随即开始播放
+type FillerPlayer struct {
+	clip       []float32
+	sampleRate int
+}
+
+// NewFillerPlayerFromFile 加载16位PCM的WAV文件作为填充音，多声道取平均
+func NewFillerPlayerFromFile(path string) (*FillerPlayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取填充音失败: %w", err)
+	}
+	body, format, err := parseWAV(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析填充音失败: %w", err)
+	}
+	if len(body) == 0 {
+		return nil, fmt.Errorf("填充音为空: %s", path)
+	}
+	return &FillerPlayer{clip: downmix(s16leToFloat32(body), format.Channels), sampleRate: format.SampleRate}, nil
+}
+
+// Duration 返回填充音的时长
+func (f *FillerPlayer) Duration() time.Duration {
+	return time.Duration(len(f.clip)) * time.Second / time.Duration(f.sampleRate)
+}
+
+// Play 在输出上播放填充音，输出不支持填充音时忽略
+func (f *FillerPlayer) Play(output speechOutput) {
+	if f == nil {
+		return
+	}
+	if output, ok := output.(fillerOutput); ok {
+		output.WriteFiller(f.clip, f.sampleRate)
+	}
+}
+
+// fadeOut 把一段音频线性淡出到静音
+func fadeOut(pcm []int16) []int16 {
+	out := make([]int16, len(pcm))
+	for i, sample := range pcm {
+		out[i] = int16(float64(sample) * float64(len(pcm)-i) / float64(len(pcm)))
+	}
+	return out
+}
+
+// playFiller 在识别出的发言即将送去生成回复时播放填充音，未配置填充音或未发布音频轨道时不播放
+func (a *AIAgent) playFiller() {
+	if a.filler == nil {
+		return
+	}
+	if output := a.audioWriter(); output != nil {
+		a.filler.Play(output)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	defaultWelcomeMessage      = "你好！我是你的AI助手，有什么可以帮助你的吗？"
+	defaultParticipantGreeting = "欢迎 {name} 加入房间！"
+	defaultGreetingDelay       = 2 * time.Second
+)
+
+// sendWelcomeMessage 在首次加入房间后向所有人发送欢迎消息
+func (a *AIAgent) sendWelcomeMessage() {
+	// 等待连接稳定，期间代理关闭时不再发送
+	select {
+	case <-a.ctx.Done():
+		return
+	case <-time.After(a.config.Greeting.Delay):
+	}
+
+	err := a.publisher.PublishDataPacket(lksdk.UserData([]byte(a.config.Greeting.Welcome)))
+	if err != nil {
+		a.logger.Errorf("发送欢迎消息失败: %v", err)
+		return
+	}
+
+	a.logger.Info("已发送欢迎消息")
+}
+
+// greetParticipant 向新加入的参与者发送问候，开启 Once 时每个参与者只问候一次
+func (a *AIAgent) greetParticipant(participant *lksdk.RemoteParticipant) {
+	greeting := a.config.Greeting
+	if !greeting.Enabled || greeting.Participant == "" {
+		return
+	}
+	if a.isIgnored(participant.Identity()) {
+		return
+	}
+	if greeting.Once && !a.markGreeted(participant.Identity()) {
+		a.logger.Debugf("已问候过 %s，不再重复问候", participant.Identity())
+		return
+	}
+
+	name := participant.Name()
+	if name == "" {
+		name = participant.Identity()
+	}
+	message := strings.ReplaceAll(greeting.Participant, "{name}", name)
+	if err := a.publisher.PublishDataPacket(lksdk.UserData([]byte(message))); err != nil {
+		a.logger.Errorf("发送个人欢迎消息失败: %v", err)
+	}
+}
+
+// markGreeted 记录参与者已被问候，之前没有记录时返回 true
+func (a *AIAgent) markGreeted(identity string) bool {
+	a.greetedMu.Lock()
+	defer a.greetedMu.Unlock()
+	if a.greeted[identity] {
+		return false
+	}
+	a.greeted[identity] = true
+	return true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+const (
+	serviceLLM = "llm"
+	serviceSTT = "stt"
+	serviceTTS = "tts"
+)
+
+// RoomStatus 是 /status 接口中单个房间的状态
+type RoomStatus struct {
+	Room         string `json:"room"`
+	Connected    bool   `json:"connected"`
+	Participants int    `json:"participants"`
+	// 代理本次加入房间的会话，用于导出字幕
+	SessionID string `json:"session_id"`
+	// 房间的LLM token用量，未设置房间预算时为空
+	TokenUsage *BudgetUsage `json:"token_usage,omitempty"`
+	// 房间的累计用量和估算费用，未配置 cost 单价时为空
+	Cost *TurnCost `json:"cost,omitempty"`
+}
+
+// Status 是 /status 接口返回的JSON
+type Status struct {
+	Ready    bool            `json:"ready"`
+	Rooms    []RoomStatus    `json:"rooms"`
+	Services map[string]bool `json:"services"`
+	// 所有房间共享的LLM token用量，未设置全局预算时为空
+	TokenUsage *BudgetUsage `json:"token_usage,omitempty"`
+}
+
+// Connected 返回代理当前是否已连接到房间，断线重连期间为 false
+func (a *AIAgent) Connected() bool {
+	return a.State() == StateConnected
+}
+
+// ParticipantCount 返回房间中其他参与者的数量
+func (a *AIAgent) ParticipantCount() int {
+	a.sessionMu.Lock()
+	room := a.room
+	a.sessionMu.Unlock()
+
+	if room == nil {
+		return 0
+	}
+	return len(room.GetRemoteParticipants())
+}
+
+func (m *Manager) serviceStatus() map[string]bool {
+	capabilities := m.services.Capabilities()
+	return map[string]bool{
+		serviceLLM: capabilities.LLM,
+		serviceSTT: capabilities.STT,
+		serviceTTS: capabilities.TTS,
+	}
+}
+
+// Status 汇总所有房间和AI服务的状态。至少加入了一个房间、所有房间都已连接、
+// 并且配置中要求的服务都可用时才算就绪
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	agents := make(map[string]*AIAgent, len(m.agents))
+	for roomName, agent := range m.agents {
+		agents[roomName] = agent
+	}
+	m.mu.Unlock()
+
+	status := Status{
+		Ready:      len(agents) > 0,
+		Rooms:      make([]RoomStatus, 0, len(agents)),
+		Services:   m.serviceStatus(),
+		TokenUsage: m.services.budget.Usage(),
+	}
+	for roomName, agent := range agents {
+		connected := agent.Connected()
+		status.Ready = status.Ready && connected
+		room := RoomStatus{
+			Room:         roomName,
+			Connected:    connected,
+			Participants: agent.ParticipantCount(),
+			SessionID:    agent.SessionID(),
+			TokenUsage:   agent.budget.Usage(),
+		}
+		if m.config.Cost.enabled() {
+			cost := agent.costs.Total()
+			room.Cost = &cost
+		}
+		status.Rooms = append(status.Rooms, room)
+	}
+	sort.Slice(status.Rooms, func(i, j int) bool { return status.Rooms[i].Room < status.Rooms[j].Room })
+
+	for _, service := range m.config.requiredServices() {
+		if !status.Services[service] {
+			status.Ready = false
+		}
+	}
+	return status
+}
+
+// HealthHandler 提供 /healthz、/readyz 和 /status 接口
+func (m *Manager) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !m.Status().Ready {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Status())
+	})
+	return mux
+}
+
+// ServeHealth 在指定地址上提供健康检查接口，阻塞直到服务退出
+func (m *Manager) ServeHealth(addr string) error {
+	return http.ListenAndServe(addr, m.HealthHandler())
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	// 每位说话人默认保存的对话轮数
+	defaultMaxHistoryTurns = 20
+	defaultResetReply      = "好的，我们重新开始吧。"
+)
+
+var defaultResetPhrases = []string{"重新开始", "清除记忆", "start over", "reset conversation"}
+
+// ConversationHistory 保存一位说话人与代理的对话，作为后续回复的上下文
+type ConversationHistory struct {
+	mu sync.Mutex
+	// 最多保存的对话轮数，超过时丢弃最早的一轮，0 表示不限制
+	maxTurns int
+	messages []ChatMessage
+	// 每次追加后保存历史，为空或历史已被清空时不保存
+	persist func(messages []ChatMessage)
+	// 正在后台压缩较早的对话，同一时间只压缩一次
+	summarizing bool
+}
+
+// Messages 返回按时间顺序排列的历史消息副本
+func (h *ConversationHistory) Messages() []ChatMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]ChatMessage(nil), h.messages...)
+}
+
+// Append 记录一轮完整的对话
+func (h *ConversationHistory) Append(user, assistant string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messages = append(h.messages,
+		ChatMessage{Role: ChatRoleUser, Content: user},
+		ChatMessage{Role: ChatRoleAssistant, Content: assistant},
+	)
+	h.trim()
+	if h.persist != nil {
+		h.persist(append([]ChatMessage(nil), h.messages...))
+	}
+}
+
+// trim 只保留最近 maxTurns 轮，开头的摘要不计入轮数，调用方需持有 mu
+func (h *ConversationHistory) trim() {
+	summary, turns := splitSummary(h.messages)
+	if h.maxTurns > 0 && len(turns) > 2*h.maxTurns {
+		h.messages = append(summary, turns[len(turns)-2*h.maxTurns:]...)
+	}
+}
+
+// splitSummary 把历史分为开头的摘要和之后的对话，没有摘要时第一个返回值为空
+func splitSummary(messages []ChatMessage) ([]ChatMessage, []ChatMessage) {
+	if len(messages) > 0 && messages[0].Role == ChatRoleSystem {
+		return []ChatMessage{messages[0]}, messages[1:]
+	}
+	return nil, messages
+}
+
+// detach 停止保存历史，进行中的对话之后追加的内容不会写回已清空的存储
+func (h *ConversationHistory) detach() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.persist = nil
+}
+
+// conversation 返回说话人的对话历史。说话人通常是参与者身份，开启说话人分离时
+// 是由参与者身份和说话人标签组成的伪身份，见 speakerIdentity
+func (a *AIAgent) conversation(speaker string) *ConversationHistory {
+	a.historiesMu.Lock()
+	defer a.historiesMu.Unlock()
+
+	history, ok := a.histories[speaker]
+	if !ok {
+		history = a.restoreConversation(speaker)
+		a.histories[speaker] = history
+	}
+	return history
+}
+
+// restoreConversation 从存储中恢复说话人之前的对话，之后每轮对话都写回存储
+func (a *AIAgent) restoreConversation(speaker string) *ConversationHistory {
+	history := &ConversationHistory{maxTurns: a.config.History.MaxTurns}
+	if a.historyStore == nil {
+		return history
+	}
+
+	key := historyKey(a.config.LiveKit.RoomName, speaker)
+	messages, err := a.historyStore.Load(a.ctx, key)
+	if err != nil {
+		a.logger.Errorf("恢复 %s 的对话历史失败: %v", speaker, err)
+	} else if len(messages) > 0 {
+		a.logger.Infof("已恢复 %s 的 %d 轮对话", speaker, len(messages)/2)
+		history.messages = messages
+		history.trim()
+	}
+	history.persist = func(messages []ChatMessage) {
+		if err := a.historyStore.Save(context.Background(), key, messages); err != nil {
+			a.logger.Errorf("保存 %s 的对话历史失败: %v", speaker, err)
+		}
+	}
+	return history
+}
+
+// releaseConversations 参与者离开时从代理中移除其对话历史，存储中的历史保留，重新加入时恢复
+func (a *AIAgent) releaseConversations(identity string) {
+	a.historiesMu.Lock()
+	defer a.historiesMu.Unlock()
+
+	for speaker := range a.histories {
+		if ownsSpeaker(identity, speaker) {
+			delete(a.histories, speaker)
+		}
+	}
+}
+
+// forgetConversations 删除参与者及其分离出的所有说话人的对话历史，包括存储中保存的历史
+func (a *AIAgent) forgetConversations(identity string) {
+	a.historiesMu.Lock()
+	defer a.historiesMu.Unlock()
+
+	speakers := map[string]bool{identity: true}
+	for speaker, history := range a.histories {
+		if ownsSpeaker(identity, speaker) {
+			history.detach()
+			delete(a.histories, speaker)
+			speakers[speaker] = true
+		}
+	}
+	if a.historyStore == nil {
+		return
+	}
+	for speaker := range speakers {
+		if err := a.historyStore.Delete(context.Background(), historyKey(a.config.LiveKit.RoomName, speaker)); err != nil {
+			a.logger.Errorf("删除 %s 的对话历史失败: %v", speaker, err)
+		}
+	}
+}
+
+// ownsSpeaker 判断说话人是参与者本人或从其混音轨道中分离出的说话人
+func ownsSpeaker(identity, speaker string) bool {
+	return speaker == identity || strings.HasPrefix(speaker, identity+speakerSeparator)
+}
+
+// isResetPhrase 判断一句话是否是清空对话历史的指令，不区分大小写，忽略首尾的空白和标点
+func (a *AIAgent) isResetPhrase(text string) bool {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.TrimFunc(s, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsPunct(r)
+		}))
+	}
+	text = normalize(text)
+	if text == "" {
+		return false
+	}
+	for _, phrase := range a.config.History.ResetPhrases {
+		if normalize(phrase) == text {
+			return true
+		}
+	}
+	return false
+}
+
+// handleReset 处理客户端发送的 reset 消息
+func (a *AIAgent) handleReset(participant *lksdk.RemoteParticipant) {
+	ctx := a.withTurn(a.session(), participant.Identity())
+	a.startTurn(func() { a.resetConversation(ctx, participant) })
+}
+
+// resetConversation 清空参与者的对话历史并回复确认。进行中的对话之后记录的内容
+// 写入已经丢弃的历史，不会带入之后的对话
+func (a *AIAgent) resetConversation(ctx context.Context, participant *lksdk.RemoteParticipant) {
+	a.forgetConversations(participant.Identity())
+	a.turnLogger(ctx).Infof("已清空 %s 的对话历史", participant.Identity())
+	if reply := a.config.History.ResetReply; reply != "" {
+		a.say(ctx, participant, reply)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 参与者离开后默认保留对话历史的时长，期间重新加入（如网络短暂中断）可以继续之前的对话
+const defaultHistoryRetention = 10 * time.Minute
+
+const (
+	historyStoreMemory = "memory"
+	historyStoreFile   = "file"
+)
+
+// HistoryStore 按键保存对话历史，参与者断线后重新加入或代理重新连接房间时据此恢复对话。
+// 键由房间名和说话人身份组成，见 historyKey
+type HistoryStore interface {
+	// Load 返回保存的对话历史，没有保存或已经过期时返回 nil
+	Load(ctx context.Context, key string) ([]ChatMessage, error)
+	Save(ctx context.Context, key string, messages []ChatMessage) error
+	Delete(ctx context.Context, key string) error
+}
+
+// historyKey 返回说话人在房间中的对话历史的键，同一身份在不同房间的对话互不影响
+func historyKey(room, speaker string) string {
+	return room + "/" + speaker
+}
+
+type storedHistory struct {
+	SavedAt  time.Time       `json:"saved_at"`
+	Messages []storedMessage `json:"messages"`
+}
+
+type storedMessage struct {
+	Role    ChatRole `json:"role"`
+	Content string   `json:"content"`
+}
+
+func newStoredHistory(messages []ChatMessage, now time.Time) storedHistory {
+	stored := storedHistory{SavedAt: now, Messages: make([]storedMessage, len(messages))}
+	for i, message := range messages {
+		stored.Messages[i] = storedMessage{Role: message.Role, Content: message.Content}
+	}
+	return stored
+}
+
+func (h storedHistory) chatMessages() []ChatMessage {
+	messages := make([]ChatMessage, len(h.Messages))
+	for i, message := range h.Messages {
+		messages[i] = ChatMessage{Role: message.Role, Content: message.Content}
+	}
+	return messages
+}
+
+// expired 判断保存的历史是否超过了保留时长，retention 为0时永不过期
+func (h storedHistory) expired(retention time.Duration, now time.Time) bool {
+	return retention > 0 && now.Sub(h.SavedAt) > retention
+}
+
+// MemoryHistoryStore 在进程内保存对话历史，代理重新连接房间或被重新创建后仍可恢复，进程退出后丢失
+type MemoryHistoryStore struct {
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]storedHistory
+}
+
+// NewMemoryHistoryStore 创建内存存储，最后一次保存超过 retention 的历史视为过期，0 表示永不过期
+func NewMemoryHistoryStore(retention time.Duration) *MemoryHistoryStore {
+	return &MemoryHistoryStore{retention: retention, now: time.Now, entries: make(map[string]storedHistory)}
+}
+
+func (s *MemoryHistoryStore) Load(ctx context.Context, key string) ([]ChatMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || entry.expired(s.retention, s.now()) {
+		delete(s.entries, key)
+		return nil, nil
+	}
+	return entry.chatMessages(), nil
+}
+
+func (s *MemoryHistoryStore) Save(ctx context.Context, key string, messages []ChatMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	// 顺便清理已经过期的历史，避免离开的参与者一直占用内存
+	for other, entry := range s.entries {
+		if entry.expired(s.retention, now) {
+			delete(s.entries, other)
+		}
+	}
+	s.entries[key] = newStoredHistory(messages, now)
+	return nil
+}
+
+func (s *MemoryHistoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// FileHistoryStore 把每位说话人的对话历史保存为目录下的一个JSON文件，进程重启后仍可恢复
+type FileHistoryStore struct {
+	dir       string
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewFileHistoryStore 创建文件存储，目录不存在时自动创建，过期的含义同 NewMemoryHistoryStore
+func NewFileHistoryStore(dir string, retention time.Duration) (*FileHistoryStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建对话历史目录失败: %w", err)
+	}
+	return &FileHistoryStore{dir: dir, retention: retention, now: time.Now}, nil
+}
+
+// path 返回键对应的文件，键中的 / 等字符会被转义
+func (s *FileHistoryStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".json")
+}
+
+func (s *FileHistoryStore) Load(ctx context.Context, key string) ([]ChatMessage, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取对话历史失败: %w", err)
+	}
+	var stored storedHistory
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("解析对话历史失败: %w", err)
+	}
+	if stored.expired(s.retention, s.now()) {
+		return nil, s.Delete(ctx, key)
+	}
+	return stored.chatMessages(), nil
+}
+
+// Save 先写入临时文件再重命名，写到一半退出时不会留下损坏的历史
+func (s *FileHistoryStore) Save(ctx context.Context, key string, messages []ChatMessage) error {
+	data, err := json.Marshal(newStoredHistory(messages, s.now()))
+	if err != nil {
+		return fmt.Errorf("序列化对话历史失败: %w", err)
+	}
+	file, err := os.CreateTemp(s.dir, ".history-*")
+	if err != nil {
+		return fmt.Errorf("保存对话历史失败: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return fmt.Errorf("保存对话历史失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("保存对话历史失败: %w", err)
+	}
+	if err := os.Rename(file.Name(), s.path(key)); err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("保存对话历史失败: %w", err)
+	}
+	return nil
+}
+
+func (s *FileHistoryStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("删除对话历史失败: %w", err)
+	}
+	return nil
+}
+
+// newHistoryStore 按配置创建对话历史存储
+func newHistoryStore(cfg HistoryConfig) (HistoryStore, error) {
+	switch cfg.Store {
+	case historyStoreMemory, "":
+		return NewMemoryHistoryStore(cfg.Retention), nil
+	case historyStoreFile:
+		return NewFileHistoryStore(cfg.Path, cfg.Retention)
+	default:
+		return nil, fmt.Errorf("未知的对话历史存储: %s", cfg.Store)
+	}
+}
+
+func (c HistoryConfig) validate() error {
+	if c.MaxTurns < 0 {
+		return fmt.Errorf("max_turns 不能为负数")
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("retention 不能为负数")
+	}
+	if c.SummarizeAfter < 0 {
+		return fmt.Errorf("summarize_after 不能为负数")
+	}
+	if c.SummarizeAfter > 0 {
+		if c.SummaryKeepTurns < 0 || c.SummaryKeepTurns >= c.SummarizeAfter {
+			return fmt.Errorf("summary_keep_turns 必须在 0 到 summarize_after 之间")
+		}
+		if c.SummaryMaxTokens <= 0 {
+			return fmt.Errorf("summary_max_tokens 必须大于0")
+		}
+		if c.MaxTurns > 0 && c.SummarizeAfter >= c.MaxTurns {
+			return fmt.Errorf("summarize_after 必须小于 max_turns，否则较早的对话在压缩前就被丢弃")
+		}
+	}
+	switch c.Store {
+	case historyStoreMemory, "":
+	case historyStoreFile:
+		if c.Path == "" {
+			return fmt.Errorf("store 为 file 时必须设置 path")
+		}
+	default:
+		return fmt.Errorf("未知的对话历史存储 %q，可选 %s 或 %s", c.Store, historyStoreMemory, historyStoreFile)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryHistoryStoreExpires(t *testing.T) {
+	store := NewMemoryHistoryStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	messages := []ChatMessage{{Role: "user", Content: "你好"}, {Role: "assistant", Content: "你好！"}}
+	if err := store.Save(ctx, "room/alice", messages); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Load(ctx, "room/alice"); len(got) != 2 || got[1].Content != "你好！" {
+		t.Errorf("loaded %v", got)
+	}
+	if got, _ := store.Load(ctx, "other/alice"); len(got) != 0 {
+		t.Errorf("history leaked to another room: %v", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got, _ := store.Load(ctx, "room/alice"); len(got) != 0 {
+		t.Errorf("expired history loaded: %v", got)
+	}
+}
+
+func TestFileHistoryStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	messages := []ChatMessage{{Role: "user", Content: "我叫小明"}, {Role: "assistant", Content: "你好小明"}}
+
+	store, err := NewFileHistoryStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(ctx, historyKey("room", "alice/../bob"), messages); err != nil {
+		t.Fatal(err)
+	}
+
+	// 进程重启后新建的存储仍能读取
+	reopened, err := NewFileHistoryStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Load(ctx, historyKey("room", "alice/../bob"))
+	if err != nil || len(got) != 2 || got[0].Content != "我叫小明" {
+		t.Fatalf("loaded %v, %v", got, err)
+	}
+	if got, _ := reopened.Load(ctx, historyKey("room", "bob")); len(got) != 0 {
+		t.Errorf("identities not matched exactly: %v", got)
+	}
+
+	if err := reopened.Delete(ctx, historyKey("room", "alice/../bob")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopened.Load(ctx, historyKey("room", "alice/../bob")); len(got) != 0 {
+		t.Errorf("deleted history loaded: %v", got)
+	}
+}
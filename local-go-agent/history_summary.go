@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// 压缩后保留原文的最近对话轮数
+	defaultSummaryKeepTurns = 4
+	// 摘要的最大token数
+	defaultSummaryMaxTokens = 200
+	summaryPrefix           = "之前对话的摘要："
+)
+
+// summaryInstruction 是压缩对话时的系统提示词
+const summaryInstruction = "把下面的对话浓缩成一段简短的摘要，保留人名、事实、偏好和还没有完成的事项，" +
+	"用对话使用的语言书写，只输出摘要本身。"
+
+// summaryCandidate 判断历史是否超过 after 轮，超过时返回现有的摘要和除最近 keep 轮以外需要压缩的消息。
+// 正在压缩时返回 false
+func (h *ConversationHistory) summaryCandidate(after, keep int) ([]ChatMessage, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	summary, turns := splitSummary(h.messages)
+	if h.summarizing || after <= 0 || len(turns) <= 2*after {
+		return nil, false
+	}
+	h.summarizing = true
+	return append(summary, turns[:len(turns)-2*keep]...), true
+}
+
+// compact 用摘要替换压缩的消息。压缩期间历史被裁剪过时开头已经不同，放弃这次压缩；
+// 期间追加的对话保留在摘要之后
+func (h *ConversationHistory) compact(replaced []ChatMessage, summary string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.summarizing = false
+	if summary == "" || len(h.messages) < len(replaced) {
+		return false
+	}
+	for i, message := range replaced {
+		if h.messages[i] != message {
+			return false
+		}
+	}
+	messages := []ChatMessage{{Role: ChatRoleSystem, Content: summaryPrefix + summary}}
+	h.messages = append(messages, h.messages[len(replaced):]...)
+	if h.persist != nil {
+		h.persist(append([]ChatMessage(nil), h.messages...))
+	}
+	return true
+}
+
+// summarizeHistory 对话历史超过 history.summarize_after 轮时，在后台调用LLM把较早的对话连同之前的摘要
+// 浓缩成一段摘要放在历史开头，只保留最近 summary_keep_turns 轮原文，长时间的对话不会超出上下文窗口
+func (a *AIAgent) summarizeHistory(ctx context.Context, speaker string, history *ConversationHistory) {
+	cfg := a.config.History
+	if a.llm == nil || a.budgetExceeded() {
+		return
+	}
+	replaced, ok := history.summaryCandidate(cfg.SummarizeAfter, cfg.SummaryKeepTurns)
+	if !ok {
+		return
+	}
+	// 回复已经发出，这轮对话结束或被取消后摘要仍继续完成
+	ctx = context.WithoutCancel(ctx)
+	started := a.startTurn(func() {
+		logger := a.turnLogger(ctx)
+		summary, err := a.summarize(ctx, replaced)
+		if err != nil {
+			logger.Warnf("压缩 %s 的对话历史失败: %v", speaker, err)
+		}
+		if history.compact(replaced, summary) {
+			logger.Infof("已把 %s 较早的 %d 条对话压缩为摘要", speaker, len(replaced))
+		}
+	})
+	if !started {
+		history.compact(nil, "")
+	}
+}
+
+// summarize 请求LLM把消息浓缩为摘要
+func (a *AIAgent) summarize(ctx context.Context, messages []ChatMessage) (string, error) {
+	var transcript strings.Builder
+	for _, message := range messages {
+		switch message.Role {
+		case ChatRoleSystem:
+			transcript.WriteString(message.Content)
+		case ChatRoleAssistant:
+			fmt.Fprintf(&transcript, "助手: %s", message.Content)
+		default:
+			fmt.Fprintf(&transcript, "用户: %s", message.Content)
+		}
+		transcript.WriteString("\n")
+	}
+
+	timeout := a.config.OpenAI.Timeout
+	if timeout <= 0 {
+		timeout = defaultLLMTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	summary, err := a.llm.Generate(ctx, summaryInstruction, transcript.String(), GenOptions{
+		MaxTokens: a.config.History.SummaryMaxTokens,
+		OnUsage:   func(usage TokenUsage) { a.recordUsage(ctx, usage) },
+		Seed:      a.config.OpenAI.Seed,
+	})
+	return strings.TrimSpace(summary), err
+}
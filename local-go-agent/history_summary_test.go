@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestLongConversationIsSummarized(t *testing.T) {
+	llm := &fakeLLM{reply: "小明喜欢猫。"}
+	agent, _ := newTestAgent(&AIServices{LLM: llm})
+	agent.config.History.SummarizeAfter = 3
+	agent.config.History.SummaryKeepTurns = 1
+	participant := &lksdk.RemoteParticipant{}
+	identity := participant.Identity()
+
+	for i := 1; i <= 4; i++ {
+		agent.handleChatMessage(context.Background(), fmt.Sprintf("第%d句", i), participant)
+	}
+	agent.turns.Wait()
+
+	messages := agent.conversation(identity).Messages()
+	if len(messages) != 3 {
+		t.Fatalf("history = %v, want summary and the last turn", messages)
+	}
+	if messages[0].Role != ChatRoleSystem || messages[0].Content != summaryPrefix+"小明喜欢猫。" {
+		t.Errorf("summary = %+v", messages[0])
+	}
+	if messages[1].Content != "第4句" {
+		t.Errorf("kept turn = %+v, want the most recent one", messages[1])
+	}
+	prompts := llm.Prompts()
+	if request := prompts[len(prompts)-1]; !strings.Contains(request, "用户: 第1句") || strings.Contains(request, "第4句") {
+		t.Errorf("summary request = %q", request)
+	}
+}
+
+func TestSummaryCompactionKeepsConcurrentTurns(t *testing.T) {
+	history := &ConversationHistory{}
+	history.Append("q1", "a1")
+	history.Append("q2", "a2")
+
+	replaced, ok := history.summaryCandidate(1, 1)
+	if !ok || len(replaced) != 2 {
+		t.Fatalf("candidate = %v, %v", replaced, ok)
+	}
+	if _, ok := history.summaryCandidate(1, 1); ok {
+		t.Errorf("a second summary started while one is running")
+	}
+	// 压缩期间追加的对话保留在摘要之后
+	history.Append("q3", "a3")
+	if !history.compact(replaced, "s1") {
+		t.Fatal("compact failed")
+	}
+	messages := history.Messages()
+	if len(messages) != 5 || messages[0].Content != summaryPrefix+"s1" || messages[1].Content != "q2" || messages[4].Content != "a3" {
+		t.Errorf("history = %v", messages)
+	}
+
+	// 裁剪时摘要保留在开头，不计入轮数
+	history.maxTurns = 1
+	history.Append("q4", "a4")
+	messages = history.Messages()
+	if len(messages) != 3 || messages[0].Role != ChatRoleSystem || messages[1].Content != "q4" {
+		t.Errorf("history after trim = %v", messages)
+	}
+
+	// 压缩期间历史被裁剪过时放弃这次压缩
+	if history.compact([]ChatMessage{{Role: ChatRoleUser, Content: "q1"}}, "s2") {
+		t.Errorf("compacted a history whose beginning changed")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestConversationHistoryEvictsOldestTurns(t *testing.T) {
+	history := &ConversationHistory{maxTurns: 2}
+	for i := 1; i <= 3; i++ {
+		history.Append(fmt.Sprintf("q%d", i), fmt.Sprintf("a%d", i))
+	}
+
+	messages := history.Messages()
+	if len(messages) != 4 || messages[0].Content != "q2" || messages[3].Content != "a3" {
+		t.Errorf("history = %v, want the last 2 turns", messages)
+	}
+}
+
+func TestResetPhraseClearsHistory(t *testing.T) {
+	llm := &fakeLLM{reply: "好的。"}
+	agent, publisher := newTestAgent(&AIServices{LLM: llm})
+	participant := &lksdk.RemoteParticipant{}
+	identity := participant.Identity()
+
+	agent.conversation(identity).Append("我叫小明", "你好小明")
+	agent.conversation(speakerIdentity(identity, "A")).Append("我是A", "你好A")
+
+	agent.handleChatMessage(context.Background(), " Start over! ", participant)
+
+	if llm.Calls() != 0 {
+		t.Errorf("reset phrase was sent to the llm")
+	}
+	if messages := agent.conversation(identity).Messages(); len(messages) != 0 {
+		t.Errorf("history not cleared: %v", messages)
+	}
+	if messages := agent.conversation(speakerIdentity(identity, "A")).Messages(); len(messages) != 0 {
+		t.Errorf("diarized speaker history not cleared: %v", messages)
+	}
+	if !containsString(publisher.Messages(), defaultResetReply) {
+		t.Errorf("messages = %v, want reset acknowledgement", publisher.Messages())
+	}
+
+	agent.handleChatMessage(context.Background(), "start over with the story", participant)
+	if llm.Calls() != 1 {
+		t.Errorf("a sentence containing the phrase should not reset")
+	}
+}
+
+func TestHistorySurvivesReconnect(t *testing.T) {
+	store := NewMemoryHistoryStore(time.Minute)
+	agent, _ := newTestAgent(&AIServices{LLM: &fakeLLM{reply: "好的。"}, histories: store})
+	participant := &lksdk.RemoteParticipant{}
+	identity := participant.Identity()
+
+	agent.conversation(identity).Append("我叫小明", "你好小明")
+	agent.onParticipantDisconnected(participant)
+	if messages := agent.conversation(identity).Messages(); len(messages) != 2 || messages[0].Content != "我叫小明" {
+		t.Errorf("history after rejoining = %v", messages)
+	}
+
+	// 重新连接房间时代理被重新创建，按参与者身份恢复对话
+	reconnected, _ := newTestAgent(&AIServices{LLM: &fakeLLM{reply: "好的。"}, histories: store})
+	if messages := reconnected.conversation(identity).Messages(); len(messages) != 2 {
+		t.Errorf("history after reconnecting = %v", messages)
+	}
+	if messages := reconnected.conversation(identity + "-other").Messages(); len(messages) != 0 {
+		t.Errorf("another participant got the history: %v", messages)
+	}
+
+	// 重置对话后存储中的历史也一并删除
+	reconnected.forgetConversations(identity)
+	again, _ := newTestAgent(&AIServices{LLM: &fakeLLM{reply: "好的。"}, histories: store})
+	if messages := again.conversation(identity).Messages(); len(messages) != 0 {
+		t.Errorf("history after reset = %v", messages)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+const defaultIdleTimeout = 5 * time.Minute
+
+// SetIdleHandler 设置房间空闲超时后的处理，为空时代理直接关闭。
+// Manager 用它在离开房间的同时移除该房间的代理
+func (a *AIAgent) SetIdleHandler(handler func()) {
+	a.idleMu.Lock()
+	defer a.idleMu.Unlock()
+
+	a.onIdle = handler
+}
+
+// checkIdle 在房间中没有其他参与者时开始空闲倒计时，有参与者时取消倒计时
+func (a *AIAgent) checkIdle() {
+	if a.ParticipantCount() == 0 {
+		a.startIdleTimer()
+	} else {
+		a.stopIdleTimer()
+	}
+}
+
+func (a *AIAgent) startIdleTimer() {
+	timeout := a.config.LiveKit.IdleTimeout
+	if timeout <= 0 || a.closing.Load() {
+		return
+	}
+
+	a.idleMu.Lock()
+	defer a.idleMu.Unlock()
+
+	if a.idleTimer != nil {
+		return
+	}
+	a.logger.Infof("房间中没有其他参与者，%s 后离开房间", timeout)
+	a.idleRound++
+	round := a.idleRound
+	a.idleTimer = time.AfterFunc(timeout, func() { a.idleTimeout(round) })
+}
+
+func (a *AIAgent) stopIdleTimer() {
+	a.idleMu.Lock()
+	defer a.idleMu.Unlock()
+
+	if a.idleTimer == nil {
+		return
+	}
+	a.idleTimer.Stop()
+	a.idleTimer = nil
+	a.logger.Debug("取消空闲倒计时")
+}
+
+// idleTimeout 在倒计时结束时离开房间。倒计时已被取消或替换，或者期间有人重新加入时不做处理
+func (a *AIAgent) idleTimeout(round uint64) {
+	a.idleMu.Lock()
+	if a.idleTimer == nil || a.idleRound != round {
+		a.idleMu.Unlock()
+		return
+	}
+	a.idleTimer = nil
+	handler := a.onIdle
+	a.idleMu.Unlock()
+
+	if a.ParticipantCount() > 0 {
+		return
+	}
+
+	a.logger.Info("房间空闲超时，离开房间")
+	if handler != nil {
+		handler()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		a.logger.Warnf("等待对话完成失败: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleTimer(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	agent.config.LiveKit.IdleTimeout = 20 * time.Millisecond
+
+	idle := make(chan struct{}, 1)
+	agent.SetIdleHandler(func() { idle <- struct{}{} })
+
+	// 倒计时结束前有人加入，不应离开房间
+	agent.checkIdle()
+	agent.stopIdleTimer()
+	select {
+	case <-idle:
+		t.Fatal("idle handler called after the timer was stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	agent.checkIdle()
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatal("idle handler not called after the timeout")
+	}
+}
+
+func TestIdleTimerDisabled(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	agent.config.LiveKit.IdleTimeout = 0
+
+	agent.checkIdle()
+	agent.idleMu.Lock()
+	defer agent.idleMu.Unlock()
+	if agent.idleTimer != nil {
+		t.Fatal("idle timer started with the timeout disabled")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// isIgnored 判断是否忽略参与者：不处理其音频和文字消息，也不问候。SetIgnored 的设置优先，
+// 其次是 ignore_participants 配置和参与者元数据中的 "ignore": true
+func (a *AIAgent) isIgnored(identity string) bool {
+	a.ignoredMu.RLock()
+	ignored, ok := a.ignored[identity]
+	a.ignoredMu.RUnlock()
+	if ok {
+		return ignored
+	}
+	if slices.Contains(a.config.IgnoreParticipants, identity) {
+		return true
+	}
+	return a.participantSettings(identity).Ignore
+}
+
+// SetIgnored 设置是否忽略参与者，优先于配置和元数据，参与者离开后仍然有效。
+// 开始忽略时立即停止处理其音频并丢弃排队的发言，取消忽略时恢复处理已订阅的音频轨道
+func (a *AIAgent) SetIgnored(identity string, ignored bool) {
+	was := a.isIgnored(identity)
+	a.ignoredMu.Lock()
+	if a.ignored == nil {
+		a.ignored = make(map[string]bool)
+	}
+	a.ignored[identity] = ignored
+	a.ignoredMu.Unlock()
+
+	a.ignoreChanged(identity, was)
+}
+
+// onParticipantMetadataChanged 重新读取参与者的个人偏好，元数据中的 "ignore" 随时生效
+func (a *AIAgent) onParticipantMetadataChanged(oldMetadata string, p lksdk.Participant) {
+	participant, ok := p.(*lksdk.RemoteParticipant)
+	if !ok {
+		return
+	}
+	was := a.isIgnored(participant.Identity())
+	a.loadParticipantSettings(participant)
+	a.ignoreChanged(participant.Identity(), was)
+}
+
+// ignoreChanged 在忽略状态变化时停止或恢复处理参与者的音频，状态不变时什么也不做，
+// 避免重新订阅正在处理的轨道
+func (a *AIAgent) ignoreChanged(identity string, was bool) {
+	ignored := a.isIgnored(identity)
+	if ignored == was {
+		return
+	}
+	if ignored {
+		a.logger.Infof("忽略参与者 %s", identity)
+		a.stopParticipantTracks(identity)
+		a.forgetTurnQueue(identity)
+		return
+	}
+	a.logger.Infof("不再忽略参与者 %s", identity)
+	for _, participant := range a.Participants() {
+		if participant.Identity() == identity {
+			a.resumeAudioTracks(participant)
+		}
+	}
+}
+
+// resumeAudioTracks 重新处理参与者已订阅的音频轨道
+func (a *AIAgent) resumeAudioTracks(participant *lksdk.RemoteParticipant) {
+	for _, publication := range participant.TrackPublications() {
+		remote, ok := publication.(*lksdk.RemoteTrackPublication)
+		if !ok || remote.Kind() != lksdk.TrackKindAudio || remote.TrackRemote() == nil {
+			continue
+		}
+		a.onTrackSubscribed(remote.TrackRemote(), remote, participant)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestIsIgnored(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	agent.config.IgnoreParticipants = []string{"other-bot"}
+	agent.settings["observer"] = ParticipantSettings{Ignore: true}
+
+	for identity, want := range map[string]bool{"other-bot": true, "observer": true, "alice": false} {
+		if got := agent.isIgnored(identity); got != want {
+			t.Errorf("isIgnored(%q) = %v, want %v", identity, got, want)
+		}
+	}
+
+	// SetIgnored 优先于配置和元数据
+	agent.SetIgnored("other-bot", false)
+	agent.SetIgnored("alice", true)
+	if agent.isIgnored("other-bot") || !agent.isIgnored("alice") {
+		t.Error("SetIgnored did not override the configured list")
+	}
+}
+
+func TestParticipantMetadataIgnoreFlag(t *testing.T) {
+	settings, err := parseParticipantSettings(`{"ignore":true}`)
+	if err != nil || !settings.Ignore {
+		t.Errorf("settings = %+v, %v, want ignore", settings, err)
+	}
+}
+
+func TestIgnoredParticipantIsNotGreeted(t *testing.T) {
+	agent, publisher := newTestAgent(&AIServices{})
+	agent.config.Greeting.Enabled = true
+	agent.config.Greeting.Participant = "你好，{name}"
+	participant := &lksdk.RemoteParticipant{}
+
+	agent.SetIgnored(participant.Identity(), true)
+	agent.greetParticipant(participant)
+	if got := publisher.Messages(); len(got) != 0 {
+		t.Errorf("greeted an ignored participant: %v", got)
+	}
+
+	agent.SetIgnored(participant.Identity(), false)
+	agent.greetParticipant(participant)
+	if got := publisher.Messages(); len(got) != 1 {
+		t.Errorf("messages = %v, want one greeting", got)
+	}
+}
+
+func TestIgnoredParticipantChatIsDropped(t *testing.T) {
+	llm := &fakeLLM{reply: "好的。"}
+	agent, _ := newTestAgent(&AIServices{LLM: llm})
+	agent.sessionCtx = agent.ctx
+	params := lksdk.DataReceiveParams{Sender: &lksdk.RemoteParticipant{}, SenderIdentity: "other-bot"}
+	packet := &lksdk.UserDataPacket{Payload: []byte("你好")}
+
+	agent.SetIgnored("other-bot", true)
+	agent.onDataReceived(packet, params)
+	agent.turns.Wait()
+	if calls := llm.Calls(); calls != 0 {
+		t.Errorf("llm called %d times for an ignored participant", calls)
+	}
+
+	agent.SetIgnored("other-bot", false)
+	agent.onDataReceived(packet, params)
+	deadline := time.Now().Add(5 * time.Second)
+	for llm.Calls() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	agent.turns.Wait()
+	if calls := llm.Calls(); calls != 1 {
+		t.Errorf("llm called %d times after the participant was no longer ignored, want 1", calls)
+	}
+}
+
+func TestIgnoreChangesOnlyActOnTransitions(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	key := trackKey{identity: "alice", trackSID: "TR_mic"}
+	ctx, _ := agent.startTrack(key)
+
+	// 没有被忽略过的参与者取消忽略时，不重新处理正在处理的轨道
+	agent.SetIgnored("alice", false)
+	if ctx.Err() != nil {
+		t.Fatal("restarted a track of a participant that was never ignored")
+	}
+
+	// 会话中元数据改为 {"ignore":true} 时立即停止处理
+	ctx, _ = agent.startTrack(trackKey{identity: "bob", trackSID: "TR_mic"})
+	agent.settingsMu.Lock()
+	agent.settings["bob"] = ParticipantSettings{Ignore: true}
+	agent.settingsMu.Unlock()
+	agent.ignoreChanged("bob", false)
+	if ctx.Err() == nil {
+		t.Error("kept processing audio after the metadata asked to be ignored")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import "github.com/pion/rtp"
+
+// 抖动缓冲默认最多缓存的乱序包数量，20ms一包时约等于100ms的延迟
+const defaultJitterBufferDepth = 5
+
+// 序列号向前或向后跳跃超过该值时认为发送端重新开始编号，直接从新位置继续而不是补齐大段静音
+const maxJitterGap = 50
+
+// jitterBuffer 按RTP序列号对音频包重新排序，缓存超过 depth 个包仍等不到的包视为丢失
+type jitterBuffer struct {
+	depth   int
+	packets map[uint16]*rtp.Packet
+	next    uint16
+	started bool
+}
+
+func newJitterBuffer(depth int) *jitterBuffer {
+	if depth <= 0 {
+		depth = defaultJitterBufferDepth
+	}
+	return &jitterBuffer{depth: depth, packets: make(map[uint16]*rtp.Packet)}
+}
+
+// Push 加入一个包，返回按序列号排好序、可以解码的包，其中 nil 表示丢失的包
+func (j *jitterBuffer) Push(packet *rtp.Packet) []*rtp.Packet {
+	seq := packet.SequenceNumber
+	if !j.started {
+		j.next = seq
+		j.started = true
+	}
+
+	var ready []*rtp.Packet
+	if seqBefore(seq, j.next) {
+		// 迟到或重复的包，对应位置已经输出
+		if j.next-seq <= maxJitterGap {
+			return nil
+		}
+		// 远早于期望的序列号，发送端重新开始了编号，先输出缓存的包
+		ready = j.Drain()
+		j.next = seq
+		j.started = true
+	}
+	j.packets[seq] = packet
+
+	if len(j.packets) > j.depth {
+		if earliest := j.earliest(); earliest-j.next > maxJitterGap {
+			j.next = earliest
+		}
+	}
+
+	for {
+		if packet, ok := j.packets[j.next]; ok {
+			ready = append(ready, packet)
+			delete(j.packets, j.next)
+		} else if len(j.packets) > j.depth {
+			ready = append(ready, nil)
+		} else {
+			return ready
+		}
+		j.next++
+	}
+}
+
+// Drain 在轨道结束时按序列号输出缓存中剩余的包，中间缺少的包为 nil，之后重新开始计数
+func (j *jitterBuffer) Drain() []*rtp.Packet {
+	var ready []*rtp.Packet
+	for len(j.packets) > 0 {
+		if earliest := j.earliest(); earliest-j.next > maxJitterGap {
+			j.next = earliest
+		}
+		packet, ok := j.packets[j.next]
+		if ok {
+			delete(j.packets, j.next)
+		}
+		ready = append(ready, packet)
+		j.next++
+	}
+	j.started = false
+	return ready
+}
+
+// earliest 返回缓存中最早的序列号，调用方需保证缓存不为空
+func (j *jitterBuffer) earliest() uint16 {
+	var earliest uint16
+	first := true
+	for seq := range j.packets {
+		if first || seqBefore(seq, earliest) {
+			earliest = seq
+			first = false
+		}
+	}
+	return earliest
+}
+
+// seqBefore 判断序列号 a 是否在 b 之前，处理16位序列号回绕
+func seqBefore(a, b uint16) bool {
+	return a != b && b-a < 1<<15
+}
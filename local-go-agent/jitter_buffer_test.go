@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+// 丢失的包在输出中记为 -1
+const lostPacket = -1
+
+func pushSequences(j *jitterBuffer, seqs ...uint16) []int {
+	var out []int
+	for _, seq := range seqs {
+		out = append(out, packetSequences(j.Push(&rtp.Packet{Header: rtp.Header{SequenceNumber: seq}}))...)
+	}
+	return out
+}
+
+func packetSequences(packets []*rtp.Packet) []int {
+	var out []int
+	for _, packet := range packets {
+		if packet == nil {
+			out = append(out, lostPacket)
+			continue
+		}
+		out = append(out, int(packet.SequenceNumber))
+	}
+	return out
+}
+
+func TestJitterBufferReorders(t *testing.T) {
+	j := newJitterBuffer(3)
+	got := pushSequences(j, 10, 12, 11, 14, 13, 15)
+	if want := []int{10, 11, 12, 13, 14, 15}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output = %v, want %v", got, want)
+	}
+	// 迟到和重复的包已经输出过，直接丢弃
+	if got := pushSequences(j, 12, 15); len(got) != 0 {
+		t.Errorf("late packets produced %v", got)
+	}
+}
+
+func TestJitterBufferConcealsLoss(t *testing.T) {
+	j := newJitterBuffer(2)
+	// 11 一直没有到达，缓存超过深度后输出 nil 由解码器补偿
+	got := pushSequences(j, 10, 12, 13, 14)
+	if want := []int{10, lostPacket, 12, 13, 14}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output = %v, want %v", got, want)
+	}
+}
+
+func TestJitterBufferSequenceWraparound(t *testing.T) {
+	j := newJitterBuffer(3)
+	got := pushSequences(j, 65534, 0, 65535, 1)
+	if want := []int{65534, 65535, 0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output = %v, want %v", got, want)
+	}
+}
+
+func TestJitterBufferLargeJumps(t *testing.T) {
+	j := newJitterBuffer(2)
+	// 向前跳过一大段，不补齐几百个丢失的包
+	got := pushSequences(j, 100, 101, 1000, 1001, 1002)
+	if want := []int{100, 101, 1000, 1001, 1002}; !reflect.DeepEqual(got, want) {
+		t.Errorf("forward jump output = %v, want %v", got, want)
+	}
+	// 发送端重新从较小的序列号开始编号，新的包不被当作迟到的包丢弃
+	got = pushSequences(j, 5, 6, 7)
+	if want := []int{5, 6, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backward jump output = %v, want %v", got, want)
+	}
+}
+
+func TestJitterBufferDrain(t *testing.T) {
+	j := newJitterBuffer(5)
+	if got := pushSequences(j, 20, 22, 24); !reflect.DeepEqual(got, []int{20}) {
+		t.Fatalf("output = %v, want only the first packet before the buffer fills", got)
+	}
+	got := packetSequences(j.Drain())
+	if want := []int{lostPacket, 22, lostPacket, 24}; !reflect.DeepEqual(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+	if got := j.Drain(); len(got) != 0 {
+		t.Errorf("second drain = %v, want empty", got)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// 短于这个时长的发言语言检测不可靠，沿用上一次检测到的语言
+const minLanguageDetectionDuration = 1500 * time.Millisecond
+
+var languageNames = map[string]string{
+	"zh": "中文",
+	"en": "English",
+	"ja": "日本語",
+	"ko": "한국어",
+	"fr": "Français",
+	"de": "Deutsch",
+	"es": "Español",
+}
+
+// systemPrompt 按本轮对话的变量渲染人设的系统提示词模板，并在后面追加使用指定语言回复的要求，
+// language 为空时使用人设的默认语言
+func (a *AIAgent) systemPrompt(ctx context.Context, participant *lksdk.RemoteParticipant, speaker, language string) string {
+	persona := a.personaFor(participant.Identity())
+	if language == "" {
+		language = persona.Language
+	}
+	prompt := a.renderSystemPrompt(ctx, persona, a.promptVars(participant, speaker, language))
+	prompt += "\n" + languageInstruction(language)
+	if instruction := a.voices.instruction(); instruction != "" {
+		prompt += "\n" + instruction
+	}
+	if instruction := replyLengthInstruction(a.config.Audio.MaxReplyDuration, language); instruction != "" {
+		prompt += "\n" + instruction
+	}
+	return prompt
+}
+
+func languageInstruction(language string) string {
+	switch language {
+	case "", "zh":
+		return "请用中文回复用户的问题。"
+	case "en":
+		return "Reply to the user in English."
+	}
+
+	name, ok := languageNames[language]
+	if !ok {
+		name = language
+	}
+	return fmt.Sprintf("Reply to the user in %s (language code: %s).", name, language)
+}
+
+// transcriptionLanguage 返回识别一段发言时指定的语言，空字符串表示交给识别服务检测。
+// 服务支持自动检测时每段发言都重新检测，参与者可以在对话中切换语言；发言太短时检测不可靠，
+// 沿用上一次检测到的语言
+func (a *AIAgent) transcriptionLanguage(identity string, duration time.Duration) string {
+	last := a.participantLanguage(identity)
+	if detector, ok := a.stt.(languageDetector); !ok || !detector.DetectsLanguage() {
+		return last
+	}
+	if last != "" && duration < minLanguageDetectionDuration {
+		return last
+	}
+	return ""
+}
+
+// participantLanguage 返回参与者此前检测到的语言，未检测过时返回空字符串
+func (a *AIAgent) participantLanguage(identity string) string {
+	a.languagesMu.RLock()
+	defer a.languagesMu.RUnlock()
+
+	return a.languages[identity]
+}
+
+func (a *AIAgent) setParticipantLanguage(identity, language string) {
+	a.languagesMu.Lock()
+	defer a.languagesMu.Unlock()
+
+	a.languages[identity] = language
+}
+
+func (a *AIAgent) forgetParticipantLanguage(identity string) {
+	a.languagesMu.Lock()
+	defer a.languagesMu.Unlock()
+
+	delete(a.languages, identity)
+}
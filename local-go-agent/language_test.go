@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// detectingSTT 按顺序返回预设的检测结果，并记录每次请求指定的语言
+type detectingSTT struct {
+	results   []Transcript
+	requested []string
+}
+
+func (s *detectingSTT) Transcribe(ctx context.Context, pcm []byte, lang string) (Transcript, error) {
+	s.requested = append(s.requested, lang)
+	result := s.results[0]
+	s.results = s.results[1:]
+	if lang != "" {
+		result.Language, result.LanguageDetected = lang, false
+	}
+	return result, nil
+}
+
+func (s *detectingSTT) DetectsLanguage() bool {
+	return true
+}
+
+func TestLanguageSwitchesBetweenUtterances(t *testing.T) {
+	stt := &detectingSTT{results: []Transcript{
+		{Text: "你好", Confidence: 0.9, Language: "zh", LanguageDetected: true, Final: true},
+		{Text: "How are you", Confidence: 0.9, Language: "en", LanguageDetected: true, Final: true},
+		{Text: "OK", Confidence: 0.9, Final: true},
+		{Text: "谢谢你的帮助", Confidence: 0.9, Language: "zh", LanguageConfidence: 0.3, Final: true},
+	}}
+	agent, _ := newTestAgent(&AIServices{STT: stt, LLM: &fakeLLM{reply: "好的。"}})
+	agent.persona.Voices = map[string]string{"en": "english-voice", "zh": "chinese-voice"}
+	participant := &lksdk.RemoteParticipant{}
+	identity := participant.Identity()
+
+	long := make([]int16, 2*sttSampleRate)
+	short := make([]int16, sttSampleRate/2)
+
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: long}, participant)
+	if got := agent.speechOptions(participant, agent.participantLanguage(identity)).Voice; got != "chinese-voice" {
+		t.Errorf("voice after chinese = %q", got)
+	}
+
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: long}, participant)
+	language := agent.participantLanguage(identity)
+	if language != "en" {
+		t.Fatalf("language after switching = %q, want en", language)
+	}
+	if got := agent.speechOptions(participant, language).Voice; got != "english-voice" {
+		t.Errorf("voice after english = %q", got)
+	}
+	if prompt := agent.systemPrompt(context.Background(), participant, identity, language); !strings.Contains(prompt, "English") {
+		t.Errorf("system prompt does not ask for english: %q", prompt)
+	}
+
+	// 短发言沿用上一次的语言，低置信度的检测也不会切回默认语言
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: short}, participant)
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: long}, participant)
+	want := []string{"", "", "en", ""}
+	if strings.Join(stt.requested, ",") != strings.Join(want, ",") {
+		t.Errorf("requested languages = %q, want %q", stt.requested, want)
+	}
+	if language := agent.participantLanguage(identity); language != "en" {
+		t.Errorf("language after a low-confidence detection = %q, want en", language)
+	}
+}
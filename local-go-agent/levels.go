@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// 默认每秒上报一次音量
+	defaultLevelInterval = time.Second
+	// 完全静音时记为的电平，避免出现负无穷
+	minLevelDBFS = -100.0
+	// 默认的噪声底，整段发言的每一帧都低于它时不送去识别
+	defaultNoiseFloor = -60.0
+	// 判断发言是否低于噪声底时按这个时长分帧
+	noiseFloorFrame = 20 * time.Millisecond
+)
+
+// AudioLevel 是一段时间内的音量，单位为 dBFS（0 为满幅）
+type AudioLevel struct {
+	RMS  float64
+	Peak float64
+}
+
+// dbfs 把 [0, 1] 范围的幅度换算为 dBFS
+func dbfs(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return minLevelDBFS
+	}
+	return max(20*math.Log10(amplitude), minLevelDBFS)
+}
+
+// levelMeter 累计解码后的音频，每经过 interval 时长的音频返回一次这段时间的音量。
+// 按音频时长而不是实际时间计时，离线模拟时同样适用
+type levelMeter struct {
+	interval int
+
+	samples    int
+	sumSquares float64
+	peak       float64
+}
+
+// newLevelMeter 创建音量表，interval 不大于0时不计量，返回 nil
+func newLevelMeter(interval time.Duration) *levelMeter {
+	if interval <= 0 {
+		return nil
+	}
+	return &levelMeter{interval: max(1, int(interval*sttSampleRate/time.Second))}
+}
+
+// Push 累计一帧音频，满一个上报周期时返回这段时间的音量
+func (m *levelMeter) Push(pcm []int16) (AudioLevel, bool) {
+	if m == nil {
+		return AudioLevel{}, false
+	}
+	for _, sample := range pcm {
+		value := float64(sample) / 32768
+		m.sumSquares += value * value
+		m.peak = max(m.peak, math.Abs(value))
+	}
+	m.samples += len(pcm)
+	if m.samples < m.interval {
+		return AudioLevel{}, false
+	}
+
+	level := AudioLevel{RMS: dbfs(math.Sqrt(m.sumSquares / float64(m.samples))), Peak: dbfs(m.peak)}
+	m.samples, m.sumSquares, m.peak = 0, 0, 0
+	return level, true
+}
+
+// loudestFrameLevel 返回一段音频中最响的一帧的 RMS 电平
+func loudestFrameLevel(pcm []int16) float64 {
+	frame := int(noiseFloorFrame * sttSampleRate / time.Second)
+	loudest := 0.0
+	for start := 0; start < len(pcm); start += frame {
+		loudest = max(loudest, rms(pcm[start:min(start+frame, len(pcm))]))
+	}
+	return dbfs(loudest)
+}
+
+// reportLevel 通过事件和指标发布参与者的音量
+func (a *AIAgent) reportLevel(identity string, level AudioLevel) {
+	a.metrics.SetAudioLevel(identity, level)
+	a.emit(AgentEvent{Type: EventAudioLevel, ParticipantIdentity: identity, Level: level})
+}
+
+// belowNoiseFloor 判断一段发言是否一直低于噪声底，这样的发言不送去识别
+func (a *AIAgent) belowNoiseFloor(pcm []int16) bool {
+	floor := a.config.Audio.NoiseFloor
+	return floor < 0 && loudestFrameLevel(pcm) < floor
+}
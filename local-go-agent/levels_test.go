@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestLevelMeter(t *testing.T) {
+	meter := newLevelMeter(100 * time.Millisecond)
+
+	// 每帧20ms，第5帧时满一个周期
+	for i := 0; i < 4; i++ {
+		if _, ok := meter.Push(toneFrame(16384)); ok {
+			t.Fatalf("reported after %d frames", i+1)
+		}
+	}
+	level, ok := meter.Push(toneFrame(16384))
+	if !ok {
+		t.Fatal("no report after a full interval")
+	}
+	// 半满幅的方波 RMS 和峰值都约为 -6 dBFS
+	if math.Abs(level.RMS+6.02) > 0.1 || math.Abs(level.Peak+6.02) > 0.1 {
+		t.Errorf("level = %+v, want about -6 dBFS", level)
+	}
+
+	for i := 0; i < 4; i++ {
+		meter.Push(toneFrame(0))
+	}
+	if level, _ := meter.Push(toneFrame(0)); level.RMS != minLevelDBFS {
+		t.Errorf("silence measured as %v dBFS", level.RMS)
+	}
+
+	if newLevelMeter(0) != nil {
+		t.Error("meter created with reporting disabled")
+	}
+}
+
+func TestIngestSkipsUtterancesBelowNoiseFloor(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{STT: &fakeSTT{}})
+	agent.config.Audio.ListeningMode = ListeningModePushToTalk
+	agent.config.Audio.LevelInterval = 20 * time.Millisecond
+	participant := &lksdk.RemoteParticipant{}
+	agent.setPushToTalk(participant.Identity(), true)
+	ingest := agent.newAudioIngest(participant, "track")
+
+	// 约 -70 dBFS 的底噪
+	if ingest.Push(context.Background(), toneFrame(10)) || ingest.Flush(context.Background()) {
+		t.Error("an utterance below the noise floor was sent to the turn queue")
+	}
+
+	event := <-agent.Events()
+	if event.Type != EventAudioLevel || event.Level.RMS > -60 {
+		t.Errorf("event = %+v, want an audio level below -60 dBFS", event)
+	}
+
+	// 正常音量的发言照常送出
+	ingest.Push(context.Background(), toneFrame(8000))
+	if !ingest.Flush(context.Background()) {
+		t.Error("an utterance above the noise floor was dropped")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 同时进行的对话（STT、LLM、TTS 调用）数量上限的默认值
+const defaultMaxConcurrentTurns = 4
+
+// turnLimiter 限制同时进行的对话数量，避免房间内多人同时说话时并发请求超出服务商的速率限制。
+// 由所有房间共享，nil 表示不限制
+type turnLimiter struct {
+	slots chan struct{}
+}
+
+func newTurnLimiter(limit int) *turnLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &turnLimiter{slots: make(chan struct{}, limit)}
+}
+
+// acquire 占用一个名额，名额用完时排队等待直到有对话结束或 ctx 取消
+func (l *turnLimiter) acquire(ctx context.Context, logger *logrus.Entry) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	logger.Infof("同时进行的对话已达上限 %d，排队等待", cap(l.slots))
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *turnLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
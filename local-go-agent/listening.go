@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ListeningMode 决定代理何时收听参与者的音频
+type ListeningMode string
+
+const (
+	// ListeningModeContinuous 持续收听，每隔 BufferDuration 送出一段音频
+	ListeningModeContinuous ListeningMode = "continuous"
+	// ListeningModeVAD 检测到说话后开始收听，静音超过 VADSilence 时送出一段发言
+	ListeningModeVAD ListeningMode = "vad"
+	// ListeningModePushToTalk 只收听客户端 ptt start 和 stop 消息之间的音频
+	ListeningModePushToTalk ListeningMode = "push_to_talk"
+)
+
+const (
+	// 每条轨道最多缓冲的音频时长
+	defaultMaxBufferDuration = 30 * time.Second
+	// 切分仍在进行的发言时带入下一段的音频时长
+	defaultSegmentOverlap = 300 * time.Millisecond
+	// 一段发言最长的时长，持续说话时到达该时长就送去识别
+	defaultMaxUtteranceDuration = 15 * time.Second
+
+	defaultVADThreshold = 0.02
+	defaultVADSilence   = 700 * time.Millisecond
+)
+
+func (m ListeningMode) validate() error {
+	switch m {
+	case "", ListeningModeContinuous, ListeningModeVAD, ListeningModePushToTalk:
+		return nil
+	default:
+		return fmt.Errorf("未知的收听模式: %s", m)
+	}
+}
+
+// setPushToTalk 记录参与者是否按下了说话键
+func (a *AIAgent) setPushToTalk(identity string, talking bool) {
+	a.pttMu.Lock()
+	defer a.pttMu.Unlock()
+	if talking {
+		a.talking[identity] = true
+	} else {
+		delete(a.talking, identity)
+	}
+}
+
+func (a *AIAgent) pushToTalkActive(identity string) bool {
+	a.pttMu.Lock()
+	defer a.pttMu.Unlock()
+	return a.talking[identity]
+}
+
+// utteranceSegmenter 按收听模式把解码后的音频切分为一段段发言
+type utteranceSegmenter struct {
+	mode           ListeningMode
+	bufferDuration time.Duration
+	// 按键说话模式下查询当前是否在说话
+	talking func() bool
+
+	vadThreshold float64
+	vadSilence   time.Duration
+	speaking     bool
+	silence      time.Duration
+
+	// 缓冲区满时提前送出已缓冲的音频
+	buffer     *pcmRingBuffer
+	onOverflow func()
+	// 一段发言最多的采样数，持续说话没有静音时到达后强制切分，0 表示只受缓冲区容量限制
+	maxUtterance   int
+	onMaxUtterance func()
+	// 切分仍在进行的发言时，上一段末尾 overlap 个采样留在缓冲区开头，carried 是当前缓冲区中
+	// 这部分采样的数量，lastOverlap 是最近送出的发言开头与上一段重叠的采样数
+	overlap     int
+	carried     int
+	lastOverlap int
+	// 固定间隔模式按 now 计时，为空时使用系统时间；离线模拟时按音频时长推进
+	now       func() time.Time
+	lastFlush time.Time
+}
+
+func (a *AIAgent) newUtteranceSegmenter(identity string) *utteranceSegmenter {
+	audio := a.config.Audio
+	segmenter := &utteranceSegmenter{
+		mode:           audio.ListeningMode,
+		bufferDuration: audio.BufferDuration,
+		talking:        func() bool { return a.pushToTalkActive(identity) },
+		vadThreshold:   audio.VADThreshold,
+		vadSilence:     audio.VADSilence,
+		buffer:         newPCMRingBuffer(bufferCapacity(audio.MaxBufferDuration)),
+		overlap:        int(audio.SegmentOverlap * sttSampleRate / time.Second),
+		onOverflow: func() {
+			a.logger.Warnf("%s 的音频缓冲区已满，提前送出已缓冲的音频", identity)
+			a.metrics.IncAudioOverflow()
+		},
+		maxUtterance: int(audio.MaxUtteranceDuration * sttSampleRate / time.Second),
+		onMaxUtterance: func() {
+			a.logger.Infof("%s 持续说话超过 %v，先送出已缓冲的发言", identity, audio.MaxUtteranceDuration)
+		},
+		lastFlush: time.Now(),
+	}
+	if segmenter.vadThreshold <= 0 {
+		segmenter.vadThreshold = defaultVADThreshold
+	}
+	if segmenter.vadSilence <= 0 {
+		segmenter.vadSilence = defaultVADSilence
+	}
+	return segmenter
+}
+
+// Push 追加一帧音频，一段发言结束或缓冲区已满时返回该段发言
+func (s *utteranceSegmenter) Push(pcm []int16) []int16 {
+	switch s.mode {
+	case ListeningModePushToTalk:
+		// 松开按键后的第一帧送出缓冲的发言
+		if s.talking() {
+			return s.append(pcm)
+		}
+		return s.flush()
+	case ListeningModeVAD:
+		if rms(pcm) >= s.vadThreshold {
+			s.speaking = true
+			s.silence = 0
+		} else if !s.speaking {
+			return nil
+		} else {
+			s.silence += time.Duration(len(pcm)) * time.Second / sttSampleRate
+		}
+		if early := s.append(pcm); early != nil {
+			return early
+		}
+		if s.silence < s.vadSilence {
+			return nil
+		}
+		s.speaking = false
+		s.silence = 0
+		return s.flush()
+	default:
+		if early := s.append(pcm); early != nil {
+			return early
+		}
+		if s.clock().Sub(s.lastFlush) < s.bufferDuration {
+			return nil
+		}
+		return s.cut()
+	}
+}
+
+// append 把一帧音频写入缓冲区，放不下时先取出已缓冲的音频作为一段发言返回；
+// 写入后发言达到 maxUtterance 时切分，之后的音频作为新的一段继续缓冲
+func (s *utteranceSegmenter) append(pcm []int16) []int16 {
+	var early []int16
+	if s.buffer.Len() > 0 && s.buffer.Len()+len(pcm) > s.buffer.Cap() {
+		early = s.cut()
+		if s.onOverflow != nil {
+			s.onOverflow()
+		}
+	}
+	s.buffer.Write(pcm)
+	if early == nil && s.maxUtterance > 0 && s.buffer.Len() >= s.maxUtterance {
+		early = s.cut()
+		if s.onMaxUtterance != nil {
+			s.onMaxUtterance()
+		}
+	}
+	return early
+}
+
+// Buffered 返回当前是否有尚未送出的发言
+func (s *utteranceSegmenter) Buffered() bool {
+	return s.buffer.Len() > s.carried
+}
+
+// Overlap 返回最近送出的发言开头有多少采样与上一段发言的末尾重复
+func (s *utteranceSegmenter) Overlap() int {
+	return s.lastOverlap
+}
+
+// Flush 立即结束当前发言并返回已缓冲的音频
+func (s *utteranceSegmenter) Flush() []int16 {
+	s.speaking = false
+	s.silence = 0
+	return s.flush()
+}
+
+// flush 送出缓冲的发言，只剩上一段带入的音频时不送出
+func (s *utteranceSegmenter) flush() []int16 {
+	s.lastFlush = s.clock()
+	s.lastOverlap, s.carried = s.carried, 0
+	if s.buffer.Len() <= s.lastOverlap {
+		s.buffer.Drain()
+		s.lastOverlap = 0
+		return nil
+	}
+	return s.buffer.Drain()
+}
+
+// cut 在发言进行中切分，末尾 overlap 的音频留作下一段的开头，跨越切分点的词在下一段中完整出现
+func (s *utteranceSegmenter) cut() []int16 {
+	utterance := s.flush()
+	if keep := min(s.overlap, len(utterance)); keep > 0 {
+		s.buffer.Write(utterance[len(utterance)-keep:])
+		s.carried = keep
+	}
+	return utterance
+}
+
+func (s *utteranceSegmenter) clock() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+	return s.now()
+}
+
+// bufferCapacity 返回可以缓冲 duration 时长音频的采样数
+func bufferCapacity(duration time.Duration) int {
+	if duration <= 0 {
+		duration = defaultMaxBufferDuration
+	}
+	return int(duration * sttSampleRate / time.Second)
+}
+
+// rms 返回一帧音频的均方根电平，范围 [0, 1]
+func rms(pcm []int16) float64 {
+	if len(pcm) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, sample := range pcm {
+		value := float64(sample) / 32768
+		sum += value * value
+	}
+	return math.Sqrt(sum / float64(len(pcm)))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func toneFrame(amplitude int16) []int16 {
+	pcm := make([]int16, sttSampleRate/50)
+	for i := range pcm {
+		if i%2 == 0 {
+			pcm[i] = amplitude
+		} else {
+			pcm[i] = -amplitude
+		}
+	}
+	return pcm
+}
+
+func TestUtteranceSegmenterVAD(t *testing.T) {
+	segmenter := &utteranceSegmenter{
+		mode:         ListeningModeVAD,
+		vadThreshold: defaultVADThreshold,
+		vadSilence:   100 * time.Millisecond,
+		buffer:       newPCMRingBuffer(bufferCapacity(time.Second)),
+	}
+
+	// 说话前的静音不缓冲
+	for i := 0; i < 10; i++ {
+		if utterance := segmenter.Push(toneFrame(0)); utterance != nil {
+			t.Fatal("silence produced an utterance")
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if utterance := segmenter.Push(toneFrame(8000)); utterance != nil {
+			t.Fatal("utterance ended while speaking")
+		}
+	}
+	var utterance []int16
+	for i := 0; i < 5 && utterance == nil; i++ {
+		utterance = segmenter.Push(toneFrame(0))
+	}
+	if want := 15 * len(toneFrame(0)); len(utterance) != want {
+		t.Fatalf("got %d samples, want %d", len(utterance), want)
+	}
+}
+
+func TestUtteranceSegmenterPushToTalk(t *testing.T) {
+	talking := false
+	segmenter := &utteranceSegmenter{
+		mode:    ListeningModePushToTalk,
+		talking: func() bool { return talking },
+		buffer:  newPCMRingBuffer(bufferCapacity(time.Second)),
+	}
+
+	if utterance := segmenter.Push(toneFrame(8000)); utterance != nil {
+		t.Fatal("audio before ptt start produced an utterance")
+	}
+	talking = true
+	for i := 0; i < 3; i++ {
+		if utterance := segmenter.Push(toneFrame(8000)); utterance != nil {
+			t.Fatal("utterance ended before ptt stop")
+		}
+	}
+	talking = false
+	if utterance := segmenter.Push(toneFrame(8000)); len(utterance) != 3*len(toneFrame(0)) {
+		t.Fatalf("got %d samples after ptt stop, want %d", len(utterance), 3*len(toneFrame(0)))
+	}
+}
+
+// notifySTT 每次识别时发出通知
+type notifySTT struct {
+	heard chan int
+}
+
+func (s *notifySTT) Transcribe(ctx context.Context, pcm []byte, lang string) (Transcript, error) {
+	s.heard <- len(pcm) / 2
+	return Transcript{}, nil
+}
+
+func TestPushToTalkStopFlushesWithoutMoreAudio(t *testing.T) {
+	stt := &notifySTT{heard: make(chan int, 1)}
+	agent, _ := newTestAgent(&AIServices{STT: stt})
+	agent.config.Audio.ListeningMode = ListeningModePushToTalk
+	participant := &lksdk.RemoteParticipant{}
+	ctx, track := agent.startTrack(trackKey{identity: participant.Identity(), trackSID: "track"})
+	track.attach(ctx, agent.newAudioIngest(participant, "track"))
+	defer track.close()
+
+	agent.handlePushToTalk(participant.Identity(), pttStateStart)
+	for i := 0; i < 3; i++ {
+		track.push(toneFrame(8000))
+	}
+	// 松开按键后客户端不再发送音频
+	agent.handlePushToTalk(participant.Identity(), pttStateStop)
+
+	select {
+	case samples := <-stt.heard:
+		if samples != 3*len(toneFrame(0)) {
+			t.Errorf("transcribed %d samples, want %d", samples, 3*len(toneFrame(0)))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("utterance was not sent after ptt stop")
+	}
+}
+
+func TestUtteranceSegmenterFlushesWhenFull(t *testing.T) {
+	overflows := 0
+	segmenter := &utteranceSegmenter{
+		mode:       ListeningModePushToTalk,
+		talking:    func() bool { return true },
+		buffer:     newPCMRingBuffer(bufferCapacity(100 * time.Millisecond)),
+		onOverflow: func() { overflows++ },
+	}
+
+	// 一直按住说话键，缓冲区写满后提前送出，不会超过容量
+	var total int
+	for i := 0; i < 1000; i++ {
+		if utterance := segmenter.Push(toneFrame(8000)); utterance != nil {
+			if len(utterance) > segmenter.buffer.Cap() {
+				t.Fatalf("utterance of %d samples exceeds capacity %d", len(utterance), segmenter.buffer.Cap())
+			}
+			total += len(utterance)
+		}
+		if segmenter.buffer.Len() > segmenter.buffer.Cap() {
+			t.Fatalf("buffer holds %d samples, capacity %d", segmenter.buffer.Len(), segmenter.buffer.Cap())
+		}
+	}
+	total += segmenter.buffer.Len()
+	if want := 1000 * len(toneFrame(0)); total != want {
+		t.Errorf("got %d samples in total, want %d", total, want)
+	}
+	if overflows == 0 {
+		t.Error("expected the buffer to overflow")
+	}
+}
+
+func TestUtteranceSegmenterCutsLongUtterance(t *testing.T) {
+	cuts := 0
+	segmenter := &utteranceSegmenter{
+		mode:           ListeningModeVAD,
+		vadThreshold:   defaultVADThreshold,
+		vadSilence:     100 * time.Millisecond,
+		buffer:         newPCMRingBuffer(bufferCapacity(time.Second)),
+		maxUtterance:   bufferCapacity(200 * time.Millisecond),
+		onMaxUtterance: func() { cuts++ },
+	}
+
+	// 一直说话没有静音，每 200ms 送出一段，之后继续缓冲新的一段
+	var utterances [][]int16
+	for i := 0; i < 50; i++ {
+		if utterance := segmenter.Push(toneFrame(8000)); utterance != nil {
+			utterances = append(utterances, utterance)
+		}
+	}
+	if len(utterances) != 5 || cuts != 5 {
+		t.Fatalf("got %d utterances and %d cuts, want 5", len(utterances), cuts)
+	}
+	for _, utterance := range utterances {
+		if len(utterance) != segmenter.maxUtterance {
+			t.Fatalf("got %d samples, want %d", len(utterance), segmenter.maxUtterance)
+		}
+	}
+	if !segmenter.speaking {
+		t.Error("forced cut should not end the speech")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// 探测一个LiveKit服务器是否存活的超时
+const liveKitProbeTimeout = 3 * time.Second
+
+// URLStrategy 决定配置了多个LiveKit服务器地址时的尝试顺序
+type URLStrategy string
+
+const (
+	// URLStrategyOrdered 按配置的顺序尝试
+	URLStrategyOrdered URLStrategy = "ordered"
+	// URLStrategyLatency 按探测的延迟从低到高尝试
+	URLStrategyLatency URLStrategy = "latency"
+)
+
+func (s URLStrategy) validate() error {
+	switch s {
+	case "", URLStrategyOrdered, URLStrategyLatency:
+		return nil
+	default:
+		return fmt.Errorf("未知的 url_strategy %q，可选 ordered 或 latency", s)
+	}
+}
+
+// serverURLs 返回配置的LiveKit服务器地址，urls 为空时只使用 url
+func (c LiveKitConfig) serverURLs() []string {
+	if len(c.URLs) > 0 {
+		return c.URLs
+	}
+	if c.URL == "" {
+		return nil
+	}
+	return []string{c.URL}
+}
+
+func (c LiveKitConfig) validateURLs() error {
+	if err := c.URLStrategy.validate(); err != nil {
+		return err
+	}
+	for _, raw := range c.URLs {
+		if _, err := probeURL(raw); err != nil {
+			return fmt.Errorf("urls 中的地址 %q 无效: %w", raw, err)
+		}
+	}
+	return nil
+}
+
+// probeURL 把 ws/wss 地址换算成LiveKit服务器的HTTP根路径，服务器存活时返回200
+func probeURL(raw string) (string, error) {
+	endpoint, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	switch endpoint.Scheme {
+	case "ws", "http":
+		endpoint.Scheme = "http"
+	case "wss", "https":
+		endpoint.Scheme = "https"
+	default:
+		return "", fmt.Errorf("不支持的协议 %q", endpoint.Scheme)
+	}
+	if endpoint.Host == "" {
+		return "", errors.New("缺少主机名")
+	}
+	endpoint.Path = "/"
+	endpoint.RawQuery = ""
+	return endpoint.String(), nil
+}
+
+// probeLiveKit 请求服务器的HTTP根路径，返回响应的延迟
+func probeLiveKit(ctx context.Context, raw string) (time.Duration, error) {
+	endpoint, err := probeURL(raw)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, liveKitProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("状态码 %d", resp.StatusCode)
+	}
+	return time.Since(start), nil
+}
+
+// candidateURLs 返回本次连接依次尝试的服务器地址。只有一个地址时直接使用；有多个地址时同时探测，
+// 跳过探测失败的地址，上次连接成功的地址排在最前，其余按 url_strategy 排序。
+// 所有地址都探测失败时仍按原顺序全部尝试，探测请求可能被防火墙拦截而WebSocket连接正常
+func (a *AIAgent) candidateURLs() []string {
+	urls := a.config.LiveKit.serverURLs()
+	if len(urls) <= 1 {
+		return urls
+	}
+
+	latencies := make([]time.Duration, len(urls))
+	errs := make([]error, len(urls))
+	var wg sync.WaitGroup
+	for i, raw := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latencies[i], errs[i] = probeLiveKit(a.ctx, raw)
+		}()
+	}
+	wg.Wait()
+
+	type candidate struct {
+		url     string
+		latency time.Duration
+	}
+	var alive []candidate
+	for i, raw := range urls {
+		if errs[i] != nil {
+			a.logger.Warnf("LiveKit服务器 %s 探测失败，跳过: %v", raw, errs[i])
+			continue
+		}
+		alive = append(alive, candidate{url: raw, latency: latencies[i]})
+	}
+	if len(alive) == 0 {
+		a.logger.Warn("所有LiveKit服务器探测失败，按配置顺序逐个尝试")
+		return urls
+	}
+
+	last := a.serverURL()
+	slices.SortStableFunc(alive, func(x, y candidate) int {
+		switch {
+		case x.url == last && y.url != last:
+			return -1
+		case y.url == last && x.url != last:
+			return 1
+		case a.config.LiveKit.URLStrategy == URLStrategyLatency:
+			return cmp.Compare(x.latency, y.latency)
+		default:
+			return 0
+		}
+	})
+	ordered := make([]string, len(alive))
+	for i, c := range alive {
+		ordered[i] = c.url
+	}
+	return ordered
+}
+
+// dialRoom 依次尝试候选地址，返回第一个连接成功的房间和地址
+func (a *AIAgent) dialRoom(token string, callback *lksdk.RoomCallback) (*lksdk.Room, string, error) {
+	urls := a.candidateURLs()
+	var errs []error
+	for _, raw := range urls {
+		room, err := lksdk.ConnectToRoomWithToken(raw, token, callback, a.connectOptions()...)
+		if err == nil {
+			return room, raw, nil
+		}
+		if len(urls) > 1 {
+			a.logger.Warnf("连接LiveKit服务器 %s 失败，尝试下一个: %v", raw, err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", raw, err))
+	}
+	if len(errs) == 0 {
+		return nil, "", errors.New("没有可用的LiveKit服务器地址")
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// serverURL 返回当前（或上一次）连接成功的LiveKit服务器地址，房间管理接口也使用该地址
+func (a *AIAgent) serverURL() string {
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
+
+	return a.liveKitURL
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"ws://livekit:7880", "http://livekit:7880/"},
+		{"wss://lk.example.com/rtc?x=1", "https://lk.example.com/"},
+		{"https://lk.example.com", "https://lk.example.com/"},
+	}
+	for _, tt := range tests {
+		got, err := probeURL(tt.raw)
+		if err != nil || got != tt.want {
+			t.Errorf("probeURL(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+	if _, err := probeURL("tcp://livekit:7880"); err == nil {
+		t.Error("probeURL accepted an unsupported scheme")
+	}
+}
+
+// liveKitServer 模拟LiveKit服务器的HTTP根路径，delay 后返回 status
+func liveKitServer(t *testing.T, status int, delay time.Duration) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestCandidateURLsSkipsDeadServers(t *testing.T) {
+	slow := liveKitServer(t, http.StatusOK, 50*time.Millisecond)
+	dead := liveKitServer(t, http.StatusServiceUnavailable, 0)
+	fast := liveKitServer(t, http.StatusOK, 0)
+
+	agent, _ := newTestAgent(&AIServices{})
+	agent.config.LiveKit.URLs = []string{slow, dead, fast}
+
+	if got, want := agent.candidateURLs(), []string{slow, fast}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ordered candidates = %v, want %v", got, want)
+	}
+
+	agent.config.LiveKit.URLStrategy = URLStrategyLatency
+	if got, want := agent.candidateURLs(), []string{fast, slow}; !reflect.DeepEqual(got, want) {
+		t.Errorf("latency candidates = %v, want %v", got, want)
+	}
+
+	// 重连时优先使用上次连接成功的地址
+	agent.config.LiveKit.URLStrategy = URLStrategyOrdered
+	agent.liveKitURL = fast
+	if got, want := agent.candidateURLs(), []string{fast, slow}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reconnect candidates = %v, want %v", got, want)
+	}
+}
+
+func TestCandidateURLsTriesAllWhenProbesFail(t *testing.T) {
+	dead := liveKitServer(t, http.StatusBadGateway, 0)
+	agent, _ := newTestAgent(&AIServices{})
+	agent.config.LiveKit.URLs = []string{dead, "ws://127.0.0.1:1"}
+
+	if got := agent.candidateURLs(); !reflect.DeepEqual(got, agent.config.LiveKit.URLs) {
+		t.Errorf("candidates = %v, want every configured url", got)
+	}
+
+	// 只有一个地址时不探测
+	agent.config.LiveKit.URLs = nil
+	agent.config.LiveKit.URL = "ws://127.0.0.1:1"
+	if got := agent.candidateURLs(); !reflect.DeepEqual(got, []string{"ws://127.0.0.1:1"}) {
+		t.Errorf("single url candidates = %v", got)
+	}
+}
+
+func TestLiveKitURLsConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LiveKit.URL = ""
+	cfg.LiveKit.URLs = []string{"ws://a:7880", "ws://b:7880"}
+	for _, key := range cfg.missingKeys() {
+		if key == "livekit.url" {
+			t.Error("livekit.url is required although urls are set")
+		}
+	}
+
+	cfg.LiveKit.URLs = []string{"ws://a:7880", "a:7880"}
+	if err := cfg.LiveKit.validateURLs(); err == nil {
+		t.Error("validateURLs accepted an address without a scheme")
+	}
+	cfg.LiveKit.URLs = nil
+	cfg.LiveKit.URLStrategy = "random"
+	if err := cfg.LiveKit.validateURLs(); err == nil {
+		t.Error("validateURLs accepted an unknown strategy")
+	}
+
+	t.Setenv("LIVEKIT_URLS", "ws://a:7880,ws://b:7880")
+	cfg = DefaultConfig()
+	if err := cfg.applyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.LiveKit.serverURLs(); !reflect.DeepEqual(got, []string{"ws://a:7880", "ws://b:7880"}) {
+		t.Errorf("server urls from LIVEKIT_URLS = %v", got)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "context"
+
+type ChatRole string
+
+const (
+	ChatRoleUser      ChatRole = "user"
+	ChatRoleAssistant ChatRole = "assistant"
+	// 压缩较早对话得到的摘要，位于历史的开头
+	ChatRoleSystem ChatRole = "system"
+)
+
+// ChatMessage 是一条历史对话消息
+type ChatMessage struct {
+	Role    ChatRole
+	Content string
+}
+
+// GenOptions 是单次生成的参数，零值表示使用服务端默认值
+type GenOptions struct {
+	// 覆盖服务默认使用的模型，为空时使用默认模型
+	Model       string
+	MaxTokens   int
+	Temperature float64
+	// 按时间顺序排列的历史对话，位于系统提示词和本轮用户消息之间
+	History []ChatMessage
+	// 每次请求完成后报告消耗的token，一次生成中调用工具时会有多次请求
+	OnUsage func(usage TokenUsage)
+	// 随机种子，服务端支持时相同的输入和种子生成相同的回复，用于测试和演示；nil 表示不指定
+	Seed *int64
+	// 回复格式: text 或 json_object，为空时使用服务端默认值
+	ResponseFormat string
+	// 每次请求完成后报告服务端的 system_fingerprint，指定 Seed 时用它判断后端配置是否变化
+	OnFingerprint func(fingerprint string)
+}
+
+const (
+	responseFormatText       = "text"
+	responseFormatJSONObject = "json_object"
+)
+
+// TokenUsage 是一次请求消耗的token数量
+type TokenUsage struct {
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+func (u TokenUsage) Total() int64 {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// LanguageModel 是大语言模型服务的抽象
+type LanguageModel interface {
+	Generate(ctx context.Context, system, user string, opts GenOptions) (string, error)
+	// GenerateStream 在生成过程中把每段新增文本交给 onDelta，返回完整回复
+	GenerateStream(ctx context.Context, system, user string, opts GenOptions, onDelta func(delta string)) (string, error)
+}
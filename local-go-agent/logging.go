@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+type turnLoggerKey struct{}
+
+func newLogger(cfg LogConfig) *logrus.Logger {
+	logger := logrus.New()
+
+	// 级别和格式在加载配置时已校验
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logger.SetLevel(level)
+	if cfg.Format == logFormatJSON {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	}
+	return logger
+}
+
+func (c LogConfig) validate() error {
+	if c.Level != "" {
+		if _, err := logrus.ParseLevel(c.Level); err != nil {
+			return err
+		}
+	}
+	switch c.Format {
+	case "", logFormatText, logFormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("未知的日志格式: %s", c.Format)
+	}
+}
+
+// withTurn 为一轮对话生成 turn_id，返回的上下文中带有附加了 turn_id 和参与者身份的日志记录器，
+// 同一轮对话中STT、LLM、TTS的日志都可以按 turn_id 检索
+func (a *AIAgent) withTurn(ctx context.Context, identity string) context.Context {
+	logger := a.logger.WithFields(logrus.Fields{
+		"turn_id":     newTurnID(),
+		"participant": identity,
+	})
+	return context.WithValue(ctx, turnLoggerKey{}, logger)
+}
+
+// turnLogger 返回上下文中当前对话的日志记录器，不在对话中时返回代理的日志记录器
+func (a *AIAgent) turnLogger(ctx context.Context) *logrus.Entry {
+	if logger, ok := ctx.Value(turnLoggerKey{}).(*logrus.Entry); ok {
+		return logger
+	}
+	return a.logger
+}
+
+func newTurnID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// newSessionID 生成代理加入房间的会话ID，包含房间名和开始时间，便于在对话记录中查找
+func newSessionID(room string, started time.Time) string {
+	var id [2]byte
+	rand.Read(id[:])
+	return fmt.Sprintf("%s-%s-%s", room, started.UTC().Format("20060102T150405Z"), hex.EncodeToString(id[:]))
+}
+
+// SessionID 返回代理本次加入房间的会话ID
+func (a *AIAgent) SessionID() string {
+	return a.sessionID
+}
@@ -2,271 +2,936 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/openai/openai-go/v3/option"
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v3"
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	defaultLiveKitURL    = "ws://livekit:7880"
-	defaultAPIKey        = "APIcyMmEUQTDGnS"
-	defaultAPISecret     = "EfnCKnGxm8dyz8x7kia5UoP8coukwGmoVemUrBSiRBc"
 	defaultRoomName      = "test-room"
 	defaultParticipantID = "go-ai-agent"
 )
 
+// 没有配置API密钥也没有访问令牌时无法连接，不会使用任何内置凭据
+var errMissingCredentials = errors.New("未提供LiveKit凭据: 请设置 LIVEKIT_API_KEY 和 LIVEKIT_API_SECRET，或 LIVEKIT_TOKEN / LIVEKIT_TOKEN_URL")
+
+// LLM请求的默认超时时间，超时或代理关闭时请求会被取消
+const defaultLLMTimeout = 30 * time.Second
+
+// 收到退出信号后等待进行中的对话完成的最长时间
+const shutdownGracePeriod = 10 * time.Second
+
+// 读取RTP包遇到临时错误时的重试间隔
+const (
+	initialReadRetryDelay = 10 * time.Millisecond
+	maxReadRetryDelay     = time.Second
+)
+
 type AIAgent struct {
-	room         *lksdk.Room
-	logger       *logrus.Logger
-	participants map[string]*lksdk.RemoteParticipant
-	ctx          context.Context
-	cancel       context.CancelFunc
+	config    *Config
+	room      *lksdk.Room
+	publisher dataPublisher
+	logger    *logrus.Entry
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	// 房间中的其他参与者，由房间回调协程写入
+	participantsMu sync.RWMutex
+	participants   map[string]*lksdk.RemoteParticipant
+
+	// 每个参与者检测到的语言，后续发言复用
+	languagesMu sync.RWMutex
+	languages   map[string]string
+
+	// 加入房间时确定的人设，可以通过按键菜单切换；参与者切换到的 persona_modes 中的人设
+	personaMu    sync.RWMutex
+	persona      Persona
+	personaModes map[string]string
+	// 回复中可以按名称选择的声音
+	voices *VoiceRegistry
+
+	// 唤醒词，以及说出唤醒词后等待接着说话的截止时间
+	wakeWords []*regexp.Regexp
+	wakeMu    sync.Mutex
+	awake     map[string]time.Time
+
+	// 每个参与者的发言队列，保证同一参与者的对话依次进行
+	queuesMu sync.Mutex
+	queues   map[string]*turnQueue
+	// 最近一次播放的回复属于哪位参与者的对话，插话时只打断这一轮
+	playbackMu    sync.Mutex
+	playbackOwner string
+
+	// 正在处理的音频轨道，按参与者和轨道区分
+	tracksMu sync.Mutex
+	tracks   map[trackKey]*audioTrack
+
+	// 每位说话人的对话历史
+	historiesMu sync.Mutex
+	histories   map[string]*ConversationHistory
+	// 持久保存的对话历史，为空时参与者离开后对话历史随之丢弃
+	historyStore HistoryStore
+
+	// 已经问候过的参与者，重连和重新加入时不再问候
+	greetedMu sync.Mutex
+	greeted   map[string]bool
+
+	// 处理参与者按键，为空时忽略按键
+	dtmf DTMFHandler
+
+	// 按 captions.interim_interval 节流中间字幕
+	captions *captionThrottle
+
+	// SetIgnored 设置的参与者，true 为忽略，false 为不忽略，优先于配置和元数据
+	ignoredMu sync.RWMutex
+	ignored   map[string]bool
+
+	// 保存每轮对话，为空时不保存
+	transcripts TranscriptStore
+	// 代理加入房间的这次会话，对话记录按它导出字幕，逐词时间相对 started
+	sessionID string
+	started   time.Time
+
+	// 回复发布和合成之前依次执行的中间件
+	responseMiddleware []ResponseMiddleware
+
+	// 代理开始的房间录制，没有录制时为空
+	egressMu sync.Mutex
+	egressID string
+
+	// 房间中没有其他参与者时的空闲倒计时
+	idleMu    sync.Mutex
+	idleTimer *time.Timer
+	idleRound uint64
+	onIdle    func()
+
+	// 只回应主讲人时决定当前的主讲人
+	speakers *activeSpeakerGate
+
+	// 按键说话模式下正在说话的参与者
+	pttMu   sync.Mutex
+	talking map[string]bool
+
+	// 每个参与者通过元数据设置的个人偏好
+	settingsMu sync.RWMutex
+	settings   map[string]ParticipantSettings
+
+	events  chan AgentEvent
+	metrics *Metrics
+	// 通过 On 注册的事件回调，按注册顺序调用
+	handlersMu sync.RWMutex
+	handlers   map[AgentEventType][]EventHandler
+
+	// 当前会话的语音输出，未发布音频轨道时为 nil
+	audioMu  sync.Mutex
+	audioOut speechOutput
+	// 按连接质量调整语音轨道的码率，编码器不支持调整时为 nil
+	bitrate *bitrateAdapter
+
+	// 未开启录音时为 nil
+	recorderMu sync.Mutex
+	recorder   *Recorder
+
+	// 连接参数，断线重连时复用。liveKitURL 是最近一次连接成功的服务器地址，由 sessionMu 保护
+	liveKitURL  string
+	connectInfo lksdk.ConnectInfo
+	// 不为 nil 时使用它提供的访问令牌连接，而不是 connectInfo 中的API密钥
+	tokenProvider TokenProvider
+
+	// 当前房间连接的会话上下文，断线时取消以放弃进行中的对话
+	sessionMu     sync.Mutex
+	sessionCtx    context.Context
+	sessionCancel context.CancelFunc
+
+	// closing 标记主动断开，此时不再重连，也不再接受新的对话
+	closing        atomic.Bool
+	disconnectOnce sync.Once
+
+	// 连接状态，变化时写入 stateChanges
+	stateMu      sync.Mutex
+	state        State
+	stateChanges chan State
+
+	// 进行中的对话，Shutdown 时等待它们完成
+	turns supervisor
+	// 欢迎消息、音频轨道和重连等后台协程，Shutdown 断开连接后等待它们退出
+	tasks supervisor
 
 	// AI服务
-	openaiService     *OpenAIService
-	assemblyaiService *AssemblyAIService
-	cartesiaService   *CartesiaService
+	llm LanguageModel
+	stt SpeechToText
+	tts TextToSpeech
+	// pipeline 为 realtime 时不为 nil，语音对话由 Realtime 会话完成
+	realtime *RealtimeService
+
+	limiter *turnLimiter
+	filler  *FillerPlayer
+	// 本房间和所有房间共享的token预算
+	budget       *tokenBudget
+	globalBudget *tokenBudget
+	// 房间的累计估算费用
+	costs costTotal
 }
 
-func NewAIAgent() *AIAgent {
-	logger := logrus.New()
-	logger.SetLevel(logrus.InfoLevel)
+// AIServices 是AI服务客户端的集合，多个房间的代理可以共享同一组客户端
+type AIServices struct {
+	LLM LanguageModel
+	STT SpeechToText
+	TTS TextToSpeech
+	// pipeline 为 realtime 时由它完成语音对话，为空时使用 modular 流水线
+	Realtime *RealtimeService
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// 限制所有房间同时进行的对话数量，为空时不限制
+	limiter *turnLimiter
+	// 所有房间共享的token预算，为空时不限制
+	budget *tokenBudget
+	// 语音对话开始时播放的填充音，为空时不播放
+	filler *FillerPlayer
+	// 保存每轮对话，为空时不保存
+	transcripts TranscriptStore
+	// 代理加入房间的这次会话，对话记录按它导出字幕，逐词时间相对 started
+	sessionID string
+	started   time.Time
+	// 保存对话历史，参与者重新加入或代理重新连接房间后恢复，为空时只保存在代理中
+	histories HistoryStore
+}
 
-	// 初始化AI服务
-	var openaiService *OpenAIService
-	var assemblyaiService *AssemblyAIService
-	var cartesiaService *CartesiaService
+func NewAIServices(cfg *Config, logger *logrus.Logger) *AIServices {
+	services := &AIServices{
+		limiter: newTurnLimiter(cfg.Audio.MaxConcurrentTurns),
+		budget:  newTokenBudget(cfg.Budget.GlobalTokens, cfg.Budget.Window),
+	}
 
-	// 从环境变量获取API密钥
-	if openaiKey := os.Getenv("OPENAI_API_KEY"); openaiKey != "" {
-		var err error
-		openaiService, err = NewOpenAIService(openaiKey)
+	// 配置中未提供API密钥的服务不可用
+	if cfg.OpenAI.APIKey != "" {
+		var opts []option.RequestOption
+		if debugger := newAPIDebugger(cfg.Log, logger, "OpenAI"); debugger != nil {
+			opts = append(opts, option.WithHTTPClient(debugger.httpClient()))
+		}
+		openaiService, err := NewOpenAIServiceFromConfig(cfg.OpenAI, opts...)
 		if err != nil {
 			logger.Errorf("初始化OpenAI服务失败: %v", err)
 		} else {
 			logger.Info("OpenAI服务已初始化")
+			if err := openaiService.RegisterTool(currentTimeTool()); err != nil {
+				logger.Errorf("注册工具失败: %v", err)
+			}
+			if cfg.Moderation.Enabled {
+				for _, tool := range moderationTools() {
+					if err := openaiService.RegisterTool(tool); err != nil {
+						logger.Errorf("注册工具失败: %v", err)
+					}
+				}
+				logger.Warn("已开启房间管理，模型可以静音或移出参与者")
+			}
+			services.LLM = openaiService
 		}
 	} else {
 		logger.Warn("未设置OPENAI_API_KEY环境变量，OpenAI服务将不可用")
 	}
 
-	if assemblyaiKey := os.Getenv("ASSEMBLYAI_API_KEY"); assemblyaiKey != "" {
-		var err error
-		assemblyaiService, err = NewAssemblyAIService(assemblyaiKey)
+	services.STT = newSpeechToText(cfg, logger)
+
+	services.TTS = newTextToSpeech(cfg, logger)
+
+	if cfg.Pipeline == PipelineRealtime {
+		services.Realtime = newRealtimeService(cfg, logger)
+	}
+
+	if cfg.Audio.FillerPath != "" {
+		filler, err := NewFillerPlayerFromFile(cfg.Audio.FillerPath)
 		if err != nil {
-			logger.Errorf("初始化AssemblyAI服务失败: %v", err)
+			logger.Errorf("加载填充音失败，不播放填充音: %v", err)
 		} else {
-			logger.Info("AssemblyAI服务已初始化")
+			logger.Infof("已加载填充音: %s (%v)", cfg.Audio.FillerPath, filler.Duration())
+			services.filler = filler
 		}
-	} else {
-		logger.Warn("未设置ASSEMBLYAI_API_KEY环境变量，AssemblyAI服务将不可用")
 	}
 
-	if cartesiaKey := os.Getenv("CARTESIA_API_KEY"); cartesiaKey != "" {
-		cartesiaService = NewCartesiaService(cartesiaKey)
-		logger.Info("Cartesia服务已初始化")
+	histories, err := newHistoryStore(cfg.History)
+	if err != nil {
+		logger.Errorf("打开对话历史存储失败，参与者离开后不保留对话历史: %v", err)
 	} else {
-		logger.Warn("未设置CARTESIA_API_KEY环境变量，Cartesia服务将不可用")
+		services.histories = histories
 	}
 
-	return &AIAgent{
-		logger:            logger,
-		participants:      make(map[string]*lksdk.RemoteParticipant),
-		ctx:               ctx,
-		cancel:            cancel,
-		openaiService:     openaiService,
-		assemblyaiService: assemblyaiService,
-		cartesiaService:   cartesiaService,
+	if cfg.Transcripts.Path != "" {
+		store, err := NewJSONLTranscriptStore(cfg.Transcripts.Path)
+		if err != nil {
+			logger.Errorf("打开对话记录失败，不保存对话记录: %v", err)
+		} else {
+			logger.Infof("对话记录保存到: %s", cfg.Transcripts.Path)
+			services.transcripts = newAsyncTranscriptStore(store, logger)
+		}
+	}
+
+	return services
+}
+
+// Close 保存尚未写入的对话记录并关闭存储，所有房间的代理都关闭后调用
+func (s *AIServices) Close() error {
+	if closer, ok := s.transcripts.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func NewAIAgent(cfg *Config) *AIAgent {
+	logger := newLogger(cfg.Log)
+	return newAIAgent(cfg, NewAIServices(cfg, logger), NewMetrics(), logger)
+}
+
+func newAIAgent(cfg *Config, services *AIServices, metrics *Metrics, logger *logrus.Logger) *AIAgent {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := time.Now()
+
+	agent := &AIAgent{
+		config:        cfg,
+		logger:        logger.WithField("room", cfg.LiveKit.RoomName),
+		participants:  make(map[string]*lksdk.RemoteParticipant),
+		languages:     make(map[string]string),
+		settings:      make(map[string]ParticipantSettings),
+		personaModes:  make(map[string]string),
+		queues:        make(map[string]*turnQueue),
+		talking:       make(map[string]bool),
+		greeted:       make(map[string]bool),
+		histories:     make(map[string]*ConversationHistory),
+		tracks:        make(map[trackKey]*audioTrack),
+		speakers:      newActiveSpeakerGate(cfg.Audio.ActiveSpeakerHold),
+		events:        make(chan AgentEvent, eventBufferSize),
+		stateChanges:  make(chan State, stateBufferSize),
+		metrics:       metrics,
+		ctx:           ctx,
+		cancel:        cancel,
+		persona:       cfg.Persona,
+		voices:        NewVoiceRegistry(cfg.NamedVoices),
+		wakeWords:     wakeWordPatterns(cfg.WakeWord.Phrases),
+		awake:         make(map[string]time.Time),
+		tokenProvider: newTokenProvider(cfg.LiveKit),
+		llm:           services.LLM,
+		stt:           services.STT,
+		tts:           services.TTS,
+		realtime:      services.Realtime,
+		limiter:       services.limiter,
+		filler:        services.filler,
+		transcripts:   services.transcripts,
+		sessionID:     newSessionID(cfg.LiveKit.RoomName, started),
+		started:       started,
+		historyStore:  services.histories,
+		budget:        newTokenBudget(cfg.Budget.RoomTokens, cfg.Budget.Window),
+		globalBudget:  services.budget,
+	}
+	// 服务在会话和对话的 ctx 中启动的协程也由 tasks 跟踪，Shutdown 会等待它们退出
+	agent.ctx = withSupervisor(ctx, &agent.tasks)
+	agent.captions = newCaptionThrottle(cfg.Captions.InterimInterval, agent.sendCaption)
+	if len(cfg.DTMF) > 0 {
+		agent.dtmf = DTMFMenu(cfg.DTMF)
 	}
+	if cfg.OpenAI.RedactPII {
+		agent.UseResponseMiddleware(RedactPII)
+	}
+	return agent
 }
 
 func (a *AIAgent) Connect() error {
-	// 获取环境变量
-	liveKitURL := getEnv("LIVEKIT_URL", defaultLiveKitURL)
-	apiKey := getEnv("LIVEKIT_API_KEY", defaultAPIKey)
-	apiSecret := getEnv("LIVEKIT_API_SECRET", defaultAPISecret)
-	roomName := getEnv("ROOM_NAME", defaultRoomName)
-	participantID := getEnv("PARTICIPANT_NAME", defaultParticipantID)
-
-	a.logger.Infof("连接到LiveKit服务器: %s", liveKitURL)
-	a.logger.Infof("房间名称: %s", roomName)
-	a.logger.Infof("参与者ID: %s", participantID)
-
-	// 创建房间连接
-	room, err := lksdk.ConnectToRoom(liveKitURL, lksdk.ConnectInfo{
-		APIKey:              apiKey,
-		APISecret:           apiSecret,
-		RoomName:            roomName,
-		ParticipantIdentity: participantID,
-		ParticipantName:     "AI助手",
-	}, &lksdk.RoomCallback{
+	lkConfig := a.config.LiveKit
+	if a.tokenProvider == nil && (lkConfig.APIKey == "" || lkConfig.APISecret == "") {
+		return errMissingCredentials
+	}
+
+	a.logger.Infof("连接到LiveKit服务器: %s", strings.Join(lkConfig.serverURLs(), ", "))
+	a.logger.Infof("房间名称: %s", lkConfig.RoomName)
+	a.logger.Infof("参与者ID: %s", lkConfig.ParticipantIdentity)
+	a.logger.Infof("会话ID: %s", a.sessionID)
+
+	a.connectInfo = lksdk.ConnectInfo{
+		APIKey:              lkConfig.APIKey,
+		APISecret:           lkConfig.APISecret,
+		RoomName:            lkConfig.RoomName,
+		ParticipantIdentity: lkConfig.ParticipantIdentity,
+		ParticipantName:     lkConfig.ParticipantName,
+	}
+
+	a.logCapabilities()
+	a.setState(StateConnecting)
+	if err := a.connectRoom(); err != nil {
+		a.setState(StateDisconnected)
+		return err
+	}
+	a.setState(StateConnected)
+	a.logger.Info("成功连接到LiveKit房间")
+
+	persona := a.resolvePersona(lkConfig.RoomName, a.room.Metadata())
+	if err := persona.validate(); err != nil {
+		a.Disconnect()
+		return fmt.Errorf("房间 %s 的人设无效: %w", lkConfig.RoomName, err)
+	}
+	a.setPersona(persona)
+
+	// 加入前已在房间中的参与者不会触发 OnParticipantConnected，需要主动读取其元数据
+	a.restoreParticipants()
+
+	// 发送欢迎消息，仅在首次连接时发送，重连不会重复发送
+	if a.config.Greeting.Enabled && a.config.Greeting.Welcome != "" {
+		a.spawn("欢迎消息", a.sendWelcomeMessage)
+	}
+
+	return nil
+}
+
+// connectRoom 使用保存的连接参数建立房间连接，并开启新的会话上下文
+func (a *AIAgent) connectRoom() error {
+	callback := &lksdk.RoomCallback{
 		ParticipantCallback: lksdk.ParticipantCallback{
-			OnTrackSubscribed: a.onTrackSubscribed,
+			OnDataPacket:      a.onDataReceived,
+			OnMetadataChanged: a.onParticipantMetadataChanged,
+			// 房间回调收到所有参与者的连接质量，代理只关心自己的
+			OnConnectionQualityChanged: a.onConnectionQualityChanged,
 		},
 		OnParticipantConnected:    a.onParticipantConnected,
 		OnParticipantDisconnected: a.onParticipantDisconnected,
 		OnDisconnected:            a.onRoomDisconnected,
-	})
+		OnActiveSpeakersChanged:   a.onActiveSpeakersChanged,
+	}
+	// 只播报的代理不订阅轨道，也就不需要处理轨道的回调
+	if a.config.LiveKit.Subscribe {
+		callback.OnTrackSubscribed = a.onTrackSubscribed
+		callback.OnTrackUnsubscribed = a.onTrackUnsubscribed
+		callback.OnTrackMuted = a.onTrackMuted
+		callback.OnTrackUnmuted = a.onTrackUnmuted
+	}
 
+	var token string
+	var err error
+	if a.tokenProvider != nil {
+		// 每次连接都重新获取令牌，令牌过期导致的断线可以通过重连恢复
+		ctx, cancel := context.WithTimeout(a.ctx, tokenFetchTimeout)
+		token, err = a.tokenProvider.Token(ctx, a.connectInfo.RoomName, a.connectInfo.ParticipantIdentity)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("获取访问令牌失败: %w", err)
+		}
+	} else {
+		token, err = accessToken(a.connectInfo, a.config.LiveKit.Publish, a.config.LiveKit.Subscribe)
+		if err != nil {
+			return fmt.Errorf("签发访问令牌失败: %w", err)
+		}
+	}
+	// 配置了多个服务器地址时依次尝试，记住连接成功的地址，重连时优先使用
+	room, serverURL, err := a.dialRoom(token, callback)
 	if err != nil {
 		return fmt.Errorf("连接房间失败: %w", err)
 	}
+	if serverURL != a.serverURL() {
+		a.logger.Infof("已连接到LiveKit服务器 %s", serverURL)
+	}
 
+	a.sessionMu.Lock()
+	a.liveKitURL = serverURL
 	a.room = room
-	a.logger.Info("成功连接到LiveKit房间")
+	a.publisher = room.LocalParticipant
+	a.sessionCtx, a.sessionCancel = context.WithCancel(a.ctx)
+	sessionCtx := a.sessionCtx
+	a.sessionMu.Unlock()
 
-	// 发送欢迎消息
-	go a.sendWelcomeMessage()
+	// 没有语音合成服务时不发布音频轨道，回复只以文本发送
+	if a.speaksAudio() {
+		if err := a.publishAudioTrack(sessionCtx, room); err != nil {
+			a.logger.Errorf("语音回复不可用: %v", err)
+		}
+	}
 
 	return nil
 }
 
-func (a *AIAgent) sendWelcomeMessage() {
-	time.Sleep(2 * time.Second) // 等待连接稳定
+// connectOptions 根据网络配置和可用的服务生成连接选项
+func (a *AIAgent) connectOptions() []lksdk.ConnectOption {
+	var options []lksdk.ConnectOption
+	// 纯文字模式下不需要任何媒体轨道，避免白白接收和解码音频
+	if !a.listensToAudio() {
+		options = append(options, lksdk.WithAutoSubscribe(false))
+	}
+	if a.config.Network.ForceRelay {
+		options = append(options, lksdk.WithICETransportPolicy(webrtc.ICETransportPolicyRelay))
+	}
+	return options
+}
 
-	welcomeMsg := "你好！我是你的AI助手，有什么可以帮助你的吗？"
+func (a *AIAgent) session() context.Context {
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
 
-	// 发送文本消息
-	err := a.room.LocalParticipant.PublishData([]byte(welcomeMsg))
-	if err != nil {
-		a.logger.Errorf("发送欢迎消息失败: %v", err)
-		return
+	if a.sessionCtx == nil {
+		return a.ctx
 	}
+	return a.sessionCtx
+}
+
+// endSession 取消当前会话上下文，正在进行的音频处理和对话都会随之退出
+func (a *AIAgent) endSession() {
+	a.sessionMu.Lock()
+	defer a.sessionMu.Unlock()
 
-	a.logger.Info("已发送欢迎消息")
+	if a.sessionCancel != nil {
+		a.sessionCancel()
+	}
 }
 
 func (a *AIAgent) onParticipantConnected(participant *lksdk.RemoteParticipant) {
 	a.logger.Infof("参与者加入: %s (%s)", participant.Name(), participant.Identity())
-	a.participants[participant.Identity()] = participant
+	a.addParticipant(participant)
+	a.loadParticipantSettings(participant)
+	a.emit(AgentEvent{Type: EventParticipantJoined, ParticipantIdentity: participant.Identity()})
+	a.stopIdleTimer()
 
-	// 向新参与者发送欢迎消息
-	welcomeMsg := fmt.Sprintf("欢迎 %s 加入房间！", participant.Name())
-	err := a.room.LocalParticipant.PublishData([]byte(welcomeMsg))
-	if err != nil {
-		a.logger.Errorf("发送个人欢迎消息失败: %v", err)
-	}
+	a.greetParticipant(participant)
 }
 
 func (a *AIAgent) onParticipantDisconnected(participant *lksdk.RemoteParticipant) {
 	a.logger.Infof("参与者离开: %s (%s)", participant.Name(), participant.Identity())
-	delete(a.participants, participant.Identity())
+	a.removeParticipant(participant.Identity())
+	a.forgetParticipantLanguage(participant.Identity())
+	a.forgetParticipantSettings(participant.Identity())
+	a.forgetPersonaMode(participant.Identity())
+	a.forgetWake(participant.Identity())
+	a.forgetTurnQueue(participant.Identity())
+	a.setPushToTalk(participant.Identity(), false)
+	a.stopParticipantTracks(participant.Identity())
+	a.speakers.Forget(participant.Identity())
+	// 对话历史仍保存在存储中，短暂断线后重新加入时继续之前的对话
+	a.releaseConversations(participant.Identity())
+	a.metrics.DeleteAudioLevel(participant.Identity())
+	if recorder := a.currentRecorder(); recorder != nil {
+		if err := recorder.CloseParticipant(participant.Identity()); err != nil {
+			a.logger.Errorf("保存录音失败: %v", err)
+		}
+	}
+	a.checkIdle()
 }
 
 func (a *AIAgent) onTrackSubscribed(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, participant *lksdk.RemoteParticipant) {
 	a.logger.Infof("订阅轨道: %s 来自 %s", publication.Name(), participant.Identity())
 
 	if publication.Kind() == lksdk.TrackKindAudio {
+		if !a.listensToAudio() {
+			return
+		}
+		if a.isIgnored(participant.Identity()) {
+			a.logger.Infof("忽略 %s 的音频轨道", participant.Identity())
+			return
+		}
 		a.logger.Info("开始处理音频轨道")
-		go a.processAudioTrack(track, participant)
+		key := trackKey{identity: participant.Identity(), trackSID: publication.SID()}
+		ctx, audioTrack := a.startTrack(key)
+		audioTrack.muted.Store(publication.IsMuted())
+		a.spawn("音频轨道", func() {
+			defer a.finishTrack(key, audioTrack)
+			a.processAudioTrack(ctx, track, publication, participant, audioTrack)
+		})
 	}
 }
 
-func (a *AIAgent) processAudioTrack(track *webrtc.TrackRemote, participant *lksdk.RemoteParticipant) {
+func (a *AIAgent) processAudioTrack(ctx context.Context, track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, participant *lksdk.RemoteParticipant, state *audioTrack) {
 	a.logger.Infof("处理来自 %s 的音频轨道", participant.Identity())
 
-	// 音频缓冲区
-	audioBuffer := make([]byte, 0)
-	bufferDuration := 3 * time.Second // 收集3秒的音频数据
-	lastProcessTime := time.Now()
+	// 按协商出的编码选择解码器，不支持的编码直接报错，不把无法解析的数据送去识别
+	codec := track.Codec()
+	decoder, err := newAudioDecoder(codec)
+	if err != nil {
+		a.logger.Errorf("无法处理 %s 的音频轨道: %v", participant.Identity(), err)
+		a.emitError(participant.Identity(), err)
+		return
+	}
+	a.logger.Debugf("%s 的音频轨道使用 %s 编码", participant.Identity(), codec.MimeType)
+
+	// 按序列号重排乱序的包，丢失的包补静音，避免打乱送去识别的音频
+	jitter := newJitterBuffer(a.config.Audio.JitterBufferDepth)
+
+	state.attach(ctx, a.newAudioIngest(participant, publication.SID()))
+	defer state.close()
+	// 客户端附带RTP音量扩展时，持续静音的包不解码
+	gate := newLevelGate(audioLevelExtensionID(publication.Receiver()), a.config.Audio.RTPLevelGate)
+	var seenMutes int64
+	retryDelay := initialReadRetryDelay
+
+	// decode 解码排好序的包送入处理链，nil 表示丢失的包，用补偿音频代替
+	decode := func(packets []*rtp.Packet) {
+		for _, packet := range packets {
+			var (
+				pcm []int16
+				err error
+			)
+			if packet == nil {
+				pcm = decoder.Conceal()
+			} else if silence, skip := gate.Skip(packet); skip {
+				pcm = silence
+			} else if pcm, err = decoder.Decode(packet.Payload); err != nil {
+				a.logger.Debugf("丢弃无法解码的音频包: %v", err)
+				continue
+			} else {
+				gate.Decoded(pcm)
+			}
+			state.push(pcm)
+		}
+	}
 
 	for {
 		select {
-		case <-a.ctx.Done():
+		case <-ctx.Done():
 			return
 		default:
+			if !publication.IsSubscribed() {
+				a.logger.Infof("已取消订阅 %s 的音频轨道，停止处理", participant.Identity())
+				return
+			}
+
 			// 读取音频数据
 			rtpPacket, _, err := track.ReadRTP()
 			if err != nil {
-				a.logger.Errorf("读取RTP包失败: %v", err)
+				if isTerminalReadError(err) {
+					a.logger.Infof("%s 的音频轨道已结束: %v", participant.Identity(), err)
+					// 还在等待乱序包的音频不丢弃
+					decode(jitter.Drain())
+					return
+				}
+
+				// 临时错误，退避后重试，避免空转占满CPU
+				a.logger.Warnf("读取RTP包失败，%v 后重试: %v", retryDelay, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(retryDelay):
+				}
+				retryDelay = min(retryDelay*2, maxReadRetryDelay)
 				continue
 			}
+			retryDelay = initialReadRetryDelay
 
-			// 将RTP包的payload添加到缓冲区
-			audioBuffer = append(audioBuffer, rtpPacket.Payload...)
+			// 其他负载类型（如舒适噪声）不是协商出的编码，交给解码器只会解码失败
+			if rtpPacket.PayloadType != uint8(track.PayloadType()) {
+				continue
+			}
 
-			// 检查是否应该处理音频
-			if time.Since(lastProcessTime) >= bufferDuration && len(audioBuffer) > 0 {
-				go a.processAudioBuffer(audioBuffer, participant)
-				audioBuffer = make([]byte, 0) // 清空缓冲区
-				lastProcessTime = time.Now()
+			// 静音前缓冲的语音单独成为一段发言，静音期间的音频不再缓冲
+			if mutes := state.mutes.Load(); mutes != seenMutes {
+				seenMutes = mutes
+				state.flush()
+			}
+			if state.muted.Load() {
+				continue
 			}
+
+			decode(jitter.Push(rtpPacket))
 		}
 	}
 }
 
-func (a *AIAgent) processAudioBuffer(audioData []byte, participant *lksdk.RemoteParticipant) {
-	a.logger.Infof("开始处理音频数据，大小: %d bytes", len(audioData))
+// isTerminalReadError 判断读取错误是否表示轨道已经结束，此时应退出处理协程
+func isTerminalReadError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed)
+}
+
+func (a *AIAgent) processAudioBuffer(ctx context.Context, request turnRequest, participant *lksdk.RemoteParticipant) {
+	pcm := request.pcm
+	ctx = withTurnTimings(ctx)
+	logger := a.turnLogger(ctx)
+	logger.Infof("开始处理音频数据，时长: %v", time.Duration(len(pcm))*time.Second/sttSampleRate)
+	turnStart := time.Now()
 
 	// 步骤1: 语音转文字 (STT)
-	var transcription string
-	if a.assemblyaiService != nil {
-		var err error
-		transcription, err = a.assemblyaiService.TranscribeAudioBytes(audioData)
-		if err != nil {
-			a.logger.Errorf("语音转文字失败: %v", err)
-			// 发送错误消息
-			a.sendTextMessage("抱歉，我无法理解您说的话。")
-			return
+	if a.stt == nil {
+		// 纯文字模式下不会订阅音频，加入房间时已提示过
+		logger.Debug("语音识别服务不可用，跳过语音转文字")
+		return
+	}
+	// 支持自动检测时每段发言重新检测语言，见 transcriptionLanguage
+	identity := participant.Identity()
+	previous := a.participantLanguage(identity)
+	requested := a.transcriptionLanguage(identity, time.Duration(len(pcm))*time.Second/sttSampleRate)
+	sttStart := time.Now()
+	result, err := a.transcribe(ctx, identity, pcm, requested)
+	a.observeStage(ctx, stageSTT, time.Since(sttStart))
+	// 对话被取消（超时、打断或断线）不是识别失败，不发送道歉
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logger.Errorf("语音转文字失败: %v", err)
+		a.metrics.IncError(stageSTT)
+		a.emitError(identity, err)
+		// 发送错误消息
+		a.sendTextMessage(serviceErrorReply(err, "抱歉，我无法理解您说的话。"))
+		return
+	}
+	a.chargeAudio(ctx, time.Duration(len(pcm))*time.Second/sttSampleRate)
+	if request.stitcher != nil {
+		result.Text = request.stitcher.Stitch(result, time.Duration(len(pcm))*time.Second/sttSampleRate, time.Duration(request.overlap)*time.Second/sttSampleRate)
+	}
+	// 等待唤醒时在整段发言中查找唤醒词，没有唤醒词的发言不检测语言，直接忽略；说了唤醒词的发言沿用这次识别结果
+	if _, found := a.matchWakeWord(result.Text); a.wakeWordIdle(identity) && !found {
+		logger.Debug("未检测到唤醒词，忽略这段发言")
+		return
+	}
+	language := a.transcriptLanguage(ctx, identity, result, requested, previous)
+	a.handleTranscript(ctx, result, language, participant, turnStart)
+}
+
+// transcribe 识别一段发言，识别服务支持时带上参与者在元数据中设置的转录选项
+func (a *AIAgent) transcribe(ctx context.Context, identity string, pcm []int16, language string) (Transcript, error) {
+	if transcriber, ok := a.stt.(optionsTranscriber); ok {
+		return transcriber.TranscribeWithOptions(ctx, int16ToBytes(pcm), language, a.participantSettings(identity).Transcribe)
+	}
+	return a.stt.Transcribe(ctx, int16ToBytes(pcm), language)
+}
+
+// processTranscript 处理流式识别在服务端检测到发言结束时给出的转录结果
+func (a *AIAgent) processTranscript(ctx context.Context, result Transcript, participant *lksdk.RemoteParticipant) {
+	ctx = withTurnTimings(ctx)
+	turnStart := time.Now()
+	identity := participant.Identity()
+	// 没有检测语言时，结果中的语言就是打开识别会话时指定的语言
+	requested := result.Language
+	if result.LanguageDetected || result.LanguageConfidence > 0 {
+		requested = ""
+	}
+	language := a.transcriptLanguage(ctx, identity, result, requested, a.participantLanguage(identity))
+	a.handleTranscript(ctx, result, language, participant, turnStart)
+}
+
+// transcriptLanguage 根据转录结果更新参与者的语言，返回本轮回复使用的语言
+func (a *AIAgent) transcriptLanguage(ctx context.Context, identity string, result Transcript, requested, previous string) string {
+	logger := a.turnLogger(ctx)
+	language := result.Language
+	switch {
+	case result.LanguageDetected:
+		if language != previous {
+			logger.Infof("检测到 %s 的语言: %s (置信度: %.2f)", identity, language, result.LanguageConfidence)
 		}
-		a.logger.Infof("转录结果: %s", transcription)
-	} else {
-		a.logger.Warn("AssemblyAI服务不可用，跳过语音转文字")
-		a.sendTextMessage("抱歉，语音识别服务暂时不可用。")
+		a.setParticipantLanguage(identity, language)
+	case requested == "" && previous != "":
+		// 检测不可靠时沿用上一次检测到的语言，而不是回退到默认语言
+		logger.Infof("%s 的语言检测置信度不足 (%.2f)，沿用上一次的语言: %s", identity, result.LanguageConfidence, previous)
+		language = previous
+	case result.LanguageConfidence > 0:
+		logger.Infof("%s 的语言检测置信度不足 (%.2f)，使用默认语言: %s", identity, result.LanguageConfidence, language)
+	}
+	return language
+}
+
+// handleTranscript 过滤转录结果并回复
+func (a *AIAgent) handleTranscript(ctx context.Context, transcript Transcript, language string, participant *lksdk.RemoteParticipant, turnStart time.Time) {
+	logger := a.turnLogger(ctx)
+	transcript, ok := a.passWakeWord(ctx, participant, transcript)
+	if !ok {
 		return
 	}
+	transcription := transcript.Text
+	logger.Infof("转录结果: %s", transcription)
+	a.emit(AgentEvent{Type: EventTranscriptReceived, ParticipantIdentity: participant.Identity(), Text: transcription})
 
-	// 如果转录结果为空或太短，跳过处理
-	if len(transcription) < 3 {
-		a.logger.Info("转录结果太短，跳过处理")
+	// 连接已断开，放弃本轮对话
+	if ctx.Err() != nil {
 		return
 	}
 
-	// 步骤2: 生成AI回复 (LLM)
-	var aiResponse string
-	if a.openaiService != nil {
-		var err error
-		systemMessage := "你是一个友好的AI助手，请用中文回复用户的问题。回复要简洁明了。"
-		aiResponse, err = a.openaiService.GenerateResponse(systemMessage, transcription, 150, 0.7)
-		if err != nil {
-			a.logger.Errorf("生成AI回复失败: %v", err)
-			aiResponse = "抱歉，我现在无法生成回复。"
+	if utterance := utteranceFrom(ctx); utterance != nil {
+		utterance.words = transcript.Words
+	}
+
+	// 过滤空白、低置信度和只有语气词的转录结果，避免噪声触发一轮LLM和TTS
+	if ok, reason := filterTranscript(transcript, a.config.Audio); !ok {
+		logger.Infof("%s，跳过处理: %q", reason, transcription)
+		return
+	}
+
+	// 结束短语只用于结束发言，不属于发言内容
+	transcript = a.stripEndPhrase(transcript)
+	transcription = transcript.Text
+	if strings.TrimSpace(transcription) == "" {
+		logger.Info("发言只有结束短语，跳过处理")
+		return
+	}
+
+	if a.isResetPhrase(transcription) {
+		a.resetConversation(ctx, participant)
+		return
+	}
+	if name, ok := a.personaSwitchRequest(transcription); ok {
+		a.switchPersona(ctx, participant, name)
+		return
+	}
+
+	// 发言通过了唤醒词和过滤，即将生成回复，用填充音掩盖生成的延迟
+	a.playFiller()
+
+	// 开启说话人分离时，混音轨道中每位说话人的话分别回复，各自保留对话历史
+	if len(transcript.Speakers) > 0 {
+		for _, turn := range transcript.Speakers {
+			speaker := speakerIdentity(participant.Identity(), turn.Speaker)
+			if !a.respond(ctx, participant, speaker, turn.Text, language, transcript.Final) {
+				return
+			}
 		}
-		a.logger.Infof("AI回复: %s", aiResponse)
-	} else {
-		a.logger.Warn("OpenAI服务不可用，使用默认回复")
-		aiResponse = fmt.Sprintf("我听到您说：%s。但是AI服务暂时不可用。", transcription)
+	} else if !a.respond(ctx, participant, participant.Identity(), transcription, language, transcript.Final) {
+		return
 	}
 
-	// 步骤3: 文字转语音 (TTS)
-	if a.cartesiaService != nil {
-		audioResponse, err := a.cartesiaService.TextToSpeech(a.ctx, aiResponse)
-		if err != nil {
-			a.logger.Errorf("文字转语音失败: %v", err)
-			// 如果TTS失败，发送文本消息
-			a.sendTextMessage(aiResponse)
-		} else {
-			// 发送音频回复
-			a.sendAudioMessage(audioResponse, participant)
+	a.metrics.ObserveTurn(time.Since(turnStart))
+}
+
+// respond 回复说话人的一段话：生成AI回复 (LLM)，同时按句进行文字转语音 (TTS)。
+// 对话被取消时返回 false
+func (a *AIAgent) respond(ctx context.Context, participant *lksdk.RemoteParticipant, speaker, text, language string, final bool) bool {
+	a.publishCaption(captionTypeTranscript, speaker, text, final)
+
+	speech := a.startSpeech(ctx, participant, language)
+	aiResponse := a.generateReply(ctx, participant, speaker, text, language, speech)
+	spoken := speech.Finish(aiResponse)
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	// 无法播放语音时发送文本消息
+	if !spoken {
+		a.sendTextMessage(stripVoiceTags(aiResponse))
+	}
+	a.saveTurn(ctx, speaker, text, stripVoiceTags(aiResponse))
+	return true
+}
+
+// fingerprintLogger 记录每次LLM请求的 system_fingerprint，指定了种子时一起记录，便于复现回复
+func (a *AIAgent) fingerprintLogger(ctx context.Context) func(fingerprint string) {
+	logger := a.turnLogger(ctx)
+	return func(fingerprint string) {
+		if seed := a.config.OpenAI.Seed; seed != nil {
+			logger.Infof("LLM seed: %d, system_fingerprint: %s", *seed, fingerprint)
+			return
 		}
+		logger.Debugf("LLM system_fingerprint: %s", fingerprint)
+	}
+}
+
+// generateReply 调用LLM生成回复，生成过程中把新增文本写入 out，完整生成后调用 out.Complete。
+// speaker 决定使用哪段对话历史，通常是参与者身份，开启说话人分离时是说话人的伪身份。
+// 服务不可用或调用失败时返回兜底文案，兜底文案不会写入 out，也不记入历史
+func (a *AIAgent) generateReply(ctx context.Context, participant *lksdk.RemoteParticipant, speaker, userText, language string, out replyWriter) string {
+	logger := a.turnLogger(ctx)
+	if a.llm == nil {
+		logger.Debug("语言模型服务不可用，使用默认回复")
+		return fmt.Sprintf("我听到您说：%s。但是AI服务暂时不可用。", userText)
+	}
+
+	if a.budgetExceeded() {
+		logger.Warn("LLM token预算已用完，使用默认回复")
+		return budgetExceededReply
+	}
+
+	timeout := a.config.OpenAI.Timeout
+	if timeout <= 0 {
+		timeout = defaultLLMTimeout
+	}
+	// 工具在发起对话的代理所在的房间中执行
+	llmCtx, cancel := context.WithTimeout(withToolAgent(ctx, a), timeout)
+	defer cancel()
+
+	identity := participant.Identity()
+	systemMessage := a.systemPrompt(ctx, participant, speaker, language)
+	history := a.conversation(speaker)
+	llmStart := time.Now()
+
+	// 流式生成，每收到一段文本就发布一次中间字幕。有回复中间件时等完整回复处理后再输出
+	var partial strings.Builder
+	stream := func(delta string) {
+		partial.WriteString(delta)
+		a.publishCaption(captionTypeResponse, speaker, stripVoiceTags(partial.String()), false)
+		out.Write(delta)
+	}
+	if len(a.responseMiddleware) > 0 {
+		stream = func(string) {}
+	}
+	aiResponse, err := a.llm.GenerateStream(llmCtx, systemMessage, userText, GenOptions{
+		Model:          a.participantSettings(identity).Model,
+		MaxTokens:      a.replyMaxTokens(identity, language),
+		Temperature:    a.config.OpenAI.Temperature,
+		History:        history.Messages(),
+		OnUsage:        func(usage TokenUsage) { a.recordUsage(ctx, usage) },
+		Seed:           a.config.OpenAI.Seed,
+		ResponseFormat: a.config.OpenAI.ResponseFormat,
+		OnFingerprint:  a.fingerprintLogger(ctx),
+	}, stream)
+	a.observeStage(ctx, stageLLM, time.Since(llmStart))
+	// 生成中途失败时 out 中只有半段回复，由 speechPipeline.Finish 改说兜底文案
+	if err == nil {
+		out.Complete()
+	}
+	if err != nil {
+		logger.Errorf("生成AI回复失败: %v", err)
+		a.metrics.IncError(stageLLM)
+		a.emitError(identity, err)
+		aiResponse = serviceErrorReply(err, "抱歉，我现在无法生成回复。")
+	} else if filtered, ok := a.filterResponse(ctx, participant, aiResponse); !ok {
+		aiResponse = middlewareFallbackReply
 	} else {
-		a.logger.Warn("Cartesia服务不可用，发送文本回复")
-		// 发送文本消息
-		a.sendTextMessage(aiResponse)
+		// 历史中记录处理后实际说出的回复
+		aiResponse = filtered
+		if truncated, ok := truncateReply(aiResponse, a.config.Audio.MaxReplyDuration); ok {
+			logger.Infof("回复估算朗读时长超过 %v，截断为: %s", a.config.Audio.MaxReplyDuration, truncated)
+			aiResponse = truncated
+		}
+		history.Append(userText, aiResponse)
+		a.summarizeHistory(ctx, speaker, history)
+	}
+	logger.Infof("AI回复: %s", aiResponse)
+	a.emit(AgentEvent{Type: EventResponseGenerated, ParticipantIdentity: identity, Text: aiResponse})
+	a.publishCaption(captionTypeResponse, speaker, stripVoiceTags(aiResponse), true)
+	return aiResponse
+}
+
+// synthesizeReply 将一段回复合成为浮点采样，合成失败时返回 false
+func (a *AIAgent) synthesizeReply(ctx context.Context, participant *lksdk.RemoteParticipant, reply, language, voice string) ([]float32, int, bool) {
+	logger := a.turnLogger(ctx)
+	ttsStart := time.Now()
+	pcm, sampleRate, err := synthesizeSpeech(ctx, a.tts, reply, a.voiceOptions(ctx, participant, language, voice))
+	a.observeStage(ctx, stageTTS, time.Since(ttsStart))
+	if err != nil {
+		logger.Errorf("文字转语音失败: %v", err)
+		a.metrics.IncError(stageTTS)
+		a.emitError(participant.Identity(), err)
+		return nil, 0, false
 	}
+	a.chargeCharacters(ctx, reply)
+	return pcm, sampleRate, true
+}
+
+// speechOptions 返回合成参数，参与者设置的声音优先于人设为该语言指定的声音
+func (a *AIAgent) speechOptions(participant *lksdk.RemoteParticipant, language string) SpeechOptions {
+	voice := a.participantSettings(participant.Identity()).Voice
+	if voice == "" {
+		voice = a.personaFor(participant.Identity()).voiceFor(language)
+	}
+	return SpeechOptions{Language: language, Voice: voice}
 }
 
 func (a *AIAgent) sendTextMessage(message string) {
-	err := a.room.LocalParticipant.PublishData([]byte(message))
+	err := a.publisher.PublishDataPacket(lksdk.UserData([]byte(message)))
 	if err != nil {
 		a.logger.Errorf("发送文本消息失败: %v", err)
 	} else {
@@ -274,46 +939,133 @@ func (a *AIAgent) sendTextMessage(message string) {
 	}
 }
 
-func (a *AIAgent) sendAudioMessage(audioData []byte, participant *lksdk.RemoteParticipant) {
-	a.logger.Infof("准备发送音频回复，大小: %d bytes", len(audioData))
+// sendAudioMessage 播放并录制一段回复的音频。回复已被新的回复取代时丢弃音频并返回 false
+func (a *AIAgent) sendAudioMessage(ctx context.Context, samples []float32, sampleRate int, participant *lksdk.RemoteParticipant) bool {
+	logger := a.turnLogger(ctx)
+	logger.Infof("准备发送音频回复，时长: %v", time.Duration(len(samples))*time.Second/time.Duration(sampleRate))
 
-	// 这里需要将音频数据转换为适合LiveKit的格式
-	// 由于这是一个复杂的过程，现在先发送文本通知
-	textNotification := "🎵 AI正在生成语音回复..."
-	a.sendTextMessage(textNotification)
+	// 发送时由语音输出重采样到编码器的采样率
+	if writer := a.audioWriter(); writer == nil {
+		logger.Debug("未发布音频轨道，丢弃音频回复")
+	} else if handled, played := writePlayback(ctx, writer, samples, sampleRate); !handled {
+		writer.Write(samples, sampleRate)
+	} else if !played {
+		logger.Debug("回复已被新的回复取代，丢弃音频")
+		return false
+	}
+	a.playbackMu.Lock()
+	a.playbackOwner = participant.Identity()
+	a.playbackMu.Unlock()
 
-	// TODO: 实现音频轨道发布
-	// 这需要创建音频轨道并发布到房间
-	a.logger.Info("音频回复功能正在开发中，已发送文本通知")
+	// TTS输出的采样率各不相同（如Cartesia为22050Hz），录音统一重采样到48kHz
+	if recorder := a.currentRecorder(); recorder != nil {
+		pcm := float32ToInt16(resample(samples, sampleRate, webrtcSampleRate))
+		if err := recorder.WriteOutgoing(participant.Identity(), pcm, webrtcSampleRate); err != nil {
+			logger.Errorf("写入录音失败: %v", err)
+		}
+	}
+	return true
+}
+
+// closeRoom 离开当前连接的房间，没有连接或连接已经断开时什么也不做
+func (a *AIAgent) closeRoom() {
+	a.sessionMu.Lock()
+	room := a.room
+	a.sessionMu.Unlock()
+
+	if room != nil && room.ConnectionState() != lksdk.ConnectionStateDisconnected {
+		room.Disconnect()
+	}
 }
 
 func (a *AIAgent) onRoomDisconnected() {
 	a.logger.Info("与房间断开连接")
-	a.cancel()
+	a.stopIdleTimer()
+	a.endSession()
+
+	if a.closing.Load() {
+		a.setState(StateDisconnected)
+		a.cancel()
+		return
+	}
+
+	// 非主动断开（如网络中断），尝试重新连接。只有已连接时才开始重连，同一时间只有一个重连循环
+	if a.compareAndSetState(StateConnected, StateReconnecting) {
+		a.spawn("重连", a.reconnectLoop)
+	}
 }
 
+// Disconnect 主动断开连接并释放资源。信号处理、空闲离开和关闭流程都可能调用它，
+// 可以在多个协程中重复调用，只有第一次生效，其余调用等待第一次完成后返回
 func (a *AIAgent) Disconnect() {
-	if a.room != nil {
-		a.room.Disconnect()
-	}
-	a.cancel()
+	a.disconnectOnce.Do(a.disconnect)
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func (a *AIAgent) disconnect() {
+	a.closing.Store(true)
+	a.endSession()
+	a.closeRoom()
+	a.captions.Stop()
+	a.cancel()
+	a.setState(StateDisconnected)
+
+	if recorder := a.currentRecorder(); recorder != nil {
+		if err := recorder.Close(); err != nil {
+			a.logger.Errorf("保存录音失败: %v", err)
+		}
 	}
-	return defaultValue
 }
 
 func main() {
-	log.Println("启动LiveKit Go AI代理...")
+	os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	agent := NewAIAgent()
+// runAgent 加入配置的房间并运行代理，直到收到退出信号
+func runAgent(cfg *Config) error {
+	log.Printf("启动LiveKit Go AI代理 %s...", version)
 
-	// 连接到LiveKit
-	if err := agent.Connect(); err != nil {
-		log.Fatalf("连接失败: %v", err)
+	// 缺少凭据等必填配置时立即退出，而不是等到连接时才失败
+	if missing := cfg.missingKeys(); len(missing) > 0 {
+		return fmt.Errorf("缺少必填配置: %s", strings.Join(missing, ", "))
+	}
+
+	manager := NewManager(cfg)
+
+	if cfg.Metrics.Addr != "" {
+		go func() {
+			log.Printf("Prometheus指标服务监听: %s", cfg.Metrics.Addr)
+			if err := manager.Metrics().Serve(cfg.Metrics.Addr); err != nil {
+				log.Printf("指标服务退出: %v", err)
+			}
+		}()
+	}
+
+	// 健康检查在加入房间前启动，加入完成前 /readyz 返回503
+	if cfg.Health.Addr != "" {
+		go func() {
+			log.Printf("健康检查服务监听: %s", cfg.Health.Addr)
+			if err := manager.ServeHealth(cfg.Health.Addr); err != nil {
+				log.Printf("健康检查服务退出: %v", err)
+			}
+		}()
+	}
+
+	// 加入房间前检查API密钥和网络，不必等到第一段发言才发现配置错误
+	if err := manager.Preflight(context.Background()); err != nil {
+		manager.Close()
+		return err
+	}
+
+	// 连接到LiveKit，未配置多个房间时只加入 room_name 指定的房间
+	rooms := cfg.LiveKit.Rooms
+	if len(rooms) == 0 {
+		rooms = []string{cfg.LiveKit.RoomName}
+	}
+	for _, roomName := range rooms {
+		if err := manager.JoinRoom(roomName); err != nil {
+			manager.Close()
+			return fmt.Errorf("连接失败: %w", err)
+		}
 	}
 
 	// 等待中断信号
@@ -323,7 +1075,18 @@ func main() {
 	log.Println("AI代理已启动，等待连接...")
 	<-sigChan
 
+	// 等待进行中的对话完成，超时或再次收到信号时强制关闭
 	log.Println("正在关闭AI代理...")
-	agent.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	go func() {
+		<-sigChan
+		log.Println("再次收到退出信号，强制关闭")
+		cancel()
+	}()
+	if err := manager.Shutdown(ctx); err != nil {
+		log.Printf("等待对话完成失败: %v", err)
+	}
+	cancel()
 	log.Println("AI代理已关闭")
+	return nil
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConnectRequiresCredentials(t *testing.T) {
+	tests := []struct {
+		name      string
+		apiKey    string
+		apiSecret string
+	}{
+		{name: "no credentials"},
+		{name: "key without secret", apiKey: "key"},
+		{name: "secret without key", apiSecret: "secret"},
+	}
+
+	for _, tt := range tests {
+		agent, _ := newTestAgent(&AIServices{})
+		agent.config.LiveKit.APIKey = tt.apiKey
+		agent.config.LiveKit.APISecret = tt.apiSecret
+
+		if err := agent.Connect(); !errors.Is(err, errMissingCredentials) {
+			t.Errorf("%s: Connect = %v, want errMissingCredentials", tt.name, err)
+		}
+		if agent.room != nil {
+			t.Errorf("%s: connected without credentials", tt.name)
+		}
+	}
+
+	if cfg := DefaultConfig(); cfg.LiveKit.APIKey != "" || cfg.LiveKit.APISecret != "" {
+		t.Error("default config ships LiveKit credentials")
+	}
+}
+
+func TestConcurrentDisconnect(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	if err := agent.EnableRecording(filepath.Join(t.TempDir(), "rec")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 信号处理、房间断开回调和关闭流程可能同时触发断开
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			agent.Disconnect()
+		}()
+		go func() {
+			defer wg.Done()
+			agent.onRoomDisconnected()
+		}()
+		go func() {
+			defer wg.Done()
+			agent.Shutdown(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	if state := agent.State(); state != StateDisconnected {
+		t.Errorf("state = %v, want disconnected", state)
+	}
+	if agent.ctx.Err() == nil {
+		t.Error("agent context should be cancelled")
+	}
+	if agent.startTurn(func() {}) {
+		t.Error("new turns should be rejected after disconnect")
+	}
+}
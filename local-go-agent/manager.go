@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Manager 在同一个进程中管理多个房间的代理，各房间的参与者和对话状态相互隔离，
+// AI服务客户端和指标在所有房间之间共享
+type Manager struct {
+	config   *Config
+	logger   *logrus.Logger
+	services *AIServices
+	metrics  *Metrics
+
+	mu     sync.Mutex
+	agents map[string]*AIAgent
+	// 正在连接的房间，连接期间不持有 mu，用它防止重复加入
+	joining map[string]bool
+	// 为空时各房间按配置创建令牌提供者
+	tokenProvider TokenProvider
+}
+
+func NewManager(cfg *Config) *Manager {
+	logger := newLogger(cfg.Log)
+	return &Manager{
+		config:   cfg,
+		logger:   logger,
+		services: NewAIServices(cfg, logger),
+		metrics:  NewMetrics(),
+		agents:   make(map[string]*AIAgent),
+		joining:  make(map[string]bool),
+	}
+}
+
+// SetTokenProvider 让之后加入的房间都使用该令牌提供者连接
+func (m *Manager) SetTokenProvider(provider TokenProvider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokenProvider = provider
+}
+
+func (m *Manager) Metrics() *Metrics {
+	return m.metrics
+}
+
+// JoinRoom 创建一个绑定到指定房间的代理并连接。连接期间不阻塞其他房间的加入、离开和状态查询
+func (m *Manager) JoinRoom(roomName string) error {
+	if roomName == "" {
+		return fmt.Errorf("房间名称不能为空")
+	}
+
+	m.mu.Lock()
+	if _, exists := m.agents[roomName]; exists || m.joining[roomName] {
+		m.mu.Unlock()
+		return fmt.Errorf("已在房间 %s 中", roomName)
+	}
+	m.joining[roomName] = true
+	provider := m.tokenProvider
+	m.mu.Unlock()
+
+	agent, err := m.connectAgent(roomName, provider)
+
+	m.mu.Lock()
+	delete(m.joining, roomName)
+	if err == nil {
+		m.agents[roomName] = agent
+	}
+	m.mu.Unlock()
+	return err
+}
+
+// connectAgent 创建并连接房间的代理，失败时关闭代理，释放它的上下文和后台协程
+func (m *Manager) connectAgent(roomName string, provider TokenProvider) (*AIAgent, error) {
+	// 每个房间使用独立的配置副本，避免修改共享配置
+	cfg := *m.config
+	cfg.LiveKit.RoomName = roomName
+
+	agent := newAIAgent(&cfg, m.services, m.metrics, m.logger)
+	if provider != nil {
+		agent.SetTokenProvider(provider)
+	}
+	agent.SetIdleHandler(func() { m.leaveIdleRoom(roomName, agent) })
+
+	var err error
+	if cfg.Recording.Dir != "" {
+		if err = agent.EnableRecording(filepath.Join(cfg.Recording.Dir, roomName)); err != nil {
+			err = fmt.Errorf("开启房间 %s 的录音失败: %w", roomName, err)
+		}
+	}
+	if err == nil {
+		if err = agent.Connect(); err != nil {
+			err = fmt.Errorf("加入房间 %s 失败: %w", roomName, err)
+		}
+	}
+	if err != nil {
+		m.shutdownAgent(roomName, agent)
+		return nil, err
+	}
+	return agent, nil
+}
+
+// LeaveRoom 等待进行中的对话完成后断开指定房间的代理，不影响其他房间
+func (m *Manager) LeaveRoom(roomName string) {
+	m.mu.Lock()
+	agent, exists := m.agents[roomName]
+	delete(m.agents, roomName)
+	m.mu.Unlock()
+
+	if !exists {
+		return
+	}
+	m.shutdownAgent(roomName, agent)
+	m.logger.Infof("已离开房间: %s", roomName)
+}
+
+// shutdownAgent 在宽限期内关闭房间的代理
+func (m *Manager) shutdownAgent(roomName string, agent *AIAgent) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	defer cancel()
+	if err := agent.Shutdown(ctx); err != nil {
+		m.logger.Warnf("等待房间 %s 的对话完成失败: %v", roomName, err)
+	}
+}
+
+// leaveIdleRoom 在房间空闲超时后移除并关闭该房间的代理，代理已被替换或移除时不做处理
+func (m *Manager) leaveIdleRoom(roomName string, agent *AIAgent) {
+	m.mu.Lock()
+	if m.agents[roomName] != agent {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.agents, roomName)
+	m.mu.Unlock()
+
+	m.shutdownAgent(roomName, agent)
+	m.logger.Infof("房间 %s 空闲，已离开", roomName)
+}
+
+func (m *Manager) Agent(roomName string) (*AIAgent, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agent, exists := m.agents[roomName]
+	return agent, exists
+}
+
+func (m *Manager) Rooms() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rooms := make([]string, 0, len(m.agents))
+	for roomName := range m.agents {
+		rooms = append(rooms, roomName)
+	}
+	return rooms
+}
+
+// Close 断开所有房间
+func (m *Manager) Close() {
+	for _, roomName := range m.Rooms() {
+		m.LeaveRoom(roomName)
+	}
+}
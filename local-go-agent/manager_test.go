@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// blockingTokenProvider 在 release 关闭之前阻塞获取令牌，之后返回错误
+type blockingTokenProvider struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingTokenProvider) Token(ctx context.Context, roomName, identity string) (string, error) {
+	close(p.started)
+	<-p.release
+	return "", errors.New("令牌服务不可用")
+}
+
+func newTestManager() *Manager {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return &Manager{
+		config:   DefaultConfig(),
+		logger:   logger,
+		services: &AIServices{},
+		metrics:  NewMetrics(),
+		agents:   make(map[string]*AIAgent),
+		joining:  make(map[string]bool),
+	}
+}
+
+func TestJoinRoomDoesNotBlockOtherRooms(t *testing.T) {
+	manager := newTestManager()
+	provider := &blockingTokenProvider{started: make(chan struct{}), release: make(chan struct{})}
+	manager.SetTokenProvider(provider)
+
+	joined := make(chan error, 1)
+	go func() { joined <- manager.JoinRoom("room-a") }()
+	<-provider.started
+
+	// 连接期间可以查询状态，同一房间不能重复加入
+	done := make(chan struct{})
+	go func() {
+		manager.Rooms()
+		manager.Status()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("status blocked while another room was connecting")
+	}
+	if err := manager.JoinRoom("room-a"); err == nil {
+		t.Error("joined a room that is still connecting")
+	}
+
+	close(provider.release)
+	if err := <-joined; err == nil {
+		t.Fatal("join succeeded without a token")
+	}
+	if rooms := manager.Rooms(); len(rooms) != 0 {
+		t.Errorf("rooms = %v after a failed join", rooms)
+	}
+	manager.mu.Lock()
+	joining := len(manager.joining)
+	manager.mu.Unlock()
+	if joining != 0 {
+		t.Error("failed join kept the room reserved")
+	}
+}
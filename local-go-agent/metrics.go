@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	stageSTT = "stt"
+	stageLLM = "llm"
+	stageTTS = "tts"
+	// 整轮对话超时
+	stageTurn = "turn"
+)
+
+type Metrics struct {
+	registry     *prometheus.Registry
+	sttDuration  prometheus.Histogram
+	llmDuration  prometheus.Histogram
+	ttsDuration  prometheus.Histogram
+	turnDuration prometheus.Histogram
+	stageErrors  *prometheus.CounterVec
+	// 音频缓冲区写满、提前送出发言的次数
+	audioOverflows prometheus.Counter
+	llmTokens      *prometheus.CounterVec
+	// 按 cost 单价估算的费用
+	costUSD *prometheus.CounterVec
+	// 每个参与者最近一次上报的音量
+	audioLevels *prometheus.GaugeVec
+}
+
+func NewMetrics() *Metrics {
+	// 覆盖从几百毫秒到十几秒的外部服务调用耗时
+	buckets := []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 8, 13, 20}
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		sttDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "stt_duration_seconds",
+			Help:    "语音转文字耗时",
+			Buckets: buckets,
+		}),
+		llmDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "llm_duration_seconds",
+			Help:    "生成AI回复耗时",
+			Buckets: buckets,
+		}),
+		ttsDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "tts_duration_seconds",
+			Help:    "文字转语音耗时",
+			Buckets: buckets,
+		}),
+		turnDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "turn_total_seconds",
+			Help:    "一轮对话从开始转录到发出回复的总耗时",
+			Buckets: buckets,
+		}),
+		stageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pipeline_errors_total",
+			Help: "各处理阶段的错误次数",
+		}, []string{"stage"}),
+		audioOverflows: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "audio_buffer_overflows_total",
+			Help: "音频缓冲区写满、提前送出已缓冲音频的次数",
+		}),
+		llmTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "llm_tokens_total",
+			Help: "LLM消耗的token数量",
+		}, []string{"type"}),
+		costUSD: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cost_usd_total",
+			Help: "按配置的单价估算的服务费用（美元）",
+		}, []string{"service"}),
+		audioLevels: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "participant_audio_level_dbfs",
+			Help: "参与者最近一个上报周期的音量",
+		}, []string{"participant", "type"}),
+	}
+
+	m.registry.MustRegister(m.sttDuration, m.llmDuration, m.ttsDuration, m.turnDuration, m.stageErrors, m.audioOverflows, m.llmTokens, m.costUSD, m.audioLevels)
+	return m
+}
+
+func (m *Metrics) ObserveStage(stage string, duration time.Duration) {
+	switch stage {
+	case stageSTT:
+		m.sttDuration.Observe(duration.Seconds())
+	case stageLLM:
+		m.llmDuration.Observe(duration.Seconds())
+	case stageTTS:
+		m.ttsDuration.Observe(duration.Seconds())
+	}
+}
+
+func (m *Metrics) ObserveTurn(duration time.Duration) {
+	m.turnDuration.Observe(duration.Seconds())
+}
+
+func (m *Metrics) IncError(stage string) {
+	m.stageErrors.WithLabelValues(stage).Inc()
+}
+
+func (m *Metrics) IncAudioOverflow() {
+	m.audioOverflows.Inc()
+}
+
+func (m *Metrics) AddTokens(usage TokenUsage) {
+	m.llmTokens.WithLabelValues("prompt").Add(float64(usage.PromptTokens))
+	m.llmTokens.WithLabelValues("completion").Add(float64(usage.CompletionTokens))
+}
+
+func (m *Metrics) AddCost(service string, usd float64) {
+	if usd > 0 {
+		m.costUSD.WithLabelValues(service).Add(usd)
+	}
+}
+
+func (m *Metrics) SetAudioLevel(identity string, level AudioLevel) {
+	m.audioLevels.WithLabelValues(identity, "rms").Set(level.RMS)
+	m.audioLevels.WithLabelValues(identity, "peak").Set(level.Peak)
+}
+
+// DeleteAudioLevel 在参与者离开后删除其音量，避免指标无限增长
+func (m *Metrics) DeleteAudioLevel(identity string) {
+	m.audioLevels.DeletePartialMatch(prometheus.Labels{"participant": identity})
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Serve 在指定地址上提供 /metrics 接口，阻塞直到服务退出
+func (m *Metrics) Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	return http.ListenAndServe(addr, mux)
+}
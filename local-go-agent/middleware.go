@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"regexp"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// ResponseMiddleware 在LLM生成的回复发布和合成之前处理回复文本，返回处理后的文本，
+// 用于屏蔽敏感词、脱敏或改写语气。返回错误时放弃这次回复，改用 middlewareFallbackReply
+type ResponseMiddleware func(ctx context.Context, participant *lksdk.RemoteParticipant, text string) (string, error)
+
+// 回复中间件出错时的安全回复
+const middlewareFallbackReply = "抱歉，这个问题我暂时无法回答。"
+
+// UseResponseMiddleware 追加回复中间件，多个中间件按追加的顺序依次处理，需在加入房间前调用。
+// 有中间件时要等完整回复处理后才能发布字幕和合成语音，回复不再边生成边播放
+func (a *AIAgent) UseResponseMiddleware(middleware ...ResponseMiddleware) {
+	a.responseMiddleware = append(a.responseMiddleware, middleware...)
+}
+
+// filterResponse 依次执行回复中间件，任何一个出错时返回 false
+func (a *AIAgent) filterResponse(ctx context.Context, participant *lksdk.RemoteParticipant, text string) (string, bool) {
+	for _, middleware := range a.responseMiddleware {
+		filtered, err := middleware(ctx, participant, text)
+		if err != nil {
+			a.turnLogger(ctx).Errorf("回复中间件处理失败，改用安全回复: %v", err)
+			return "", false
+		}
+		text = filtered
+	}
+	return text, true
+}
+
+// 回复中可能出现的个人信息：邮箱、18位身份证号和大陆手机号
+var piiPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`\b\d{17}[\dXx]\b`),
+	regexp.MustCompile(`\b1[3-9]\d{9}\b`),
+}
+
+// RedactPII 是示例中间件，把回复中的邮箱、身份证号和手机号替换为 [已隐藏]
+func RedactPII(ctx context.Context, participant *lksdk.RemoteParticipant, text string) (string, error) {
+	for _, pattern := range piiPatterns {
+		text = pattern.ReplaceAllString(text, "[已隐藏]")
+	}
+	return text, nil
+}
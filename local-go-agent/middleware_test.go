@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestResponseMiddleware(t *testing.T) {
+	heard := Transcript{Text: "我的联系方式是什么", Confidence: 0.9, Language: "zh", Final: true}
+	reply := "您的手机号是13812345678。"
+
+	upper := func(ctx context.Context, participant *lksdk.RemoteParticipant, text string) (string, error) {
+		return strings.ReplaceAll(text, "[已隐藏]", "[HIDDEN]"), nil
+	}
+	failing := func(ctx context.Context, participant *lksdk.RemoteParticipant, text string) (string, error) {
+		return "", errors.New("moderation service down")
+	}
+
+	tests := []struct {
+		name       string
+		middleware []ResponseMiddleware
+		spoken     []string
+		history    int
+	}{
+		{"runs in order", []ResponseMiddleware{RedactPII, upper}, []string{"您的手机号是[HIDDEN]。"}, 2},
+		{"error falls back", []ResponseMiddleware{RedactPII, failing}, []string{middlewareFallbackReply}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tts := &fakeTTS{}
+			agent, publisher := newTestAgent(&AIServices{STT: &fakeSTT{result: heard}, LLM: &fakeLLM{reply: reply}, TTS: tts})
+			agent.UseResponseMiddleware(tt.middleware...)
+
+			participant := &lksdk.RemoteParticipant{}
+			agent.processAudioBuffer(context.Background(), turnRequest{pcm: make([]int16, sttSampleRate/10)}, participant)
+
+			if spoken := tts.Texts(); !reflect.DeepEqual(spoken, tt.spoken) {
+				t.Errorf("spoken = %q, want %q", spoken, tt.spoken)
+			}
+			for _, message := range publisher.Messages() {
+				if strings.Contains(message, "13812345678") {
+					t.Errorf("unfiltered reply published: %q", message)
+				}
+			}
+			if history := agent.conversation(participant.Identity()).Messages(); len(history) != tt.history {
+				t.Errorf("history = %+v, want %d messages", history, tt.history)
+			}
+		})
+	}
+}
+
+func TestRedactPII(t *testing.T) {
+	text := "请联系 zhang.san@example.com 或拨打13912345678，证件号11010519491231002X。"
+	got, err := RedactPII(context.Background(), nil, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "请联系 [已隐藏] 或拨打[已隐藏]，证件号[已隐藏]。"
+	if got != want {
+		t.Errorf("RedactPII = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	moderationMute   = "mute"
+	moderationRemove = "remove"
+)
+
+var errModerationDisabled = errors.New("未开启 moderation.enabled，不允许管理参与者")
+
+// toolAgentKey 是上下文中发起本轮对话的代理，工具通过它在对应的房间中执行操作
+type toolAgentKey struct{}
+
+func withToolAgent(ctx context.Context, a *AIAgent) context.Context {
+	return context.WithValue(ctx, toolAgentKey{}, a)
+}
+
+func toolAgent(ctx context.Context) (*AIAgent, bool) {
+	a, ok := ctx.Value(toolAgentKey{}).(*AIAgent)
+	return a, ok
+}
+
+// roomServiceClient 创建LiveKit房间服务的客户端，需要API密钥
+func (a *AIAgent) roomServiceClient() (*lksdk.RoomServiceClient, error) {
+	if a.connectInfo.APIKey == "" || a.connectInfo.APISecret == "" {
+		return nil, fmt.Errorf("未配置LiveKit API密钥，无法管理参与者")
+	}
+	return lksdk.NewRoomServiceClient(a.serverURL(), a.connectInfo.APIKey, a.connectInfo.APISecret), nil
+}
+
+// MuteParticipant 通过服务端API静音参与者发布的所有音频轨道，需要开启 moderation.enabled
+func (a *AIAgent) MuteParticipant(ctx context.Context, identity, reason string) error {
+	err := a.muteParticipant(ctx, identity)
+	a.auditModeration(ctx, moderationMute, identity, reason, err)
+	return err
+}
+
+func (a *AIAgent) muteParticipant(ctx context.Context, identity string) error {
+	client, err := a.moderationClient(identity)
+	if err != nil {
+		return err
+	}
+	room := a.connectInfo.RoomName
+	info, err := client.GetParticipant(ctx, &livekit.RoomParticipantIdentity{Room: room, Identity: identity})
+	if err != nil {
+		return fmt.Errorf("查询参与者 %s 失败: %w", identity, err)
+	}
+
+	muted := 0
+	for _, track := range info.Tracks {
+		if track.Type != livekit.TrackType_AUDIO || track.Muted {
+			continue
+		}
+		_, err := client.MutePublishedTrack(ctx, &livekit.MuteRoomTrackRequest{
+			Room:     room,
+			Identity: identity,
+			TrackSid: track.Sid,
+			Muted:    true,
+		})
+		if err != nil {
+			return fmt.Errorf("静音参与者 %s 的轨道 %s 失败: %w", identity, track.Sid, err)
+		}
+		muted++
+	}
+	if muted == 0 {
+		return fmt.Errorf("参与者 %s 没有未静音的音频轨道", identity)
+	}
+	return nil
+}
+
+// RemoveParticipant 通过服务端API把参与者移出房间，需要开启 moderation.enabled
+func (a *AIAgent) RemoveParticipant(ctx context.Context, identity, reason string) error {
+	err := a.removeFromRoom(ctx, identity)
+	a.auditModeration(ctx, moderationRemove, identity, reason, err)
+	return err
+}
+
+func (a *AIAgent) removeFromRoom(ctx context.Context, identity string) error {
+	client, err := a.moderationClient(identity)
+	if err != nil {
+		return err
+	}
+	_, err = client.RemoveParticipant(ctx, &livekit.RoomParticipantIdentity{
+		Room:     a.connectInfo.RoomName,
+		Identity: identity,
+	})
+	if err != nil {
+		return fmt.Errorf("移出参与者 %s 失败: %w", identity, err)
+	}
+	return nil
+}
+
+// moderationClient 检查是否允许管理该参与者，代理不能管理自己
+func (a *AIAgent) moderationClient(identity string) (*lksdk.RoomServiceClient, error) {
+	if !a.config.Moderation.Enabled {
+		return nil, errModerationDisabled
+	}
+	if identity == "" {
+		return nil, fmt.Errorf("缺少参与者身份")
+	}
+	if identity == a.connectInfo.ParticipantIdentity {
+		return nil, fmt.Errorf("不能管理代理自己")
+	}
+	return a.roomServiceClient()
+}
+
+// auditModeration 记录每次管理操作，无论成功与否。日志带有 audit=moderation 字段，
+// 对话中的操作还带有发起对话的参与者
+func (a *AIAgent) auditModeration(ctx context.Context, action, identity, reason string, err error) {
+	logger := a.turnLogger(ctx).WithFields(logrus.Fields{
+		"audit":  "moderation",
+		"action": action,
+		"target": identity,
+		"reason": reason,
+	})
+	if err != nil {
+		logger.Errorf("管理操作失败: %v", err)
+	} else {
+		logger.Warnf("已对 %s 执行 %s", identity, action)
+	}
+	a.emit(AgentEvent{Type: EventModeration, ParticipantIdentity: identity, Action: action, Text: reason, Err: err})
+}
+
+// moderationArguments 是管理工具的参数
+type moderationArguments struct {
+	Identity string `json:"identity"`
+	Reason   string `json:"reason"`
+}
+
+// moderationTools 返回静音和移出参与者的工具，只在开启 moderation.enabled 时注册
+func moderationTools() []Tool {
+	parameters := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"identity": map[string]interface{}{"type": "string", "description": "参与者的身份（identity）"},
+			"reason":   map[string]interface{}{"type": "string", "description": "执行操作的原因，会记录在审计日志中"},
+		},
+		"required": []string{"identity", "reason"},
+	}
+	return []Tool{
+		{
+			Name:        "mute_participant",
+			Description: "静音扰乱秩序的参与者的麦克风。只在参与者持续干扰他人时使用",
+			Parameters:  parameters,
+			Handler:     moderationHandler((*AIAgent).MuteParticipant, "已静音"),
+		},
+		{
+			Name:        "remove_participant",
+			Description: "把严重扰乱秩序的参与者移出房间。只在警告和静音无效时使用",
+			Parameters:  parameters,
+			Handler:     moderationHandler((*AIAgent).RemoveParticipant, "已移出房间"),
+		},
+	}
+}
+
+func moderationHandler(action func(a *AIAgent, ctx context.Context, identity, reason string) error, done string) ToolHandler {
+	return func(ctx context.Context, arguments string) (string, error) {
+		a, ok := toolAgent(ctx)
+		if !ok {
+			return "", fmt.Errorf("不在房间的对话中，无法管理参与者")
+		}
+		var args moderationArguments
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("参数格式错误: %w", err)
+		}
+		if err := action(a, ctx, args.Identity, args.Reason); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s", done, args.Identity), nil
+	}
+}
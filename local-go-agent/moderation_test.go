@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+// fakeRoomService 是只实现了管理操作的房间服务
+type fakeRoomService struct {
+	livekit.RoomService
+
+	mu      sync.Mutex
+	muted   []string
+	removed []string
+}
+
+func (s *fakeRoomService) GetParticipant(ctx context.Context, req *livekit.RoomParticipantIdentity) (*livekit.ParticipantInfo, error) {
+	return &livekit.ParticipantInfo{Identity: req.Identity, Tracks: []*livekit.TrackInfo{
+		{Sid: "TR_audio", Type: livekit.TrackType_AUDIO},
+		{Sid: "TR_video", Type: livekit.TrackType_VIDEO},
+	}}, nil
+}
+
+func (s *fakeRoomService) MutePublishedTrack(ctx context.Context, req *livekit.MuteRoomTrackRequest) (*livekit.MuteRoomTrackResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.muted = append(s.muted, req.Room+"/"+req.Identity+"/"+req.TrackSid)
+	return &livekit.MuteRoomTrackResponse{}, nil
+}
+
+func (s *fakeRoomService) RemoveParticipant(ctx context.Context, req *livekit.RoomParticipantIdentity) (*livekit.RemoveParticipantResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed = append(s.removed, req.Room+"/"+req.Identity)
+	return &livekit.RemoveParticipantResponse{}, nil
+}
+
+func newModerationAgent(t *testing.T, enabled bool) (*AIAgent, *fakeRoomService) {
+	t.Helper()
+	service := &fakeRoomService{}
+	server := httptest.NewServer(livekit.NewRoomServiceServer(service))
+	t.Cleanup(server.Close)
+
+	agent, _ := newTestAgent(&AIServices{})
+	agent.config.Moderation.Enabled = enabled
+	agent.liveKitURL = server.URL
+	agent.connectInfo.APIKey = "key"
+	agent.connectInfo.APISecret = "secret"
+	agent.connectInfo.RoomName = "lobby"
+	agent.connectInfo.ParticipantIdentity = "agent"
+	return agent, service
+}
+
+func TestModerationToolsActInTheCallingRoom(t *testing.T) {
+	agent, service := newModerationAgent(t, true)
+	ctx := withToolAgent(agent.withTurn(context.Background(), "host"), agent)
+	tools := moderationTools()
+
+	if _, err := tools[0].Handler(ctx, `{"identity":"troll","reason":"刷屏"}`); err != nil {
+		t.Fatalf("mute: %v", err)
+	}
+	if _, err := tools[1].Handler(ctx, `{"identity":"troll","reason":"继续刷屏"}`); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if len(service.muted) != 1 || service.muted[0] != "lobby/troll/TR_audio" {
+		t.Errorf("muted tracks = %v, want only the audio track", service.muted)
+	}
+	if len(service.removed) != 1 || service.removed[0] != "lobby/troll" {
+		t.Errorf("removed = %v", service.removed)
+	}
+
+	// 每次操作都发出审计事件
+	var actions []string
+	for len(agent.events) > 0 {
+		if event := <-agent.events; event.Type == EventModeration {
+			actions = append(actions, event.Action+":"+event.Text)
+		}
+	}
+	if len(actions) != 2 || actions[0] != "mute:刷屏" || actions[1] != "remove:继续刷屏" {
+		t.Errorf("audit events = %v", actions)
+	}
+
+	if _, err := tools[1].Handler(ctx, `{"identity":"agent","reason":"x"}`); err == nil {
+		t.Error("the agent removed itself")
+	}
+}
+
+func TestModerationRequiresPermission(t *testing.T) {
+	agent, service := newModerationAgent(t, false)
+
+	if err := agent.RemoveParticipant(context.Background(), "troll", "刷屏"); !errors.Is(err, errModerationDisabled) {
+		t.Errorf("RemoveParticipant = %v, want errModerationDisabled", err)
+	}
+	if err := agent.MuteParticipant(context.Background(), "troll", "刷屏"); !errors.Is(err, errModerationDisabled) {
+		t.Errorf("MuteParticipant = %v, want errModerationDisabled", err)
+	}
+	if len(service.muted)+len(service.removed) != 0 {
+		t.Error("moderation reached the room service while disabled")
+	}
+	if event := <-agent.events; event.Type != EventModeration || event.Err == nil {
+		t.Errorf("refused action was not audited: %+v", event)
+	}
+}
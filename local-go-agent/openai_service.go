@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
@@ -10,32 +12,91 @@ import (
 
 type OpenAIService struct {
 	client openai.Client
+	model  openai.ChatModel
+
+	// 已注册的工具，toolOrder 保证每次请求中工具的顺序一致
+	toolsMu   sync.RWMutex
+	tools     map[string]Tool
+	toolOrder []string
 }
 
-func NewOpenAIService(apiKey string) (*OpenAIService, error) {
+// NewOpenAIService 创建使用OpenAI API的服务，opts 附加到客户端的默认选项之后
+func NewOpenAIService(apiKey string, opts ...option.RequestOption) (*OpenAIService, error) {
 	if apiKey == "" {
 		return nil, fmt.Errorf("OpenAI API key is required")
 	}
 
-	client := openai.NewClient(option.WithAPIKey(apiKey))
-	return &OpenAIService{client: client}, nil
+	client := openai.NewClient(append([]option.RequestOption{option.WithAPIKey(apiKey)}, opts...)...)
+	return &OpenAIService{client: client, model: openai.ChatModelGPT3_5Turbo}, nil
+}
+
+// 未指定时使用的Azure OpenAI API版本
+const defaultAzureAPIVersion = "2024-06-01"
+
+// NewAzureOpenAIService 创建使用Azure OpenAI部署的服务。请求发送到
+// {endpoint}/openai/deployments/{deployment}/，通过 api-key 请求头认证，模型由部署决定
+func NewAzureOpenAIService(endpoint, deployment, apiVersion, apiKey string, opts ...option.RequestOption) (*OpenAIService, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("Azure OpenAI endpoint is required")
+	}
+	if deployment == "" {
+		return nil, fmt.Errorf("Azure OpenAI deployment is required")
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("Azure OpenAI API key is required")
+	}
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+
+	baseURL := strings.TrimSuffix(endpoint, "/") + "/openai/deployments/" + deployment + "/"
+	client := openai.NewClient(append([]option.RequestOption{
+		option.WithBaseURL(baseURL),
+		option.WithQueryAdd("api-version", apiVersion),
+		option.WithHeader("api-key", apiKey),
+		// 客户端默认会根据 OPENAI_API_KEY 设置 Authorization，Azure 不使用该请求头
+		option.WithHeaderDel("authorization"),
+	}, opts...)...)
+	// Azure 按部署路由请求，请求体中的模型名使用部署名
+	return &OpenAIService{client: client, model: openai.ChatModel(deployment)}, nil
 }
 
-func (s *OpenAIService) GenerateResponse(systemMessage, userMessage string, maxTokens int, temperature float64) (string, error) {
-	ctx := context.Background()
+func NewOpenAIServiceFromConfig(cfg OpenAIConfig, opts ...option.RequestOption) (*OpenAIService, error) {
+	if cfg.Azure.Endpoint != "" {
+		return NewAzureOpenAIService(cfg.Azure.Endpoint, cfg.Azure.Deployment, cfg.Azure.APIVersion, cfg.APIKey, opts...)
+	}
+
+	service, err := NewOpenAIService(cfg.APIKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Model != "" {
+		service.model = openai.ChatModel(cfg.Model)
+	}
+	return service, nil
+}
+
+// Preflight 列出模型，检查API密钥和网络是否可用
+func (s *OpenAIService) Preflight(ctx context.Context) error {
+	if _, err := s.client.Models.List(ctx); err != nil {
+		return openAIError(fmt.Errorf("列出模型失败: %w", err))
+	}
+	return nil
+}
 
+func (s *OpenAIService) GenerateResponse(ctx context.Context, systemMessage, userMessage string, maxTokens int, temperature float64) (string, error) {
 	params := openai.ChatCompletionNewParams{
 		Messages: []openai.ChatCompletionMessageParamUnion{
 			openai.SystemMessage(systemMessage),
 			openai.UserMessage(userMessage),
 		},
-		Model: openai.ChatModelGPT3_5Turbo,
+		Model: s.model,
 		// 暂时省略MaxTokens和Temperature参数，使用默认值
 	}
 
 	completion, err := s.client.Chat.Completions.New(ctx, params)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate response: %w", err)
+		return "", fmt.Errorf("failed to generate response: %w", openAIError(err))
 	}
 
 	if len(completion.Choices) == 0 {
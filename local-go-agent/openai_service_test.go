@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+)
+
+func newTestOpenAIService(baseURL string) *OpenAIService {
+	client := openai.NewClient(
+		option.WithAPIKey("test-key"),
+		option.WithBaseURL(baseURL),
+		option.WithMaxRetries(0),
+	)
+	return &OpenAIService{client: client, model: openai.ChatModelGPT3_5Turbo}
+}
+
+func TestGenerateResponseCancelledContext(t *testing.T) {
+	// 服务端一直不返回，只有取消上下文才能结束请求
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	service := newTestOpenAIService(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := service.GenerateResponse(ctx, "system", "hello", 10, 0.7)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GenerateResponse did not return after the context was cancelled")
+	}
+}
+
+func TestAzureOpenAIServiceRequest(t *testing.T) {
+	var path, apiVersion, apiKey, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		apiVersion = r.URL.Query().Get("api-version")
+		apiKey = r.Header.Get("api-key")
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"hi"}}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("OPENAI_API_KEY", "")
+	service, err := NewAzureOpenAIService(server.URL+"/", "my-deployment", "2024-06-01", "azure-key")
+	if err != nil {
+		t.Fatalf("NewAzureOpenAIService: %v", err)
+	}
+
+	reply, err := service.Generate(context.Background(), "system", "hello", GenOptions{})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if reply != "hi" {
+		t.Errorf("reply = %q", reply)
+	}
+	if path != "/openai/deployments/my-deployment/chat/completions" {
+		t.Errorf("path = %q", path)
+	}
+	if apiVersion != "2024-06-01" || apiKey != "azure-key" || authorization != "" {
+		t.Errorf("api-version = %q, api-key = %q, Authorization = %q", apiVersion, apiKey, authorization)
+	}
+}
+
+func TestAzureOpenAIServiceValidation(t *testing.T) {
+	if _, err := NewAzureOpenAIService("", "deployment", "", "key"); err == nil {
+		t.Error("expected an error for an empty endpoint")
+	}
+	if _, err := NewAzureOpenAIService("https://example.openai.azure.com", "", "", "key"); err == nil {
+		t.Error("expected an error for an empty deployment")
+	}
+}
+
+func TestGenerateSendsSeedAndReportsFingerprint(t *testing.T) {
+	var request struct {
+		Seed           *int64 `json:"seed"`
+		ResponseFormat struct {
+			Type string `json:"type"`
+		} `json:"response_format"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","object":"chat.completion","system_fingerprint":"fp_test","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{}"}}]}`))
+	}))
+	defer server.Close()
+
+	seed := int64(42)
+	var fingerprints []string
+	_, err := newTestOpenAIService(server.URL).Generate(context.Background(), "system", "reply in json", GenOptions{
+		Seed:           &seed,
+		ResponseFormat: responseFormatJSONObject,
+		OnFingerprint:  func(fingerprint string) { fingerprints = append(fingerprints, fingerprint) },
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if request.Seed == nil || *request.Seed != 42 || request.ResponseFormat.Type != "json_object" {
+		t.Errorf("seed = %v, response_format = %q", request.Seed, request.ResponseFormat.Type)
+	}
+	if len(fingerprints) != 1 || fingerprints[0] != "fp_test" {
+		t.Errorf("fingerprints = %q, want [fp_test]", fingerprints)
+	}
+
+	// 不指定时不发送 seed，由服务端随机采样
+	request.Seed = nil
+	if _, err := newTestOpenAIService(server.URL).Generate(context.Background(), "system", "hello", GenOptions{}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if request.Seed != nil {
+		t.Errorf("seed = %d, want omitted", *request.Seed)
+	}
+}
+
+func TestAzureAPIKeyOnlyReplacesKeyForAzure(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "openai-key")
+	t.Setenv("AZURE_OPENAI_API_KEY", "azure-key")
+
+	cfg := DefaultConfig()
+	if err := cfg.applyEnv(); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if cfg.OpenAI.APIKey != "openai-key" {
+		t.Errorf("api key = %q, want the OpenAI key when Azure is not configured", cfg.OpenAI.APIKey)
+	}
+
+	t.Setenv("AZURE_OPENAI_ENDPOINT", "https://example.openai.azure.com")
+	cfg = DefaultConfig()
+	if err := cfg.applyEnv(); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+	if cfg.OpenAI.APIKey != "azure-key" {
+		t.Errorf("api key = %q, want the Azure key", cfg.OpenAI.APIKey)
+	}
+}
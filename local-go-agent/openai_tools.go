@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/shared"
+)
+
+// 单次对话中允许模型连续调用工具的最大轮数，防止模型陷入工具调用死循环
+const maxToolRounds = 5
+
+// ToolHandler 接收模型生成的JSON参数字符串，返回交给模型的工具执行结果
+type ToolHandler func(ctx context.Context, arguments string) (string, error)
+
+type Tool struct {
+	Name        string
+	Description string
+	// JSON Schema 格式的参数定义，为空表示无参数
+	Parameters map[string]interface{}
+	Handler    ToolHandler
+}
+
+func (s *OpenAIService) RegisterTool(tool Tool) error {
+	if tool.Name == "" {
+		return fmt.Errorf("tool name is required")
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("tool %s handler is required", tool.Name)
+	}
+
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+
+	if s.tools == nil {
+		s.tools = make(map[string]Tool)
+	}
+	if _, exists := s.tools[tool.Name]; !exists {
+		s.toolOrder = append(s.toolOrder, tool.Name)
+	}
+	s.tools[tool.Name] = tool
+	return nil
+}
+
+func (s *OpenAIService) toolParams() []openai.ChatCompletionToolUnionParam {
+	s.toolsMu.RLock()
+	defer s.toolsMu.RUnlock()
+
+	params := make([]openai.ChatCompletionToolUnionParam, 0, len(s.toolOrder))
+	for _, name := range s.toolOrder {
+		tool := s.tools[name]
+		definition := openai.FunctionDefinitionParam{
+			Name:       tool.Name,
+			Parameters: openai.FunctionParameters(tool.Parameters),
+		}
+		if tool.Description != "" {
+			definition.Description = openai.String(tool.Description)
+		}
+		params = append(params, openai.ChatCompletionFunctionTool(definition))
+	}
+	return params
+}
+
+func (s *OpenAIService) lookupTool(name string) (Tool, bool) {
+	s.toolsMu.RLock()
+	defer s.toolsMu.RUnlock()
+
+	tool, ok := s.tools[name]
+	return tool, ok
+}
+
+// GenerateResponseWithTools 在发送消息时附带已注册的工具，模型返回工具调用时执行对应的
+// handler 并把结果追加到对话中再次请求，直到模型给出最终的文本回复
+func (s *OpenAIService) GenerateResponseWithTools(ctx context.Context, systemMessage, userMessage string, maxTokens int, temperature float64) (string, error) {
+	return s.Generate(ctx, systemMessage, userMessage, GenOptions{MaxTokens: maxTokens, Temperature: temperature})
+}
+
+// Generate 实现 LanguageModel，请求中附带已注册的工具
+func (s *OpenAIService) Generate(ctx context.Context, system, user string, opts GenOptions) (string, error) {
+	messages := chatMessages(system, user, opts.History)
+	tools := s.toolParams()
+
+	for round := 0; round < maxToolRounds; round++ {
+		params := s.chatParams(messages, tools, opts)
+
+		completion, err := s.client.Chat.Completions.New(ctx, params)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate response: %w", openAIError(err))
+		}
+		reportUsage(opts, completion.Usage)
+		reportFingerprint(opts, completion.SystemFingerprint)
+
+		if len(completion.Choices) == 0 {
+			return "", fmt.Errorf("no response generated")
+		}
+
+		message := completion.Choices[0].Message
+		if len(message.ToolCalls) == 0 {
+			return message.Content, nil
+		}
+
+		// 模型可能在同一轮中调用多个工具，每个调用都需要对应一条工具结果消息
+		messages = append(messages, message.ToParam())
+		for _, call := range message.ToolCalls {
+			result := s.invokeTool(ctx, call)
+			messages = append(messages, openai.ToolMessage(result, call.ID))
+		}
+	}
+
+	return "", fmt.Errorf("tool calls exceeded %d rounds without a final answer", maxToolRounds)
+}
+
+// GenerateStream 实现 LanguageModel，以流式方式请求，工具调用的处理与 Generate 相同
+func (s *OpenAIService) GenerateStream(ctx context.Context, system, user string, opts GenOptions, onDelta func(delta string)) (string, error) {
+	messages := chatMessages(system, user, opts.History)
+	tools := s.toolParams()
+
+	for round := 0; round < maxToolRounds; round++ {
+		params := s.chatParams(messages, tools, opts)
+		if opts.OnUsage != nil {
+			// 流式响应默认不包含用量，需要显式请求，用量在最后一个分块中返回
+			params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+		}
+		stream := s.client.Chat.Completions.NewStreaming(ctx, params)
+
+		acc := openai.ChatCompletionAccumulator{}
+		for stream.Next() {
+			chunk := stream.Current()
+			acc.AddChunk(chunk)
+			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" && onDelta != nil {
+				onDelta(chunk.Choices[0].Delta.Content)
+			}
+		}
+		err := stream.Err()
+		stream.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate response: %w", openAIError(err))
+		}
+		reportUsage(opts, acc.Usage)
+		reportFingerprint(opts, acc.SystemFingerprint)
+
+		if len(acc.Choices) == 0 {
+			return "", fmt.Errorf("no response generated")
+		}
+
+		message := acc.Choices[0].Message
+		if len(message.ToolCalls) == 0 {
+			return message.Content, nil
+		}
+
+		messages = append(messages, message.ToParam())
+		for _, call := range message.ToolCalls {
+			result := s.invokeTool(ctx, call)
+			messages = append(messages, openai.ToolMessage(result, call.ID))
+		}
+	}
+
+	return "", fmt.Errorf("tool calls exceeded %d rounds without a final answer", maxToolRounds)
+}
+
+func (s *OpenAIService) chatParams(messages []openai.ChatCompletionMessageParamUnion, tools []openai.ChatCompletionToolUnionParam, opts GenOptions) openai.ChatCompletionNewParams {
+	params := openai.ChatCompletionNewParams{
+		Messages: messages,
+		Model:    s.model,
+		Tools:    tools,
+	}
+	if opts.Model != "" {
+		params.Model = openai.ChatModel(opts.Model)
+	}
+	if opts.MaxTokens > 0 {
+		params.MaxTokens = openai.Int(int64(opts.MaxTokens))
+	}
+	if opts.Temperature > 0 {
+		params.Temperature = openai.Float(opts.Temperature)
+	}
+	if opts.Seed != nil {
+		params.Seed = openai.Int(*opts.Seed)
+	}
+	switch opts.ResponseFormat {
+	case responseFormatText:
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{OfText: &shared.ResponseFormatTextParam{}}
+	case responseFormatJSONObject:
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{OfJSONObject: &shared.ResponseFormatJSONObjectParam{}}
+	}
+	return params
+}
+
+func reportUsage(opts GenOptions, usage openai.CompletionUsage) {
+	if opts.OnUsage == nil {
+		return
+	}
+	opts.OnUsage(TokenUsage{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens})
+}
+
+func reportFingerprint(opts GenOptions, fingerprint string) {
+	if opts.OnFingerprint == nil {
+		return
+	}
+	opts.OnFingerprint(fingerprint)
+}
+
+// chatMessages 按系统提示词、历史对话、本轮用户消息的顺序组装请求消息
+func chatMessages(system, user string, history []ChatMessage) []openai.ChatCompletionMessageParamUnion {
+	messages := make([]openai.ChatCompletionMessageParamUnion, 0, len(history)+2)
+	messages = append(messages, openai.SystemMessage(system))
+	for _, message := range history {
+		switch message.Role {
+		case ChatRoleAssistant:
+			messages = append(messages, openai.AssistantMessage(message.Content))
+		case ChatRoleSystem:
+			messages = append(messages, openai.SystemMessage(message.Content))
+		default:
+			messages = append(messages, openai.UserMessage(message.Content))
+		}
+	}
+	return append(messages, openai.UserMessage(user))
+}
+
+// invokeTool 执行单个工具调用，执行失败时把错误描述作为结果返回给模型，让模型自行决定如何回复
+func (s *OpenAIService) invokeTool(ctx context.Context, call openai.ChatCompletionMessageToolCallUnion) string {
+	name := call.Function.Name
+	tool, ok := s.lookupTool(name)
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", name)
+	}
+
+	result, err := tool.Handler(ctx, call.Function.Arguments)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return result
+}
+
+// currentTimeTool 是一个内置示例工具，让模型可以回答与当前时间相关的问题
+func currentTimeTool() Tool {
+	return Tool{
+		Name:        "get_current_time",
+		Description: "获取当前的日期和时间",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+		Handler: func(ctx context.Context, arguments string) (string, error) {
+			return time.Now().Format("2006-01-02 15:04:05 Monday"), nil
+		},
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+)
+
+const (
+	defaultOpenAITTSModel = "gpt-4o-mini-tts"
+	defaultOpenAITTSVoice = "alloy"
+	// response_format 为 pcm 时返回 24kHz 单声道16位小端PCM
+	openAITTSSampleRate = 24000
+)
+
+// openAIVoices 是OpenAI支持的声音。人设和参与者设置的声音通常是主语音合成服务的声音ID，
+// 作为备用服务时不认识的声音改用配置的声音
+var openAIVoices = map[string]bool{
+	"alloy": true, "ash": true, "ballad": true, "coral": true, "echo": true, "fable": true,
+	"onyx": true, "nova": true, "sage": true, "shimmer": true, "verse": true, "marin": true, "cedar": true,
+}
+
+// OpenAITTSService 使用OpenAI的 audio/speech 接口合成语音
+type OpenAITTSService struct {
+	client       openai.Client
+	model        string
+	voice        string
+	instructions string
+}
+
+func NewOpenAITTSService(apiKey string, opts ...option.RequestOption) (*OpenAITTSService, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("OpenAI API key is required")
+	}
+
+	client := openai.NewClient(append([]option.RequestOption{option.WithAPIKey(apiKey)}, opts...)...)
+	return &OpenAITTSService{client: client, model: defaultOpenAITTSModel, voice: defaultOpenAITTSVoice}, nil
+}
+
+func NewOpenAITTSServiceFromConfig(cfg OpenAIConfig, opts ...option.RequestOption) (*OpenAITTSService, error) {
+	service, err := NewOpenAITTSService(cfg.APIKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TTS.Model != "" {
+		service.model = cfg.TTS.Model
+	}
+	if cfg.TTS.Voice != "" {
+		service.voice = cfg.TTS.Voice
+	}
+	service.instructions = cfg.TTS.Instructions
+	return service, nil
+}
+
+func (s *OpenAITTSService) Synthesize(ctx context.Context, text string) (io.ReadCloser, AudioFormat, error) {
+	return s.SynthesizeWithOptions(ctx, text, SpeechOptions{})
+}
+
+// SynthesizeWithOptions 使用指定的OpenAI声音合成，声音不是OpenAI的声音时使用配置的声音。
+// 语言由模型根据文本判断
+func (s *OpenAITTSService) SynthesizeWithOptions(ctx context.Context, text string, opts SpeechOptions) (io.ReadCloser, AudioFormat, error) {
+	voice := s.voice
+	if openAIVoices[opts.Voice] {
+		voice = opts.Voice
+	}
+	params := openai.AudioSpeechNewParams{
+		Input:          text,
+		Model:          openai.SpeechModel(s.model),
+		Voice:          openai.AudioSpeechNewParamsVoice(voice),
+		ResponseFormat: openai.AudioSpeechNewParamsResponseFormatPCM,
+	}
+	if s.instructions != "" {
+		params.Instructions = openai.String(s.instructions)
+	}
+
+	resp, err := s.client.Audio.Speech.New(ctx, params)
+	if err != nil {
+		return nil, AudioFormat{}, openAIError(fmt.Errorf("OpenAI语音合成失败: %w", err))
+	}
+	return resp.Body, AudioFormat{SampleRate: openAITTSSampleRate, Channels: 1, Encoding: AudioEncodingPCMS16LE}, nil
+}
+
+// Preflight 列出模型，检查API密钥和网络是否可用
+func (s *OpenAITTSService) Preflight(ctx context.Context) error {
+	if _, err := s.client.Models.List(ctx); err != nil {
+		return openAIError(fmt.Errorf("列出模型失败: %w", err))
+	}
+	return nil
+}
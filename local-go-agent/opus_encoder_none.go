@@ -0,0 +1,10 @@
+//go:build !opus
+
+package main
+
+import "errors"
+
+// newOpusEncoder 在未使用 -tags opus 构建时不可用，编码Opus需要 cgo 和 libopus
+func newOpusEncoder() (audioEncoder, error) {
+	return nil, errors.New("构建时未启用Opus编码（需要 libopus，使用 -tags opus 构建）")
+}
@@ -0,0 +1,49 @@
+//go:build opus
+
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/sirupsen/logrus"
+)
+
+func TestOpusEncoderEncodesFrames(t *testing.T) {
+	encoder, err := newOpusEncoder()
+	if err != nil {
+		t.Fatalf("newOpusEncoder: %v", err)
+	}
+	if codec := encoder.Codec(); codec.MimeType != webrtc.MimeTypeOpus || codec.ClockRate != 48000 {
+		t.Errorf("codec = %+v, want 48kHz Opus", codec)
+	}
+
+	frame := make([]int16, encoder.SampleRate()/50)
+	for i := range frame {
+		frame[i] = int16(i % 200 * 100)
+	}
+	if packet := encoder.Encode(frame); len(packet) == 0 {
+		t.Error("encoded an empty packet")
+	}
+}
+
+func TestOpusEncoderBitrateIsAdjustable(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	encoder, err := newOpusEncoder()
+	if err != nil {
+		t.Fatalf("newOpusEncoder: %v", err)
+	}
+
+	cfg := DefaultConfig().Audio
+	cfg.AdaptiveBitrate = true
+	adapter := newBitrateAdapter(encoder, cfg, logrus.NewEntry(logger))
+	if adapter == nil {
+		t.Fatal("Opus encoder bitrate should be adjustable")
+	}
+	defer adapter.Stop()
+	if err := encoder.(bitrateEncoder).SetComplexity(11); err == nil {
+		t.Error("accepted an invalid complexity")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// ParticipantSettings 是参与者通过元数据设置的个人偏好，空字段使用全局配置，
+// 例如 {"voice":"narrator","lang":"en","model":"gpt-4o"}。其他代理和旁听者可以设置 {"ignore":true}，
+// 代理不处理其音频和文字消息
+type ParticipantSettings struct {
+	// 语音合成使用的声音ID
+	Voice string `json:"voice"`
+	// 识别和回复使用的语言，设置后不再自动检测
+	Language string `json:"lang"`
+	// 生成回复使用的模型
+	Model string `json:"model"`
+	// 代理忽略该参与者，不处理其音频和文字消息，也不问候
+	Ignore bool `json:"ignore"`
+	// 识别该参与者发言时的转录选项，如会议主题的专业术语，与配置中的选项合并
+	Transcribe TranscribeOptions `json:"transcribe"`
+}
+
+// parseParticipantSettings 解析参与者元数据，元数据为空时返回零值
+func parseParticipantSettings(metadata string) (ParticipantSettings, error) {
+	var settings ParticipantSettings
+	if strings.TrimSpace(metadata) == "" {
+		return settings, nil
+	}
+	if err := json.Unmarshal([]byte(metadata), &settings); err != nil {
+		return ParticipantSettings{}, fmt.Errorf("解析参与者元数据失败: %w", err)
+	}
+	if err := settings.Transcribe.validate(); err != nil {
+		return ParticipantSettings{}, fmt.Errorf("参与者元数据中的转录选项无效: %w", err)
+	}
+	return settings, nil
+}
+
+// loadParticipantSettings 读取并保存参与者的个人偏好，元数据格式错误时使用全局配置
+func (a *AIAgent) loadParticipantSettings(participant *lksdk.RemoteParticipant) {
+	identity := participant.Identity()
+	settings, err := parseParticipantSettings(participant.Metadata())
+	if err != nil {
+		a.logger.Warnf("%s 的元数据无效，使用全局配置: %v", identity, err)
+	}
+
+	a.settingsMu.Lock()
+	a.settings[identity] = settings
+	a.settingsMu.Unlock()
+
+	if settings.Language != "" {
+		a.setParticipantLanguage(identity, settings.Language)
+	}
+}
+
+func (a *AIAgent) participantSettings(identity string) ParticipantSettings {
+	a.settingsMu.RLock()
+	defer a.settingsMu.RUnlock()
+
+	return a.settings[identity]
+}
+
+func (a *AIAgent) forgetParticipantSettings(identity string) {
+	a.settingsMu.Lock()
+	defer a.settingsMu.Unlock()
+
+	delete(a.settings, identity)
+}
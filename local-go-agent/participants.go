@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sort"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// Participants 返回房间中其他参与者的快照，按身份排序
+func (a *AIAgent) Participants() []*lksdk.RemoteParticipant {
+	a.participantsMu.RLock()
+	defer a.participantsMu.RUnlock()
+
+	participants := make([]*lksdk.RemoteParticipant, 0, len(a.participants))
+	for _, participant := range a.participants {
+		participants = append(participants, participant)
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].Identity() < participants[j].Identity()
+	})
+	return participants
+}
+
+func (a *AIAgent) addParticipant(participant *lksdk.RemoteParticipant) {
+	a.participantsMu.Lock()
+	defer a.participantsMu.Unlock()
+
+	a.participants[participant.Identity()] = participant
+}
+
+func (a *AIAgent) removeParticipant(identity string) {
+	a.participantsMu.Lock()
+	defer a.participantsMu.Unlock()
+
+	delete(a.participants, identity)
+}
+
+// replaceParticipants 用重连后房间中的参与者替换参与者列表
+func (a *AIAgent) replaceParticipants(participants []*lksdk.RemoteParticipant) {
+	byIdentity := make(map[string]*lksdk.RemoteParticipant, len(participants))
+	for _, participant := range participants {
+		byIdentity[participant.Identity()] = participant
+	}
+
+	a.participantsMu.Lock()
+	defer a.participantsMu.Unlock()
+
+	a.participants = byIdentity
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// 在 -race 下运行，检查房间回调和读取参与者列表并发时没有数据竞争
+func TestParticipantsConcurrentAccess(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	participant := &lksdk.RemoteParticipant{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				agent.addParticipant(participant)
+				agent.removeParticipant(participant.Identity())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, p := range agent.Participants() {
+					_ = p.Identity()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	agent.replaceParticipants([]*lksdk.RemoteParticipant{participant})
+	if got := agent.Participants(); len(got) != 1 || got[0] != participant {
+		t.Errorf("participants = %v, want the restored participant", got)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const defaultSystemPrompt = "你是一个友好的AI助手。回复要简洁明了。"
+
+// Persona 决定代理在房间中的角色，空字段沿用上一级的设置
+type Persona struct {
+	// 系统提示词，回复语言的要求会追加在后面
+	SystemPrompt string `yaml:"system_prompt" json:"system_prompt"`
+	// 未检测到参与者语言时使用的回复语言
+	Language string `yaml:"language" json:"language"`
+	// 参与者未指定声音时使用的声音ID
+	Voice string `yaml:"voice" json:"voice"`
+	// 按回复语言选择的声音ID，如 {"en": "...", "zh": "..."}，未列出的语言使用 Voice
+	Voices map[string]string `yaml:"voices" json:"voices"`
+}
+
+// merge 用 override 中的非空字段覆盖当前设置
+func (p Persona) merge(override Persona) Persona {
+	if strings.TrimSpace(override.SystemPrompt) != "" {
+		p.SystemPrompt = override.SystemPrompt
+	}
+	if override.Language != "" {
+		p.Language = override.Language
+	}
+	if override.Voice != "" {
+		p.Voice = override.Voice
+	}
+	if len(override.Voices) > 0 {
+		voices := make(map[string]string, len(p.Voices)+len(override.Voices))
+		for language, voice := range p.Voices {
+			voices[language] = voice
+		}
+		for language, voice := range override.Voices {
+			voices[language] = voice
+		}
+		p.Voices = voices
+	}
+	return p
+}
+
+// isZero 判断是否没有设置任何字段
+func (p Persona) isZero() bool {
+	return p.SystemPrompt == "" && p.Language == "" && p.Voice == "" && len(p.Voices) == 0
+}
+
+// voiceFor 返回用某种语言回复时的声音
+func (p Persona) voiceFor(language string) string {
+	if voice := p.Voices[language]; voice != "" {
+		return voice
+	}
+	return p.Voice
+}
+
+func (p Persona) validate() error {
+	if strings.TrimSpace(p.SystemPrompt) == "" {
+		return fmt.Errorf("系统提示词不能为空")
+	}
+	_, err := ParsePromptTemplate(p.SystemPrompt)
+	return err
+}
+
+// roomMetadata 是房间元数据中与代理相关的部分，例如 {"persona":{"system_prompt":"你是一名英语老师"}}
+type roomMetadata struct {
+	Persona Persona `json:"persona"`
+}
+
+// currentPersona 返回当前生效的人设，对话中可能被切换
+func (a *AIAgent) currentPersona() Persona {
+	a.personaMu.RLock()
+	defer a.personaMu.RUnlock()
+	return a.persona
+}
+
+func (a *AIAgent) setPersona(persona Persona) {
+	a.personaMu.Lock()
+	defer a.personaMu.Unlock()
+	a.persona = persona
+}
+
+// resolvePersona 依次应用全局人设、配置中该房间的人设和房间元数据中的人设，
+// 房间元数据格式错误时忽略元数据
+func (a *AIAgent) resolvePersona(roomName, metadata string) Persona {
+	persona := a.config.Persona.merge(a.config.Personas[roomName])
+
+	if strings.TrimSpace(metadata) != "" {
+		var parsed roomMetadata
+		if err := json.Unmarshal([]byte(metadata), &parsed); err != nil {
+			a.logger.Warnf("房间 %s 的元数据无效，忽略其中的人设: %v", roomName, err)
+		} else {
+			persona = persona.merge(parsed.Persona)
+		}
+	}
+	return persona
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const dataTypePersona = "persona"
+
+// 切换人设的说法，如 "切换到翻译模式"、"switch to translator mode"，比较前去掉空格和标点并转为小写
+var (
+	personaSwitchPrefixes = []string{"切换到", "切换成", "切换为", "换成", "switchto", "changeto"}
+	personaSwitchSuffixes = []string{"模式", "人设", "mode", "persona"}
+)
+
+// PersonaMode 是参与者可以在对话中切换的一种人设，空字段沿用房间的人设
+type PersonaMode struct {
+	Persona `yaml:",inline"`
+	// 说话或发消息切换时可以用来指代该模式的其他名称，如 ["翻译", "translator"]
+	Aliases []string `yaml:"aliases"`
+	// 切换后清空参与者的对话历史，默认保留
+	ResetHistory bool `yaml:"reset_history"`
+	// 切换后的确认回复，为空时使用默认文案
+	Confirmation string `yaml:"confirmation"`
+}
+
+func (m PersonaMode) validate() error {
+	if m.SystemPrompt == "" {
+		return nil
+	}
+	_, err := ParsePromptTemplate(m.SystemPrompt)
+	return err
+}
+
+// SetPersona 为参与者切换到配置中名为 personaName 的人设，之后这位参与者的对话使用它的系统提示词、
+// 声音和语言，其他参与者不受影响。personaName 为空时恢复房间的人设。
+// 对话历史默认保留，人设配置了 reset_history 时清空
+func (a *AIAgent) SetPersona(participantIdentity, personaName string) error {
+	var mode PersonaMode
+	if personaName != "" {
+		var ok bool
+		if mode, ok = a.config.PersonaModes[personaName]; !ok {
+			return fmt.Errorf("未知的人设: %s", personaName)
+		}
+	}
+
+	a.personaMu.Lock()
+	if personaName == "" {
+		delete(a.personaModes, participantIdentity)
+	} else {
+		a.personaModes[participantIdentity] = personaName
+	}
+	a.personaMu.Unlock()
+
+	if mode.ResetHistory {
+		a.forgetConversations(participantIdentity)
+	}
+	return nil
+}
+
+// personaFor 返回参与者当前使用的人设：房间的人设叠加参与者切换到的人设
+func (a *AIAgent) personaFor(identity string) Persona {
+	a.personaMu.RLock()
+	defer a.personaMu.RUnlock()
+
+	name, ok := a.personaModes[identity]
+	if !ok {
+		return a.persona
+	}
+	return a.persona.merge(a.config.PersonaModes[name].Persona)
+}
+
+func (a *AIAgent) forgetPersonaMode(identity string) {
+	a.personaMu.Lock()
+	defer a.personaMu.Unlock()
+
+	delete(a.personaModes, identity)
+}
+
+// personaSwitchRequest 判断参与者说的话是否是切换人设的请求，返回要切换到的人设
+func (a *AIAgent) personaSwitchRequest(text string) (string, bool) {
+	if len(a.config.PersonaModes) == 0 {
+		return "", false
+	}
+	normalized := normalizeCommand(text)
+	for _, prefix := range personaSwitchPrefixes {
+		target, ok := strings.CutPrefix(normalized, prefix)
+		if !ok {
+			continue
+		}
+		candidates := []string{target}
+		for _, suffix := range personaSwitchSuffixes {
+			if trimmed, ok := strings.CutSuffix(target, suffix); ok {
+				candidates = append(candidates, trimmed)
+			}
+		}
+		for _, candidate := range candidates {
+			if name, ok := a.lookupPersonaMode(candidate); ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// lookupPersonaMode 按名称或别名查找人设，normalized 已去掉空格和标点
+func (a *AIAgent) lookupPersonaMode(normalized string) (string, bool) {
+	if normalized == "" {
+		return "", false
+	}
+	for name, mode := range a.config.PersonaModes {
+		if normalizeCommand(name) == normalized {
+			return name, true
+		}
+		for _, alias := range mode.Aliases {
+			if normalizeCommand(alias) == normalized {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// normalizeCommand 去掉空格和标点并转为小写，用于匹配说出的命令
+func normalizeCommand(text string) string {
+	return strings.ToLower(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			return -1
+		}
+		return r
+	}, text))
+}
+
+// switchPersona 为参与者切换人设并用新的人设回复确认
+func (a *AIAgent) switchPersona(ctx context.Context, participant *lksdk.RemoteParticipant, name string) {
+	logger := a.turnLogger(ctx)
+	if err := a.SetPersona(participant.Identity(), name); err != nil {
+		logger.Warnf("切换人设失败: %v", err)
+		return
+	}
+	logger.Infof("%s 切换到人设: %s", participant.Identity(), name)
+
+	reply := a.config.PersonaModes[name].Confirmation
+	if reply == "" {
+		reply = fmt.Sprintf("好的，已切换到%s模式。", name)
+	}
+	a.say(ctx, participant, reply)
+}
+
+// handlePersonaMessage 处理客户端发送的 {"type":"persona","name":"translator"} 消息，name 为空时恢复房间的人设
+func (a *AIAgent) handlePersonaMessage(participant *lksdk.RemoteParticipant, name string) {
+	ctx := a.withTurn(a.session(), participant.Identity())
+	if name == "" {
+		a.SetPersona(participant.Identity(), "")
+		a.turnLogger(ctx).Infof("%s 恢复房间的人设", participant.Identity())
+		return
+	}
+	if resolved, ok := a.lookupPersonaMode(normalizeCommand(name)); ok {
+		name = resolved
+	}
+	a.startTurn(func() { a.switchPersona(ctx, participant, name) })
+}
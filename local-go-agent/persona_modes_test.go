@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"gopkg.in/yaml.v3"
+)
+
+func translatorModes() map[string]PersonaMode {
+	return map[string]PersonaMode{
+		"翻译": {
+			Persona: Persona{SystemPrompt: "你是一名翻译，把听到的话翻译成英文。", Voice: "translator-voice"},
+			Aliases: []string{"translator", "translation"},
+		},
+	}
+}
+
+func TestPersonaModeParsesInlinePersona(t *testing.T) {
+	var modes map[string]PersonaMode
+	data := "translator:\n  system_prompt: 你是一名翻译\n  voice: v1\n  aliases: [翻译]\n  reset_history: true\n"
+	if err := yaml.Unmarshal([]byte(data), &modes); err != nil {
+		t.Fatal(err)
+	}
+	mode := modes["translator"]
+	if mode.SystemPrompt != "你是一名翻译" || mode.Voice != "v1" || !mode.ResetHistory || len(mode.Aliases) != 1 {
+		t.Errorf("mode = %+v", mode)
+	}
+}
+
+func TestSwitchPersonaBySpokenPhrase(t *testing.T) {
+	llm := &fakeLLM{reply: "好的。"}
+	agent, publisher := newTestAgent(&AIServices{LLM: llm})
+	agent.config.PersonaModes = translatorModes()
+	agent.persona = Persona{SystemPrompt: "你是一个助手", Voice: "room-voice"}
+	participant := &lksdk.RemoteParticipant{}
+	identity := participant.Identity()
+	agent.conversation(identity).Append("我叫小明", "你好小明")
+
+	for _, phrase := range []string{"切换到翻译模式。", "Switch to translator mode!", "换成 translation"} {
+		if name, ok := agent.personaSwitchRequest(phrase); !ok || name != "翻译" {
+			t.Errorf("personaSwitchRequest(%q) = %q, %v", phrase, name, ok)
+		}
+	}
+	if _, ok := agent.personaSwitchRequest("切换到翻译模式之前先说说天气"); ok {
+		t.Errorf("a sentence containing the phrase should not switch")
+	}
+
+	agent.handleChatMessage(context.Background(), "切换到翻译模式", participant)
+	if llm.Calls() != 0 {
+		t.Errorf("switch phrase was sent to the llm")
+	}
+	if !containsString(publisher.Messages(), "好的，已切换到翻译模式。") {
+		t.Errorf("messages = %v, want confirmation", publisher.Messages())
+	}
+
+	persona := agent.personaFor(identity)
+	if persona.Voice != "translator-voice" || !strings.Contains(persona.SystemPrompt, "翻译") {
+		t.Errorf("persona after switching = %+v", persona)
+	}
+	if messages := agent.conversation(identity).Messages(); len(messages) != 2 {
+		t.Errorf("history should be kept by default: %v", messages)
+	}
+	if other := agent.personaFor(identity + "-other"); other.Voice != "room-voice" {
+		t.Errorf("another participant's persona changed: %+v", other)
+	}
+
+	if err := agent.SetPersona(identity, ""); err != nil {
+		t.Fatal(err)
+	}
+	if persona := agent.personaFor(identity); persona.Voice != "room-voice" {
+		t.Errorf("persona after clearing = %+v", persona)
+	}
+}
+
+func TestSetPersonaResetsHistoryWhenConfigured(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{LLM: &fakeLLM{reply: "好的。"}})
+	modes := translatorModes()
+	mode := modes["翻译"]
+	mode.ResetHistory = true
+	modes["翻译"] = mode
+	agent.config.PersonaModes = modes
+
+	agent.conversation("alice").Append("我叫小明", "你好小明")
+	agent.conversation("bob").Append("我叫小红", "你好小红")
+
+	if err := agent.SetPersona("alice", "未知"); err == nil {
+		t.Errorf("switching to an unknown persona should fail")
+	}
+	if err := agent.SetPersona("alice", "翻译"); err != nil {
+		t.Fatal(err)
+	}
+	if messages := agent.conversation("alice").Messages(); len(messages) != 0 {
+		t.Errorf("history not cleared: %v", messages)
+	}
+	if messages := agent.conversation("bob").Messages(); len(messages) != 2 {
+		t.Errorf("another participant's history cleared: %v", messages)
+	}
+}
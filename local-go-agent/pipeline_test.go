@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestProcessAudioBuffer(t *testing.T) {
+	heard := Transcript{Text: "今天天气怎么样", Confidence: 0.9, Language: "zh", Final: true}
+	reply := "今天晴天。适合出门！"
+
+	tests := []struct {
+		name     string
+		stt      *fakeSTT
+		llm      *fakeLLM
+		tts      *fakeTTS
+		bargeIn  bool
+		llmCalls int
+		// 期望送去合成的句子
+		spoken []string
+		// 期望发送的文本消息中必须包含和不能包含的内容
+		sent    []string
+		notSent []string
+	}{
+		{
+			name:     "normal turn",
+			stt:      &fakeSTT{result: heard},
+			llm:      &fakeLLM{reply: reply},
+			tts:      &fakeTTS{},
+			llmCalls: 1,
+			spoken:   []string{"今天晴天。", "适合出门！"},
+			notSent:  []string{reply},
+		},
+		{
+			name:    "empty transcript",
+			stt:     &fakeSTT{result: Transcript{Confidence: 0.9, Final: true}},
+			llm:     &fakeLLM{reply: reply},
+			tts:     &fakeTTS{},
+			notSent: []string{reply},
+		},
+		{
+			name:    "stt error",
+			stt:     &fakeSTT{err: errors.New("upload failed")},
+			llm:     &fakeLLM{reply: reply},
+			tts:     &fakeTTS{},
+			sent:    []string{"抱歉，我无法理解您说的话。"},
+			notSent: []string{reply},
+		},
+		{
+			name:     "llm error",
+			stt:      &fakeSTT{result: heard},
+			llm:      &fakeLLM{err: errors.New("rate limited")},
+			tts:      &fakeTTS{},
+			llmCalls: 1,
+			spoken:   []string{"抱歉，我现在无法生成回复。"},
+		},
+		{
+			name:     "tts error falls back to text",
+			stt:      &fakeSTT{result: heard},
+			llm:      &fakeLLM{reply: reply},
+			tts:      &fakeTTS{err: errors.New("synthesis failed")},
+			llmCalls: 1,
+			// 合成失败的句子被跳过，其余句子照常合成
+			spoken: []string{"今天晴天。", "适合出门！"},
+			sent:   []string{reply},
+		},
+		{
+			name:     "barge-in cancels the turn",
+			stt:      &fakeSTT{result: heard},
+			llm:      &fakeLLM{},
+			tts:      &fakeTTS{},
+			bargeIn:  true,
+			llmCalls: 1,
+			notSent:  []string{reply, "抱歉，我现在无法生成回复。"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent, publisher := newTestAgent(&AIServices{LLM: tt.llm, STT: tt.stt, TTS: tt.tts})
+			// 逐句合成，按顺序检查送去合成的句子
+			agent.config.Audio.TTSConcurrency = 1
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.bargeIn {
+				tt.llm.cancel = cancel
+			}
+
+			agent.processAudioBuffer(ctx, turnRequest{pcm: make([]int16, sttSampleRate/10)}, &lksdk.RemoteParticipant{})
+
+			if calls := tt.llm.Calls(); calls != tt.llmCalls {
+				t.Errorf("llm calls = %d, want %d", calls, tt.llmCalls)
+			}
+			if spoken := tt.tts.Texts(); !reflect.DeepEqual(spoken, tt.spoken) {
+				t.Errorf("spoken = %q, want %q", spoken, tt.spoken)
+			}
+
+			messages := publisher.Messages()
+			for _, want := range tt.sent {
+				if !containsString(messages, want) {
+					t.Errorf("messages %q missing %q", messages, want)
+				}
+			}
+			for _, unwanted := range tt.notSent {
+				if containsString(messages, unwanted) {
+					t.Errorf("messages %q should not contain %q", messages, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestTurnDeadline(t *testing.T) {
+	llm := &fakeLLM{block: true}
+	tts := &fakeTTS{}
+	stt := &fakeSTT{result: Transcript{Text: "讲个长故事", Confidence: 0.9, Final: true}}
+	agent, publisher := newTestAgent(&AIServices{LLM: llm, STT: stt, TTS: tts})
+	agent.config.Audio.TurnDeadline = 50 * time.Millisecond
+
+	agent.enqueueTurn(&lksdk.RemoteParticipant{}, turnRequest{ctx: context.Background(), pcm: make([]int16, sttSampleRate/10)})
+	agent.turns.Wait()
+
+	// 超时要取消进行中的请求，而不是丢下它继续运行
+	if err := llm.CtxErr(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("llm request ended with %v, want deadline exceeded", err)
+	}
+	if messages := publisher.Messages(); !reflect.DeepEqual(messages, []string{defaultTurnTimeoutReply}) {
+		t.Errorf("messages = %q, want only the timeout reply", messages)
+	}
+	if spoken := tts.Texts(); !reflect.DeepEqual(spoken, []string{defaultTurnTimeoutReply}) {
+		t.Errorf("spoken = %q, want only the timeout reply", spoken)
+	}
+}
+
+func containsString(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProcessAudioBufferDiarization(t *testing.T) {
+	stt := &fakeSTT{result: Transcript{
+		Text:       "你好 我想问天气",
+		Confidence: 0.9,
+		Language:   "zh",
+		Final:      true,
+		Speakers: []SpeakerTurn{
+			{Speaker: "A", Text: "你好", StartMs: 0, EndMs: 500},
+			{Speaker: "B", Text: "我想问天气", StartMs: 600, EndMs: 1500},
+		},
+	}}
+	llm := &fakeLLM{reply: "好的。"}
+	agent, _ := newTestAgent(&AIServices{STT: stt, LLM: llm, TTS: &fakeTTS{}})
+
+	participant := &lksdk.RemoteParticipant{}
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: make([]int16, sttSampleRate)}, participant)
+
+	if got := llm.Calls(); got != 2 {
+		t.Fatalf("LLM called %d times, want one call per speaker", got)
+	}
+	// 每位说话人的对话历史相互独立
+	for speaker, text := range map[string]string{"A": "你好", "B": "我想问天气"} {
+		history := agent.conversation(speakerIdentity(participant.Identity(), speaker)).Messages()
+		if len(history) != 2 || history[0].Content != text {
+			t.Errorf("speaker %s history = %+v", speaker, history)
+		}
+	}
+	if history := agent.conversation(participant.Identity()).Messages(); len(history) != 0 {
+		t.Errorf("participant history should be empty, got %+v", history)
+	}
+}
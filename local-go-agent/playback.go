@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// playbackMixer 是可以在回复之间切换的语音输出，由 pacedWriter 实现。
+// 每段回复有自己的编号，开始新的回复后旧回复的音频不再播放
+type playbackMixer interface {
+	Begin() uint64
+	WriteGeneration(generation uint64, samples []float32, sampleRate int) bool
+	Stop(generation uint64)
+}
+
+type playbackKey struct{}
+
+// playback 是一段回复在语音输出上的编号，第一段音频写入时才开始，
+// 回复还在生成时不会打断正在播放的上一段回复
+type playback struct {
+	mu         sync.Mutex
+	mixer      playbackMixer
+	generation uint64
+}
+
+// withPlayback 返回为一段回复分配播放编号的上下文，同一段回复的所有音频都通过该上下文发送
+func withPlayback(ctx context.Context) context.Context {
+	return context.WithValue(ctx, playbackKey{}, &playback{})
+}
+
+// writePlayback 播放一段回复的音频。语音输出不支持切换或上下文中没有回复时返回 false，由调用方直接写入；
+// 否则 played 表示音频是否被播放，为 false 时这段回复已被新的回复取代
+func writePlayback(ctx context.Context, output speechOutput, samples []float32, sampleRate int) (handled, played bool) {
+	mixer, ok := output.(playbackMixer)
+	p, _ := ctx.Value(playbackKey{}).(*playback)
+	if !ok || p == nil {
+		return false, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 会话重新发布了轨道时从新的输出开始
+	if p.mixer != mixer {
+		p.mixer = mixer
+		p.generation = mixer.Begin()
+	}
+	return true, mixer.WriteGeneration(p.generation, samples, sampleRate)
+}
+
+// stopPlayback 停止播放一段回复还没播完的音频，对话被打断或取消时调用
+func stopPlayback(ctx context.Context) {
+	p, _ := ctx.Value(playbackKey{}).(*playback)
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.mixer != nil {
+		p.mixer.Stop(p.generation)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func constantSamples(n int, value float32) []float32 {
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = value
+	}
+	return samples
+}
+
+func TestPacedWriterCrossfadesPreemptedReply(t *testing.T) {
+	writer := newTestPacedWriter(&fakeTrack{})
+
+	first := writer.Begin()
+	writer.WriteGeneration(first, constantSamples(8000, 0.5), 8000)
+	writer.nextFrame()
+
+	second := writer.Begin()
+	if writer.WriteGeneration(first, constantSamples(8000, 0.5), 8000) {
+		t.Error("stale reply was queued after being preempted")
+	}
+	if !writer.WriteGeneration(second, constantSamples(800, -0.5), 8000) {
+		t.Fatal("current reply was discarded")
+	}
+
+	// 旧回复在10ms内淡出，同时新回复淡入，相邻采样之间没有跳变
+	frame := writer.nextFrame()
+	if frame[0] != 16383 || frame[80] != -16383 {
+		t.Errorf("crossfade starts at %d and ends at %d, want the old level fading into the new one", frame[0], frame[80])
+	}
+	for i := 1; i < len(frame); i++ {
+		if step := int(frame[i]) - int(frame[i-1]); step > 500 || step < -500 {
+			t.Fatalf("click at sample %d: %d -> %d", i, frame[i-1], frame[i])
+		}
+	}
+	if got := writer.Buffered(); got != 80*time.Millisecond {
+		t.Errorf("buffered = %v, want only the rest of the new reply", got)
+	}
+
+	// 停止后剩余的音频淡出，之后的写入被丢弃
+	writer.Stop(second)
+	if writer.WriteGeneration(second, constantSamples(800, 0.5), 8000) {
+		t.Error("stopped reply was queued")
+	}
+	if got := writer.Buffered(); got != 10*time.Millisecond {
+		t.Errorf("buffered after stop = %v, want a 10ms fade", got)
+	}
+}
+
+func TestPreemptedReplyStopsWriting(t *testing.T) {
+	tts := &fakeTTS{}
+	agent, _ := newTestAgent(&AIServices{TTS: tts})
+	agent.config.Audio.TTSConcurrency = 1
+	writer := newTestPacedWriter(&fakeTrack{})
+	agent.audioOut = writer
+	participant := &lksdk.RemoteParticipant{}
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	old := agent.startSpeech(context.Background(), participant, "")
+	// 看到下一个字才确认断句
+	old.Write("第一句。第")
+	waitFor("the first reply to play", func() bool { return writer.Buffered() > 0 })
+
+	// 另一位参与者的回复开始播放，取代了第一段回复
+	current := agent.startSpeech(context.Background(), participant, "")
+	current.Write("新的回复。好")
+	waitFor("the new reply to play", func() bool { return len(tts.Texts()) == 2 && writer.Buffered() > 0 })
+
+	old.Write("二句。第三句。")
+	if !old.Finish("") {
+		t.Error("a preempted reply should not fall back to a text message")
+	}
+	// Finish 返回时合成协程已经退出，被取代后不再合成后面的句子
+	texts := strings.Join(tts.Texts(), "|")
+	if strings.Contains(texts, "第三句") {
+		t.Errorf("preempted reply kept synthesizing: %s", texts)
+	}
+	if !current.Finish("") {
+		t.Error("current reply was not played")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPreflightTimeout = 10 * time.Second
+
+// PreflightMode 决定加入房间前自检AI服务失败时的处理方式
+type PreflightMode string
+
+const (
+	// PreflightModeOff 不自检，凭据错误要到第一轮对话才会发现
+	PreflightModeOff PreflightMode = "off"
+	// PreflightModeWarn 自检失败时记录警告，仍然加入房间
+	PreflightModeWarn PreflightMode = "warn"
+	// PreflightModeFail 自检失败时不加入房间，启动失败
+	PreflightModeFail PreflightMode = "fail"
+)
+
+// PreflightConfig 让代理在加入房间前用一次很小的请求检查每个已配置的AI服务：
+// OpenAI 列出模型，AssemblyAI 查询转录列表，Cartesia 列出声音，不产生识别或合成费用
+type PreflightConfig struct {
+	// off、warn 或 fail
+	Mode PreflightMode `yaml:"mode"`
+	// 所有服务检查的总超时
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c PreflightConfig) validate() error {
+	switch c.Mode {
+	case "", PreflightModeOff, PreflightModeWarn, PreflightModeFail:
+	default:
+		return fmt.Errorf("未知的 mode %q，可选 off、warn 或 fail", c.Mode)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout 不能小于0")
+	}
+	return nil
+}
+
+// preflightChecker 是可以在加入房间前检查API密钥和连通性的服务，
+// 本地服务（whisper_local、espeak）在创建时已经检查过，不需要实现
+type preflightChecker interface {
+	Preflight(ctx context.Context) error
+}
+
+// PreflightResult 是一个服务的自检结果
+type PreflightResult struct {
+	Provider string
+	Err      error
+	Latency  time.Duration
+}
+
+// PreflightError 汇总自检失败的服务
+type PreflightError struct {
+	Failed []PreflightResult
+}
+
+func (e *PreflightError) Error() string {
+	parts := make([]string, len(e.Failed))
+	for i, result := range e.Failed {
+		parts[i] = fmt.Sprintf("%s: %v", result.Provider, result.Err)
+	}
+	return "AI服务自检失败: " + strings.Join(parts, "; ")
+}
+
+func (e *PreflightError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, result := range e.Failed {
+		errs[i] = result.Err
+	}
+	return errs
+}
+
+// Preflight 同时检查所有已配置的AI服务，任何服务失败时返回 *PreflightError
+func (s *AIServices) Preflight(ctx context.Context) error {
+	var failed []PreflightResult
+	for _, result := range s.PreflightResults(ctx) {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) > 0 {
+		return &PreflightError{Failed: failed}
+	}
+	return nil
+}
+
+// PreflightResults 同时检查所有已配置的AI服务，按 LLM、语音识别、语音合成（含备用服务）的顺序返回每个服务的结果
+func (s *AIServices) PreflightResults(ctx context.Context) []PreflightResult {
+	checkers := s.preflightCheckers()
+	results := make([]PreflightResult, len(checkers))
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := checker.Preflight(ctx)
+			results[i] = PreflightResult{Provider: providerName(checker), Err: err, Latency: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (s *AIServices) preflightCheckers() []preflightChecker {
+	services := []any{s.LLM, s.STT}
+	switch tts := s.TTS.(type) {
+	case *fallbackTTS:
+		for _, named := range tts.services {
+			services = append(services, named.service)
+		}
+	case *streamingFallbackTTS:
+		for _, named := range tts.services {
+			services = append(services, named.service)
+		}
+	default:
+		services = append(services, s.TTS)
+	}
+
+	var checkers []preflightChecker
+	for _, service := range services {
+		if checker, ok := service.(preflightChecker); ok {
+			checkers = append(checkers, checker)
+		}
+	}
+	return checkers
+}
+
+// providerName 返回自检结果中显示的服务名称
+func providerName(service any) string {
+	switch service.(type) {
+	case *OpenAIService:
+		return "OpenAI"
+	case *OpenAITTSService:
+		return "OpenAI TTS"
+	case *AssemblyAIService:
+		return "AssemblyAI"
+	case *CartesiaService:
+		return "Cartesia"
+	default:
+		return fmt.Sprintf("%T", service)
+	}
+}
+
+// Preflight 按 preflight 配置在加入房间前自检AI服务，记录每个服务的结果。
+// mode 为 fail 且有服务失败时返回错误，为 warn 时只记录警告
+func (m *Manager) Preflight(ctx context.Context) error {
+	cfg := m.config.Preflight
+	if cfg.Mode == "" || cfg.Mode == PreflightModeOff {
+		return nil
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultPreflightTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var failed []PreflightResult
+	for _, result := range m.services.PreflightResults(ctx) {
+		if result.Err != nil {
+			m.logger.Errorf("AI服务自检 %s: 失败 (%v): %v", result.Provider, result.Latency.Round(time.Millisecond), result.Err)
+			failed = append(failed, result)
+			continue
+		}
+		m.logger.Infof("AI服务自检 %s: 正常 (%v)", result.Provider, result.Latency.Round(time.Millisecond))
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	err := &PreflightError{Failed: failed}
+	if cfg.Mode == PreflightModeFail {
+		return err
+	}
+	m.logger.Warnf("%v，仍然加入房间", err)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AssemblyAI/assemblyai-go-sdk"
+	"github.com/sirupsen/logrus"
+)
+
+func TestPreflightReportsEachProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/models":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"object":"list","data":[]}`)
+		case "/v2/transcript":
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":"Authentication error, API token missing/invalid"}`)
+		case "/voices":
+			if r.Header.Get("X-API-Key") != "cartesia-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			io.WriteString(w, `[]`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	cartesia := NewCartesiaService("cartesia-key")
+	cartesia.baseURL = server.URL
+	services := &AIServices{
+		LLM: newTestOpenAIService(server.URL),
+		STT: &AssemblyAIService{client: assemblyai.NewClientWithOptions(assemblyai.WithAPIKey("bad"), assemblyai.WithBaseURL(server.URL))},
+		TTS: &fallbackTTS{services: []namedTTS{{name: ttsProviderCartesia, service: cartesia}, {name: ttsProviderEspeak, service: &fakeTTS{}}}},
+	}
+
+	results := services.PreflightResults(context.Background())
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want OpenAI, AssemblyAI and Cartesia: %+v", len(results), results)
+	}
+	for i, want := range []string{"OpenAI", "AssemblyAI", "Cartesia"} {
+		if results[i].Provider != want {
+			t.Errorf("result %d is %s, want %s", i, results[i].Provider, want)
+		}
+	}
+	if results[0].Err != nil || results[2].Err != nil {
+		t.Errorf("OpenAI and Cartesia should pass: %v, %v", results[0].Err, results[2].Err)
+	}
+
+	err := services.Preflight(context.Background())
+	var preflightErr *PreflightError
+	if !errors.As(err, &preflightErr) || len(preflightErr.Failed) != 1 || preflightErr.Failed[0].Provider != "AssemblyAI" {
+		t.Fatalf("Preflight() = %v, want only AssemblyAI to fail", err)
+	}
+	var authErr *ErrAuth
+	if !errors.As(err, &authErr) {
+		t.Errorf("bad key should be reported as an auth error: %v", err)
+	}
+}
+
+func TestManagerPreflightMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	manager := &Manager{config: DefaultConfig(), logger: logger, services: &AIServices{LLM: newTestOpenAIService(server.URL)}}
+
+	for mode, wantErr := range map[PreflightMode]bool{PreflightModeOff: false, PreflightModeWarn: false, PreflightModeFail: true} {
+		manager.config.Preflight.Mode = mode
+		if err := manager.Preflight(context.Background()); (err != nil) != wantErr {
+			t.Errorf("mode %s: Preflight() = %v, want error %v", mode, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	defaultHighPassCutoff = 80.0
+	defaultTargetRMS      = 0.1
+	defaultMaxGain        = 10.0
+	defaultNoiseGateRatio = 2.0
+
+	// 低于该电平的音频视为静音，自动增益不会放大它
+	agcSilenceRMS = 0.001
+	// 增益下降和上升的平滑系数，下降快以免爆音，上升慢以免放大呼吸声
+	agcAttack  = 0.5
+	agcRelease = 0.1
+	// 放大后的峰值上限，留出余量避免削波
+	agcPeakLimit = 0.95
+
+	// 噪声门的FFT帧长和帧移，50%重叠
+	noiseGateFrameSize = 512
+	noiseGateHop       = noiseGateFrameSize / 2
+	// 噪声门对低于噪声电平的频点的衰减倍数
+	noiseGateAttenuation = 0.1
+	// 噪声电平跟随信号上升的速度，下降时立即跟随
+	noiseFloorRise = 0.005
+)
+
+// PreprocessConfig 是送去语音识别前对解码后音频的预处理，各阶段可以单独开启
+type PreprocessConfig struct {
+	// 高通滤波，滤掉低频的嗡嗡声和风噪
+	HighPass       bool    `yaml:"high_pass"`
+	HighPassCutoff float64 `yaml:"high_pass_cutoff"`
+	// 自动增益，把音量调整到目标均方根电平 (0-1)，最多放大 MaxGain 倍
+	AGC       bool    `yaml:"agc"`
+	TargetRMS float64 `yaml:"target_rms"`
+	MaxGain   float64 `yaml:"max_gain"`
+	// 频谱噪声门，衰减幅度低于估计噪声电平 NoiseGateRatio 倍的频点
+	NoiseGate      bool    `yaml:"noise_gate"`
+	NoiseGateRatio float64 `yaml:"noise_gate_ratio"`
+}
+
+func (c PreprocessConfig) validate() error {
+	if c.HighPass && c.HighPassCutoff >= sttSampleRate/2 {
+		return fmt.Errorf("高通滤波截止频率 %.0fHz 必须低于 %dHz", c.HighPassCutoff, sttSampleRate/2)
+	}
+	if c.AGC && c.TargetRMS >= 1 {
+		return fmt.Errorf("目标电平 %.2f 必须小于 1", c.TargetRMS)
+	}
+	return nil
+}
+
+// audioStage 是预处理的一个阶段，有状态，每条轨道使用独立的实例
+type audioStage interface {
+	process(samples []float64) []float64
+}
+
+// audioPreprocessor 依次执行开启的预处理阶段，为 nil 时原样返回音频
+type audioPreprocessor struct {
+	stages []audioStage
+}
+
+// newAudioPreprocessor 按配置创建预处理器，没有开启任何阶段时返回 nil
+func newAudioPreprocessor(cfg PreprocessConfig) *audioPreprocessor {
+	var stages []audioStage
+	if cfg.HighPass {
+		stages = append(stages, newHighPassFilter(cfg.HighPassCutoff, sttSampleRate))
+	}
+	if cfg.NoiseGate {
+		stages = append(stages, newSpectralGate(cfg.NoiseGateRatio))
+	}
+	// 增益放在最后，避免放大后再滤波改变电平
+	if cfg.AGC {
+		stages = append(stages, newAutoGain(cfg.TargetRMS, cfg.MaxGain))
+	}
+	if len(stages) == 0 {
+		return nil
+	}
+	return &audioPreprocessor{stages: stages}
+}
+
+// Process 处理一帧PCM。噪声门按帧缓冲，返回的采样数可能与输入不同
+func (p *audioPreprocessor) Process(pcm []int16) []int16 {
+	if p == nil {
+		return pcm
+	}
+
+	samples := make([]float64, len(pcm))
+	for i, sample := range pcm {
+		samples[i] = float64(sample) / 32768
+	}
+	for _, stage := range p.stages {
+		samples = stage.process(samples)
+	}
+
+	out := make([]int16, len(samples))
+	for i, sample := range samples {
+		out[i] = int16(math.Max(-1, math.Min(sample, 32767.0/32768)) * 32768)
+	}
+	return out
+}
+
+// highPassFilter 是二阶巴特沃斯高通滤波器
+type highPassFilter struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func newHighPassFilter(cutoff float64, sampleRate int) *highPassFilter {
+	if cutoff <= 0 {
+		cutoff = defaultHighPassCutoff
+	}
+	w0 := 2 * math.Pi * cutoff / float64(sampleRate)
+	alpha := math.Sin(w0) / math.Sqrt2
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+	return &highPassFilter{
+		b0: (1 + cos) / 2 / a0,
+		b1: -(1 + cos) / a0,
+		b2: (1 + cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+func (f *highPassFilter) process(samples []float64) []float64 {
+	for i, x := range samples {
+		y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+		f.x2, f.x1 = f.x1, x
+		f.y2, f.y1 = f.y1, y
+		samples[i] = y
+	}
+	return samples
+}
+
+// autoGain 按帧把音量平滑地调整到目标电平，峰值受限不会削波
+type autoGain struct {
+	target  float64
+	maxGain float64
+	gain    float64
+}
+
+func newAutoGain(target, maxGain float64) *autoGain {
+	if target <= 0 {
+		target = defaultTargetRMS
+	}
+	if maxGain <= 0 {
+		maxGain = defaultMaxGain
+	}
+	return &autoGain{target: target, maxGain: maxGain, gain: 1}
+}
+
+func (g *autoGain) process(samples []float64) []float64 {
+	if len(samples) == 0 {
+		return samples
+	}
+
+	var sum, peak float64
+	for _, sample := range samples {
+		sum += sample * sample
+		peak = math.Max(peak, math.Abs(sample))
+	}
+	level := math.Sqrt(sum / float64(len(samples)))
+
+	// 静音时保持当前增益，避免把底噪放大到目标电平
+	if level >= agcSilenceRMS {
+		desired := math.Min(g.target/level, g.maxGain)
+		if desired < g.gain {
+			g.gain += (desired - g.gain) * agcAttack
+		} else {
+			g.gain += (desired - g.gain) * agcRelease
+		}
+	}
+
+	gain := g.gain
+	if peak*gain > agcPeakLimit {
+		gain = agcPeakLimit / peak
+	}
+	for i := range samples {
+		samples[i] *= gain
+	}
+	return samples
+}
+
+// spectralGate 按频点估计噪声电平，衰减低于噪声电平一定倍数的频点。
+// 使用平方根汉宁窗分析和合成，50%重叠相加后可以无失真地重建信号
+type spectralGate struct {
+	ratio  float64
+	window []float64
+	noise  []float64
+
+	// 未凑满一个帧移的输入，当前分析帧，以及上一帧待叠加的后半部分
+	pending []float64
+	frame   []float64
+	overlap []float64
+}
+
+func newSpectralGate(ratio float64) *spectralGate {
+	if ratio <= 0 {
+		ratio = defaultNoiseGateRatio
+	}
+	window := make([]float64, noiseGateFrameSize)
+	for i := range window {
+		window[i] = math.Sqrt(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/noiseGateFrameSize))
+	}
+	return &spectralGate{
+		ratio:   ratio,
+		window:  window,
+		frame:   make([]float64, noiseGateFrameSize),
+		overlap: make([]float64, noiseGateHop),
+	}
+}
+
+func (g *spectralGate) process(samples []float64) []float64 {
+	g.pending = append(g.pending, samples...)
+
+	var out []float64
+	for len(g.pending) >= noiseGateHop {
+		copy(g.frame, g.frame[noiseGateHop:])
+		copy(g.frame[noiseGateHop:], g.pending[:noiseGateHop])
+		g.pending = g.pending[noiseGateHop:]
+
+		processed := g.processFrame()
+		for i := 0; i < noiseGateHop; i++ {
+			out = append(out, g.overlap[i]+processed[i])
+		}
+		copy(g.overlap, processed[noiseGateHop:])
+	}
+	// 复制剩余的输入，避免一直引用越来越大的底层数组
+	g.pending = append([]float64(nil), g.pending...)
+	return out
+}
+
+func (g *spectralGate) processFrame() []float64 {
+	spectrum := make([]complex128, noiseGateFrameSize)
+	for i, sample := range g.frame {
+		spectrum[i] = complex(sample*g.window[i], 0)
+	}
+	fft(spectrum, false)
+
+	if g.noise == nil {
+		g.noise = make([]float64, noiseGateFrameSize)
+		for i, bin := range spectrum {
+			g.noise[i] = cmplx.Abs(bin)
+		}
+	}
+	for i, bin := range spectrum {
+		magnitude := cmplx.Abs(bin)
+		if magnitude < g.noise[i] {
+			g.noise[i] = magnitude
+		} else {
+			g.noise[i] += (magnitude - g.noise[i]) * noiseFloorRise
+		}
+		if magnitude < g.noise[i]*g.ratio {
+			spectrum[i] = bin * noiseGateAttenuation
+		}
+	}
+
+	fft(spectrum, true)
+	frame := make([]float64, noiseGateFrameSize)
+	for i, bin := range spectrum {
+		frame[i] = real(bin) * g.window[i]
+	}
+	return frame
+}
+
+// fft 原地计算长度为2的幂的离散傅里叶变换，inverse 为 true 时计算逆变换（含 1/n 缩放）
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], x[start+k+size/2]*w
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+
+	if inverse {
+		for i := range x {
+			x[i] /= complex(float64(n), 0)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// sineFrames 生成指定幅度 (0-1) 的正弦波，按20ms切分为帧
+func sineFrames(freq, amplitude float64, seconds float64) [][]int16 {
+	frameSize := sttSampleRate / 50
+	frames := make([][]int16, int(seconds*50))
+	for f := range frames {
+		frame := make([]int16, frameSize)
+		for i := range frame {
+			n := float64(f*frameSize + i)
+			frame[i] = int16(amplitude * 32767 * math.Sin(2*math.Pi*freq*n/sttSampleRate))
+		}
+		frames[f] = frame
+	}
+	return frames
+}
+
+func peak(pcm []int16) int {
+	var highest int
+	for _, sample := range pcm {
+		highest = max(highest, int(math.Abs(float64(sample))))
+	}
+	return highest
+}
+
+func TestAutoGainReachesTargetRMS(t *testing.T) {
+	preprocessor := newAudioPreprocessor(PreprocessConfig{AGC: true, TargetRMS: 0.1, MaxGain: 20})
+
+	// 幅度 0.02 的正弦波均方根约 0.014，需要放大约7倍
+	var last []int16
+	for _, frame := range sineFrames(440, 0.02, 1) {
+		last = preprocessor.Process(frame)
+		if p := peak(last); p >= 32767 {
+			t.Fatalf("output clipped: peak %d", p)
+		}
+	}
+
+	if level := rms(last); math.Abs(level-0.1) > 0.01 {
+		t.Errorf("rms after agc = %.4f, want about 0.1", level)
+	}
+}
+
+func TestAutoGainDoesNotClipPeaks(t *testing.T) {
+	preprocessor := newAudioPreprocessor(PreprocessConfig{AGC: true, TargetRMS: 0.3, MaxGain: 20})
+
+	// 先用安静的信号把增益拉高，再突然出现接近满幅的尖峰
+	for _, frame := range sineFrames(440, 0.02, 1) {
+		preprocessor.Process(frame)
+	}
+	spike := make([]int16, sttSampleRate/50)
+	spike[10] = 30000
+	spike[11] = -30000
+
+	limit := agcPeakLimit * 32768
+	if p := peak(preprocessor.Process(spike)); float64(p) > limit+1 {
+		t.Errorf("spike peak = %d, want at most %.0f", p, limit)
+	}
+}
+
+func TestAutoGainIgnoresSilence(t *testing.T) {
+	preprocessor := newAudioPreprocessor(PreprocessConfig{AGC: true})
+
+	silence := toneFrame(10)
+	out := preprocessor.Process(silence)
+	if peak(out) != 10 {
+		t.Errorf("silence amplified to peak %d", peak(out))
+	}
+}
+
+func TestHighPassRemovesHum(t *testing.T) {
+	preprocessor := newAudioPreprocessor(PreprocessConfig{HighPass: true, HighPassCutoff: 100})
+
+	var hum, voice []int16
+	for _, frame := range sineFrames(20, 0.5, 1) {
+		hum = preprocessor.Process(frame)
+	}
+	preprocessor = newAudioPreprocessor(PreprocessConfig{HighPass: true, HighPassCutoff: 100})
+	for _, frame := range sineFrames(1000, 0.5, 1) {
+		voice = preprocessor.Process(frame)
+	}
+
+	if level := rms(hum); level > 0.05 {
+		t.Errorf("20Hz hum rms after filter = %.4f, want below 0.05", level)
+	}
+	if level := rms(voice); level < 0.33 {
+		t.Errorf("1kHz tone rms after filter = %.4f, want about 0.35", level)
+	}
+}
+
+func TestSpectralGate(t *testing.T) {
+	preprocessor := newAudioPreprocessor(PreprocessConfig{NoiseGate: true})
+
+	// 稳定的低电平噪声被衰减，之后出现的响亮语音基本不受影响
+	var samples int
+	var noise, voice []int16
+	for _, frame := range sineFrames(300, 0.01, 1) {
+		noise = preprocessor.Process(frame)
+		samples += len(noise)
+	}
+	for _, frame := range sineFrames(1000, 0.5, 0.5) {
+		voice = preprocessor.Process(frame)
+		samples += len(voice)
+	}
+
+	if want := 75 * sttSampleRate / 50; samples < want-noiseGateFrameSize || samples > want {
+		t.Errorf("gate produced %d samples for %d input samples", samples, want)
+	}
+	if level := rms(noise); level > 0.002 {
+		t.Errorf("steady noise rms after gate = %.4f, want below 0.002", level)
+	}
+	if level := rms(voice); math.Abs(level-0.35) > 0.03 {
+		t.Errorf("voice rms after gate = %.4f, want about 0.35", level)
+	}
+}
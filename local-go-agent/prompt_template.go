@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// 历史摘要中最多包含的用户发言数
+const promptHistoryTurns = 3
+
+// PromptVars 是渲染系统提示词时可以使用的变量，如 {{.ParticipantName}}、{{.TimeOfDay}}
+type PromptVars struct {
+	// 参与者的显示名称，没有设置时为身份
+	ParticipantName     string
+	ParticipantIdentity string
+	RoomName            string
+	// 回复使用的语言代码
+	Language string
+	// 当前时间和时段（凌晨、上午、下午、晚上）
+	Now       time.Time
+	TimeOfDay string
+	// 参与者最近几次说的话，用 "；" 连接，没有历史时为空
+	HistorySummary string
+}
+
+// PromptTemplate 是用 text/template 编写的系统提示词，每轮对话按当时的变量渲染。
+// 不含模板语法的提示词原样输出
+type PromptTemplate struct {
+	tmpl *template.Template
+}
+
+// ParsePromptTemplate 解析系统提示词模板，并用示例变量试渲染一次，
+// 语法错误和不存在的变量在加载配置时就会报错
+func ParsePromptTemplate(text string) (*PromptTemplate, error) {
+	prompt, err := parsePromptTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := prompt.Render(PromptVars{Now: time.Now(), TimeOfDay: timeOfDay(time.Now())}); err != nil {
+		return nil, err
+	}
+	return prompt, nil
+}
+
+func parsePromptTemplate(text string) (*PromptTemplate, error) {
+	tmpl, err := template.New("system_prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("系统提示词模板无效: %w", err)
+	}
+	return &PromptTemplate{tmpl: tmpl}, nil
+}
+
+func (t *PromptTemplate) Render(vars PromptVars) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("渲染系统提示词失败: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func timeOfDay(now time.Time) string {
+	switch hour := now.Hour(); {
+	case hour < 6:
+		return "凌晨"
+	case hour < 12:
+		return "上午"
+	case hour < 18:
+		return "下午"
+	default:
+		return "晚上"
+	}
+}
+
+// historySummary 返回最近几次用户发言，供提示词模板引用
+func historySummary(messages []ChatMessage) string {
+	var recent []string
+	for i := len(messages) - 1; i >= 0 && len(recent) < promptHistoryTurns; i-- {
+		if messages[i].Role == ChatRoleUser {
+			recent = append([]string{messages[i].Content}, recent...)
+		}
+	}
+	return strings.Join(recent, "；")
+}
+
+// promptVars 收集本轮对话渲染提示词使用的变量
+func (a *AIAgent) promptVars(participant *lksdk.RemoteParticipant, speaker, language string) PromptVars {
+	now := time.Now()
+	vars := PromptVars{
+		RoomName:       a.config.LiveKit.RoomName,
+		Language:       language,
+		Now:            now,
+		TimeOfDay:      timeOfDay(now),
+		HistorySummary: historySummary(a.conversation(speaker).Messages()),
+	}
+	if participant != nil {
+		vars.ParticipantIdentity = participant.Identity()
+		vars.ParticipantName = participant.Name()
+		if vars.ParticipantName == "" {
+			vars.ParticipantName = participant.Identity()
+		}
+	}
+	return vars
+}
+
+// renderSystemPrompt 渲染人设的系统提示词模板，渲染失败时使用未渲染的提示词
+func (a *AIAgent) renderSystemPrompt(ctx context.Context, persona Persona, vars PromptVars) string {
+	prompt, err := parsePromptTemplate(persona.SystemPrompt)
+	if err == nil {
+		var rendered string
+		if rendered, err = prompt.Render(vars); err == nil {
+			return rendered
+		}
+	}
+	a.turnLogger(ctx).Errorf("系统提示词模板无效，使用原始提示词: %v", err)
+	return persona.SystemPrompt
+}
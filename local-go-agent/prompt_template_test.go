@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	prompt, err := ParsePromptTemplate("你是{{.RoomName}}的助手，现在是{{.TimeOfDay}} {{.Now.Format \"15:04\"}}，用户：{{.ParticipantName}}。最近：{{.HistorySummary}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := prompt.Render(PromptVars{
+		RoomName:        "客服",
+		ParticipantName: "小王",
+		Now:             time.Date(2024, 5, 1, 20, 30, 0, 0, time.Local),
+		TimeOfDay:       timeOfDay(time.Date(2024, 5, 1, 20, 30, 0, 0, time.Local)),
+		HistorySummary:  historySummary([]ChatMessage{{Role: ChatRoleUser, Content: "你好"}, {Role: ChatRoleAssistant, Content: "您好"}, {Role: ChatRoleUser, Content: "查订单"}}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "你是客服的助手，现在是晚上 20:30，用户：小王。最近：你好；查订单"; got != want {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+}
+
+func TestPromptTemplateFailsFast(t *testing.T) {
+	for _, text := range []string{"你好{{.RoomName", "你好{{.Unknown}}"} {
+		if _, err := ParsePromptTemplate(text); err == nil {
+			t.Errorf("ParsePromptTemplate(%q) should fail", text)
+		}
+		if err := (Persona{SystemPrompt: text}).validate(); err == nil {
+			t.Errorf("persona with %q should be invalid", text)
+		}
+	}
+}
+
+func TestSystemPromptRendersPerTurn(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	agent.config.LiveKit.RoomName = "lobby"
+	agent.setPersona(Persona{SystemPrompt: "房间 {{.RoomName}}，身份 {{.ParticipantIdentity}}", Language: "zh"})
+
+	prompt := agent.systemPrompt(context.Background(), &lksdk.RemoteParticipant{}, "", "")
+	if !strings.HasPrefix(prompt, "房间 lobby，身份 \n") {
+		t.Errorf("system prompt = %q", prompt)
+	}
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// PipelineMode 决定语音对话的处理方式
+type PipelineMode string
+
+const (
+	// PipelineModular 依次调用语音识别、语言模型和语音合成服务
+	PipelineModular PipelineMode = "modular"
+	// PipelineRealtime 把参与者的音频直接送入 OpenAI Realtime API，由同一个websocket会话完成识别、生成和合成，
+	// 延迟更低，不再使用 stt_provider、tts_provider 和对话队列
+	PipelineRealtime PipelineMode = "realtime"
+)
+
+func (m PipelineMode) validate() error {
+	switch m {
+	case "", PipelineModular, PipelineRealtime:
+		return nil
+	default:
+		return fmt.Errorf("未知的 pipeline %q，可选 modular 或 realtime", m)
+	}
+}
+
+const (
+	defaultRealtimeURL   = "wss://api.openai.com/v1/realtime"
+	defaultRealtimeModel = "gpt-4o-realtime-preview"
+	defaultRealtimeVoice = "alloy"
+	// Realtime API 的 pcm16 音频固定为24kHz单声道
+	realtimeSampleRate = 24000
+	// 等待处理的会话事件数量，音频事件不会丢弃，处理跟不上时读取等待
+	realtimeEventBuffer = 64
+	// 服务端识别参与者发言使用的模型
+	realtimeTranscriptionModel = "whisper-1"
+)
+
+// RealtimeConfig 是 pipeline 为 realtime 时 OpenAI Realtime API 的设置
+type RealtimeConfig struct {
+	// 为空时使用 openai.api_key
+	APIKey string `yaml:"api_key"`
+	Model  string `yaml:"model"`
+	// 合成使用的声音，如 alloy、verse、shimmer
+	Voice string `yaml:"voice"`
+	// websocket地址，使用代理或兼容服务时修改
+	URL string `yaml:"url"`
+	// 服务端判断一段发言结束所需的静音时长，0 使用服务端默认值
+	SilenceDuration time.Duration `yaml:"silence_duration"`
+	// 连接断开后重连的重试次数
+	Retries int `yaml:"retries"`
+}
+
+func (c RealtimeConfig) validate() error {
+	if c.SilenceDuration < 0 {
+		return fmt.Errorf("silence_duration 不能小于0")
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("retries 不能小于0")
+	}
+	if c.URL != "" {
+		if _, err := url.Parse(c.URL); err != nil {
+			return fmt.Errorf("url 格式错误: %w", err)
+		}
+	}
+	return nil
+}
+
+// RealtimeService 连接 OpenAI Realtime API，每个会话把一路参与者的音频转为代理的语音回复
+type RealtimeService struct {
+	apiKey  string
+	model   string
+	voice   string
+	url     string
+	silence time.Duration
+	retries int
+
+	logger *logrus.Entry
+	debug  *apiDebugger
+}
+
+// NewRealtimeService 创建 Realtime 服务，cfg.APIKey 为空时使用 apiKey
+func NewRealtimeService(cfg RealtimeConfig, apiKey string) *RealtimeService {
+	service := &RealtimeService{
+		apiKey:  cfg.APIKey,
+		model:   cfg.Model,
+		voice:   cfg.Voice,
+		url:     cfg.URL,
+		silence: cfg.SilenceDuration,
+		retries: cfg.Retries,
+		logger:  logrus.NewEntry(logrus.StandardLogger()),
+	}
+	if service.apiKey == "" {
+		service.apiKey = apiKey
+	}
+	if service.model == "" {
+		service.model = defaultRealtimeModel
+	}
+	if service.voice == "" {
+		service.voice = defaultRealtimeVoice
+	}
+	if service.url == "" {
+		service.url = defaultRealtimeURL
+	}
+	return service
+}
+
+// newRealtimeService 按配置创建 Realtime 服务，没有API密钥时返回 nil，语音对话改用 modular 流水线
+func newRealtimeService(cfg *Config, logger *logrus.Logger) *RealtimeService {
+	service := NewRealtimeService(cfg.Realtime, cfg.OpenAI.APIKey)
+	if service.apiKey == "" {
+		logger.Warn("pipeline 为 realtime 但未设置 realtime.api_key 或 OPENAI_API_KEY，改用 modular 流水线")
+		return nil
+	}
+	service.logger = logger.WithField("service", "OpenAI Realtime")
+	service.debug = newAPIDebugger(cfg.Log, logger, "OpenAI Realtime")
+	logger.Infof("OpenAI Realtime服务已初始化，模型 %s，声音 %s", service.model, service.voice)
+	return service
+}
+
+// RealtimeSessionConfig 是一个会话的设置，重连后重新发送
+type RealtimeSessionConfig struct {
+	// 系统提示词
+	Instructions string
+	// 为空时使用 realtime.voice
+	Voice string
+}
+
+// RealtimeEventType 是会话返回的事件类型
+type RealtimeEventType string
+
+const (
+	// RealtimeEventAudio 是一段合成的语音，Audio 为 realtimeSampleRate 的采样
+	RealtimeEventAudio RealtimeEventType = "audio"
+	// RealtimeEventSpeechStarted 表示服务端检测到参与者开始说话，正在播放的回复应停止
+	RealtimeEventSpeechStarted RealtimeEventType = "speech_started"
+	// RealtimeEventTranscript 是参与者一段发言的转录，Text 为转录文字，ItemID 为这段发言在会话中的对话项。
+	// 服务端不会自动回复，需要调用 Respond
+	RealtimeEventTranscript RealtimeEventType = "transcript"
+	// RealtimeEventResponseDelta 是回复文字新增的部分
+	RealtimeEventResponseDelta RealtimeEventType = "response_delta"
+	// RealtimeEventResponseDone 表示一条回复结束，Text 为完整的回复文字
+	RealtimeEventResponseDone RealtimeEventType = "response_done"
+	// RealtimeEventUsage 在每条回复结束时给出，包括被插话取消的回复，Usage 为这条回复的token用量
+	RealtimeEventUsage RealtimeEventType = "usage"
+	// RealtimeEventError 是服务端对某个请求返回的错误，Err 为 *realtimeError，会话仍然可用
+	RealtimeEventError RealtimeEventType = "error"
+)
+
+// RealtimeEvent 是会话返回的一个事件
+type RealtimeEvent struct {
+	Type   RealtimeEventType
+	Text   string
+	ItemID string
+	Audio  []float32
+	Usage  TokenUsage
+	Err    error
+}
+
+// realtimeServerEvent 是 Realtime API 返回的消息，只解析用到的字段
+type realtimeServerEvent struct {
+	Type       string `json:"type"`
+	Delta      string `json:"delta"`
+	Transcript string `json:"transcript"`
+	ItemID     string `json:"item_id"`
+	Response   struct {
+		Usage struct {
+			InputTokens  int64 `json:"input_tokens"`
+			OutputTokens int64 `json:"output_tokens"`
+		} `json:"usage"`
+	} `json:"response"`
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+var errRealtimeSessionClosed = errors.New("Realtime会话已关闭")
+
+// Connect 打开一个会话，在后台建立连接并发送会话设置，不阻塞调用方。连接建立前写入的音频被丢弃，
+// 连接失败后 Write 返回错误。连接意外断开时自动重连并重新发送设置，
+// 服务端保存的对话上下文会丢失，重连期间写入的音频被丢弃
+func (s *RealtimeService) Connect(ctx context.Context, cfg RealtimeSessionConfig) (*realtimeSession, error) {
+	if _, err := s.endpoint(); err != nil {
+		return nil, err
+	}
+	if cfg.Voice == "" {
+		cfg.Voice = s.voice
+	}
+	session := &realtimeSession{
+		service: s,
+		config:  cfg,
+		events:  make(chan RealtimeEvent, realtimeEventBuffer),
+		closed:  make(chan struct{}),
+	}
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	started := goTracked(ctx, func() {
+		defer stop()
+		session.receive(ctx)
+	})
+	if !started {
+		stop()
+		return nil, errSupervisorClosed
+	}
+	return session, nil
+}
+
+func (s *RealtimeService) endpoint() (string, error) {
+	endpoint, err := url.Parse(s.url)
+	if err != nil {
+		return "", fmt.Errorf("Realtime地址错误: %v", err)
+	}
+	query := endpoint.Query()
+	query.Set("model", s.model)
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// realtimeSession 是一次 Realtime 会话
+type realtimeSession struct {
+	service *RealtimeService
+	config  RealtimeSessionConfig
+	events  chan RealtimeEvent
+
+	mu sync.Mutex
+	// 连接建立前和重连期间为 nil
+	conn *websocket.Conn
+	// 当前连接上已经记录过发送失败，同一次断线只记录一次
+	writeFailed bool
+	// 重连失败等无法恢复的错误
+	err error
+
+	closed chan struct{}
+	once   sync.Once
+}
+
+// dial 建立连接并发送会话设置
+func (s *realtimeSession) dial(ctx context.Context) (*websocket.Conn, error) {
+	endpoint, err := s.service.endpoint()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+s.service.apiKey)
+	header.Set("OpenAI-Beta", "realtime=v1")
+	s.service.debug.logDial(endpoint)
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		if resp != nil {
+			return nil, classifyServiceError("OpenAI Realtime", resp.StatusCode, fmt.Errorf("连接OpenAI Realtime失败，状态 %d: %w", resp.StatusCode, err))
+		}
+		return nil, classifyServiceError("OpenAI Realtime", 0, fmt.Errorf("连接OpenAI Realtime失败: %w", err))
+	}
+	if err := conn.WriteJSON(s.sessionUpdate()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("发送Realtime会话设置失败: %w", err)
+	}
+	return conn, nil
+}
+
+// sessionUpdate 返回 session.update 消息：收发 pcm16 音频，由服务端检测发言结束并识别，
+// 代理检查唤醒词、过滤和预算后再调用 Respond 回复
+func (s *realtimeSession) sessionUpdate() map[string]any {
+	turnDetection := map[string]any{"type": "server_vad", "create_response": false}
+	if s.service.silence > 0 {
+		turnDetection["silence_duration_ms"] = s.service.silence.Milliseconds()
+	}
+	return map[string]any{
+		"type": "session.update",
+		"session": map[string]any{
+			"modalities":                []string{"audio", "text"},
+			"instructions":              s.config.Instructions,
+			"voice":                     s.config.Voice,
+			"input_audio_format":        "pcm16",
+			"output_audio_format":       "pcm16",
+			"input_audio_transcription": map[string]string{"model": realtimeTranscriptionModel},
+			"turn_detection":            turnDetection,
+		},
+	}
+}
+
+// Write 发送一段 sttSampleRate 的PCM，连接建立前和重连期间丢弃
+func (s *realtimeSession) Write(pcm []int16) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if s.isClosed() {
+		return errRealtimeSessionClosed
+	}
+	if s.conn == nil {
+		return nil
+	}
+	samples := resample(s16leToFloat32(int16ToBytes(pcm)), sttSampleRate, realtimeSampleRate)
+	// 发送失败说明连接已断开，接收协程会发现并重连
+	err := s.conn.WriteJSON(map[string]string{
+		"type":  "input_audio_buffer.append",
+		"audio": base64.StdEncoding.EncodeToString(int16ToBytes(float32ToInt16(samples))),
+	})
+	if err != nil && !s.writeFailed {
+		s.writeFailed = true
+		s.service.logger.Warnf("发送Realtime音频失败，等待重连: %v", err)
+	}
+	return nil
+}
+
+// Respond 请求服务端回复参与者刚才的发言
+func (s *realtimeSession) Respond() error {
+	return s.send(map[string]string{"type": "response.create"})
+}
+
+// Discard 从会话的对话上下文中删除一段不回复的发言，之后的回复不会参考它
+func (s *realtimeSession) Discard(itemID string) error {
+	if itemID == "" {
+		return nil
+	}
+	return s.send(map[string]string{"type": "conversation.item.delete", "item_id": itemID})
+}
+
+// send 发送一条客户端消息，重连期间返回错误
+func (s *realtimeSession) send(message any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	if s.isClosed() {
+		return errRealtimeSessionClosed
+	}
+	if s.conn == nil {
+		return errors.New("Realtime会话正在重连")
+	}
+	return s.conn.WriteJSON(message)
+}
+
+// Events 返回会话事件，会话关闭后关闭
+func (s *realtimeSession) Events() <-chan RealtimeEvent {
+	return s.events
+}
+
+// Err 返回导致会话结束的错误，主动关闭时为 nil
+func (s *realtimeSession) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Close 关闭会话
+func (s *realtimeSession) Close() error {
+	var err error
+	s.once.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		close(s.closed)
+		if s.conn != nil {
+			err = s.conn.Close()
+		}
+	})
+	return err
+}
+
+func (s *realtimeSession) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// receive 建立连接并读取会话事件，连接意外断开时重连，直到会话关闭或无法恢复
+func (s *realtimeSession) receive(ctx context.Context) {
+	defer close(s.events)
+
+	if err := s.connect(ctx); err != nil {
+		s.fail(err)
+		return
+	}
+	for {
+		s.mu.Lock()
+		conn := s.conn
+		s.mu.Unlock()
+		if conn == nil {
+			// 连接建立之前会话已经关闭
+			return
+		}
+
+		err := s.read(conn)
+		if s.isClosed() || ctx.Err() != nil {
+			return
+		}
+		if !isTransientStreamError(err) {
+			s.fail(fmt.Errorf("OpenAI Realtime会话失败: %w", err))
+			return
+		}
+		if err := s.reconnect(ctx, err); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// read 读取一条连接上的消息直到出错
+func (s *realtimeSession) read(conn *websocket.Conn) error {
+	for {
+		var message realtimeServerEvent
+		if err := conn.ReadJSON(&message); err != nil {
+			return err
+		}
+		switch message.Type {
+		case "response.audio.delta":
+			data, err := base64.StdEncoding.DecodeString(message.Delta)
+			if err != nil {
+				return fmt.Errorf("解析Realtime音频失败: %w", err)
+			}
+			s.emit(RealtimeEvent{Type: RealtimeEventAudio, Audio: s16leToFloat32(data)})
+		case "input_audio_buffer.speech_started":
+			s.emit(RealtimeEvent{Type: RealtimeEventSpeechStarted})
+		case "conversation.item.input_audio_transcription.completed":
+			s.emit(RealtimeEvent{Type: RealtimeEventTranscript, Text: message.Transcript, ItemID: message.ItemID})
+		case "response.audio_transcript.delta":
+			s.emit(RealtimeEvent{Type: RealtimeEventResponseDelta, Text: message.Delta})
+		case "response.audio_transcript.done":
+			s.emit(RealtimeEvent{Type: RealtimeEventResponseDone, Text: message.Transcript})
+		case "response.done":
+			usage := message.Response.Usage
+			s.emit(RealtimeEvent{Type: RealtimeEventUsage, Usage: TokenUsage{PromptTokens: usage.InputTokens, CompletionTokens: usage.OutputTokens}})
+		case "error":
+			s.emit(RealtimeEvent{Type: RealtimeEventError, Err: &realtimeError{Code: message.Error.Code, Message: message.Error.Message}})
+		}
+	}
+}
+
+// realtimeError 是服务端在会话中返回的错误
+type realtimeError struct {
+	Code    string
+	Message string
+}
+
+func (e *realtimeError) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (s *realtimeSession) emit(event RealtimeEvent) {
+	select {
+	case s.events <- event:
+	case <-s.closed:
+	}
+}
+
+// reconnect 重新建立连接并发送会话设置
+func (s *realtimeSession) reconnect(ctx context.Context, cause error) error {
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.mu.Unlock()
+
+	err := retryTransient(ctx, s.service.retries, isTransientDialError, func() error {
+		return s.connect(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("OpenAI Realtime断开后重连失败 (%v): %w", cause, err)
+	}
+	return nil
+}
+
+// connect 建立连接并发送会话设置
+func (s *realtimeSession) connect(ctx context.Context) error {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isClosed() {
+		conn.Close()
+		return nil
+	}
+	s.conn = conn
+	s.writeFailed = false
+	return nil
+}
+
+func (s *realtimeSession) fail(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	s.Close()
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func newTestRealtimeService(t *testing.T, handler func(conn *websocket.Conn, r *http.Request)) *RealtimeService {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		defer conn.Close()
+		handler(conn, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewRealtimeService(RealtimeConfig{
+		APIKey:  "test-key",
+		Voice:   "verse",
+		URL:     "ws" + strings.TrimPrefix(server.URL, "http"),
+		Retries: 1,
+	}, "")
+}
+
+// readRealtimeMessage 读取一条客户端消息，返回消息类型和内容
+func readRealtimeMessage(t *testing.T, conn *websocket.Conn) (string, map[string]any) {
+	var message map[string]any
+	if err := conn.ReadJSON(&message); err != nil {
+		return "", nil
+	}
+	kind, _ := message["type"].(string)
+	return kind, message
+}
+
+func realtimeAudioDelta(samples int) map[string]any {
+	return map[string]any{"type": "response.audio.delta", "delta": base64.StdEncoding.EncodeToString(make([]byte, samples*2))}
+}
+
+func TestRealtimePipelineSpeaksResponse(t *testing.T) {
+	var session map[string]any
+	appended := make(chan int, 1)
+	service := newTestRealtimeService(t, func(conn *websocket.Conn, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("authorization = %q", got)
+		}
+		if got := r.URL.Query().Get("model"); got != defaultRealtimeModel {
+			t.Errorf("model = %q", got)
+		}
+		kind, message := readRealtimeMessage(t, conn)
+		if kind != "session.update" {
+			t.Errorf("first message = %q, want session.update", kind)
+		}
+		session, _ = message["session"].(map[string]any)
+
+		kind, message = readRealtimeMessage(t, conn)
+		if kind != "input_audio_buffer.append" {
+			t.Errorf("second message = %q, want input_audio_buffer.append", kind)
+		}
+		audio, _ := base64.StdEncoding.DecodeString(message["audio"].(string))
+		appended <- len(audio)
+
+		conn.WriteJSON(map[string]any{"type": "input_audio_buffer.speech_started"})
+		conn.WriteJSON(map[string]any{"type": "conversation.item.input_audio_transcription.completed", "item_id": "item_1", "transcript": "你好"})
+		// 代理检查过发言后才请求回复
+		kind, _ = readRealtimeMessage(t, conn)
+		for kind == "input_audio_buffer.append" {
+			kind, _ = readRealtimeMessage(t, conn)
+		}
+		if kind != "response.create" {
+			t.Errorf("message after the transcript = %q, want response.create", kind)
+		}
+		conn.WriteJSON(realtimeAudioDelta(realtimeSampleRate / 50))
+		conn.WriteJSON(map[string]any{"type": "response.audio_transcript.delta", "delta": "你好，"})
+		conn.WriteJSON(map[string]any{"type": "response.audio_transcript.done", "transcript": "你好，有什么可以帮你？"})
+		conn.WriteJSON(map[string]any{"type": "response.done", "response": map[string]any{"usage": map[string]any{"input_tokens": 30, "output_tokens": 12}}})
+		conn.ReadMessage()
+	})
+
+	agent, publisher := newTestAgent(&AIServices{Realtime: service})
+	agent.captions = newCaptionThrottle(0, agent.sendCaption)
+	agent.budget = newTokenBudget(1000, 0)
+	output := &recordingOutput{}
+	agent.audioOut = output
+	if !agent.listensToAudio() {
+		t.Error("realtime pipeline does not listen to audio without a speech-to-text service")
+	}
+
+	responses := make(chan ResponseEvent, 1)
+	agent.OnResponse(func(event ResponseEvent) { responses <- event })
+	var transcripts []string
+	var mu sync.Mutex
+	agent.OnTranscript(func(event TranscriptEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		transcripts = append(transcripts, event.Text)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ingest := agent.newAudioIngest(&lksdk.RemoteParticipant{}, "track")
+	defer ingest.Close()
+	// 会话在后台连接，连接建立前的音频被丢弃
+	var got int
+	for got == 0 {
+		if ingest.Push(ctx, toneFrame(8000)) {
+			t.Error("realtime audio was segmented locally")
+		}
+		select {
+		case got = <-appended:
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	// 20ms 的16kHz音频重采样到24kHz发送
+	if want := realtimeSampleRate / 50 * 2; got != want {
+		t.Errorf("appended %d bytes, want %d", got, want)
+	}
+	select {
+	case event := <-responses:
+		if event.Text != "你好，有什么可以帮你？" {
+			t.Errorf("response = %q", event.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response from the realtime session")
+	}
+
+	if session["voice"] != "verse" || !strings.Contains(session["instructions"].(string), agent.config.Persona.SystemPrompt) {
+		t.Errorf("session = %v, want the persona prompt and configured voice", session)
+	}
+	if detection, _ := session["turn_detection"].(map[string]any); detection["create_response"] != false {
+		t.Errorf("turn_detection = %v, want replies requested by the agent", session["turn_detection"])
+	}
+	if history := agent.conversation("").Messages(); len(history) != 2 || history[1].Content != "你好，有什么可以帮你？" {
+		t.Errorf("history = %+v, want the realtime turn", history)
+	}
+	for deadline := time.Now().Add(5 * time.Second); agent.budget.Usage().Used == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if used := agent.budget.Usage().Used; used != 42 {
+		t.Errorf("budget used %d tokens, want the 42 the response reported", used)
+	}
+	mu.Lock()
+	if len(transcripts) != 1 || transcripts[0] != "你好" {
+		t.Errorf("transcripts = %v", transcripts)
+	}
+	mu.Unlock()
+	if got := output.durations; len(got) != 1 || got[0] != 20*time.Millisecond {
+		t.Errorf("played %v, want the 20ms of realtime audio", got)
+	}
+	captions := publisher.Captions()
+	if last := captions[len(captions)-1]; last.Type != captionTypeResponse || !last.Final {
+		t.Errorf("last caption = %+v, want the final response", last)
+	}
+}
+
+func TestRealtimePipelineChecksTranscripts(t *testing.T) {
+	requests := make(chan map[string]any, 2)
+	service := newTestRealtimeService(t, func(conn *websocket.Conn, r *http.Request) {
+		readRealtimeMessage(t, conn)
+		conn.WriteJSON(map[string]any{"type": "conversation.item.input_audio_transcription.completed", "item_id": "item_1", "transcript": "今天天气不错"})
+		conn.WriteJSON(map[string]any{"type": "conversation.item.input_audio_transcription.completed", "item_id": "item_2", "transcript": "小助手，讲个笑话"})
+		for len(requests) < cap(requests) {
+			kind, message := readRealtimeMessage(t, conn)
+			if kind == "" {
+				return
+			}
+			if kind != "input_audio_buffer.append" {
+				requests <- message
+			}
+		}
+		conn.ReadMessage()
+	})
+
+	agent, _ := newTestAgent(&AIServices{Realtime: service})
+	agent.config.WakeWord.Phrases = []string{"小助手"}
+	agent.wakeWords = wakeWordPatterns(agent.config.WakeWord.Phrases)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ingest := agent.newAudioIngest(&lksdk.RemoteParticipant{}, "track")
+	defer ingest.Close()
+	ingest.Push(ctx, toneFrame(8000))
+
+	// 没有唤醒词的发言从会话中删除，不请求回复；说了唤醒词的发言才请求回复
+	for _, want := range []string{"conversation.item.delete", "response.create"} {
+		select {
+		case message := <-requests:
+			if message["type"] != want {
+				t.Errorf("request = %v, want %s", message, want)
+			}
+			if want == "conversation.item.delete" && message["item_id"] != "item_1" {
+				t.Errorf("deleted %v, want the utterance without the wake word", message["item_id"])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s request", want)
+		}
+	}
+}
+
+func TestRealtimeConnectFailureFallsBackToModular(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	service := NewRealtimeService(RealtimeConfig{APIKey: "bad-key", URL: "ws" + strings.TrimPrefix(server.URL, "http")}, "")
+	agent, _ := newTestAgent(&AIServices{Realtime: service})
+	turns := agent.newRealtimeTurns(&lksdk.RemoteParticipant{})
+	defer turns.Close()
+
+	// 连接在后台建立，写入不会等待；连接失败后改为 modular 流水线
+	ctx := context.Background()
+	deadline := time.Now().Add(5 * time.Second)
+	for turns.Write(ctx, toneFrame(8000)) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !turns.failed {
+		t.Error("audio still went to the realtime session after the connection failed")
+	}
+	agent.tasks.Wait()
+}
+
+func TestRealtimeSessionReconnects(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+	service := newTestRealtimeService(t, func(conn *websocket.Conn, r *http.Request) {
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+
+		if kind, _ := readRealtimeMessage(t, conn); kind != "session.update" {
+			t.Errorf("connection %d began with %q, want session.update", n, kind)
+		}
+		if n == 1 {
+			// 连接意外断开
+			conn.UnderlyingConn().Close()
+			return
+		}
+		conn.WriteJSON(map[string]any{"type": "response.audio_transcript.done", "transcript": "Done."})
+		conn.ReadMessage()
+	})
+
+	session, err := service.Connect(context.Background(), RealtimeSessionConfig{Instructions: "be brief"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	select {
+	case event := <-session.Events():
+		if event.Type != RealtimeEventResponseDone || event.Text != "Done." {
+			t.Errorf("event = %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not reconnect")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if connections != 2 {
+		t.Errorf("connections = %d, want 2", connections)
+	}
+}
+
+func TestRealtimeSessionReportsServerErrors(t *testing.T) {
+	service := newTestRealtimeService(t, func(conn *websocket.Conn, r *http.Request) {
+		readRealtimeMessage(t, conn)
+		conn.WriteJSON(map[string]any{"type": "error", "error": map[string]any{"code": "invalid_value", "message": "bad voice"}})
+		conn.WriteJSON(map[string]any{"type": "response.audio_transcript.done", "transcript": "still here"})
+		conn.ReadMessage()
+	})
+	session, err := service.Connect(context.Background(), RealtimeSessionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	event := <-session.Events()
+	if event.Type != RealtimeEventError || !strings.Contains(event.Err.Error(), "bad voice") {
+		t.Errorf("event = %+v, want the server error", event)
+	}
+	if event := <-session.Events(); event.Type != RealtimeEventResponseDone {
+		t.Errorf("session stopped after a server error, got %+v", event)
+	}
+}
+
+func TestRealtimePipelineConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LiveKit.APIKey = "key"
+	cfg.LiveKit.APISecret = "secret"
+	cfg.Pipeline = PipelineRealtime
+	if missing := strings.Join(cfg.missingKeys(), ","); missing != "realtime.api_key" {
+		t.Errorf("missing keys = %s", missing)
+	}
+	cfg.OpenAI.APIKey = "key"
+	if missing := cfg.missingKeys(); len(missing) != 0 {
+		t.Errorf("missing keys with openai.api_key = %v", missing)
+	}
+
+	if err := PipelineMode("hybrid").validate(); err == nil {
+		t.Error("validate accepted an unknown pipeline")
+	}
+	if service := NewRealtimeService(cfg.Realtime, cfg.OpenAI.APIKey); service.apiKey != "key" || service.url != defaultRealtimeURL {
+		t.Errorf("service = %+v, want openai.api_key and the default url", service)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// realtimeTurns 把参与者的音频持续送入 OpenAI Realtime 会话，识别、回复和合成都由会话完成，
+// 返回的语音直接发布到语音轨道，代替本地切分发言和对话队列
+type realtimeTurns struct {
+	agent       *AIAgent
+	participant *lksdk.RemoteParticipant
+
+	session *realtimeSession
+	// 会话无法打开或无法恢复后不再打开，之后的音频按 modular 流水线处理
+	failed bool
+}
+
+// newRealtimeTurns 在 pipeline 为 realtime 时返回 realtimeTurns，否则返回 nil。
+// 回声模式直接回放音频，不使用 Realtime 会话
+func (a *AIAgent) newRealtimeTurns(participant *lksdk.RemoteParticipant) *realtimeTurns {
+	if a.realtime == nil || a.config.Echo.Mode != EchoModeOff {
+		return nil
+	}
+	return &realtimeTurns{agent: a, participant: participant}
+}
+
+// Write 把一帧预处理后的音频送入 Realtime 会话，返回 false 时调用方按 modular 流水线处理
+func (t *realtimeTurns) Write(ctx context.Context, pcm []int16) bool {
+	if t == nil || t.failed {
+		return false
+	}
+	identity := t.participant.Identity()
+	if t.session == nil {
+		language := t.agent.participantLanguage(identity)
+		// 连接在后台建立，之前的音频被丢弃；连接失败时下一次写入返回错误，改为 modular 流水线
+		session, err := t.agent.realtime.Connect(ctx, RealtimeSessionConfig{
+			Instructions: t.agent.systemPrompt(ctx, t.participant, identity, language),
+		})
+		if err != nil {
+			t.agent.logger.Errorf("打开 %s 的Realtime会话失败，改为分别调用识别、生成和合成: %v", identity, err)
+			t.agent.emitError(identity, err)
+			t.failed = true
+			return false
+		}
+		if !t.agent.spawn("Realtime会话", func() { t.receive(ctx, session) }) {
+			session.Close()
+			t.failed = true
+			return false
+		}
+		t.agent.logger.Infof("已为 %s 打开Realtime会话", identity)
+		t.session = session
+	}
+	if err := t.session.Write(pcm); err != nil {
+		t.agent.logger.Errorf("%s 的Realtime会话中断，改为分别调用识别、生成和合成: %v", identity, err)
+		t.Close()
+		t.failed = true
+		return false
+	}
+	return true
+}
+
+// accept 按 modular 流水线的规则决定是否回复参与者的一段发言，返回去掉唤醒词后的文字
+func (t *realtimeTurns) accept(ctx context.Context, text string) (string, bool) {
+	a := t.agent
+	transcript, ok := a.passWakeWord(ctx, t.participant, Transcript{Text: strings.TrimSpace(text), Final: true})
+	if !ok {
+		return "", false
+	}
+	if ok, reason := filterTranscript(transcript, a.config.Audio); !ok {
+		a.logger.Infof("%s，跳过处理: %q", reason, transcript.Text)
+		return "", false
+	}
+	if a.budgetExceeded() {
+		a.logger.Warn("LLM token预算已用完，不再请求Realtime回复")
+		a.sendTextMessage(budgetExceededReply)
+		return "", false
+	}
+	return transcript.Text, true
+}
+
+// Close 结束 Realtime 会话
+func (t *realtimeTurns) Close() {
+	if t == nil || t.session == nil {
+		return
+	}
+	t.session.Close()
+	t.session = nil
+}
+
+// receive 播放会话返回的语音，发布字幕和事件，直到会话关闭。发言与 modular 流水线一样经过唤醒词、
+// 过滤、token预算和同时进行的对话数量的检查后才请求回复，回复经过回复中间件后记入对话历史
+func (t *realtimeTurns) receive(ctx context.Context, session *realtimeSession) {
+	a := t.agent
+	identity := t.participant.Identity()
+	logger := a.logger.WithField("participant", identity)
+	// 每条回复单独一个播放上下文，参与者插话时停止的只是正在播放的回复
+	playback := withPlayback(ctx)
+	speaking := false
+	var userText string
+	var reply strings.Builder
+	// 已请求还没结束的回复，有回复进行中时占用一个对话名额
+	responses := 0
+	defer func() {
+		if responses > 0 {
+			a.limiter.release()
+		}
+	}()
+
+	endSpeech := func() {
+		if speaking {
+			speaking = false
+			a.emit(AgentEvent{Type: EventSpeechEnded, ParticipantIdentity: identity})
+		}
+	}
+	for event := range session.Events() {
+		switch event.Type {
+		case RealtimeEventAudio:
+			if !speaking {
+				speaking = true
+				a.emit(AgentEvent{Type: EventSpeechStarted, ParticipantIdentity: identity})
+			}
+			a.sendAudioMessage(playback, event.Audio, realtimeSampleRate, t.participant)
+		case RealtimeEventSpeechStarted:
+			// 服务端检测到插话后会取消正在生成的回复，已经排队的音频在这里淡出
+			stopPlayback(playback)
+			playback = withPlayback(ctx)
+			endSpeech()
+		case RealtimeEventTranscript:
+			text, ok := t.accept(ctx, event.Text)
+			if !ok {
+				if err := session.Discard(event.ItemID); err != nil {
+					logger.Warnf("删除不回复的发言失败: %v", err)
+				}
+				continue
+			}
+			if responses == 0 {
+				if err := a.limiter.acquire(ctx, logger); err != nil {
+					continue
+				}
+			}
+			if err := session.Respond(); err != nil {
+				logger.Errorf("请求Realtime回复失败: %v", err)
+				if responses == 0 {
+					a.limiter.release()
+				}
+				continue
+			}
+			responses++
+			userText = text
+			a.logger.Infof("%s 说: %s", identity, userText)
+			a.emit(AgentEvent{Type: EventTranscriptReceived, ParticipantIdentity: identity, Text: userText})
+			a.publishCaption(captionTypeTranscript, identity, userText, true)
+		case RealtimeEventResponseDelta:
+			reply.WriteString(event.Text)
+			a.publishCaption(captionTypeResponse, identity, reply.String(), false)
+		case RealtimeEventResponseDone:
+			reply.Reset()
+			// 语音已经在播放，中间件只能处理字幕和历史中的文字；拒绝时停止还没播完的语音
+			text, ok := a.filterResponse(ctx, t.participant, event.Text)
+			if !ok {
+				stopPlayback(playback)
+				playback = withPlayback(ctx)
+				text = middlewareFallbackReply
+				a.sendTextMessage(text)
+			}
+			if ok && userText != "" {
+				history := a.conversation(identity)
+				history.Append(userText, text)
+				a.summarizeHistory(ctx, identity, history)
+			}
+			a.logger.Infof("AI回复: %s", text)
+			a.emit(AgentEvent{Type: EventResponseGenerated, ParticipantIdentity: identity, Text: text})
+			a.publishCaption(captionTypeResponse, identity, text, true)
+			a.saveTurn(ctx, identity, userText, text)
+			userText = ""
+			endSpeech()
+		case RealtimeEventUsage:
+			a.recordUsage(ctx, event.Usage)
+			if responses > 0 {
+				responses--
+				if responses == 0 {
+					a.limiter.release()
+				}
+			}
+		case RealtimeEventError:
+			a.logger.Errorf("%s 的Realtime会话返回错误: %v", identity, event.Err)
+			a.emitError(identity, event.Err)
+		}
+	}
+	endSpeech()
+	if err := session.Err(); err != nil && ctx.Err() == nil {
+		a.logger.Errorf("%s 的Realtime会话结束: %v", identity, err)
+		a.emitError(identity, err)
+	}
+}
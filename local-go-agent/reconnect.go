@@ -0,0 +1,55 @@
+package main
+
+import "time"
+
+const (
+	initialReconnectBackoff = 1 * time.Second
+	maxReconnectBackoff     = 30 * time.Second
+)
+
+// reconnectLoop 在意外断线后按指数退避重新连接房间，直到成功或代理被主动关闭。
+// 调用方已把状态切换为 StateReconnecting
+func (a *AIAgent) reconnectLoop() {
+	backoff := initialReconnectBackoff
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if a.closing.Load() {
+			return
+		}
+
+		a.logger.Infof("尝试重新连接房间 (第%d次)", attempt)
+		if err := a.connectRoom(); err != nil {
+			a.logger.Errorf("重新连接失败: %v", err)
+			backoff = min(backoff*2, maxReconnectBackoff)
+			continue
+		}
+
+		// 重连期间开始关闭时保持关闭的状态，并离开刚连上的房间
+		if !a.compareAndSetState(StateReconnecting, StateConnected) {
+			a.closeRoom()
+			return
+		}
+		a.restoreParticipants()
+		a.logger.Info("已重新连接到LiveKit房间")
+		return
+	}
+}
+
+// restoreParticipants 根据当前连接中已存在的参与者重建参与者列表和个人偏好，不会发送欢迎消息，
+// 房间为空时开始空闲倒计时。
+// 音频轨道会由自动订阅重新触发 onTrackSubscribed，从而恢复音频处理。
+func (a *AIAgent) restoreParticipants() {
+	participants := a.room.GetRemoteParticipants()
+	for _, participant := range participants {
+		a.loadParticipantSettings(participant)
+		a.markGreeted(participant.Identity())
+	}
+	a.replaceParticipants(participants)
+	a.logger.Infof("已恢复 %d 个参与者", len(participants))
+	a.checkIdle()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// participantRecording 保存一个参与者听到的（输入）和代理说出的（输出）两路录音
+type participantRecording struct {
+	incoming *wavWriter
+	outgoing *wavWriter
+}
+
+// Recorder 按参与者把输入和输出音频流式写入带时间戳的WAV文件，不在内存中缓存整段音频
+type Recorder struct {
+	dir string
+
+	mu         sync.Mutex
+	recordings map[string]*participantRecording
+	closed     bool
+}
+
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建录音目录失败: %w", err)
+	}
+	return &Recorder{dir: dir, recordings: make(map[string]*participantRecording)}, nil
+}
+
+func (r *Recorder) WriteIncoming(identity string, pcm []int16, sampleRate int) error {
+	return r.write(identity, "in", pcm, sampleRate)
+}
+
+func (r *Recorder) WriteOutgoing(identity string, pcm []int16, sampleRate int) error {
+	return r.write(identity, "out", pcm, sampleRate)
+}
+
+func (r *Recorder) write(identity, direction string, pcm []int16, sampleRate int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+
+	recording, ok := r.recordings[identity]
+	if !ok {
+		recording = &participantRecording{}
+		r.recordings[identity] = recording
+	}
+
+	writer := &recording.incoming
+	if direction == "out" {
+		writer = &recording.outgoing
+	}
+	if *writer == nil {
+		name := fmt.Sprintf("%s_%s_%s.wav", time.Now().Format("20060102-150405"), unsafeFileChars.ReplaceAllString(identity, "_"), direction)
+		w, err := newWAVWriter(filepath.Join(r.dir, name), sampleRate)
+		if err != nil {
+			return err
+		}
+		*writer = w
+	}
+	if (*writer).sampleRate != sampleRate {
+		return fmt.Errorf("录音采样率不一致: 文件为 %d Hz，写入 %d Hz", (*writer).sampleRate, sampleRate)
+	}
+	return (*writer).Write(pcm)
+}
+
+// CloseParticipant 结束参与者的录音并回填WAV头部
+func (r *Recorder) CloseParticipant(identity string) error {
+	r.mu.Lock()
+	recording, ok := r.recordings[identity]
+	delete(r.recordings, identity)
+	r.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return recording.close()
+}
+
+// Close 结束所有录音，之后的写入会被忽略
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	recordings := r.recordings
+	r.recordings = make(map[string]*participantRecording)
+	r.closed = true
+	r.mu.Unlock()
+
+	var firstErr error
+	for _, recording := range recordings {
+		if err := recording.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (p *participantRecording) close() error {
+	var firstErr error
+	for _, writer := range []*wavWriter{p.incoming, p.outgoing} {
+		if writer == nil {
+			continue
+		}
+		if err := writer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// EnableRecording 开启录音，之后参与者的输入音频和代理的语音回复都会写入 dir
+func (a *AIAgent) EnableRecording(dir string) error {
+	recorder, err := NewRecorder(dir)
+	if err != nil {
+		return err
+	}
+
+	a.recorderMu.Lock()
+	previous := a.recorder
+	a.recorder = recorder
+	a.recorderMu.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+	a.logger.Infof("已开启录音，保存目录: %s", dir)
+	return nil
+}
+
+func (a *AIAgent) currentRecorder() *Recorder {
+	a.recorderMu.Lock()
+	defer a.recorderMu.Unlock()
+
+	return a.recorder
+}
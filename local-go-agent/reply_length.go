@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// 估算朗读时长的语速：中日韩文字每秒约4个字，其他文字（含空格）每秒约14个字符，约合每秒2.5个英文单词
+	cjkRunesPerSecond   = 4.0
+	otherRunesPerSecond = 14.0
+	// 由目标时长推算 max_tokens：中文约每字1个token，英文约每4个字符1个token，
+	// 再留出一半余量，超出目标的部分由 replyLimiter 在句子边界截断，避免回复在句子中间被截断
+	cjkTokensPerRune   = 1.0
+	otherTokensPerRune = 0.25
+	replyTokenHeadroom = 1.5
+)
+
+// estimateSpeakingDuration 按字符数估算朗读一段文本需要的时长，忽略声音标记和标点
+func estimateSpeakingDuration(text string) time.Duration {
+	var cjk, other int
+	for _, r := range stripVoiceTags(text) {
+		switch {
+		case isCJK(r):
+			cjk++
+		case unicode.IsPunct(r):
+		default:
+			other++
+		}
+	}
+	seconds := float64(cjk)/cjkRunesPerSecond + float64(other)/otherRunesPerSecond
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// replyLengthInstruction 返回让模型把回复控制在 target 朗读时长内的提示，target 为0时返回空字符串
+func replyLengthInstruction(target time.Duration, language string) string {
+	if target <= 0 {
+		return ""
+	}
+	seconds := int(target.Seconds())
+	switch language {
+	case "", "zh", "ja", "ko":
+		return fmt.Sprintf("回复会被朗读出来，请在%d秒内说完，不超过%d个字。", seconds, int(target.Seconds()*cjkRunesPerSecond))
+	default:
+		return fmt.Sprintf("Your reply will be spoken aloud. Keep it under %d seconds, about %d words.", seconds, int(target.Seconds()*otherRunesPerSecond/6))
+	}
+}
+
+// replyMaxTokens 由目标朗读时长推算 max_tokens，与配置的 max_tokens 取较小值，target 为0时返回 configured
+func replyMaxTokens(target time.Duration, language string, configured int) int {
+	if target <= 0 {
+		return configured
+	}
+	perSecond := otherRunesPerSecond * otherTokensPerRune
+	switch language {
+	case "", "zh", "ja", "ko":
+		perSecond = cjkRunesPerSecond * cjkTokensPerRune
+	}
+	derived := max(int(target.Seconds()*perSecond*replyTokenHeadroom), 1)
+	if configured > 0 {
+		return min(configured, derived)
+	}
+	return derived
+}
+
+// replyMaxTokens 返回本轮回复的 max_tokens，language 为空时按人设的默认语言推算
+func (a *AIAgent) replyMaxTokens(identity, language string) int {
+	if language == "" {
+		language = a.personaFor(identity).Language
+	}
+	return replyMaxTokens(a.config.Audio.MaxReplyDuration, language, a.config.OpenAI.MaxTokens)
+}
+
+// replyLimiter 按句子累计回复的朗读时长，超过 max 的句子及其之后的内容都被丢弃。
+// 第一句总会保留，即使它本身就超过了 max
+type replyLimiter struct {
+	max      time.Duration
+	spent    time.Duration
+	splitter *SentenceSplitter
+	kept     int
+	// 已有句子被丢弃，之后的内容都不再保留
+	truncated bool
+}
+
+func newReplyLimiter(max time.Duration) *replyLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &replyLimiter{max: max, splitter: NewSentenceSplitter(defaultMaxSentenceRunes)}
+}
+
+// Push 追加一段流式生成的文本，返回因此变得完整且没有超过时长的句子
+func (l *replyLimiter) Push(delta string) []string {
+	return l.keep(l.splitter.Push(delta))
+}
+
+// Flush 返回剩余的不完整句子，超过时长时返回空
+func (l *replyLimiter) Flush() []string {
+	if sentence := l.splitter.Flush(); sentence != "" {
+		return l.keep([]string{sentence})
+	}
+	return nil
+}
+
+func (l *replyLimiter) keep(sentences []string) []string {
+	var kept []string
+	for _, sentence := range sentences {
+		if l.truncated {
+			break
+		}
+		duration := estimateSpeakingDuration(sentence)
+		if l.kept > 0 && l.spent+duration > l.max {
+			l.truncated = true
+			break
+		}
+		l.spent += duration
+		l.kept++
+		kept = append(kept, sentence)
+	}
+	return kept
+}
+
+// truncateReply 在句子边界截断回复，使估算的朗读时长不超过 max，结果与逐段写入 replyLimiter 时保留的句子一致。
+// max 为0或没有超过时返回原文
+func truncateReply(reply string, max time.Duration) (string, bool) {
+	limiter := newReplyLimiter(max)
+	if limiter == nil {
+		return reply, false
+	}
+	sentences := append(limiter.Push(reply), limiter.Flush()...)
+	if !limiter.truncated {
+		return reply, false
+	}
+	return joinSentences(sentences), true
+}
+
+// joinSentences 拼接句子，两个句子的相邻字符都是ASCII时用空格分隔
+func joinSentences(sentences []string) string {
+	var b strings.Builder
+	for i, sentence := range sentences {
+		if i > 0 {
+			previous := sentences[i-1]
+			if previous[len(previous)-1] <= unicode.MaxASCII && sentence[0] <= unicode.MaxASCII {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(sentence)
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestEstimateSpeakingDuration(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+	}{
+		{"你好世界", time.Second},
+		{"你好，世界！", time.Second},
+		{"hello world, ok", time.Second},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := estimateSpeakingDuration(tt.text); got != tt.want {
+			t.Errorf("estimateSpeakingDuration(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateReplyAtSentenceBoundary(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		max   time.Duration
+		want  string
+		cut   bool
+	}{
+		{"unlimited", "第一句。第二句。第三句。", 0, "第一句。第二句。第三句。", false},
+		{"fits", "第一句。第二句。", 2 * time.Second, "第一句。第二句。", false},
+		{"chinese", "第一句。第二句。第三句。", 2 * time.Second, "第一句。第二句。", true},
+		{"english", "One two three. Four five six. Seven eight nine.", 2500 * time.Millisecond, "One two three. Four five six.", true},
+		{"first sentence kept", "这是一句很长很长很长很长的话。短句。", time.Second, "这是一句很长很长很长很长的话。", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cut := truncateReply(tt.reply, tt.max)
+			if got != tt.want || cut != tt.cut {
+				t.Errorf("truncateReply = %q, %v, want %q, %v", got, cut, tt.want, tt.cut)
+			}
+		})
+	}
+}
+
+func TestReplyLimiterStreamingMatchesTruncate(t *testing.T) {
+	reply := "第一句。第二句。第三句。第四句。"
+	limiter := newReplyLimiter(2 * time.Second)
+	var kept []string
+	for _, r := range reply {
+		kept = append(kept, limiter.Push(string(r))...)
+	}
+	kept = append(kept, limiter.Flush()...)
+
+	want, _ := truncateReply(reply, 2*time.Second)
+	if got := strings.Join(kept, ""); got != want {
+		t.Errorf("streamed %q, want %q", got, want)
+	}
+	if !limiter.truncated {
+		t.Error("limiter did not report truncation")
+	}
+}
+
+func TestReplyLengthPromptAndMaxTokens(t *testing.T) {
+	if got := replyLengthInstruction(0, "zh"); got != "" {
+		t.Errorf("instruction without limit = %q, want empty", got)
+	}
+	if got := replyLengthInstruction(10*time.Second, "zh"); !strings.Contains(got, "10秒") || !strings.Contains(got, "40个字") {
+		t.Errorf("chinese instruction = %q", got)
+	}
+	if got := replyLengthInstruction(10*time.Second, "en"); !strings.Contains(got, "10 seconds") {
+		t.Errorf("english instruction = %q", got)
+	}
+
+	tests := []struct {
+		target     time.Duration
+		language   string
+		configured int
+		want       int
+	}{
+		{0, "zh", 500, 500},
+		{10 * time.Second, "zh", 500, 60},
+		{10 * time.Second, "en", 500, 52},
+		{10 * time.Second, "en", 30, 30},
+		{10 * time.Second, "zh", 0, 60},
+	}
+	for _, tt := range tests {
+		if got := replyMaxTokens(tt.target, tt.language, tt.configured); got != tt.want {
+			t.Errorf("replyMaxTokens(%v, %q, %d) = %d, want %d", tt.target, tt.language, tt.configured, got, tt.want)
+		}
+	}
+}
+
+func TestSpeechStopsAtMaxReplyDuration(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{TTS: &orderedTTS{}})
+	agent.config.Audio.MaxReplyDuration = 2 * time.Second
+	output := &recordingOutput{}
+	agent.audioOut = output
+
+	speech := agent.startSpeech(context.Background(), &lksdk.RemoteParticipant{}, "")
+	speech.Write("第一句。第二句。第三句。第四句。")
+	if !speech.Finish("") {
+		t.Fatal("reply was not spoken")
+	}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}
+	if !reflect.DeepEqual(output.durations, want) {
+		t.Errorf("played %v, want only the sentences within 2s %v", output.durations, want)
+	}
+}
+
+func TestGenerateReplyTruncatesAndLimitsTokens(t *testing.T) {
+	llm := &fakeLLM{reply: "第一句。第二句。第三句。"}
+	agent, _ := newTestAgent(&AIServices{LLM: llm})
+	agent.config.Audio.MaxReplyDuration = 2 * time.Second
+	agent.config.OpenAI.MaxTokens = 500
+
+	participant := &lksdk.RemoteParticipant{}
+	reply := agent.generateReply(agent.ctx, participant, "user", "你好", "zh", discardReply{})
+	if reply != "第一句。第二句。" {
+		t.Errorf("reply = %q, want truncated at the second sentence", reply)
+	}
+	if got := agent.conversation("user").Messages(); len(got) == 0 || got[len(got)-1].Content != reply {
+		t.Errorf("history = %v, want the truncated reply", got)
+	}
+	if prompt := agent.systemPrompt(agent.ctx, participant, "user", "zh"); !strings.Contains(prompt, "2秒") {
+		t.Errorf("system prompt %q does not mention the reply length", prompt)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ReprocessOptions 是重新转录录音的选项
+type ReprocessOptions struct {
+	// 录音的语言，为空时由识别服务自动检测或使用其默认语言
+	Language string
+	// 整个文件的转录超时时间，0 表示不限制
+	Timeout time.Duration
+}
+
+// ReprocessSession 用识别服务的高精度模式重新转录一段录音（如 recording.path 保存的会话录音），
+// 返回带逐词时间戳的完整转录结果，用于会后修正实时转录、整理会议纪要。整个文件一次送去批量识别，
+// 不经过发言切分和流式识别；识别服务没有高精度模式时使用普通的批量识别
+func (a *AIAgent) ReprocessSession(wavPath string, opts ReprocessOptions) (Transcript, error) {
+	if a.stt == nil {
+		return Transcript{}, errors.New("语音识别服务不可用，无法重新转录")
+	}
+
+	data, err := os.ReadFile(wavPath)
+	if err != nil {
+		return Transcript{}, fmt.Errorf("读取录音失败: %w", err)
+	}
+	body, format, err := parseWAV(data)
+	if err != nil {
+		return Transcript{}, err
+	}
+	pcm := wavToSTTInput(body, format)
+	if len(pcm) == 0 {
+		return Transcript{}, fmt.Errorf("录音 %s 中没有音频", wavPath)
+	}
+	duration := time.Duration(len(pcm)) * time.Second / sttSampleRate
+
+	ctx := a.session()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	a.logger.Infof("开始重新转录: %s，时长 %v", wavPath, duration)
+	start := time.Now()
+	var transcript Transcript
+	if accurate, ok := a.stt.(accurateTranscriber); ok {
+		transcript, err = accurate.TranscribeAccurate(ctx, int16ToBytes(pcm), opts.Language)
+	} else {
+		a.logger.Info("识别服务没有高精度模式，使用普通的批量识别")
+		transcript, err = a.stt.Transcribe(ctx, int16ToBytes(pcm), opts.Language)
+	}
+	if err != nil {
+		return Transcript{}, fmt.Errorf("重新转录失败: %w", err)
+	}
+	a.chargeAudio(ctx, duration)
+	a.logger.Infof("重新转录完成，耗时 %v，%d 个词", time.Since(start).Round(time.Millisecond), len(transcript.Words))
+	return transcript, nil
+}
+
+// formatMinutes 把转录结果整理为按时间排列的文本，有说话人分离结果时每段前标注时间和说话人
+func formatMinutes(transcript Transcript) string {
+	if len(transcript.Speakers) == 0 {
+		return transcript.Text
+	}
+	var b strings.Builder
+	for _, turn := range transcript.Speakers {
+		offset := time.Duration(turn.StartMs) * time.Millisecond
+		fmt.Fprintf(&b, "[%02d:%02d] %s: %s\n", int(offset.Minutes()), int(offset.Seconds())%60, turn.Speaker, turn.Text)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
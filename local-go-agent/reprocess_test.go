@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// accurateSTT 区分普通识别和高精度识别，记录高精度识别收到的音频
+type accurateSTT struct {
+	fakeSTT
+	accurate Transcript
+
+	mu      sync.Mutex
+	samples int
+	lang    string
+}
+
+func (f *accurateSTT) TranscribeAccurate(ctx context.Context, pcm []byte, lang string) (Transcript, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.samples += len(pcm) / 2
+	f.lang = lang
+	return f.accurate, nil
+}
+
+func TestReprocessSession(t *testing.T) {
+	words := []Word{{Text: "会议", StartMs: 0, EndMs: 400}, {Text: "开始", StartMs: 400, EndMs: 900}}
+	stt := &accurateSTT{
+		fakeSTT:  fakeSTT{result: Transcript{Text: "会意开始", Final: true}},
+		accurate: Transcript{Text: "会议开始", Final: true, Words: words},
+	}
+	agent, _ := newTestAgent(&AIServices{STT: stt})
+
+	// 录音为48kHz双声道，转录前转换为识别使用的单声道采样率
+	path := filepath.Join(t.TempDir(), "session.wav")
+	if err := os.WriteFile(path, encodeWAVChannels(make([]int16, 2*webrtcSampleRate*2), webrtcSampleRate, 2), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	transcript, err := agent.ReprocessSession(path, ReprocessOptions{Language: "zh"})
+	if err != nil {
+		t.Fatalf("ReprocessSession: %v", err)
+	}
+	if transcript.Text != "会议开始" || !reflect.DeepEqual(transcript.Words, words) {
+		t.Errorf("transcript = %+v, want the high-accuracy result with words", transcript)
+	}
+	if stt.samples != 2*sttSampleRate || stt.lang != "zh" {
+		t.Errorf("transcribed %d samples in %q, want the whole file (%d samples) in zh", stt.samples, stt.lang, 2*sttSampleRate)
+	}
+
+	// 没有高精度模式的服务使用普通识别
+	agent, _ = newTestAgent(&AIServices{STT: &stt.fakeSTT})
+	transcript, err = agent.ReprocessSession(path, ReprocessOptions{})
+	if err != nil || transcript.Text != "会意开始" {
+		t.Errorf("fallback transcript = %+v, %v", transcript, err)
+	}
+}
+
+func TestFormatMinutes(t *testing.T) {
+	transcript := Transcript{
+		Text: "大家好 开始吧",
+		Speakers: []SpeakerTurn{
+			{Speaker: "A", Text: "大家好", StartMs: 1200},
+			{Speaker: "B", Text: "开始吧", StartMs: 65000},
+		},
+	}
+	if got, want := formatMinutes(transcript), "[00:01] A: 大家好\n[01:05] B: 开始吧"; got != want {
+		t.Errorf("formatMinutes = %q, want %q", got, want)
+	}
+	if got := formatMinutes(Transcript{Text: "大家好"}); got != "大家好" {
+		t.Errorf("formatMinutes without speakers = %q", got)
+	}
+}
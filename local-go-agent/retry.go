@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	initialRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 8 * time.Second
+)
+
+// retryTransient 执行 fn，transient 判断为临时性错误时按指数退避重试，最多重试 retries 次。
+// ctx 结束后不再重试，返回最后一次的错误
+func retryTransient(ctx context.Context, retries int, transient func(error) bool, fn func() error) error {
+	delay := initialRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries || ctx.Err() != nil || !transient(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// isTransientNetworkError 判断错误是否为网络抖动造成的，例如连接被重置、超时或响应被截断
+func isTransientNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,59 @@
+package main
+
+// pcmRingBuffer 是容量固定的PCM环形缓冲区，写满后覆盖最早的采样，
+// 无论参与者连续说话多久，每条轨道占用的内存都不会超过容量
+type pcmRingBuffer struct {
+	data  []int16
+	start int
+	size  int
+}
+
+func newPCMRingBuffer(capacity int) *pcmRingBuffer {
+	return &pcmRingBuffer{data: make([]int16, capacity)}
+}
+
+func (b *pcmRingBuffer) Len() int {
+	return b.size
+}
+
+func (b *pcmRingBuffer) Cap() int {
+	return len(b.data)
+}
+
+// Write 追加采样，放不下时覆盖最早的采样并返回被覆盖的数量
+func (b *pcmRingBuffer) Write(pcm []int16) int {
+	capacity := len(b.data)
+	if capacity == 0 {
+		return len(pcm)
+	}
+
+	dropped := 0
+	if len(pcm) > capacity {
+		dropped = len(pcm) - capacity
+		pcm = pcm[dropped:]
+	}
+	if overflow := b.size + len(pcm) - capacity; overflow > 0 {
+		dropped += overflow
+		b.start = (b.start + overflow) % capacity
+		b.size -= overflow
+	}
+
+	end := (b.start + b.size) % capacity
+	n := copy(b.data[end:], pcm)
+	copy(b.data, pcm[n:])
+	b.size += len(pcm)
+	return dropped
+}
+
+// Drain 按顺序取出所有采样并清空缓冲区，为空时返回 nil
+func (b *pcmRingBuffer) Drain() []int16 {
+	if b.size == 0 {
+		return nil
+	}
+	pcm := make([]int16, b.size)
+	n := copy(pcm, b.data[b.start:min(b.start+b.size, len(b.data))])
+	copy(pcm[n:], b.data[:b.size-n])
+	b.start = 0
+	b.size = 0
+	return pcm
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestPCMRingBufferNeverExceedsCapacity(t *testing.T) {
+	buffer := newPCMRingBuffer(100)
+
+	var next int16
+	written, dropped := 0, 0
+	for i := 0; i < 500; i++ {
+		// 每次写入的长度不同，覆盖环绕和单次写入超过容量的情况
+		chunk := make([]int16, i%150)
+		for j := range chunk {
+			chunk[j] = next
+			next++
+		}
+		written += len(chunk)
+		dropped += buffer.Write(chunk)
+		if buffer.Len() > buffer.Cap() {
+			t.Fatalf("buffer holds %d samples, capacity %d", buffer.Len(), buffer.Cap())
+		}
+	}
+
+	// 留下的是最近写入的采样，按写入顺序排列
+	pcm := buffer.Drain()
+	if len(pcm) != buffer.Cap() {
+		t.Fatalf("drained %d samples, want %d", len(pcm), buffer.Cap())
+	}
+	for i, sample := range pcm {
+		if want := next - int16(len(pcm)-i); sample != want {
+			t.Fatalf("sample %d = %d, want %d", i, sample, want)
+		}
+	}
+	if written-dropped != len(pcm) {
+		t.Errorf("wrote %d samples, dropped %d, kept %d", written, dropped, len(pcm))
+	}
+	if buffer.Len() != 0 || buffer.Drain() != nil {
+		t.Error("buffer is not empty after Drain")
+	}
+}
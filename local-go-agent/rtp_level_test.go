@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+const testAudioLevelID = 1
+
+func levelPacket(t *testing.T, dBov uint8) *rtp.Packet {
+	t.Helper()
+	payload, err := rtp.AudioLevelExtension{Level: dBov}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := &rtp.Packet{Header: rtp.Header{Version: 2}}
+	if err := packet.Header.SetExtension(testAudioLevelID, payload); err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func TestRTPAudioLevel(t *testing.T) {
+	if level, ok := rtpAudioLevel(levelPacket(t, 30), testAudioLevelID); !ok || level != -30 {
+		t.Errorf("level = %v, %v; want -30", level, ok)
+	}
+	if _, ok := rtpAudioLevel(&rtp.Packet{}, testAudioLevelID); ok {
+		t.Error("packet without the extension should report no level")
+	}
+}
+
+func TestLevelGate(t *testing.T) {
+	if newLevelGate(0, defaultRTPLevelGate) != nil {
+		t.Error("gate should be off when the extension is not negotiated")
+	}
+
+	gate := newLevelGate(testAudioLevelID, defaultRTPLevelGate)
+	gate.Decoded(make([]int16, 320))
+	hangoverFrames := int(rtpLevelGateHangover / defaultOpusFrameDuration)
+
+	// 静音开始后的一段时间内继续解码
+	for i := 0; i < hangoverFrames; i++ {
+		if _, skip := gate.Skip(levelPacket(t, 127)); skip {
+			t.Fatalf("quiet packet %d skipped during hangover", i)
+		}
+	}
+	silence, skip := gate.Skip(levelPacket(t, 127))
+	if !skip || len(silence) != 320 {
+		t.Fatalf("skip = %v with %d samples, want a 320 sample silent frame", skip, len(silence))
+	}
+
+	// 没有扩展的包总是解码，由能量VAD判断
+	if _, skip := gate.Skip(&rtp.Packet{}); skip {
+		t.Error("packet without the extension should be decoded")
+	}
+	// 有人说话时立即恢复解码
+	if _, skip := gate.Skip(levelPacket(t, 20)); skip {
+		t.Error("loud packet should be decoded")
+	}
+	if _, skip := gate.Skip(levelPacket(t, 127)); skip {
+		t.Error("hangover should restart after speech")
+	}
+}
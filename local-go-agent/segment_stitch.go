@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// segmentStitcher 记录同一轨道上一段发言的转录结果。发言在进行中被切分时，下一段开头
+// 重复了上一段末尾的音频，转录结果开头与上一段末尾相同的词被去掉。只比较落在重叠音频中的词，
+// 重叠之外的重复是参与者真的说了两遍
+type segmentStitcher struct {
+	mu       sync.Mutex
+	previous Transcript
+	duration time.Duration
+}
+
+// Stitch 返回去掉开头重复文字后的转录结果，duration 是这段发言的音频时长，
+// 开头 overlap 的音频与上一段末尾重叠
+func (s *segmentStitcher) Stitch(result Transcript, duration, overlap time.Duration) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, previousDuration := s.previous, s.duration
+	s.previous, s.duration = result, duration
+	text := result.Text
+	if overlap <= 0 || previous.Text == "" {
+		return text
+	}
+
+	head := transcriptTokens(text)
+	tail := transcriptTokens(previous.Text)
+	tail = tail[len(tail)-overlapTokens(previous, len(tail), previousDuration, overlap, false):]
+	drop := overlapLength(tail, head[:overlapTokens(result, len(head), duration, overlap, true)])
+	if drop == 0 {
+		return text
+	}
+	return strings.TrimLeftFunc(text[head[drop-1].end:], func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	})
+}
+
+// overlapLength 返回 head 开头需要去掉的词数，这些词重复了 tail 的末尾。tail 的最后一个词可能是
+// 在切分点被切开的前半个词，只是 head 中完整的词的前缀，完整的词保留；head 的第一个词可能是
+// 在重叠开始处被切开的后半个词，是 tail 中对应词的后缀，一并去掉
+func overlapLength(tail, head []transcriptToken) int {
+	for n := len(tail); n > 0; n-- {
+		for skip := 0; skip <= 1 && skip+n <= len(head); skip++ {
+			if skip == 1 && (n == len(tail) || !isFragment(head[0].word, tail[len(tail)-n-1].word, strings.HasSuffix)) {
+				continue
+			}
+			drop := skip + n
+			matched := true
+			for i := 0; i < n && matched; i++ {
+				previous, current := tail[len(tail)-n+i].word, head[skip+i].word
+				if i == n-1 && isFragment(previous, current, strings.HasPrefix) {
+					drop--
+					continue
+				}
+				matched = previous == current
+			}
+			if matched && drop > 0 {
+				return drop
+			}
+		}
+	}
+	// 只重复了被切开的后半个词
+	if len(tail) > 0 && len(head) > 0 && isFragment(head[0].word, tail[len(tail)-1].word, strings.HasSuffix) {
+		return 1
+	}
+	return 0
+}
+
+// isFragment 判断 part 是否是 word 被切开后的一部分，has 为 strings.HasPrefix 或 strings.HasSuffix
+func isFragment(part, word string, has func(s, part string) bool) bool {
+	return part != word && has(word, part)
+}
+
+// transcriptToken 是转录结果中的一个词，end 是它在原文中结束的字节位置
+type transcriptToken struct {
+	word string
+	end  int
+}
+
+// transcriptTokens 把转录结果切分为词：中日韩文字每个字是一个词，其他文字按空格和标点切分，
+// 比较时忽略大小写
+func transcriptTokens(text string) []transcriptToken {
+	var tokens []transcriptToken
+	start := -1
+	closeWord := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, transcriptToken{word: strings.ToLower(text[start:end]), end: end})
+			start = -1
+		}
+	}
+	for i, r := range text {
+		switch {
+		case isCJK(r):
+			closeWord(i)
+			end := i + len(string(r))
+			tokens = append(tokens, transcriptToken{word: text[i:end], end: end})
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'':
+			if start < 0 {
+				start = i
+			}
+		default:
+			closeWord(i)
+		}
+	}
+	closeWord(len(text))
+	return tokens
+}
+
+// overlapTokens 返回转录结果的 tokens 个词中落在重叠音频里的词数，head 为 true 时重叠在开头，
+// 否则在末尾。有逐词时间戳时按时间戳判断，没有时按词数平均分配音频时长估算
+func overlapTokens(result Transcript, tokens int, duration, overlap time.Duration, head bool) int {
+	if duration <= overlap {
+		return tokens
+	}
+	if len(result.Words) == 0 {
+		return min(tokens, int(math.Ceil(float64(tokens)*overlap.Seconds()/duration.Seconds())))
+	}
+	count := 0
+	for _, word := range result.Words {
+		start, end := time.Duration(word.StartMs)*time.Millisecond, time.Duration(word.EndMs)*time.Millisecond
+		if (head && start < overlap) || (!head && end > duration-overlap) {
+			count += len(transcriptTokens(word.Text))
+		}
+	}
+	return min(tokens, count)
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestSegmentStitcherRemovesRepeatedWords(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous string
+		text     string
+		want     string
+	}{
+		{"repeated words", "what is the weather", "the weather like today", "like today"},
+		{"case and punctuation", "Tell me a joke.", "a joke, please", "please"},
+		{"chinese", "今天天气怎么样", "怎么样？明天呢", "明天呢"},
+		{"word cut at the boundary is kept", "what is the wea", "the weather like", "weather like"},
+		{"word cut where the overlap starts", "what is the weather like", "her like today", "today"},
+		{"only a cut word repeated", "what is the weather", "her today", "today"},
+		{"no overlap", "hello there", "how are you", "how are you"},
+		{"repeat beyond the overlap is kept", "tell me again tell me again", "tell me again tell me again please", "tell me again please"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 每段1秒，开头500ms与上一段重叠，没有时间戳时按词数平均估算每个词的位置
+			stitcher := &segmentStitcher{}
+			stitcher.Stitch(Transcript{Text: tt.previous}, time.Second, 0)
+			if got := stitcher.Stitch(Transcript{Text: tt.text}, time.Second, 500*time.Millisecond); got != tt.want {
+				t.Errorf("Stitch(%q) after %q = %q, want %q", tt.text, tt.previous, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentStitcherUsesWordTimestamps(t *testing.T) {
+	words := func(texts ...string) []Word {
+		var result []Word
+		for i, text := range texts {
+			result = append(result, Word{Text: text, StartMs: int64(i) * 200, EndMs: int64(i+1) * 200})
+		}
+		return result
+	}
+	stitcher := &segmentStitcher{}
+	stitcher.Stitch(Transcript{Text: "no no no", Words: words("no", "no", "no")}, 600*time.Millisecond, 0)
+	// 只有第一个“no”落在重叠的150ms中，其余是参与者又说了一遍
+	got := stitcher.Stitch(Transcript{Text: "no no no stop", Words: words("no", "no", "no", "stop")}, 800*time.Millisecond, 150*time.Millisecond)
+	if want := "no no stop"; got != want {
+		t.Errorf("Stitch = %q, want %q", got, want)
+	}
+}
+
+// 每个词200ms
+const testWordSamples = sttSampleRate / 5
+
+// wordSTT 把每段相同的非零采样当作一个词：完整的200ms识别为该词，在段首或段尾被切开的只识别出半个词
+type wordSTT struct {
+	words []string
+}
+
+func (s *wordSTT) Transcribe(ctx context.Context, pcm []byte, lang string) (Transcript, error) {
+	samples := bytesToInt16(pcm)
+	var heard []string
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j] == samples[i] {
+			j++
+		}
+		if samples[i] != 0 {
+			word := s.words[int(samples[i])/1000-1]
+			switch {
+			case j-i >= testWordSamples:
+				heard = append(heard, word)
+			case i == 0:
+				heard = append(heard, word[len(word)/2:])
+			default:
+				heard = append(heard, word[:len(word)/2])
+			}
+		}
+		i = j
+	}
+	return Transcript{Text: strings.Join(heard, " "), Confidence: 0.9, Final: true}, nil
+}
+
+func TestSegmentOverlapCapturesBoundaryWord(t *testing.T) {
+	words := strings.Fields("please tell me whether tomorrow afternoon looks sunny")
+	agent, _ := newTestAgent(&AIServices{STT: &wordSTT{words: words}, LLM: &fakeLLM{reply: "好的。"}, TTS: &fakeTTS{}})
+	agent.config.Audio.BufferDuration = time.Second
+	agent.config.Audio.SegmentOverlap = 300 * time.Millisecond
+
+	// 开头100ms静音，每秒的切分点都落在一个词的中间
+	pcm := make([]int16, sttSampleRate/10, sttSampleRate/10+len(words)*testWordSamples)
+	for i := range words {
+		for range testWordSamples {
+			pcm = append(pcm, int16((i+1)*1000))
+		}
+	}
+	// 与离线模拟相同，按音频时长切分
+	ingest := agent.newAudioIngest(&lksdk.RemoteParticipant{}, "track")
+	ingest.turns = nil
+	clock := time.Now()
+	ingest.segmenter.now = func() time.Time { return clock }
+	ingest.segmenter.lastFlush = clock
+	ctx := context.Background()
+	for start := 0; start < len(pcm); start += sttSampleRate / 50 {
+		frame := pcm[start:min(start+sttSampleRate/50, len(pcm))]
+		clock = clock.Add(time.Duration(len(frame)) * time.Second / sttSampleRate)
+		if ingest.Push(ctx, frame) {
+			agent.turns.Wait()
+		}
+	}
+	if ingest.Flush(ctx) {
+		agent.turns.Wait()
+	}
+
+	var heard []string
+	for len(agent.events) > 0 {
+		if event := <-agent.events; event.Type == EventTranscriptReceived {
+			heard = append(heard, strings.Fields(event.Text)...)
+		}
+	}
+	// "tomorrow" 跨越1秒处的切分点，在下一段中完整识别；每个词只出现一次
+	for _, word := range words {
+		count := 0
+		for _, got := range heard {
+			if got == word {
+				count++
+			}
+		}
+		if count != 1 {
+			t.Errorf("%q heard %d times in %q", word, count, heard)
+		}
+	}
+}
+
+func TestMaxUtteranceDurationSegmentsMonologue(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{STT: &fakeSTT{result: Transcript{Text: "一直在说话", Confidence: 0.9, Final: true}}, LLM: &fakeLLM{reply: "好的。"}, TTS: &fakeTTS{}})
+	agent.config.Audio.ListeningMode = ListeningModeVAD
+	agent.config.Audio.MaxUtteranceDuration = 15 * time.Second
+
+	// 60秒没有停顿的说话，VAD 一直检测不到静音
+	ingest := agent.newAudioIngest(&lksdk.RemoteParticipant{}, "track")
+	ingest.turns = nil
+	ctx := context.Background()
+	maxSamples := 0
+	for range 60 * 50 {
+		if ingest.Push(ctx, toneFrame(8000)) {
+			agent.turns.Wait()
+		}
+		maxSamples = max(maxSamples, ingest.segmenter.buffer.Len())
+	}
+	if limit := bufferCapacity(agent.config.Audio.MaxUtteranceDuration); maxSamples > limit {
+		t.Fatalf("buffered %d samples, limit %d", maxSamples, limit)
+	}
+
+	transcripts := 0
+	for len(agent.events) > 0 {
+		if event := <-agent.events; event.Type == EventTranscriptReceived {
+			transcripts++
+		}
+	}
+	if transcripts < 4 {
+		t.Fatalf("got %d transcripts for 60s of speech, want at least 4", transcripts)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 没有遇到句末标点时，缓冲超过该长度就在最近的逗号或空白处强制断句
+const defaultMaxSentenceRunes = 80
+
+// SentenceSplitter 缓冲流式生成的文本，按中英文句末标点切分出完整的句子，
+// 让每个句子可以单独送去合成语音
+type SentenceSplitter struct {
+	maxRunes int
+	buf      []rune
+
+	// 已遇到句末标点，等待后续字符确认句子结束
+	pending bool
+	// 待确认的句末标点是中文标点，中文标点后不需要空白即可断句
+	pendingCJK bool
+}
+
+func NewSentenceSplitter(maxRunes int) *SentenceSplitter {
+	if maxRunes <= 0 {
+		maxRunes = defaultMaxSentenceRunes
+	}
+	return &SentenceSplitter{maxRunes: maxRunes}
+}
+
+// Push 追加一段流式文本，返回因此变得完整的句子。英文句号等需要看到后面的
+// 空白才确认断句，避免把 3.14 这样的小数切开
+func (s *SentenceSplitter) Push(text string) []string {
+	var sentences []string
+	for _, r := range text {
+		if s.pending {
+			switch {
+			case isSentenceTerminator(r) || isClosingPunct(r):
+				// 连续的标点和后引号仍属于当前句子
+			case s.pendingCJK || unicode.IsSpace(r):
+				sentences = s.emit(sentences, len(s.buf))
+				s.pending = false
+			default:
+				s.pending = false
+			}
+		}
+
+		s.buf = append(s.buf, r)
+		if isSentenceTerminator(r) {
+			s.pending = true
+			s.pendingCJK = r > unicode.MaxASCII
+		} else if !s.pending && len(s.buf) >= s.maxRunes {
+			sentences = s.emit(sentences, s.softBreak())
+		}
+	}
+	return sentences
+}
+
+// Flush 在流结束时返回剩余的不完整句子，没有剩余内容时返回空字符串
+func (s *SentenceSplitter) Flush() string {
+	sentences := s.emit(nil, len(s.buf))
+	s.pending = false
+	if len(sentences) == 0 {
+		return ""
+	}
+	return sentences[0]
+}
+
+// emit 取出缓冲区前 n 个字符作为一个句子，空白句子会被丢弃
+func (s *SentenceSplitter) emit(sentences []string, n int) []string {
+	sentence := strings.TrimSpace(string(s.buf[:n]))
+	s.buf = append(s.buf[:0], s.buf[n:]...)
+	if sentence == "" {
+		return sentences
+	}
+	return append(sentences, sentence)
+}
+
+// softBreak 返回强制断句的位置：最后一个逗号、分号或空白之后，找不到时切分整个缓冲区
+func (s *SentenceSplitter) softBreak() int {
+	for i := len(s.buf) - 1; i > 0; i-- {
+		if strings.ContainsRune("，,、；;：:", s.buf[i]) || unicode.IsSpace(s.buf[i]) {
+			return i + 1
+		}
+	}
+	return len(s.buf)
+}
+
+func isSentenceTerminator(r rune) bool {
+	return strings.ContainsRune("。！？.!?", r)
+}
+
+func isClosingPunct(r rune) bool {
+	return strings.ContainsRune("”’」』）)\"'", r)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/AssemblyAI/assemblyai-go-sdk"
+	"github.com/openai/openai-go/v3"
+)
+
+// 服务调用失败的错误类型，都包装了底层错误。调用方用 errors.As 区分失败原因，
+// 决定重试、降级还是放弃，无法归类的错误保持原样
+
+// ErrAuth 是密钥无效或没有权限，重试不会成功
+type ErrAuth struct {
+	Service    string
+	StatusCode int
+	Err        error
+}
+
+func (e *ErrAuth) Error() string { return fmt.Sprintf("%s 认证失败: %v", e.Service, e.Err) }
+func (e *ErrAuth) Unwrap() error { return e.Err }
+
+// ErrRateLimited 是请求被服务限流
+type ErrRateLimited struct {
+	Service    string
+	StatusCode int
+	Err        error
+}
+
+func (e *ErrRateLimited) Error() string {
+	return fmt.Sprintf("%s 请求被限流 (HTTP %d): %v", e.Service, e.StatusCode, e.Err)
+}
+func (e *ErrRateLimited) Unwrap() error { return e.Err }
+
+// ErrTimeout 是请求超时，包括 ctx 到期和网关超时
+type ErrTimeout struct {
+	Service string
+	Err     error
+}
+
+func (e *ErrTimeout) Error() string { return fmt.Sprintf("%s 请求超时: %v", e.Service, e.Err) }
+func (e *ErrTimeout) Unwrap() error { return e.Err }
+
+// ErrProviderUnavailable 是服务端错误或网络不通，StatusCode 为 0 表示没有收到响应
+type ErrProviderUnavailable struct {
+	Service    string
+	StatusCode int
+	Err        error
+}
+
+func (e *ErrProviderUnavailable) Error() string {
+	return fmt.Sprintf("%s 暂时不可用: %v", e.Service, e.Err)
+}
+func (e *ErrProviderUnavailable) Unwrap() error { return e.Err }
+
+// classifyServiceError 按HTTP状态和底层错误归类服务调用失败，status 为 0 表示没有收到HTTP响应。
+// 对话被取消不是服务的问题，与其他无法归类的错误一样原样返回
+func classifyServiceError(service string, status int, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return &ErrAuth{Service: service, StatusCode: status, Err: err}
+	case status == http.StatusTooManyRequests:
+		return &ErrRateLimited{Service: service, StatusCode: status, Err: err}
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return &ErrTimeout{Service: service, Err: err}
+	case status >= http.StatusInternalServerError:
+		return &ErrProviderUnavailable{Service: service, StatusCode: status, Err: err}
+	case status != 0:
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &ErrTimeout{Service: service, Err: err}
+	}
+	if isTransientNetworkError(err) {
+		return &ErrProviderUnavailable{Service: service, Err: err}
+	}
+	return err
+}
+
+// openAIError 按 OpenAI SDK 返回的状态归类错误
+func openAIError(err error) error {
+	status := 0
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		status = apiErr.StatusCode
+	}
+	return classifyServiceError("OpenAI", status, err)
+}
+
+// assemblyAIError 按 AssemblyAI SDK 返回的状态归类错误
+func assemblyAIError(err error) error {
+	status := 0
+	var apiErr assemblyai.APIError
+	if errors.As(err, &apiErr) {
+		status = apiErr.Status
+	}
+	return classifyServiceError("AssemblyAI", status, err)
+}
+
+// 服务限流或超时时的回复，让用户知道稍后重试即可
+const (
+	rateLimitedReply = "抱歉，现在请求太多了，请稍后再试。"
+	timeoutReply     = "抱歉，服务响应超时，请再说一次。"
+)
+
+// serviceErrorReply 按失败原因选择回复用户的道歉，无法归类时使用 fallback
+func serviceErrorReply(err error, fallback string) string {
+	var rateLimited *ErrRateLimited
+	var timeout *ErrTimeout
+	switch {
+	case errors.As(err, &rateLimited):
+		return rateLimitedReply
+	case errors.As(err, &timeout):
+		return timeoutReply
+	default:
+		return fallback
+	}
+}
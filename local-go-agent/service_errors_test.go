@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClassifyServiceError(t *testing.T) {
+	cause := errors.New("boom")
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		check  func(error) bool
+	}{
+		{"unauthorized", http.StatusUnauthorized, cause, func(err error) bool { var e *ErrAuth; return errors.As(err, &e) }},
+		{"forbidden", http.StatusForbidden, cause, func(err error) bool { var e *ErrAuth; return errors.As(err, &e) }},
+		{"rate limited", http.StatusTooManyRequests, cause, func(err error) bool {
+			var e *ErrRateLimited
+			return errors.As(err, &e) && e.StatusCode == http.StatusTooManyRequests
+		}},
+		{"gateway timeout", http.StatusGatewayTimeout, cause, func(err error) bool { var e *ErrTimeout; return errors.As(err, &e) }},
+		{"server error", http.StatusBadGateway, cause, func(err error) bool {
+			var e *ErrProviderUnavailable
+			return errors.As(err, &e) && e.StatusCode == http.StatusBadGateway
+		}},
+		{"deadline", 0, fmt.Errorf("请求失败: %w", context.DeadlineExceeded), func(err error) bool { var e *ErrTimeout; return errors.As(err, &e) }},
+		{"network", 0, io.ErrUnexpectedEOF, func(err error) bool { var e *ErrProviderUnavailable; return errors.As(err, &e) }},
+		{"cancelled is unchanged", 0, context.Canceled, func(err error) bool { return err == context.Canceled }},
+		{"bad request is unchanged", http.StatusBadRequest, cause, func(err error) bool { return err == cause }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyServiceError("test", tt.status, tt.err)
+			if !tt.check(err) {
+				t.Errorf("classified as %T: %v", err, err)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%v does not wrap the cause", err)
+			}
+		})
+	}
+}
+
+func TestServiceErrorsFromProviders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tts/bytes":
+			http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+		default:
+			http.Error(w, `{"error":{"message":"rate limited"}}`, http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	llm := newTestOpenAIService(server.URL)
+	_, err := llm.GenerateResponse(context.Background(), "system", "hello", 100, 0.7)
+	var rateLimited *ErrRateLimited
+	if !errors.As(err, &rateLimited) || rateLimited.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("GenerateResponse error = %v, want rate limited with status 429", err)
+	}
+	if reply := serviceErrorReply(err, "fallback"); reply != rateLimitedReply {
+		t.Errorf("reply = %q, want the rate limit reply", reply)
+	}
+
+	tts := NewCartesiaService("test-key")
+	tts.baseURL = server.URL
+	_, err = tts.TextToSpeech(context.Background(), "你好")
+	var auth *ErrAuth
+	if !errors.As(err, &auth) || auth.StatusCode != http.StatusUnauthorized {
+		t.Errorf("TextToSpeech error = %v, want auth failure", err)
+	}
+	if reply := serviceErrorReply(err, "fallback"); reply != "fallback" {
+		t.Errorf("reply = %q, want the fallback for auth failures", reply)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// startTurn 在新协程中运行一轮对话并计入进行中的对话，代理关闭后不再接受新的对话
+func (a *AIAgent) startTurn(turn func()) bool {
+	if a.closing.Load() {
+		return false
+	}
+	return a.turns.Go(func() {
+		defer a.recoverPanic("对话")
+		turn()
+	})
+}
+
+// Shutdown 停止接受新的对话，等待进行中的对话完成发布后再断开连接，最后等待后台协程退出。
+// ctx 结束时不再等待，直接断开并返回 ctx 的错误
+func (a *AIAgent) Shutdown(ctx context.Context) error {
+	a.closing.Store(true)
+	a.turns.Close()
+	a.beginShutdown()
+
+	err := a.turns.WaitContext(ctx)
+	if err != nil {
+		a.logger.Warn("等待进行中的对话超时，强制断开")
+	}
+
+	// 进行中的对话还可能打开流式识别和语音合成的会话，对话结束后才不再启动协程。
+	// 断开后会话结束，音频轨道、语音输出和重连等协程随之退出
+	a.tasks.Close()
+	a.Disconnect()
+	if err := a.tasks.WaitContext(ctx); err != nil {
+		a.logger.Warn("等待后台协程退出超时")
+		return err
+	}
+	return err
+}
+
+// Shutdown 并行关闭所有房间的代理，返回第一个超时的错误
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	agents := m.agents
+	m.agents = make(map[string]*AIAgent)
+	m.mu.Unlock()
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for roomName, agent := range agents {
+		wg.Add(1)
+		go func(roomName string, agent *AIAgent) {
+			defer wg.Done()
+			if err := agent.Shutdown(ctx); err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+			m.logger.Infof("已离开房间: %s", roomName)
+		}(roomName, agent)
+	}
+	wg.Wait()
+
+	if err := m.services.Close(); err != nil {
+		m.logger.Errorf("关闭对话记录失败: %v", err)
+	}
+	return firstErr
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// 离线模拟时送入处理链的每帧时长，与实时轨道的Opus帧相同
+const simulationFrameDuration = 20 * time.Millisecond
+
+// simulationTrackSID 是离线模拟时音频所属的轨道
+const simulationTrackSID = "simulation"
+
+// SimulateFromFile 用WAV文件代替实时音频轨道运行完整的对话流程，切分发言、STT、LLM、TTS
+// 与 processAudioTrack 相同。语音回复写入 simulationOutputPath 返回的文件，文本消息和字幕写入日志。
+// 每段发言处理完后才送入后面的音频，同一文件和同样的服务结果总能得到同样的对话，便于回归测试提示词
+func (a *AIAgent) SimulateFromFile(path string) error {
+	if a.stt == nil && a.config.Echo.Mode == EchoModeOff {
+		return errors.New("语音识别服务不可用，无法模拟")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取音频文件失败: %w", err)
+	}
+	body, format, err := parseWAV(data)
+	if err != nil {
+		return err
+	}
+	pcm := wavToSTTInput(body, format)
+
+	outputPath := simulationOutputPath(path)
+	output, err := newWAVWriter(outputPath, webrtcSampleRate)
+	if err != nil {
+		return err
+	}
+	sink := &wavOutput{writer: output, logger: a.logger}
+
+	a.audioMu.Lock()
+	a.audioOut = sink
+	a.audioMu.Unlock()
+	if a.publisher == nil {
+		a.publisher = logPublisher{logger: a.logger}
+	}
+
+	a.logger.Infof("开始模拟: %s，时长 %v", path, time.Duration(len(pcm))*time.Second/sttSampleRate)
+	ctx := a.session()
+	ingest := a.newAudioIngest(&lksdk.RemoteParticipant{}, simulationTrackSID)
+	// 模拟需要在每段发言处理完后再继续，不使用异步返回结果的服务端轮次检测
+	ingest.turns = nil
+	defer ingest.Close()
+
+	// 固定间隔模式按音频时长而不是实际经过的时间切分发言
+	clock := time.Now()
+	ingest.segmenter.now = func() time.Time { return clock }
+	ingest.segmenter.lastFlush = clock
+
+	frameSize := int(simulationFrameDuration * sttSampleRate / time.Second)
+	for start := 0; start < len(pcm); start += frameSize {
+		frame := pcm[start:min(start+frameSize, len(pcm))]
+		clock = clock.Add(time.Duration(len(frame)) * time.Second / sttSampleRate)
+		if ingest.Push(ctx, frame) {
+			a.turns.Wait()
+		}
+	}
+	if ingest.Flush(ctx) {
+		a.turns.Wait()
+	}
+
+	if err := sink.Close(); err != nil {
+		return err
+	}
+	a.logger.Infof("模拟完成，语音回复已写入: %s", outputPath)
+	return nil
+}
+
+// simulationOutputPath 返回离线模拟写入语音回复的文件，与输入文件同目录，如 input.wav 对应 input.reply.wav
+func simulationOutputPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".reply.wav"
+}
+
+// wavToSTTInput 把WAV数据转换为识别使用的单声道 sttSampleRate PCM，多声道取平均
+func wavToSTTInput(body []byte, format AudioFormat) []int16 {
+	samples := downmix(s16leToFloat32(body), format.Channels)
+	return float32ToInt16(resample(samples, format.SampleRate, sttSampleRate))
+}
+
+// wavOutput 把语音回复依次写入WAV文件
+type wavOutput struct {
+	logger *logrus.Entry
+
+	mu     sync.Mutex
+	writer *wavWriter
+}
+
+func (w *wavOutput) Write(samples []float32, sampleRate int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.writer.Write(float32ToInt16(resample(samples, sampleRate, webrtcSampleRate))); err != nil {
+		w.logger.Errorf("写入语音回复失败: %v", err)
+	}
+}
+
+func (w *wavOutput) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writer.Close()
+}
+
+// logPublisher 在离线模拟时代替房间，把要发布的文本消息和字幕写入日志
+type logPublisher struct {
+	logger *logrus.Entry
+}
+
+func (p logPublisher) PublishDataPacket(pck lksdk.DataPacket, opts ...lksdk.DataPublishOption) error {
+	if packet, ok := pck.(*lksdk.UserDataPacket); ok {
+		p.logger.WithField("topic", packet.Topic).Infof("模拟发布: %s", packet.Payload)
+	}
+	return nil
+}
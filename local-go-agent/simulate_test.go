@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSimulateFromFile(t *testing.T) {
+	llm := &fakeLLM{reply: "你好。"}
+	tts := &fakeTTS{}
+	agent, publisher := newTestAgent(&AIServices{
+		STT: &fakeSTT{result: Transcript{Text: "你好", Confidence: 0.9, Final: true}},
+		LLM: llm,
+		TTS: tts,
+	})
+
+	// 7秒的双声道8kHz音频：固定间隔模式下按音频时长每3秒切分一段，剩余的1秒在结束时送出
+	const seconds, rate = 7, 8000
+	pcm := make([]int16, seconds*rate*2)
+	for i := range pcm {
+		pcm[i] = int16(i%50) * 100
+	}
+	path := filepath.Join(t.TempDir(), "input.wav")
+	if err := os.WriteFile(path, encodeWAVChannels(pcm, rate, 2), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := agent.SimulateFromFile(path); err != nil {
+		t.Fatalf("SimulateFromFile: %v", err)
+	}
+
+	if calls := llm.Calls(); calls != 3 {
+		t.Errorf("llm called %d times, want 3", calls)
+	}
+	if texts := tts.Texts(); len(texts) != 3 {
+		t.Errorf("synthesized %v, want 3 replies", texts)
+	}
+	if messages := publisher.Messages(); len(messages) != 0 {
+		t.Errorf("sent text messages %v, want replies spoken", messages)
+	}
+
+	output, err := os.ReadFile(simulationOutputPath(path))
+	if err != nil {
+		t.Fatalf("reply not written: %v", err)
+	}
+	body, format, err := parseWAV(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.SampleRate != webrtcSampleRate || len(body) == 0 {
+		t.Errorf("reply has %d bytes at %d Hz", len(body), format.SampleRate)
+	}
+}
+
+// encodeWAVChannels 封装交错排列的多声道PCM
+func encodeWAVChannels(pcm []int16, sampleRate, channels int) []byte {
+	var buf bytes.Buffer
+	writeWAVHeader(&buf, sampleRate, channels, len(pcm)*2)
+	binary.Write(&buf, binary.LittleEndian, pcm)
+	return buf.Bytes()
+}
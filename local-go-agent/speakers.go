@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// RespondMode 决定代理回应哪些参与者的语音
+type RespondMode string
+
+const (
+	// RespondToAll 回应所有参与者
+	RespondToAll RespondMode = "all"
+	// RespondToActiveSpeaker 只回应当前的主讲人，其他人的语音先缓冲，成为主讲人后再处理
+	RespondToActiveSpeaker RespondMode = "active_speaker"
+)
+
+// 其他人需要持续成为最响亮的说话人这么久才能接替主讲人，避免短暂插话抢走发言权
+const defaultActiveSpeakerHold = 1500 * time.Millisecond
+
+func (m RespondMode) validate() error {
+	switch m {
+	case "", RespondToAll, RespondToActiveSpeaker:
+		return nil
+	default:
+		return fmt.Errorf("未知的回应模式: %s", m)
+	}
+}
+
+// activeSpeakerGate 根据LiveKit的活跃说话人更新决定当前的主讲人。
+// 没有主讲人时第一个说话的人立即成为主讲人；之后其他人必须连续 hold 时长都是最响亮的说话人才能接替
+type activeSpeakerGate struct {
+	hold time.Duration
+	now  func() time.Time
+
+	mu sync.Mutex
+	// 当前主讲人
+	active string
+	// 最近一次更新中最响亮的说话人，以及他从何时开始一直最响亮
+	dominant      string
+	dominantSince time.Time
+}
+
+func newActiveSpeakerGate(hold time.Duration) *activeSpeakerGate {
+	if hold <= 0 {
+		hold = defaultActiveSpeakerHold
+	}
+	return &activeSpeakerGate{hold: hold, now: time.Now}
+}
+
+// Update 记录最新的活跃说话人，identities 按音量从大到小排列
+func (g *activeSpeakerGate) Update(identities []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.promote()
+
+	dominant := ""
+	if len(identities) > 0 {
+		dominant = identities[0]
+	}
+	if dominant != g.dominant {
+		g.dominant = dominant
+		g.dominantSince = g.now()
+	}
+	if g.active == "" {
+		g.active = dominant
+	}
+}
+
+// Active 返回当前的主讲人
+func (g *activeSpeakerGate) Active() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.promote()
+	return g.active
+}
+
+// Allows 判断是否应回应该参与者，没有主讲人时回应所有人
+func (g *activeSpeakerGate) Allows(identity string) bool {
+	active := g.Active()
+	return active == "" || active == identity
+}
+
+// Forget 在参与者离开时让出发言权
+func (g *activeSpeakerGate) Forget(identity string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.dominant == identity {
+		g.dominant = ""
+	}
+	if g.active == identity {
+		g.active = g.dominant
+	}
+}
+
+// promote 在最响亮的说话人持续足够久后让他成为主讲人，调用方需持有锁
+func (g *activeSpeakerGate) promote() {
+	if g.dominant != "" && g.dominant != g.active && g.now().Sub(g.dominantSince) >= g.hold {
+		g.active = g.dominant
+	}
+}
+
+func (a *AIAgent) onActiveSpeakersChanged(speakers []lksdk.Participant) {
+	identities := make([]string, 0, len(speakers))
+	for _, speaker := range speakers {
+		// 忽略代理自己的语音
+		if _, ok := speaker.(*lksdk.RemoteParticipant); ok {
+			identities = append(identities, speaker.Identity())
+		}
+	}
+
+	previous := a.speakers.Active()
+	a.speakers.Update(identities)
+	if active := a.speakers.Active(); active != previous {
+		a.logger.Debugf("主讲人变为: %s", active)
+	}
+}
+
+// respondsTo 判断是否应处理该参与者的语音
+func (a *AIAgent) respondsTo(identity string) bool {
+	if a.config.Audio.RespondTo != RespondToActiveSpeaker {
+		return true
+	}
+	return a.speakers.Allows(identity)
+}
+
+// heldAudio 缓冲非主讲人的发言，成为主讲人后与下一段发言一起处理
+type heldAudio struct {
+	pcm []int16
+	// pcm 开头与已送出的上一段语音重复的采样数
+	overlap  int
+	capacity int
+}
+
+// deliverUtterance 把一段发言送入对话队列。只回应主讲人时其他人的发言先缓冲，
+// 缓冲超过上限时丢弃最早的音频。返回发言是否进入了队列
+func (a *AIAgent) deliverUtterance(request turnRequest, participant *lksdk.RemoteParticipant, held *heldAudio) bool {
+	if !a.respondsTo(participant.Identity()) {
+		if len(held.pcm) == 0 {
+			held.pcm, held.overlap = request.pcm, request.overlap
+		} else {
+			held.pcm = append(held.pcm, request.fresh()...)
+		}
+		if overflow := len(held.pcm) - held.capacity; overflow > 0 {
+			held.pcm = append([]int16(nil), held.pcm[overflow:]...)
+			held.overlap = max(held.overlap-overflow, 0)
+		}
+		a.logger.Debugf("%s 不是主讲人，缓冲其发言", participant.Identity())
+		return false
+	}
+
+	if len(held.pcm) > 0 {
+		request.pcm = append(held.pcm, request.fresh()...)
+		request.overlap = held.overlap
+		held.pcm, held.overlap = nil, 0
+	}
+	a.enqueueTurn(participant, request)
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestActiveSpeakerGate(t *testing.T) {
+	now := time.Now()
+	gate := newActiveSpeakerGate(time.Second)
+	gate.now = func() time.Time { return now }
+
+	if !gate.Allows("alice") || !gate.Allows("bob") {
+		t.Fatal("gate without an active speaker should allow everyone")
+	}
+
+	gate.Update([]string{"alice"})
+	if gate.Active() != "alice" {
+		t.Fatalf("active = %q, want alice", gate.Active())
+	}
+
+	// 短暂插话不会抢走发言权
+	gate.Update([]string{"bob", "alice"})
+	now = now.Add(300 * time.Millisecond)
+	gate.Update([]string{"alice", "bob"})
+	now = now.Add(time.Second)
+	if gate.Active() != "alice" || gate.Allows("bob") {
+		t.Fatalf("brief interjection took over: active = %q", gate.Active())
+	}
+
+	// 持续成为最响亮的说话人后接替主讲人
+	gate.Update([]string{"bob"})
+	now = now.Add(500 * time.Millisecond)
+	if gate.Active() != "alice" {
+		t.Fatalf("bob took over after 500ms")
+	}
+	now = now.Add(600 * time.Millisecond)
+	if gate.Active() != "bob" || gate.Allows("alice") {
+		t.Fatalf("active = %q after bob spoke for 1.1s, want bob", gate.Active())
+	}
+
+	// 主讲人离开后让出发言权
+	gate.Forget("bob")
+	if !gate.Allows("alice") {
+		t.Error("gate still closed after the active speaker left")
+	}
+}
+
+func TestDeliverUtteranceHoldsOtherSpeakers(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	agent.config.Audio.RespondTo = RespondToActiveSpeaker
+	agent.speakers.Update([]string{"alice"})
+
+	// 测试中的参与者身份为空，不是主讲人
+	bob := &lksdk.RemoteParticipant{}
+	held := &heldAudio{capacity: 4}
+	agent.deliverUtterance(turnRequest{pcm: []int16{1, 2, 3}}, bob, held)
+	agent.deliverUtterance(turnRequest{pcm: []int16{4, 5, 6}}, bob, held)
+
+	// 只保留最近的音频
+	if got := held.pcm; len(got) != 4 || got[0] != 3 || got[3] != 6 {
+		t.Fatalf("held audio = %v, want [3 4 5 6]", got)
+	}
+	agent.queuesMu.Lock()
+	defer agent.queuesMu.Unlock()
+	if len(agent.queues) != 0 {
+		t.Fatal("utterance from a non-active speaker was queued")
+	}
+}
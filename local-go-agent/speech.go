@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	// 等待合成的句子数量上限，超过后生成回复的一方会等待合成跟上
+	speechQueueSize = 16
+	// 默认同时合成的句子数
+	defaultTTSConcurrency = 2
+	// 某一句合成失败时代替它的停顿
+	failedSentencePause = 300 * time.Millisecond
+)
+
+// speechPipeline 把流式生成的回复按句切分，每个完整的句子立即送去合成并按顺序播放，
+// 后面的句子还在生成时前面的句子已经可以播放。逐句合成时最多同时合成 concurrency 句，
+// 按句子序号重新排序后播放。服务支持流式合成时文本直接写入合成会话，音频边合成边播放；
+// 配置了可选的声音时逐句合成，每句按其中的声音标记选择声音
+type speechPipeline struct {
+	agent       *AIAgent
+	ctx         context.Context
+	participant *lksdk.RemoteParticipant
+	language    string
+	concurrency int
+
+	splitter  *SentenceSplitter
+	sentences chan string
+	done      chan struct{}
+	written   bool
+	// 回复已完整生成。写入过文本但没有完成时生成中途失败，Finish 改说兜底文案
+	completed bool
+
+	// 流式合成会话，为空时逐句合成
+	stream  SpeechStream
+	sendErr error
+
+	// 由合成协程写入，done 关闭后读取
+	ok bool
+	// 回复被新的回复取代后不再合成和播放
+	preempted atomic.Bool
+
+	// 配置了 max_reply_duration 时按估算的朗读时长截断回复，为空时不限制
+	limiter *replyLimiter
+}
+
+// replyWriter 接收流式生成的回复，speechPipeline 边生成边合成
+type replyWriter interface {
+	Write(delta string)
+	// Complete 在回复完整生成后调用，生成失败时不调用
+	Complete()
+}
+
+func (a *AIAgent) startSpeech(ctx context.Context, participant *lksdk.RemoteParticipant, language string) *speechPipeline {
+	p := &speechPipeline{
+		agent:       a,
+		ctx:         withPlayback(ctx),
+		participant: participant,
+		language:    language,
+		concurrency: max(a.config.Audio.TTSConcurrency, 1),
+		splitter:    NewSentenceSplitter(defaultMaxSentenceRunes),
+		sentences:   make(chan string, speechQueueSize),
+		done:        make(chan struct{}),
+		limiter:     newReplyLimiter(a.config.Audio.MaxReplyDuration),
+	}
+	if streaming, ok := a.tts.(StreamingTextToSpeech); ok && a.config.LiveKit.Publish && a.voices.Len() == 0 {
+		stream, err := streaming.StreamSession(ctx, a.speechOptions(participant, language))
+		if err == nil {
+			p.stream = stream
+			go p.runStream()
+			return p
+		}
+		a.turnLogger(ctx).Warnf("打开流式语音合成失败，改为逐句合成: %v", err)
+	}
+	go p.run()
+	return p
+}
+
+// Write 追加一段流式生成的回复文本
+func (p *speechPipeline) Write(delta string) {
+	p.written = true
+	if p.limiter != nil {
+		p.queue(p.limiter.Push(delta))
+		return
+	}
+	if p.stream != nil {
+		p.sendText(delta)
+		return
+	}
+	for _, sentence := range p.splitter.Push(delta) {
+		p.sentences <- sentence
+	}
+}
+
+// Complete 表示通过 Write 写入的回复已完整生成
+func (p *speechPipeline) Complete() {
+	p.completed = true
+}
+
+// Finish 送出剩余的不完整句子并等待全部播放完成。reply 是完整回复，没有通过 Write
+// 流式写入（如使用兜底文案）时整段合成；流式生成中途失败时丢弃没说完的半句，接着说 reply。
+// 所有句子都成功播放，或回复被新的回复取代时返回 true
+func (p *speechPipeline) Finish(reply string) bool {
+	switch {
+	case !p.written:
+		p.Write(reply)
+	case !p.completed && reply != "":
+		p.interrupt(reply)
+	}
+	if p.limiter != nil {
+		p.queue(p.limiter.Flush())
+	}
+	if p.stream != nil {
+		if p.sendErr == nil && !p.preempted.Load() {
+			if err := p.stream.CloseSend(); err != nil && !p.preempted.Load() {
+				p.failSend(err)
+			}
+		}
+		p.wait()
+		return p.preempted.Load() || (p.ok && p.sendErr == nil)
+	}
+	if sentence := p.splitter.Flush(); sentence != "" {
+		p.sentences <- sentence
+	}
+	close(p.sentences)
+	p.wait()
+	return p.ok
+}
+
+// interrupt 丢弃还在缓冲的半句，把兜底文案作为单独的句子送出。已送入流式合成会话的文本无法撤回
+func (p *speechPipeline) interrupt(fallback string) {
+	if p.limiter != nil {
+		p.limiter.Flush()
+	}
+	p.splitter.Flush()
+	if p.stream != nil {
+		p.sendText(fallback)
+		return
+	}
+	p.sentences <- fallback
+}
+
+// queue 送出经过 limiter 截断后保留的完整句子
+func (p *speechPipeline) queue(sentences []string) {
+	for _, sentence := range sentences {
+		if p.stream != nil {
+			p.sendText(sentence)
+			continue
+		}
+		p.sentences <- sentence
+	}
+}
+
+// wait 等待合成协程结束。对话被取消时还没播完的音频淡出，不再继续播放
+func (p *speechPipeline) wait() {
+	<-p.done
+	if p.ctx.Err() != nil {
+		stopPlayback(p.ctx)
+	}
+}
+
+// synthesizedSentence 是一句合成好的音频，index 是句子在回复中的序号
+type synthesizedSentence struct {
+	index      int
+	pcm        []float32
+	sampleRate int
+	ok         bool
+}
+
+// run 按原顺序播放并发合成的句子。每句占用一个并发名额直到播放完，
+// 前面的句子合成较慢时后面最多只会多合成 concurrency-1 句
+func (p *speechPipeline) run() {
+	defer close(p.done)
+
+	a := p.agent
+	logger := a.turnLogger(p.ctx)
+	identity := p.participant.Identity()
+	// 不发布语音轨道时合成的语音无处播放
+	p.ok = a.tts != nil && a.config.LiveKit.Publish
+	if !p.ok {
+		logger.Debug("语音合成服务不可用或不发布语音，发送文本回复")
+		// 只消费句子，让生成方不被阻塞
+		for range p.sentences {
+		}
+		return
+	}
+
+	slots := make(chan struct{}, p.concurrency)
+	results := make(chan synthesizedSentence, p.concurrency)
+	go p.synthesize(slots, results)
+
+	pending := make(map[int]synthesizedSentence)
+	next := 0
+	started := false
+	for result := range results {
+		pending[result.index] = result
+		for {
+			sentence, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if p.play(sentence, &started) {
+				logger.Info("回复被新的回复取代，停止合成")
+				p.preempted.Store(true)
+			}
+			<-slots
+		}
+	}
+
+	if started {
+		a.emit(AgentEvent{Type: EventSpeechEnded, ParticipantIdentity: identity})
+	}
+}
+
+// synthesize 为每个句子分配序号并在并发名额内合成，结果写入 results，全部合成完后关闭
+func (p *speechPipeline) synthesize(slots chan struct{}, results chan<- synthesizedSentence) {
+	var wg sync.WaitGroup
+	defer close(results)
+	defer wg.Wait()
+
+	index := 0
+	// 声音标记对之后的句子持续有效，直到遇到下一个标记
+	voice := ""
+	for sentence := range p.sentences {
+		// 对话已取消或回复被取代后只消费剩余的句子，让生成方不被阻塞
+		if p.ctx.Err() != nil || p.preempted.Load() {
+			continue
+		}
+		var segments []voiceSegment
+		segments, voice = splitVoiceSegments(sentence, voice)
+		if len(segments) == 0 {
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(index int, segments []voiceSegment) {
+			defer wg.Done()
+			result := synthesizedSentence{index: index}
+			if p.ctx.Err() == nil && !p.preempted.Load() {
+				result.pcm, result.sampleRate, result.ok = p.agent.synthesizeSegments(p.ctx, p.participant, segments, p.language)
+			}
+			results <- result
+		}(index, segments)
+		index++
+	}
+}
+
+// play 播放一句合成好的音频，合成失败的句子跳过并以短暂停顿代替。回复被取代时返回 true
+func (p *speechPipeline) play(sentence synthesizedSentence, started *bool) bool {
+	a := p.agent
+	if p.ctx.Err() != nil || p.preempted.Load() {
+		return false
+	}
+	if !sentence.ok {
+		// 其余句子照常播放，完整回复仍会以文本发送
+		p.ok = false
+		if !*started {
+			return false
+		}
+		pause := make([]float32, int(failedSentencePause)*sttSampleRate/int(time.Second))
+		return !a.sendAudioMessage(p.ctx, pause, sttSampleRate, p.participant)
+	}
+	if !*started {
+		*started = true
+		a.emit(AgentEvent{Type: EventSpeechStarted, ParticipantIdentity: p.participant.Identity()})
+	}
+	return !a.sendAudioMessage(p.ctx, sentence.pcm, sentence.sampleRate, p.participant)
+}
+
+// sendText 把生成的文本写入合成会话，发送失败后关闭会话并忽略之后的文本
+func (p *speechPipeline) sendText(text string) {
+	if p.sendErr != nil || p.ctx.Err() != nil || p.preempted.Load() {
+		return
+	}
+	if err := p.stream.SendText(text); err != nil {
+		p.failSend(err)
+		return
+	}
+	p.agent.chargeCharacters(p.ctx, text)
+}
+
+func (p *speechPipeline) failSend(err error) {
+	p.sendErr = err
+	p.agent.turnLogger(p.ctx).Errorf("流式语音合成失败: %v", err)
+	p.stream.Close()
+}
+
+// runStream 播放流式合成返回的音频，直到会话结束
+func (p *speechPipeline) runStream() {
+	defer close(p.done)
+	defer p.stream.Close()
+
+	a := p.agent
+	logger := a.turnLogger(p.ctx)
+	identity := p.participant.Identity()
+	sampleRate := p.stream.Format().SampleRate
+
+	// 流式合成时TTS阶段耗时记为首段音频的延迟
+	ttsStart := time.Now()
+	started := false
+	for frame := range p.stream.Frames() {
+		// 关闭会话后剩余的音频被丢弃，Frames 随之结束
+		if p.preempted.Load() {
+			continue
+		}
+		if !started {
+			started = true
+			a.observeStage(p.ctx, stageTTS, time.Since(ttsStart))
+			a.emit(AgentEvent{Type: EventSpeechStarted, ParticipantIdentity: identity})
+		}
+		if !a.sendAudioMessage(p.ctx, frame, sampleRate, p.participant) {
+			logger.Info("回复被新的回复取代，停止合成")
+			p.preempted.Store(true)
+			p.stream.Close()
+		}
+	}
+
+	p.ok = true
+	// 对话被取消、发送失败或回复被取代时会话被主动关闭，不再重复记录
+	if err := p.stream.Err(); err != nil && p.ctx.Err() == nil && !p.preempted.Load() && err != errSpeechStreamClosed {
+		logger.Errorf("文字转语音失败: %v", err)
+		a.metrics.IncError(stageTTS)
+		a.emitError(identity, err)
+		p.ok = false
+	}
+	if started {
+		a.emit(AgentEvent{Type: EventSpeechEnded, ParticipantIdentity: identity})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// orderedTTS 合成 "第N句。" 时返回 N*10ms 的静音，前面的句子合成得更慢，
+// 并记录同时进行的合成数
+type orderedTTS struct {
+	fail string
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (f *orderedTTS) Synthesize(ctx context.Context, text string) (io.ReadCloser, AudioFormat, error) {
+	f.mu.Lock()
+	f.inFlight++
+	f.peak = max(f.peak, f.inFlight)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	n := strings.Index("零一二三四五", strings.TrimSuffix(strings.TrimPrefix(text, "第"), "句。")) / len("零")
+	time.Sleep(time.Duration(6-n) * 10 * time.Millisecond)
+	if text == f.fail {
+		return nil, AudioFormat{}, errors.New("synthesis failed")
+	}
+	silence := make([]byte, n*sttSampleRate/100*2)
+	return io.NopCloser(bytes.NewReader(silence)), AudioFormat{SampleRate: sttSampleRate, Channels: 1, Encoding: AudioEncodingPCMS16LE}, nil
+}
+
+// recordingOutput 记录每段播放的音频时长
+type recordingOutput struct {
+	mu        sync.Mutex
+	durations []time.Duration
+}
+
+func (o *recordingOutput) Write(samples []float32, sampleRate int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.durations = append(o.durations, time.Duration(len(samples))*time.Second/time.Duration(sampleRate))
+}
+
+func speakSentences(t *testing.T, tts *orderedTTS, concurrency int) ([]time.Duration, bool) {
+	t.Helper()
+	agent, _ := newTestAgent(&AIServices{TTS: tts})
+	agent.config.Audio.TTSConcurrency = concurrency
+	output := &recordingOutput{}
+	agent.audioOut = output
+
+	speech := agent.startSpeech(context.Background(), &lksdk.RemoteParticipant{}, "")
+	speech.Write("第一句。第二句。第三句。第四句。")
+	ok := speech.Finish("")
+	return output.durations, ok
+}
+
+func TestSpeechPlaysConcurrentSentencesInOrder(t *testing.T) {
+	tts := &orderedTTS{}
+	durations, ok := speakSentences(t, tts, 3)
+	if !ok {
+		t.Error("reply was not spoken")
+	}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 40 * time.Millisecond}
+	if !reflect.DeepEqual(durations, want) {
+		t.Errorf("played %v, want sentences in their original order %v", durations, want)
+	}
+	if tts.peak < 2 || tts.peak > 3 {
+		t.Errorf("peak concurrent syntheses = %d, want between 2 and 3", tts.peak)
+	}
+}
+
+func TestSpeechSkipsFailedSentence(t *testing.T) {
+	durations, ok := speakSentences(t, &orderedTTS{fail: "第二句。"}, 2)
+	if ok {
+		t.Error("a reply with a failed sentence should fall back to a text message")
+	}
+	want := []time.Duration{10 * time.Millisecond, failedSentencePause, 30 * time.Millisecond, 40 * time.Millisecond}
+	if !reflect.DeepEqual(durations, want) {
+		t.Errorf("played %v, want %v", durations, want)
+	}
+}
+
+func TestSpeechSpeaksFallbackWhenStreamFails(t *testing.T) {
+	tts := &fakeTTS{}
+	llm := &fakeLLM{reply: "第一句。第二句说到一半", err: errors.New("connection reset")}
+	agent, _ := newTestAgent(&AIServices{LLM: llm, TTS: tts})
+	agent.audioOut = &recordingOutput{}
+
+	agent.respond(context.Background(), &lksdk.RemoteParticipant{}, "", "你好", "zh", true)
+
+	// 句子并发合成，合成顺序不固定
+	texts := strings.Join(tts.Texts(), "|")
+	if !strings.Contains(texts, "第一句。") || !strings.Contains(texts, "抱歉") {
+		t.Errorf("synthesized %q, want the first sentence followed by the fallback", texts)
+	}
+	if strings.Contains(texts, "说到一半") {
+		t.Errorf("synthesized the cut-off sentence: %q", texts)
+	}
+}
+
+// fillerRecorder 记录播放填充音的次数
+type fillerRecorder struct {
+	recordingOutput
+	fillers int
+}
+
+func (o *fillerRecorder) WriteFiller(samples []float32, sampleRate int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.fillers++
+}
+
+func TestFillerPlaysOnlyForAcceptedTranscripts(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{LLM: &fakeLLM{reply: "好的。"}})
+	agent.filler = &FillerPlayer{clip: make([]float32, 800), sampleRate: 8000}
+	output := &fillerRecorder{}
+	agent.audioOut = output
+	participant := &lksdk.RemoteParticipant{}
+
+	for _, text := range []string{"", "嗯嗯", "umm"} {
+		agent.processTranscript(context.Background(), Transcript{Text: text, Final: true}, participant)
+	}
+	if output.fillers != 0 {
+		t.Errorf("filler played %d times for rejected transcripts", output.fillers)
+	}
+	agent.processTranscript(context.Background(), Transcript{Text: "今天天气怎么样", Final: true}, participant)
+	if output.fillers != 1 {
+		t.Errorf("filler played %d times, want once for the accepted transcript", output.fillers)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+// State 是代理与房间的连接状态
+type State int
+
+const (
+	// StateDisconnected 未连接，初始状态，也是主动断开后的最终状态
+	StateDisconnected State = iota
+	// StateConnecting 正在首次连接房间
+	StateConnecting
+	// StateConnected 已连接，正常处理对话
+	StateConnected
+	// StateReconnecting 意外断线，正在重新连接
+	StateReconnecting
+	// StateShuttingDown 正在等待进行中的对话完成后断开
+	StateShuttingDown
+)
+
+// 状态变化通道的缓冲大小，缓冲区满时丢弃最早的状态，保证最新的状态总能送达
+const stateBufferSize = 16
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateShuttingDown:
+		return "shutting_down"
+	default:
+		return "unknown"
+	}
+}
+
+// State 返回代理当前的连接状态
+func (a *AIAgent) State() State {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	return a.state
+}
+
+// StateChanges 返回状态变化的通道，每次状态改变时发送新的状态。通道不会关闭
+func (a *AIAgent) StateChanges() <-chan State {
+	return a.stateChanges
+}
+
+// setState 切换到新的状态，状态没有变化时不通知
+func (a *AIAgent) setState(state State) {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	a.changeState(state)
+}
+
+// compareAndSetState 只在当前状态为 from 时切换到 to，返回是否切换
+func (a *AIAgent) compareAndSetState(from, to State) bool {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	if a.state != from {
+		return false
+	}
+	a.changeState(to)
+	return true
+}
+
+// beginShutdown 切换到 StateShuttingDown，已经断开的代理保持断开的状态
+func (a *AIAgent) beginShutdown() {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	if a.state != StateDisconnected {
+		a.changeState(StateShuttingDown)
+	}
+}
+
+// changeState 记录并通知状态变化，调用方需持有 stateMu
+func (a *AIAgent) changeState(state State) {
+	if a.state == state {
+		return
+	}
+	a.logger.Debugf("连接状态: %s -> %s", a.state, state)
+	a.state = state
+
+	for {
+		select {
+		case a.stateChanges <- state:
+			return
+		default:
+		}
+		// 缓冲区已满，丢弃最早的状态后重试
+		select {
+		case <-a.stateChanges:
+		default:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStateChanges(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	if state := agent.State(); state != StateDisconnected {
+		t.Fatalf("initial state = %s", state)
+	}
+
+	agent.setState(StateConnecting)
+	agent.setState(StateConnected)
+	agent.setState(StateConnected)
+	if agent.compareAndSetState(StateConnecting, StateReconnecting) {
+		t.Error("state changed from a state the agent was not in")
+	}
+	if err := agent.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []State{StateConnecting, StateConnected, StateShuttingDown, StateDisconnected}
+	for _, state := range want {
+		if got := <-agent.StateChanges(); got != state {
+			t.Fatalf("state change = %s, want %s", got, state)
+		}
+	}
+	select {
+	case state := <-agent.StateChanges():
+		t.Errorf("unexpected state change to %s", state)
+	default:
+	}
+}
+
+func TestStateChangesKeepLatest(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+
+	// 没有人读取时缓冲区写满，丢弃最早的状态而不是阻塞
+	for i := 0; i < stateBufferSize; i++ {
+		agent.setState(StateConnected)
+		agent.setState(StateReconnecting)
+	}
+	agent.setState(StateShuttingDown)
+
+	var last State
+	for len(agent.StateChanges()) > 0 {
+		last = <-agent.StateChanges()
+	}
+	if last != StateShuttingDown {
+		t.Errorf("latest state = %s, want %s", last, StateShuttingDown)
+	}
+}
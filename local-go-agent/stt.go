@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SpeechToText 是语音识别服务的抽象，pcm 为 sttSampleRate 采样率的单声道16位小端PCM，
+// lang 为空时由服务自行检测或使用其默认语言
+type SpeechToText interface {
+	Transcribe(ctx context.Context, pcm []byte, lang string) (Transcript, error)
+}
+
+// languageDetector 由能够自动检测语言的识别服务实现
+type languageDetector interface {
+	// DetectsLanguage 返回不指定语言时服务是否自动检测语言
+	DetectsLanguage() bool
+}
+
+// turnDetector 由能够在流式识别中判断一轮发言何时结束的识别服务实现
+type turnDetector interface {
+	// DetectsTurns 返回是否由服务判断发言结束，此时不需要本地切分发言
+	DetectsTurns() bool
+}
+
+// accurateTranscriber 由提供高精度识别模式的服务实现，重新转录录音时使用，比实时识别慢
+type accurateTranscriber interface {
+	TranscribeAccurate(ctx context.Context, pcm []byte, lang string) (Transcript, error)
+}
+
+// optionsTranscriber 由支持按请求设置转录选项的服务实现，识别参与者的发言时带上其元数据中的选项
+type optionsTranscriber interface {
+	TranscribeWithOptions(ctx context.Context, pcm []byte, lang string, opts TranscribeOptions) (Transcript, error)
+}
+
+// StreamingSpeechToText 是支持流式识别的服务可选实现的扩展接口
+type StreamingSpeechToText interface {
+	SpeechToText
+	StartStream(ctx context.Context, lang string) (TranscriptStream, error)
+}
+
+// TranscriptStream 是一次流式识别会话，持续写入PCM并从 Results 读取中间和最终结果
+type TranscriptStream interface {
+	Write(pcm []byte) error
+	Results() <-chan Transcript
+	Close() error
+}
+
+func int16ToBytes(pcm []int16) []byte {
+	data := make([]byte, len(pcm)*2)
+	for i, sample := range pcm {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	return data
+}
+
+func bytesToInt16(data []byte) []int16 {
+	pcm := make([]int16, len(data)/2)
+	for i := range pcm {
+		pcm[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return pcm
+}
+
+const (
+	sttProviderAssemblyAI   = "assemblyai"
+	sttProviderWhisperLocal = "whisper_local"
+)
+
+// newSpeechToText 按配置创建语音识别服务，不可用时返回nil
+func newSpeechToText(cfg *Config, logger *logrus.Logger) SpeechToText {
+	switch cfg.STTProvider {
+	case sttProviderAssemblyAI, "":
+		if cfg.AssemblyAI.APIKey == "" {
+			logger.Warn("未设置ASSEMBLYAI_API_KEY环境变量，AssemblyAI服务将不可用")
+			return nil
+		}
+		service, err := NewAssemblyAIServiceFromConfig(cfg.AssemblyAI)
+		if err != nil {
+			logger.Errorf("初始化AssemblyAI服务失败: %v", err)
+			return nil
+		}
+		service.SetProgressHandler(func(progress TranscriptionProgress) {
+			logger.Debugf("AssemblyAI转录 %s: %s", progress.TranscriptID, progress.Status)
+		})
+		service.setDebugger(newAPIDebugger(cfg.Log, logger, "AssemblyAI"))
+		logger.Info("AssemblyAI服务已初始化")
+		return service
+	case sttProviderWhisperLocal:
+		service, err := NewWhisperLocalService(cfg.Whisper.ModelPath)
+		if err != nil {
+			logger.Errorf("初始化本地Whisper服务失败: %v", err)
+			return nil
+		}
+		logger.Info("本地Whisper服务已初始化")
+		return service
+	default:
+		logger.Errorf("未知的语音识别服务: %s", cfg.STTProvider)
+		return nil
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// turnStream 把参与者的音频持续送入由识别服务检测发言结束的流式识别，代替本地按静音切分发言。
+// 中间结果作为实时字幕发布，每轮发言的格式化结果直接进入对话队列
+type turnStream struct {
+	agent       *AIAgent
+	participant *lksdk.RemoteParticipant
+	trackSID    string
+	stt         StreamingSpeechToText
+
+	stream TranscriptStream
+	// 上一轮发言结束后送去识别的采样数，用于估算费用
+	streamed atomic.Int64
+	// 识别会话无法恢复后不再打开，之后的音频按本地切分发言处理
+	failed bool
+}
+
+// newTurnStream 在识别服务支持并开启了服务端轮次检测时返回 turnStream，否则返回 nil。
+// 回声模式直接回放音频，不使用识别服务
+func (a *AIAgent) newTurnStream(participant *lksdk.RemoteParticipant, trackSID string) *turnStream {
+	if a.config.Echo.Mode != EchoModeOff {
+		return nil
+	}
+	detector, ok := a.stt.(turnDetector)
+	if !ok || !detector.DetectsTurns() {
+		return nil
+	}
+	streaming, ok := a.stt.(StreamingSpeechToText)
+	if !ok {
+		return nil
+	}
+	return &turnStream{agent: a, participant: participant, trackSID: trackSID, stt: streaming}
+}
+
+// Write 把一帧预处理后的音频送入流式识别，返回 false 时调用方按本地切分发言处理。
+// 等待唤醒时不打开识别会话，由本地切分的发言查找唤醒词
+func (t *turnStream) Write(ctx context.Context, pcm []int16) bool {
+	if t == nil || t.failed {
+		return false
+	}
+	identity := t.participant.Identity()
+	if t.agent.wakeWordIdle(identity) {
+		t.Close()
+		return false
+	}
+	if t.stream == nil {
+		stream, err := t.stt.StartStream(ctx, t.agent.participantLanguage(identity))
+		if err != nil {
+			t.agent.logger.Errorf("打开 %s 的流式识别失败，改为本地切分发言: %v", identity, err)
+			t.failed = true
+			return false
+		}
+		if !t.agent.spawn("流式识别", func() { t.receive(ctx, stream) }) {
+			stream.Close()
+			return false
+		}
+		t.stream = stream
+	}
+	if err := t.stream.Write(int16ToBytes(pcm)); err != nil {
+		t.agent.logger.Errorf("%s 的流式识别中断，改为本地切分发言: %v", identity, err)
+		t.Close()
+		t.failed = true
+		return false
+	}
+	t.streamed.Add(int64(len(pcm)))
+	return true
+}
+
+// receive 发布中间结果并把每轮发言的最终结果送入对话队列，直到识别会话关闭
+func (t *turnStream) receive(ctx context.Context, stream TranscriptStream) {
+	identity := t.participant.Identity()
+	for result := range stream.Results() {
+		if !result.Final {
+			if result.Text != "" && !t.agent.wakeWordIdle(identity) {
+				t.agent.publishCaption(captionTypeTranscript, identity, result.Text, false)
+			}
+			continue
+		}
+		streamed := time.Duration(t.streamed.Swap(0)) * time.Second / sttSampleRate
+		// 文字结果无法像音频一样缓冲到成为主讲人之后
+		if !t.agent.respondsTo(identity) {
+			t.agent.logger.Debugf("%s 不是主讲人，忽略其发言", identity)
+			t.agent.chargeAudio(ctx, streamed)
+			continue
+		}
+		transcript := result
+		t.agent.enqueueTurn(t.participant, turnRequest{ctx: ctx, transcript: &transcript, streamed: streamed, trackSID: t.trackSID})
+	}
+}
+
+// Close 结束识别会话
+func (t *turnStream) Close() {
+	if t == nil || t.stream == nil {
+		return
+	}
+	t.stream.Close()
+	t.stream = nil
+}
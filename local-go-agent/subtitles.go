@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SubtitleFormat 是导出字幕的格式
+type SubtitleFormat string
+
+const (
+	SubtitleWebVTT SubtitleFormat = "vtt"
+	SubtitleSRT    SubtitleFormat = "srt"
+)
+
+// 一条字幕的时长和字数上限，词之间停顿超过 subtitleGap 时另起一条
+const (
+	maxSubtitleDuration = 6 * time.Second
+	maxSubtitleRunes    = 42
+	subtitleGap         = time.Second
+)
+
+func (f SubtitleFormat) validate() error {
+	switch f {
+	case SubtitleWebVTT, SubtitleSRT:
+		return nil
+	default:
+		return fmt.Errorf("未知的字幕格式: %s，可选 vtt 或 srt", f)
+	}
+}
+
+// subtitleCue 是一条字幕，时间相对会话开始
+type subtitleCue struct {
+	start, end time.Duration
+	speaker    string
+	text       string
+}
+
+// ExportSubtitles 把一次会话保存的对话记录导出为 WebVTT 或 SRT 字幕。字幕由参与者发言的逐词时间戳生成，
+// 时间相对代理加入房间的时间；会话中有多位说话人（包括混音轨道中分离出的说话人）时每条字幕标注说话人。代理的回复没有逐词时间戳，不写入字幕
+func (s *AIServices) ExportSubtitles(sessionID string, format SubtitleFormat) ([]byte, error) {
+	if err := format.validate(); err != nil {
+		return nil, err
+	}
+	if s.transcripts == nil {
+		return nil, errors.New("未配置 transcripts.path，没有可导出的对话记录")
+	}
+	reader, ok := s.transcripts.(sessionReader)
+	if !ok {
+		return nil, errSessionUnreadable
+	}
+	turns, err := reader.SessionTurns(context.Background(), sessionID)
+	if err != nil {
+		return nil, err
+	}
+	cues := subtitleCues(turns)
+	if len(cues) == 0 {
+		return nil, fmt.Errorf("会话 %s 没有带逐词时间戳的对话记录", sessionID)
+	}
+	return renderSubtitles(cues, format), nil
+}
+
+// subtitleCues 把每轮对话的词按停顿、时长和字数分为字幕，按开始时间排序
+func subtitleCues(turns []Turn) []subtitleCue {
+	var cues []subtitleCue
+	for _, turn := range turns {
+		var cue *subtitleCue
+		for _, word := range turn.Words {
+			start := time.Duration(word.StartMs) * time.Millisecond
+			end := max(time.Duration(word.EndMs)*time.Millisecond, start)
+			text := joinTranscriptText(cueText(cue), word.Text)
+			// 混音轨道中的词按说话人分离的标签标注，换人时另起一条
+			speaker := wordSpeaker(turn.Identity, word)
+			if cue == nil || cue.speaker != speaker || start-cue.end > subtitleGap || end-cue.start > maxSubtitleDuration || utf8.RuneCountInString(text) > maxSubtitleRunes {
+				cues = append(cues, subtitleCue{start: start, end: end, speaker: speaker, text: strings.TrimSpace(word.Text)})
+				cue = &cues[len(cues)-1]
+				continue
+			}
+			cue.end = end
+			cue.text = text
+		}
+	}
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].start < cues[j].start })
+	return cues
+}
+
+func cueText(cue *subtitleCue) string {
+	if cue == nil {
+		return ""
+	}
+	return cue.text
+}
+
+// renderSubtitles 按格式写出字幕，只有一位说话人时不标注说话人
+func renderSubtitles(cues []subtitleCue, format SubtitleFormat) []byte {
+	speakers := make(map[string]bool)
+	for _, cue := range cues {
+		speakers[cue.speaker] = true
+	}
+	labeled := len(speakers) > 1
+
+	var b strings.Builder
+	if format == SubtitleWebVTT {
+		b.WriteString("WEBVTT\n\n")
+	}
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n", i+1)
+		switch format {
+		case SubtitleWebVTT:
+			fmt.Fprintf(&b, "%s --> %s\n", subtitleTimestamp(cue.start, '.'), subtitleTimestamp(cue.end, '.'))
+			text := escapeVTT(cue.text)
+			if labeled {
+				text = fmt.Sprintf("<v %s>%s", escapeVTT(cue.speaker), text)
+			}
+			b.WriteString(text)
+		case SubtitleSRT:
+			fmt.Fprintf(&b, "%s --> %s\n", subtitleTimestamp(cue.start, ','), subtitleTimestamp(cue.end, ','))
+			if labeled {
+				fmt.Fprintf(&b, "%s: ", cue.speaker)
+			}
+			b.WriteString(cue.text)
+		}
+		b.WriteString("\n\n")
+	}
+	return []byte(b.String())
+}
+
+// subtitleTimestamp 格式化为 hh:mm:ss.mmm，SRT 的毫秒分隔符为逗号
+func subtitleTimestamp(offset time.Duration, separator byte) string {
+	ms := max(offset.Milliseconds(), 0)
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escapeVTT(text string) string {
+	return vttEscaper.Replace(text)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRenderSubtitles(t *testing.T) {
+	turns := []Turn{
+		{Identity: "alice", Words: []Word{
+			{Text: "Hello", StartMs: 1200, EndMs: 1500},
+			{Text: "there.", StartMs: 1600, EndMs: 2000},
+			// 停顿超过一秒，另起一条
+			{Text: "A<B", StartMs: 3500, EndMs: 3900},
+		}},
+		{Identity: "bob", Words: []Word{{Text: "你", StartMs: 3661000, EndMs: 3661200}, {Text: "好", StartMs: 3661200, EndMs: 3661400}}},
+	}
+	cues := subtitleCues(turns)
+
+	vtt := "WEBVTT\n\n" +
+		"1\n00:00:01.200 --> 00:00:02.000\n<v alice>Hello there.\n\n" +
+		"2\n00:00:03.500 --> 00:00:03.900\n<v alice>A&lt;B\n\n" +
+		"3\n01:01:01.000 --> 01:01:01.400\n<v bob>你好\n\n"
+	if got := string(renderSubtitles(cues, SubtitleWebVTT)); got != vtt {
+		t.Errorf("vtt =\n%s\nwant\n%s", got, vtt)
+	}
+	srt := "1\n00:00:01,200 --> 00:00:02,000\nalice: Hello there.\n\n" +
+		"2\n00:00:03,500 --> 00:00:03,900\nalice: A<B\n\n" +
+		"3\n01:01:01,000 --> 01:01:01,400\nbob: 你好\n\n"
+	if got := string(renderSubtitles(cues, SubtitleSRT)); got != srt {
+		t.Errorf("srt =\n%s\nwant\n%s", got, srt)
+	}
+
+	// 只有一位说话人时不标注
+	if got := string(renderSubtitles(cues[:2], SubtitleSRT)); strings.Contains(got, "alice:") {
+		t.Errorf("single speaker cues labeled:\n%s", got)
+	}
+}
+
+func TestSubtitleCuesLabelDiarizedSpeakers(t *testing.T) {
+	turns := []Turn{
+		{Identity: "mix", Words: []Word{
+			{Text: "你好", StartMs: 0, EndMs: 400, Speaker: "A"},
+			{Text: "你好", StartMs: 500, EndMs: 900, Speaker: "B"},
+		}},
+		// 按说话人保存的对话中，词的标签与伪身份一致
+		{Identity: speakerIdentity("mix", "A"), Words: []Word{{Text: "开会", StartMs: 2000, EndMs: 2400, Speaker: "A"}}},
+	}
+	var speakers []string
+	for _, cue := range subtitleCues(turns) {
+		speakers = append(speakers, cue.speaker)
+	}
+	if want := []string{"mix#A", "mix#B", "mix#A"}; !reflect.DeepEqual(speakers, want) {
+		t.Errorf("cue speakers = %v, want %v", speakers, want)
+	}
+}
+
+func TestExportSubtitles(t *testing.T) {
+	store, err := NewJSONLTranscriptStore(filepath.Join(t.TempDir(), "turns.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	services := &AIServices{transcripts: newAsyncTranscriptStore(store, logger)}
+	defer services.Close()
+
+	words := []Word{{Text: "会议", StartMs: 0, EndMs: 400}, {Text: "开始", StartMs: 400, EndMs: 900}}
+	services.transcripts.SaveTurn(context.Background(), Turn{SessionID: "room-1", Identity: "alice", UserText: "会议开始", Words: words})
+	services.transcripts.SaveTurn(context.Background(), Turn{SessionID: "room-2", Identity: "bob", UserText: "其他会话", Words: words})
+	services.transcripts.SaveTurn(context.Background(), Turn{SessionID: "room-3", Identity: "carol", UserText: "文字消息"})
+
+	subtitles, err := services.ExportSubtitles("room-1", SubtitleSRT)
+	if err != nil {
+		t.Fatalf("ExportSubtitles: %v", err)
+	}
+	if want := "1\n00:00:00,000 --> 00:00:00,900\n会议开始\n\n"; string(subtitles) != want {
+		t.Errorf("subtitles = %q, want %q", subtitles, want)
+	}
+	if _, err := services.ExportSubtitles("room-3", SubtitleSRT); err == nil {
+		t.Error("exported a session without word timings")
+	}
+	if _, err := services.ExportSubtitles("room-1", "ass"); err == nil {
+		t.Error("exported an unknown format")
+	}
+}
+
+func TestSavedTurnWordsAreSessionRelative(t *testing.T) {
+	stt := &fakeSTT{result: Transcript{Text: "几点了", Confidence: 0.9, Final: true, Words: []Word{
+		{Text: "几点", StartMs: 200, EndMs: 500},
+		{Text: "了", StartMs: 500, EndMs: 700},
+	}}}
+	agent, _ := newTestAgent(&AIServices{STT: stt, LLM: &fakeLLM{reply: "三点了。"}, TTS: &fakeTTS{}})
+	store := &MemoryTranscriptStore{}
+	agent.transcripts = store
+
+	// 一秒的发言在会话开始5秒后结束，从第4秒开始
+	request := turnRequest{ctx: context.Background(), pcm: make([]int16, sttSampleRate), received: agent.started.Add(5 * time.Second)}
+	agent.enqueueTurn(&lksdk.RemoteParticipant{}, request)
+	agent.turns.Wait()
+
+	turns := store.Turns()
+	if len(turns) != 1 {
+		t.Fatalf("saved %d turns, want 1", len(turns))
+	}
+	want := []Word{{Text: "几点", StartMs: 4200, EndMs: 4500}, {Text: "了", StartMs: 4500, EndMs: 4700}}
+	if turns[0].SessionID != agent.SessionID() || !reflect.DeepEqual(turns[0].Words, want) {
+		t.Errorf("turn session %q words %+v, want %q %+v", turns[0].SessionID, turns[0].Words, agent.SessionID(), want)
+	}
+}
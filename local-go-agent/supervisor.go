@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+)
+
+// supervisor 跟踪一组协程，关闭后不再启动新的协程，可以等待已启动的协程全部退出。
+// 零值可以直接使用
+type supervisor struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Go 在新协程中运行 fn，已关闭时不运行并返回 false
+func (s *supervisor) Go(fn func()) bool {
+	// 加锁保证关闭后不会再有协程计入 wg，Wait 返回后不会有新的协程
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fn()
+	}()
+	return true
+}
+
+// Close 不再启动新的协程，已启动的协程继续运行
+func (s *supervisor) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+}
+
+// Wait 等待已启动的协程全部退出
+func (s *supervisor) Wait() {
+	s.wg.Wait()
+}
+
+// WaitContext 等待已启动的协程全部退出，ctx 结束时不再等待并返回 ctx 的错误
+func (s *supervisor) WaitContext(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type supervisorKey struct{}
+
+// withSupervisor 返回携带 s 的 ctx，服务用由它派生的 ctx 启动的后台协程通过 goTracked 由 s 跟踪
+func withSupervisor(ctx context.Context, s *supervisor) context.Context {
+	return context.WithValue(ctx, supervisorKey{}, s)
+}
+
+// goTracked 在 ctx 携带的 supervisor 中运行 fn，ctx 没有携带时直接启动协程。
+// supervisor 已关闭时不运行并返回 false
+func goTracked(ctx context.Context, fn func()) bool {
+	if s, ok := ctx.Value(supervisorKey{}).(*supervisor); ok {
+		return s.Go(fn)
+	}
+	go fn()
+	return true
+}
+
+var errSupervisorClosed = errors.New("代理正在关闭")
+
+// spawn 在代理的后台协程中运行 fn，Shutdown 断开连接后等待它退出。fn 应在 a.ctx 或会话结束时返回。
+// 代理正在关闭时不运行并返回 false
+func (a *AIAgent) spawn(name string, fn func()) bool {
+	if a.closing.Load() {
+		return false
+	}
+	return a.tasks.Go(func() {
+		defer a.recoverPanic(name)
+		fn()
+	})
+}
+
+// recoverPanic 记录协程中的 panic，避免一个参与者的异常让整个进程退出
+func (a *AIAgent) recoverPanic(name string) {
+	if r := recover(); r != nil {
+		a.logger.Errorf("%s panic: %v\n%s", name, r, debug.Stack())
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"go.uber.org/goleak"
+)
+
+func TestShutdownLeavesNoGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	llm := &fakeLLM{block: true}
+	agent, _ := newTestAgent(&AIServices{LLM: llm, TTS: &fakeTTS{}})
+	agent.config.Greeting.Delay = time.Hour
+	// 等待发送欢迎消息的协程、一直在等待LLM的对话，以及一个等到会话结束才退出的后台协程
+	if !agent.spawn("欢迎消息", agent.sendWelcomeMessage) {
+		t.Fatal("spawn refused before shutdown")
+	}
+	agent.spawn("测试", func() { <-agent.ctx.Done() })
+	// 会话的语音输出正在播放一段回复
+	agent.sessionCtx, agent.sessionCancel = context.WithCancel(agent.ctx)
+	track := &fakeTrack{}
+	if err := agent.startAudioOutput(agent.sessionCtx, newTestPacedWriter(track)); err != nil {
+		t.Fatal(err)
+	}
+	agent.sendAudioMessage(agent.ctx, make([]float32, sttSampleRate), sttSampleRate, &lksdk.RemoteParticipant{})
+	for len(track.Samples()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	agent.enqueueTurn(&lksdk.RemoteParticipant{}, turnRequest{ctx: agent.ctx, text: "你好"})
+	for llm.Calls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := agent.Shutdown(ctx); err == nil {
+		t.Error("Shutdown should report that the blocked turn did not finish in time")
+	}
+	// 断开连接取消了对话的上下文，所有协程都会退出
+	agent.turns.Wait()
+	agent.tasks.Wait()
+	sent := len(track.Samples())
+	time.Sleep(3 * audioFrameDuration)
+	if got := len(track.Samples()); got != sent {
+		t.Errorf("%d frames written after Shutdown returned", got-sent)
+	}
+
+	if agent.spawn("测试", func() {}) || agent.startTurn(func() {}) {
+		t.Error("goroutines started after shutdown")
+	}
+}
+
+func TestSpawnRecoversPanic(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{})
+	agent.spawn("测试", func() { panic("boom") })
+	agent.tasks.Wait()
+
+	ran := false
+	agent.spawn("测试", func() { ran = true })
+	agent.tasks.Wait()
+	if !ran {
+		t.Error("supervisor stopped after a panic")
+	}
+}
+
+func TestGoTrackedUsesContextSupervisor(t *testing.T) {
+	var tasks supervisor
+	ctx, cancel := context.WithCancel(withSupervisor(context.Background(), &tasks))
+	defer cancel()
+
+	released := make(chan struct{})
+	if !goTracked(ctx, func() { <-released }) {
+		t.Fatal("goTracked refused before the supervisor was closed")
+	}
+	tasks.Close()
+	if goTracked(ctx, func() {}) {
+		t.Error("goTracked started a goroutine after the supervisor was closed")
+	}
+	close(released)
+	tasks.Wait()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// OutputTarget 决定代理的语音发送到哪里
+type OutputTarget string
+
+const (
+	// OutputTargetWebRTC 发布到房间的语音轨道
+	OutputTargetWebRTC OutputTarget = "webrtc"
+	// OutputTargetTelephony 以G.711编码的RTP发送给 telephony.address，不发布语音轨道
+	OutputTargetTelephony OutputTarget = "telephony"
+	// OutputTargetBoth 同时发布语音轨道和发送给电话网关
+	OutputTargetBoth OutputTarget = "both"
+)
+
+const (
+	telephonyCodecPCMU = "pcmu"
+	telephonyCodecPCMA = "pcma"
+)
+
+func (t OutputTarget) validate() error {
+	switch t {
+	case "", OutputTargetWebRTC, OutputTargetTelephony, OutputTargetBoth:
+		return nil
+	default:
+		return fmt.Errorf("未知的 output_target %q，可选 webrtc、telephony 或 both", t)
+	}
+}
+
+// webrtc 判断是否发布房间的语音轨道
+func (t OutputTarget) webrtc() bool {
+	return t != OutputTargetTelephony
+}
+
+// telephony 判断是否发送给电话网关
+func (t OutputTarget) telephony() bool {
+	return t == OutputTargetTelephony || t == OutputTargetBoth
+}
+
+// TelephonyConfig 是 output_target 包含 telephony 时的电话网关设置。语音重采样到8kHz单声道，
+// 按 G.711 编码后每20ms一个RTP包发送给SIP网关等电话系统
+type TelephonyConfig struct {
+	// 接收RTP的地址 host:port，通常是SIP网关为这路通话分配的媒体端口
+	Address string `yaml:"address"`
+	// 编码: pcmu（μ-law，北美和日本）或 pcma（A-law，其他地区）
+	Codec string `yaml:"codec"`
+}
+
+func (c TelephonyConfig) validate() error {
+	if c.Address == "" {
+		return fmt.Errorf("address 不能为空")
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("address 格式错误: %w", err)
+	}
+	switch strings.ToLower(c.Codec) {
+	case "", telephonyCodecPCMU, telephonyCodecPCMA:
+		return nil
+	default:
+		return fmt.Errorf("未知的 codec %q，可选 pcmu 或 pcma", c.Codec)
+	}
+}
+
+// encoder 返回配置的 G.711 编码器
+func (c TelephonyConfig) encoder() audioEncoder {
+	if strings.ToLower(c.Codec) == telephonyCodecPCMA {
+		return pcmaEncoder{}
+	}
+	return pcmuEncoder{}
+}
+
+// pcmaEncoder 使用G.711 A-law 编码
+type pcmaEncoder struct{}
+
+func (pcmaEncoder) Codec() webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMA, ClockRate: 8000}
+}
+
+func (pcmaEncoder) SampleRate() int {
+	return 8000
+}
+
+func (pcmaEncoder) Encode(pcm []int16) []byte {
+	out := make([]byte, len(pcm))
+	for i, sample := range pcm {
+		out[i] = linearToAlaw(sample)
+	}
+	return out
+}
+
+// linearToAlaw 按G.711把16位线性PCM压缩为8位 A-law，是 alawToLinear 的逆运算
+func linearToAlaw(sample int16) byte {
+	value := int(sample)
+	// A-law 的符号位为1表示正数
+	sign := 0x80
+	if value < 0 {
+		sign = 0
+		value = -value - 1
+	}
+	value = min(value, 0x7fff) >> 3
+
+	exponent := 0
+	for v := value >> 5; v > 0 && exponent < 7; v >>= 1 {
+		exponent++
+	}
+	var mantissa int
+	if exponent == 0 {
+		mantissa = (value >> 1) & 0x0f
+	} else {
+		mantissa = (value >> exponent) & 0x0f
+	}
+	return byte(sign|exponent<<4|mantissa) ^ 0x55
+}
+
+// rtpSender 把编码后的音频帧打包为RTP，通过UDP发送给电话网关
+type rtpSender struct {
+	conn net.Conn
+	// RTP时钟频率，用于按帧时长推进时间戳
+	clockRate int
+
+	mu     sync.Mutex
+	packet rtp.Packet
+}
+
+// newRTPSender 连接电话网关的RTP地址，负载类型使用编码的静态类型（PCMU 0，PCMA 8）
+func newRTPSender(address string, encoder audioEncoder) (*rtpSender, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("连接电话网关 %s 失败: %w", address, err)
+	}
+	payloadType := uint8(0)
+	if encoder.Codec().MimeType == webrtc.MimeTypePCMA {
+		payloadType = 8
+	}
+	return &rtpSender{
+		conn:      conn,
+		clockRate: encoder.SampleRate(),
+		packet: rtp.Packet{Header: rtp.Header{
+			Version:        2,
+			PayloadType:    payloadType,
+			SequenceNumber: uint16(rand.Uint32()),
+			Timestamp:      rand.Uint32(),
+			SSRC:           rand.Uint32(),
+		}},
+	}, nil
+}
+
+// WriteSample 发送一帧音频，序列号递增，时间戳按帧时长推进
+func (s *rtpSender) WriteSample(sample media.Sample, opts *lksdk.SampleWriteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.packet.Payload = sample.Data
+	data, err := s.packet.Marshal()
+	s.packet.SequenceNumber++
+	s.packet.Timestamp += uint32(sample.Duration.Seconds() * float64(s.clockRate))
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(data)
+	return err
+}
+
+func (s *rtpSender) Close() error {
+	return s.conn.Close()
+}
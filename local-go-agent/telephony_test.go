@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLinearToAlaw(t *testing.T) {
+	tests := []struct {
+		sample int16
+		want   byte
+	}{
+		{sample: 0, want: 0xd5},
+		{sample: -1, want: 0x55},
+		{sample: 32767, want: 0xaa},
+		{sample: -32768, want: 0x2a},
+	}
+	for _, tt := range tests {
+		if got := linearToAlaw(tt.sample); got != tt.want {
+			t.Errorf("linearToAlaw(%d) = %#x, want %#x", tt.sample, got, tt.want)
+		}
+	}
+
+	// 压缩再展开的误差不超过量化步长的一半
+	for _, sample := range []int16{100, -100, 1000, -1000, 12345, -12345, 32000, -32000} {
+		got := alawToLinear(linearToAlaw(sample))
+		tolerance := int(max(abs16(sample)/32, 16))
+		if diff := int(got) - int(sample); diff > tolerance || diff < -tolerance {
+			t.Errorf("A-law 往返 %d 得到 %d", sample, got)
+		}
+	}
+}
+
+func TestRTPSenderPacketizesG711Frames(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sender, err := newRTPSender(conn.LocalAddr().String(), pcmaEncoder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	var packets []rtp.Packet
+	buf := make([]byte, 1500)
+	for range 2 {
+		if err := sender.WriteSample(media.Sample{Data: make([]byte, 160), Duration: audioFrameDuration}, nil); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var packet rtp.Packet
+		if err := packet.Unmarshal(buf[:n]); err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, packet)
+	}
+
+	first, second := packets[0], packets[1]
+	if first.PayloadType != 8 || len(first.Payload) != 160 {
+		t.Errorf("payload type %d with %d bytes, want PCMA (8) with 160 bytes", first.PayloadType, len(first.Payload))
+	}
+	if second.SequenceNumber != first.SequenceNumber+1 || second.Timestamp != first.Timestamp+160 || second.SSRC != first.SSRC {
+		t.Errorf("second packet header %+v does not follow %+v", second.Header, first.Header)
+	}
+}
+
+func TestPacedWriterMirrorsFramesToTelephony(t *testing.T) {
+	track, phone := &fakeTrack{}, &fakeTrack{}
+	writer := newTestPacedWriter(track)
+	if err := writer.Mirror(phone, pcmaEncoder{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Mirror(phone, sampleRateEncoder{rate: 48000}); err == nil {
+		t.Error("mirror with a higher sample rate should be rejected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*audioFrameDuration)
+	defer cancel()
+	writer.Run(ctx)
+
+	if len(track.Samples()) == 0 || len(phone.Samples()) != len(track.Samples()) {
+		t.Fatalf("wrote %d frames to the track and %d to telephony", len(track.Samples()), len(phone.Samples()))
+	}
+	// 静音在 μ-law 和 A-law 中的编码不同
+	if track.Samples()[0].Data[0] != 0xff || phone.Samples()[0].Data[0] != 0xd5 {
+		t.Errorf("silence encoded as %#x and %#x", track.Samples()[0].Data[0], phone.Samples()[0].Data[0])
+	}
+}
+
+func TestPacedWriterDownsamplesMirroredFrames(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	track, phone := &fakeTrack{}, &fakeTrack{}
+	writer := newPacedWriter(track, sampleRateEncoder{rate: 48000}, logrus.NewEntry(logger))
+	if err := writer.Mirror(phone, pcmaEncoder{}); err != nil {
+		t.Fatalf("8kHz telephony should mirror a 48kHz track: %v", err)
+	}
+	if err := writer.Mirror(phone, sampleRateEncoder{rate: 44100}); err == nil {
+		t.Error("mirror whose sample rate does not divide the track's should be rejected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*audioFrameDuration)
+	defer cancel()
+	writer.Run(ctx)
+
+	if len(phone.Samples()) == 0 {
+		t.Fatal("no frames written to telephony")
+	}
+	if track, phone := len(track.Samples()[0].Data), len(phone.Samples()[0].Data); track != 960 || phone != 160 {
+		t.Errorf("frames of %d and %d samples, want 960 and 160", track, phone)
+	}
+}
+
+func TestDecimate(t *testing.T) {
+	got := decimate([]int16{0, 6, 12, 100, 200, 300}, 3)
+	if len(got) != 2 || got[0] != 6 || got[1] != 200 {
+		t.Errorf("decimate = %v, want [6 200]", got)
+	}
+}
+
+// sampleRateEncoder 只用于检查采样率
+type sampleRateEncoder struct {
+	pcmuEncoder
+	rate int
+}
+
+func (e sampleRateEncoder) SampleRate() int {
+	return e.rate
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/auth"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// 获取访问令牌的超时时间
+const tokenFetchTimeout = 10 * time.Second
+
+// accessToken 用API密钥签发加入房间的令牌，按配置授予发布和订阅轨道的权限。
+// 数据通道始终可用，不发布语音的代理仍以文字回复
+func accessToken(info lksdk.ConnectInfo, publish, subscribe bool) (string, error) {
+	grant := &auth.VideoGrant{
+		RoomJoin: true,
+		Room:     info.RoomName,
+	}
+	grant.SetCanPublish(publish)
+	grant.SetCanSubscribe(subscribe)
+	grant.SetCanPublishData(true)
+	return auth.NewAccessToken(info.APIKey, info.APISecret).
+		AddGrant(grant).
+		SetIdentity(info.ParticipantIdentity).
+		SetName(info.ParticipantName).
+		SetMetadata(info.ParticipantMetadata).
+		ToJWT()
+}
+
+// TokenProvider 为加入房间提供LiveKit访问令牌（JWT）。每次连接和断线重连都会重新获取，
+// 令牌过期后重连即可换用新令牌，代理本身不需要持有API密钥
+type TokenProvider interface {
+	Token(ctx context.Context, roomName, identity string) (string, error)
+}
+
+// StaticTokenProvider 总是返回同一个预先生成的令牌，令牌过期后无法重连
+type StaticTokenProvider string
+
+func (p StaticTokenProvider) Token(ctx context.Context, roomName, identity string) (string, error) {
+	return string(p), nil
+}
+
+// HTTPTokenProvider 从签发令牌的服务获取令牌：GET url?room=<房间>&identity=<身份>，
+// 响应为 {"token":"..."} 或令牌本身
+type HTTPTokenProvider struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPTokenProvider(tokenURL string) *HTTPTokenProvider {
+	return &HTTPTokenProvider{url: tokenURL, client: &http.Client{}}
+}
+
+func (p *HTTPTokenProvider) Token(ctx context.Context, roomName, identity string) (string, error) {
+	endpoint, err := url.Parse(p.url)
+	if err != nil {
+		return "", fmt.Errorf("令牌服务地址无效: %w", err)
+	}
+	query := endpoint.Query()
+	query.Set("room", roomName)
+	query.Set("identity", identity)
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("创建令牌请求失败: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求令牌失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取令牌失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("令牌服务返回错误状态 %d: %s", resp.StatusCode, string(body))
+	}
+
+	content := strings.TrimSpace(string(body))
+	if strings.HasPrefix(content, "{") {
+		var parsed struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+			return "", fmt.Errorf("解析令牌失败: %w", err)
+		}
+		content = parsed.Token
+	}
+	if content == "" {
+		return "", fmt.Errorf("令牌服务返回了空令牌")
+	}
+	return content, nil
+}
+
+// newTokenProvider 根据配置创建令牌提供者，未配置令牌时返回nil，使用API密钥连接
+func newTokenProvider(cfg LiveKitConfig) TokenProvider {
+	switch {
+	case cfg.TokenURL != "":
+		return NewHTTPTokenProvider(cfg.TokenURL)
+	case cfg.Token != "":
+		return StaticTokenProvider(cfg.Token)
+	default:
+		return nil
+	}
+}
+
+// SetTokenProvider 替换获取访问令牌的方式，需要在 Connect 之前调用
+func (a *AIAgent) SetTokenProvider(provider TokenProvider) {
+	a.tokenProvider = provider
+}
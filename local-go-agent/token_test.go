@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/livekit/protocol/auth"
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func TestAccessTokenGrants(t *testing.T) {
+	info := lksdk.ConnectInfo{
+		APIKey:              "key",
+		APISecret:           "secret-secret-secret-secret-secret",
+		RoomName:            "room",
+		ParticipantIdentity: "agent",
+	}
+	for _, tc := range []struct {
+		name               string
+		publish, subscribe bool
+	}{
+		{name: "both", publish: true, subscribe: true},
+		{name: "listen only", publish: false, subscribe: true},
+		{name: "announce only", publish: true, subscribe: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := accessToken(info, tc.publish, tc.subscribe)
+			if err != nil {
+				t.Fatalf("accessToken: %v", err)
+			}
+			verifier, err := auth.ParseAPIToken(token)
+			if err != nil {
+				t.Fatalf("parse token: %v", err)
+			}
+			claims, err := verifier.Verify(info.APISecret)
+			if err != nil {
+				t.Fatalf("verify token: %v", err)
+			}
+			grant := claims.Video
+			if grant.Room != "room" || !grant.RoomJoin || verifier.Identity() != "agent" {
+				t.Errorf("grant = %+v identity %q, want to join room as agent", grant, verifier.Identity())
+			}
+			if grant.GetCanPublish() != tc.publish || grant.GetCanSubscribe() != tc.subscribe || !grant.GetCanPublishData() {
+				t.Errorf("publish=%v subscribe=%v data=%v, want %v %v true",
+					grant.GetCanPublish(), grant.GetCanSubscribe(), grant.GetCanPublishData(), tc.publish, tc.subscribe)
+			}
+		})
+	}
+}
+
+func TestListenOnlyAgentRepliesWithText(t *testing.T) {
+	tts := &fakeTTS{}
+	agent, publisher := newTestAgent(&AIServices{
+		STT: &fakeSTT{result: Transcript{Text: "你好", Final: true}},
+		LLM: &fakeLLM{reply: "你好，有什么可以帮你？"},
+		TTS: tts,
+	})
+	agent.config.LiveKit.Publish = false
+	output := &captureOutput{}
+	agent.audioOut = output
+
+	if agent.speaksAudio() {
+		t.Error("listen-only agent should not publish an audio track")
+	}
+	if !agent.listensToAudio() {
+		t.Error("listen-only agent should still process audio")
+	}
+
+	agent.say(context.Background(), &lksdk.RemoteParticipant{}, "你好")
+	if texts := tts.Texts(); len(texts) != 0 {
+		t.Errorf("synthesized %q without publishing audio", texts)
+	}
+	if output.samples != 0 {
+		t.Errorf("played %d samples without publishing audio", output.samples)
+	}
+	if messages := publisher.Messages(); !reflect.DeepEqual(messages, []string{"你好"}) {
+		t.Errorf("messages = %q, want the text reply", messages)
+	}
+}
+
+func TestPublishOnlyAgentSkipsSubscription(t *testing.T) {
+	agent, _ := newTestAgent(&AIServices{STT: &fakeSTT{result: Transcript{Text: "你好", Final: true}}, TTS: &fakeTTS{}})
+	agent.config.LiveKit.Subscribe = false
+
+	if agent.listensToAudio() {
+		t.Error("publish-only agent should not process audio")
+	}
+	if !agent.speaksAudio() {
+		t.Error("publish-only agent should still publish its voice")
+	}
+}
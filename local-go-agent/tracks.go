@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// trackKey 标识参与者发布的一条音频轨道。同一参与者的多条轨道（如重新发布的麦克风）
+// 各自缓冲和识别，互不混合
+type trackKey struct {
+	identity string
+	trackSID string
+}
+
+// audioTrack 是一条正在处理的音频轨道，取消后处理协程退出，尚未处理的发言随之丢弃
+type audioTrack struct {
+	cancel context.CancelFunc
+	// 静音期间不缓冲音频
+	muted atomic.Bool
+	// 每次静音加一，处理协程据此把静音前缓冲的语音单独送出
+	mutes atomic.Int64
+
+	// 处理链由读取协程使用，松开说话键时数据通道协程也会送出发言，用 ingestMu 保护
+	ingestMu  sync.Mutex
+	ingest    *audioIngest
+	ingestCtx context.Context
+}
+
+// attach 登记轨道的处理链，之后通过 push 和 flush 使用
+func (t *audioTrack) attach(ctx context.Context, ingest *audioIngest) {
+	t.ingestMu.Lock()
+	defer t.ingestMu.Unlock()
+	t.ingest, t.ingestCtx = ingest, ctx
+}
+
+// push 把一帧解码后的音频送入处理链
+func (t *audioTrack) push(pcm []int16) {
+	t.ingestMu.Lock()
+	defer t.ingestMu.Unlock()
+	if t.ingest != nil {
+		t.ingest.Push(t.ingestCtx, pcm)
+	}
+}
+
+// flush 立即把缓冲的音频作为一段发言送出
+func (t *audioTrack) flush() {
+	t.ingestMu.Lock()
+	defer t.ingestMu.Unlock()
+	if t.ingest != nil {
+		t.ingest.Flush(t.ingestCtx)
+	}
+}
+
+// close 结束处理链，之后的 push 和 flush 不再生效
+func (t *audioTrack) close() {
+	t.ingestMu.Lock()
+	defer t.ingestMu.Unlock()
+	if t.ingest != nil {
+		t.ingest.Close()
+		t.ingest = nil
+	}
+}
+
+// startTrack 为轨道创建处理上下文，同一轨道重复订阅时先结束之前的处理
+func (a *AIAgent) startTrack(key trackKey) (context.Context, *audioTrack) {
+	ctx, cancel := context.WithCancel(a.session())
+	track := &audioTrack{cancel: cancel}
+
+	a.tracksMu.Lock()
+	defer a.tracksMu.Unlock()
+	if previous, ok := a.tracks[key]; ok {
+		previous.cancel()
+	}
+	a.tracks[key] = track
+	return ctx, track
+}
+
+// finishTrack 在处理协程退出时调用，只移除自己登记的轨道
+func (a *AIAgent) finishTrack(key trackKey, track *audioTrack) {
+	track.cancel()
+
+	a.tracksMu.Lock()
+	defer a.tracksMu.Unlock()
+	if a.tracks[key] == track {
+		delete(a.tracks, key)
+	}
+}
+
+// stopTrack 结束一条轨道的处理，丢弃其缓冲的音频和排队的发言
+func (a *AIAgent) stopTrack(key trackKey) {
+	a.tracksMu.Lock()
+	defer a.tracksMu.Unlock()
+	if track, ok := a.tracks[key]; ok {
+		track.cancel()
+		delete(a.tracks, key)
+	}
+}
+
+// flushParticipantTracks 立即送出参与者所有轨道中缓冲的发言
+func (a *AIAgent) flushParticipantTracks(identity string) {
+	a.tracksMu.Lock()
+	var tracks []*audioTrack
+	for key, track := range a.tracks {
+		if key.identity == identity {
+			tracks = append(tracks, track)
+		}
+	}
+	a.tracksMu.Unlock()
+
+	for _, track := range tracks {
+		track.flush()
+	}
+}
+
+// stopParticipantTracks 结束参与者所有轨道的处理
+func (a *AIAgent) stopParticipantTracks(identity string) {
+	a.tracksMu.Lock()
+	defer a.tracksMu.Unlock()
+	for key, track := range a.tracks {
+		if key.identity == identity {
+			track.cancel()
+			delete(a.tracks, key)
+		}
+	}
+}
+
+func (a *AIAgent) onTrackUnsubscribed(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, participant *lksdk.RemoteParticipant) {
+	if publication.Kind() != lksdk.TrackKindAudio {
+		return
+	}
+	a.logger.Infof("取消订阅 %s 的音频轨道: %s", participant.Identity(), publication.SID())
+	a.stopTrack(trackKey{identity: participant.Identity(), trackSID: publication.SID()})
+}
+
+func (a *AIAgent) onTrackMuted(publication lksdk.TrackPublication, participant lksdk.Participant) {
+	a.setTrackMuted(publication, participant, true)
+}
+
+func (a *AIAgent) onTrackUnmuted(publication lksdk.TrackPublication, participant lksdk.Participant) {
+	a.setTrackMuted(publication, participant, false)
+}
+
+func (a *AIAgent) setTrackMuted(publication lksdk.TrackPublication, participant lksdk.Participant, muted bool) {
+	if publication.Kind() != lksdk.TrackKindAudio {
+		return
+	}
+	key := trackKey{identity: participant.Identity(), trackSID: publication.SID()}
+
+	a.tracksMu.Lock()
+	track, ok := a.tracks[key]
+	a.tracksMu.Unlock()
+	if !ok {
+		return
+	}
+
+	if muted {
+		a.logger.Infof("%s 的麦克风已静音，暂停收听", key.identity)
+		track.mutes.Add(1)
+	} else {
+		a.logger.Infof("%s 的麦克风已取消静音，恢复收听", key.identity)
+	}
+	track.muted.Store(muted)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// trackInputFormat 是发布语音回复时送入编码器之前的统一格式
+var trackInputFormat = AudioFormat{SampleRate: webrtcSampleRate, Channels: 1, Encoding: AudioEncodingPCMS16LE}
+
+// transcode 把 inFormat 的音频转换为 outFormat：在 pcm_f32le 和 pcm_s16le 之间转换编码，
+// 转换声道数（减少声道时取平均，增加声道时复制），并重采样。格式相同时原样返回 in
+func transcode(in io.Reader, inFormat, outFormat AudioFormat) (io.Reader, error) {
+	if err := inFormat.validate(); err != nil {
+		return nil, fmt.Errorf("输入音频格式错误: %w", err)
+	}
+	if err := outFormat.validate(); err != nil {
+		return nil, fmt.Errorf("输出音频格式错误: %w", err)
+	}
+	if inFormat == outFormat {
+		return in, nil
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("读取音频数据失败: %w", err)
+	}
+	var samples []float32
+	switch inFormat.Encoding {
+	case AudioEncodingPCMF32LE:
+		samples = f32leToFloat32(data)
+	case AudioEncodingPCMS16LE:
+		samples = s16leToFloat32(data)
+	}
+
+	samples = remix(samples, inFormat.Channels, outFormat.Channels)
+	samples = resampleInterleaved(samples, outFormat.Channels, inFormat.SampleRate, outFormat.SampleRate)
+
+	switch outFormat.Encoding {
+	case AudioEncodingPCMF32LE:
+		return bytes.NewReader(float32ToF32LE(samples)), nil
+	default:
+		return bytes.NewReader(int16ToBytes(float32ToInt16(samples))), nil
+	}
+}
+
+func (f AudioFormat) validate() error {
+	if f.SampleRate <= 0 {
+		return fmt.Errorf("采样率 %d 无效", f.SampleRate)
+	}
+	if f.Channels <= 0 {
+		return fmt.Errorf("声道数 %d 无效", f.Channels)
+	}
+	switch f.Encoding {
+	case AudioEncodingPCMF32LE, AudioEncodingPCMS16LE:
+		return nil
+	default:
+		return fmt.Errorf("不支持的音频编码: %s", f.Encoding)
+	}
+}
+
+// remix 转换交错排列的采样的声道数，减少声道时先平均为单声道
+func remix(samples []float32, from, to int) []float32 {
+	if from == to {
+		return samples
+	}
+	mono := downmix(samples, from)
+	if to == 1 {
+		return mono
+	}
+	out := make([]float32, len(mono)*to)
+	for i, sample := range mono {
+		for c := 0; c < to; c++ {
+			out[i*to+c] = sample
+		}
+	}
+	return out
+}
+
+// resampleInterleaved 对交错排列的多声道采样逐声道重采样
+func resampleInterleaved(samples []float32, channels, from, to int) []float32 {
+	if channels == 1 || from == to {
+		return resample(samples, from, to)
+	}
+	frames := len(samples) / channels
+	var out []float32
+	for c := 0; c < channels; c++ {
+		channel := make([]float32, frames)
+		for i := range channel {
+			channel[i] = samples[i*channels+c]
+		}
+		channel = resample(channel, from, to)
+		if out == nil {
+			out = make([]float32, len(channel)*channels)
+		}
+		for i, sample := range channel {
+			out[i*channels+c] = sample
+		}
+	}
+	return out
+}
+
+// float32ToF32LE 把浮点采样编码为 pcm_f32le 字节流
+func float32ToF32LE(samples []float32) []byte {
+	data := make([]byte, len(samples)*4)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(sample))
+	}
+	return data
+}
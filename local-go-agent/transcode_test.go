@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+func transcodeSamples(t *testing.T, data []byte, inFormat, outFormat AudioFormat) []byte {
+	t.Helper()
+	reader, err := transcode(bytes.NewReader(data), inFormat, outFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestTranscodeEncoding(t *testing.T) {
+	s16 := AudioFormat{SampleRate: 16000, Channels: 1, Encoding: AudioEncodingPCMS16LE}
+	f32 := AudioFormat{SampleRate: 16000, Channels: 1, Encoding: AudioEncodingPCMF32LE}
+
+	got := f32leToFloat32(transcodeSamples(t, int16ToBytes([]int16{16384, -16384, 0}), s16, f32))
+	want := []float32{0.5, -0.5, 0}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("s16le->f32le sample %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	pcm := bytesToInt16(transcodeSamples(t, float32ToF32LE([]float32{0.5, -1, 2}), f32, s16))
+	if pcm[0] != math.MaxInt16/2 || pcm[1] != -math.MaxInt16 || pcm[2] != math.MaxInt16 {
+		t.Errorf("f32le->s16le = %v, want clipped 16-bit samples", pcm)
+	}
+}
+
+func TestTranscodeChannels(t *testing.T) {
+	stereo := AudioFormat{SampleRate: 16000, Channels: 2, Encoding: AudioEncodingPCMF32LE}
+	mono := AudioFormat{SampleRate: 16000, Channels: 1, Encoding: AudioEncodingPCMF32LE}
+
+	got := f32leToFloat32(transcodeSamples(t, float32ToF32LE([]float32{0.2, 0.4, -0.6, -0.2}), stereo, mono))
+	if len(got) != 2 || math.Abs(float64(got[0]-0.3)) > 1e-6 || math.Abs(float64(got[1]+0.4)) > 1e-6 {
+		t.Errorf("stereo->mono = %v, want channel averages", got)
+	}
+
+	got = f32leToFloat32(transcodeSamples(t, float32ToF32LE([]float32{0.1, -0.3}), mono, stereo))
+	want := []float32{0.1, 0.1, -0.3, -0.3}
+	if len(got) != len(want) {
+		t.Fatalf("mono->stereo = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mono->stereo = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestTranscodeResample(t *testing.T) {
+	in := AudioFormat{SampleRate: 24000, Channels: 2, Encoding: AudioEncodingPCMF32LE}
+	out := AudioFormat{SampleRate: 48000, Channels: 2, Encoding: AudioEncodingPCMF32LE}
+	// 左声道恒为0.5，右声道恒为-0.5，重采样后两个声道不能混在一起
+	samples := make([]float32, 2*240)
+	for i := 0; i < len(samples); i += 2 {
+		samples[i], samples[i+1] = 0.5, -0.5
+	}
+	got := f32leToFloat32(transcodeSamples(t, float32ToF32LE(samples), in, out))
+	if len(got) != 2*480 {
+		t.Fatalf("resampled %d samples, want %d", len(got), 2*480)
+	}
+	for i := 0; i < len(got); i += 2 {
+		if got[i] != 0.5 || got[i+1] != -0.5 {
+			t.Fatalf("frame %d = (%v, %v), channels were mixed", i/2, got[i], got[i+1])
+		}
+	}
+}
+
+func TestTranscodeToTrackInput(t *testing.T) {
+	// Cartesia 默认输出 22050Hz 单声道 pcm_f32le
+	in := AudioFormat{SampleRate: 22050, Channels: 1, Encoding: AudioEncodingPCMF32LE}
+	samples := make([]float32, 22050/10)
+	for i := range samples {
+		samples[i] = 0.25
+	}
+	pcm := bytesToInt16(transcodeSamples(t, float32ToF32LE(samples), in, trackInputFormat))
+	if len(pcm) != webrtcSampleRate/10 {
+		t.Errorf("converted %d samples, want 100ms at 48kHz (%d)", len(pcm), webrtcSampleRate/10)
+	}
+	if want := float32ToInt16([]float32{0.25})[0]; pcm[len(pcm)/2] != want {
+		t.Errorf("sample = %d, want %d", pcm[len(pcm)/2], want)
+	}
+}
+
+func TestTranscodeSameFormatPassesThrough(t *testing.T) {
+	in := bytes.NewReader([]byte{1, 2, 3, 4})
+	out, err := transcode(in, trackInputFormat, trackInputFormat)
+	if err != nil || out != io.Reader(in) {
+		t.Errorf("transcode = %v, %v, want the input reader unchanged", out, err)
+	}
+}
+
+func TestTranscodeRejectsUnknownFormat(t *testing.T) {
+	in := AudioFormat{SampleRate: 16000, Channels: 1, Encoding: "mp3"}
+	if _, err := transcode(bytes.NewReader(nil), in, trackInputFormat); err == nil {
+		t.Error("expected an error for an unsupported encoding")
+	}
+	if _, err := transcode(bytes.NewReader(nil), trackInputFormat, AudioFormat{Encoding: AudioEncodingPCMS16LE}); err == nil {
+		t.Error("expected an error for a zero sample rate")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var defaultFillerWords = []string{"嗯", "啊", "呃", "额", "哦", "唔", "哈", "uh", "um", "umm", "hmm", "mm", "ah", "er", "oh"}
+
+// filterTranscript 判断转录结果是否值得送入LLM，返回 false 时附带跳过的原因。
+// 只按置信度、语气词和长度过滤，"是的"、"好"这类简短但有效的回答不会被丢弃。
+func filterTranscript(transcript Transcript, cfg AudioConfig) (bool, string) {
+	text := strings.TrimSpace(transcript.Text)
+	if stripPunctuation(text) == "" {
+		return false, "转录结果为空"
+	}
+
+	if cfg.MinConfidence > 0 && transcript.Confidence > 0 && transcript.Confidence < cfg.MinConfidence {
+		return false, fmt.Sprintf("置信度过低 (%.2f < %.2f)", transcript.Confidence, cfg.MinConfidence)
+	}
+
+	if isFillerOnly(text, cfg.FillerWords) {
+		return false, "只包含语气词"
+	}
+
+	if utf8.RuneCountInString(stripPunctuation(text)) < cfg.MinTranscriptLength {
+		return false, "转录结果太短"
+	}
+
+	return true, ""
+}
+
+func stripPunctuation(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSymbol(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// isFillerOnly 判断文本是否完全由语气词组成，如 "嗯嗯，啊"、"umm, uh" 或 "Mmm"。
+// 按空白和标点分词后逐词比较，连续重复的字母或汉字视为一个，英文词必须整词匹配
+func isFillerOnly(text string, fillers []string) bool {
+	set := make(map[string]bool, len(fillers))
+	for _, filler := range fillers {
+		if filler = collapseRepeats(strings.ToLower(stripPunctuation(filler))); filler != "" {
+			set[filler] = true
+		}
+	}
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r) || unicode.IsSymbol(r)
+	})
+	if len(tokens) == 0 || len(set) == 0 {
+		return false
+	}
+	for _, token := range tokens {
+		if !isFillerToken(collapseRepeats(token), set) {
+			return false
+		}
+	}
+	return true
+}
+
+// isFillerToken 判断一个词是否是语气词。中文不用空格分词，"嗯啊" 这样连写的语气词可以拆开匹配
+func isFillerToken(token string, set map[string]bool) bool {
+	if set[token] {
+		return true
+	}
+	runes := []rune(token)
+	if !slices.ContainsFunc(runes, isCJK) {
+		return false
+	}
+	// matched[i] 表示前 i 个字可以拆分为若干语气词
+	matched := make([]bool, len(runes)+1)
+	matched[0] = true
+	for end := 1; end <= len(runes); end++ {
+		for start := 0; start < end && !matched[end]; start++ {
+			matched[end] = matched[start] && set[string(runes[start:end])]
+		}
+	}
+	return matched[len(runes)]
+}
+
+// collapseRepeats 把连续重复的字符合并为一个，如 "umm" 变为 "um"、"嗯嗯" 变为 "嗯"
+func collapseRepeats(s string) string {
+	var b strings.Builder
+	var last rune = -1
+	for _, r := range s {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
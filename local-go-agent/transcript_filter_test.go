@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func TestIsFillerOnly(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"嗯", true},
+		{"嗯嗯，啊", true},
+		{"嗯啊呃", true},
+		{"哈哈哈", true},
+		{"um, uh", true},
+		{"umm", true},
+		{"Mmm.", true},
+		{"hmmm... uhh", true},
+		{"Oh!", true},
+		{"", false},
+		{"，。", false},
+		{"嗯，好的", false},
+		{"umbrella", false},
+		{"oh no", false},
+		{"ohm", false},
+		{"嗯我想问", false},
+	}
+	for _, test := range tests {
+		if got := isFillerOnly(test.text, defaultFillerWords); got != test.want {
+			t.Errorf("isFillerOnly(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+	if isFillerOnly("嗯", nil) {
+		t.Error("no filler words configured, nothing should be filler-only")
+	}
+}
+
+func TestFilterTranscript(t *testing.T) {
+	cfg := AudioConfig{MinConfidence: 0.5, FillerWords: defaultFillerWords, MinTranscriptLength: 1}
+	tests := []struct {
+		transcript Transcript
+		want       bool
+	}{
+		{Transcript{Text: "是的", Confidence: 0.9}, true},
+		{Transcript{Text: "好"}, true},
+		{Transcript{Text: "  ", Confidence: 0.9}, false},
+		{Transcript{Text: "打开灯", Confidence: 0.3}, false},
+		{Transcript{Text: "umm", Confidence: 0.9}, false},
+	}
+	for _, test := range tests {
+		if got, reason := filterTranscript(test.transcript, cfg); got != test.want {
+			t.Errorf("filterTranscript(%q) = %v (%s), want %v", test.transcript.Text, got, reason, test.want)
+		}
+	}
+}
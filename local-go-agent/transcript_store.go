@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 等待保存的对话记录数量上限，超过时丢弃新的记录
+const transcriptQueueSize = 256
+
+// 对话记录文件中单行的长度上限
+const maxTranscriptLine = 4 * 1024 * 1024
+
+var (
+	errTranscriptQueueFull = errors.New("对话记录队列已满")
+	errSessionUnreadable   = errors.New("对话记录存储不支持读取")
+)
+
+// Turn 是保存下来的一轮对话：用户说的话、代理的回复和各阶段的耗时
+type Turn struct {
+	Room string
+	// 代理加入房间的会话，同一会话的对话可以导出为字幕
+	SessionID     string
+	Identity      string
+	UserText      string
+	AssistantText string
+	StartedAt     time.Time
+	EndedAt       time.Time
+	// 语音识别、生成回复和首句语音合成的耗时，文字消息没有语音识别
+	STTLatency time.Duration
+	LLMLatency time.Duration
+	TTSLatency time.Duration
+	// 用户这段话的逐词时间戳，时间相对会话开始，识别服务未返回时为空
+	Words []Word
+}
+
+// turnJSON 是对话记录的JSON格式，耗时写为毫秒，便于下游统计
+type turnJSON struct {
+	Room          string     `json:"room"`
+	SessionID     string     `json:"session_id,omitempty"`
+	Identity      string     `json:"identity"`
+	UserText      string     `json:"user_text"`
+	AssistantText string     `json:"assistant_text"`
+	StartedAt     time.Time  `json:"started_at"`
+	EndedAt       time.Time  `json:"ended_at"`
+	STTLatencyMs  int64      `json:"stt_latency_ms"`
+	LLMLatencyMs  int64      `json:"llm_latency_ms"`
+	TTSLatencyMs  int64      `json:"tts_latency_ms"`
+	Words         []wordJSON `json:"words,omitempty"`
+}
+
+type wordJSON struct {
+	Text    string `json:"text"`
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms"`
+	Speaker string `json:"speaker,omitempty"`
+}
+
+func (t Turn) MarshalJSON() ([]byte, error) {
+	record := turnJSON{
+		Room: t.Room, SessionID: t.SessionID, Identity: t.Identity,
+		UserText: t.UserText, AssistantText: t.AssistantText, StartedAt: t.StartedAt, EndedAt: t.EndedAt,
+		STTLatencyMs: t.STTLatency.Milliseconds(), LLMLatencyMs: t.LLMLatency.Milliseconds(), TTSLatencyMs: t.TTSLatency.Milliseconds(),
+	}
+	for _, word := range t.Words {
+		record.Words = append(record.Words, wordJSON{Text: word.Text, StartMs: word.StartMs, EndMs: word.EndMs, Speaker: word.Speaker})
+	}
+	return json.Marshal(record)
+}
+
+func (t *Turn) UnmarshalJSON(data []byte) error {
+	var record turnJSON
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	*t = Turn{
+		Room: record.Room, SessionID: record.SessionID, Identity: record.Identity,
+		UserText: record.UserText, AssistantText: record.AssistantText, StartedAt: record.StartedAt, EndedAt: record.EndedAt,
+		STTLatency: time.Duration(record.STTLatencyMs) * time.Millisecond,
+		LLMLatency: time.Duration(record.LLMLatencyMs) * time.Millisecond,
+		TTSLatency: time.Duration(record.TTSLatencyMs) * time.Millisecond,
+	}
+	for _, word := range record.Words {
+		t.Words = append(t.Words, Word{Text: word.Text, StartMs: word.StartMs, EndMs: word.EndMs, Speaker: word.Speaker})
+	}
+	return nil
+}
+
+// TranscriptStore 保存每轮对话，供分析和看板使用
+type TranscriptStore interface {
+	SaveTurn(ctx context.Context, turn Turn) error
+}
+
+// sessionReader 由能读回对话记录的存储实现，用于导出字幕
+type sessionReader interface {
+	// SessionTurns 按保存顺序返回一次会话的对话记录
+	SessionTurns(ctx context.Context, sessionID string) ([]Turn, error)
+}
+
+// JSONLTranscriptStore 把每轮对话追加为文件中的一行JSON
+type JSONLTranscriptStore struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func NewJSONLTranscriptStore(path string) (*JSONLTranscriptStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("创建对话记录目录失败: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("打开对话记录文件失败: %w", err)
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	return &JSONLTranscriptStore{path: path, file: file, encoder: encoder}, nil
+}
+
+func (s *JSONLTranscriptStore) SaveTurn(ctx context.Context, turn Turn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(turn)
+}
+
+// SessionTurns 从文件中读出会话的对话记录，跳过无法解析的行
+func (s *JSONLTranscriptStore) SessionTurns(ctx context.Context, sessionID string) ([]Turn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("打开对话记录文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var turns []Turn
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxTranscriptLine)
+	for scanner.Scan() {
+		var turn Turn
+		if err := json.Unmarshal(scanner.Bytes(), &turn); err != nil || turn.SessionID != sessionID {
+			continue
+		}
+		turns = append(turns, turn)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取对话记录失败: %w", err)
+	}
+	return turns, nil
+}
+
+func (s *JSONLTranscriptStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// MemoryTranscriptStore 把对话记录保存在内存中，用于测试
+type MemoryTranscriptStore struct {
+	mu    sync.Mutex
+	turns []Turn
+}
+
+func (s *MemoryTranscriptStore) SaveTurn(ctx context.Context, turn Turn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.turns = append(s.turns, turn)
+	return nil
+}
+
+// Turns 返回已保存的对话记录
+func (s *MemoryTranscriptStore) Turns() []Turn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Turn(nil), s.turns...)
+}
+
+func (s *MemoryTranscriptStore) SessionTurns(ctx context.Context, sessionID string) ([]Turn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var turns []Turn
+	for _, turn := range s.turns {
+		if turn.SessionID == sessionID {
+			turns = append(turns, turn)
+		}
+	}
+	return turns, nil
+}
+
+// asyncTranscriptStore 在后台协程中依次保存对话记录，保存不增加对话的延迟。
+// 队列已满时丢弃新的记录，不阻塞对话
+type asyncTranscriptStore struct {
+	store  TranscriptStore
+	logger *logrus.Logger
+
+	mu      sync.Mutex
+	closed  bool
+	turns   chan Turn
+	pending sync.WaitGroup
+	done    chan struct{}
+}
+
+func newAsyncTranscriptStore(store TranscriptStore, logger *logrus.Logger) *asyncTranscriptStore {
+	s := &asyncTranscriptStore{
+		store:  store,
+		logger: logger,
+		turns:  make(chan Turn, transcriptQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *asyncTranscriptStore) run() {
+	defer close(s.done)
+	for turn := range s.turns {
+		if err := s.store.SaveTurn(context.Background(), turn); err != nil {
+			s.logger.Errorf("保存对话记录失败: %v", err)
+		}
+		s.pending.Done()
+	}
+}
+
+// SaveTurn 把对话记录放入队列后立即返回
+func (s *asyncTranscriptStore) SaveTurn(ctx context.Context, turn Turn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.pending.Add(1)
+	select {
+	case s.turns <- turn:
+		return nil
+	default:
+		s.pending.Done()
+		return errTranscriptQueueFull
+	}
+}
+
+// Flush 等待队列中的记录全部保存
+func (s *asyncTranscriptStore) Flush() {
+	s.pending.Wait()
+}
+
+// SessionTurns 等待队列中的记录保存后从底层存储读取
+func (s *asyncTranscriptStore) SessionTurns(ctx context.Context, sessionID string) ([]Turn, error) {
+	reader, ok := s.store.(sessionReader)
+	if !ok {
+		return nil, errSessionUnreadable
+	}
+	s.Flush()
+	return reader.SessionTurns(ctx, sessionID)
+}
+
+// Close 保存队列中剩余的记录后关闭底层存储，之后的记录被忽略
+func (s *asyncTranscriptStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.turns)
+	s.mu.Unlock()
+
+	<-s.done
+	if closer, ok := s.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// turnTimings 收集一轮对话各阶段的耗时，通过上下文传给各阶段
+type turnTimings struct {
+	started time.Time
+
+	mu  sync.Mutex
+	stt time.Duration
+	llm time.Duration
+	tts time.Duration
+}
+
+type turnTimingsKey struct{}
+
+func withTurnTimings(ctx context.Context) context.Context {
+	return context.WithValue(ctx, turnTimingsKey{}, &turnTimings{started: time.Now()})
+}
+
+func turnTimingsFrom(ctx context.Context) *turnTimings {
+	timings, _ := ctx.Value(turnTimingsKey{}).(*turnTimings)
+	return timings
+}
+
+// observeStage 记录阶段耗时的指标，同时计入当前对话的耗时。语音合成只记录回复首句的耗时；
+// 说话人分离时一段发言中的每位说话人分别生成回复，每次生成回复后重新记录
+func (a *AIAgent) observeStage(ctx context.Context, stage string, duration time.Duration) {
+	a.metrics.ObserveStage(stage, duration)
+	timings := turnTimingsFrom(ctx)
+	if timings == nil {
+		return
+	}
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+	switch stage {
+	case stageSTT:
+		timings.stt = duration
+	case stageLLM:
+		timings.llm = duration
+		timings.tts = 0
+	case stageTTS:
+		if timings.tts == 0 {
+			timings.tts = duration
+		}
+	}
+}
+
+// saveTurn 把完成的一轮对话交给对话记录存储，未配置存储时忽略
+func (a *AIAgent) saveTurn(ctx context.Context, speaker, userText, reply string) {
+	if a.transcripts == nil {
+		return
+	}
+	turn := Turn{
+		Room:          a.config.LiveKit.RoomName,
+		SessionID:     a.sessionID,
+		Identity:      speaker,
+		UserText:      userText,
+		AssistantText: reply,
+		EndedAt:       time.Now(),
+	}
+	turn.StartedAt = turn.EndedAt
+	if timings := turnTimingsFrom(ctx); timings != nil {
+		timings.mu.Lock()
+		turn.StartedAt = timings.started
+		turn.STTLatency, turn.LLMLatency, turn.TTSLatency = timings.stt, timings.llm, timings.tts
+		timings.mu.Unlock()
+	}
+	if utterance := utteranceFrom(ctx); utterance != nil {
+		turn.Words = utterance.sessionWords(a.started, speaker)
+	}
+	if err := a.transcripts.SaveTurn(ctx, turn); err != nil {
+		a.turnLogger(ctx).Warnf("对话记录未保存: %v", err)
+	}
+}
+
+// utterance 是本轮对话回应的那段发言，识别后记录逐词时间戳，保存对话时换算为相对会话开始的时间
+type utterance struct {
+	start    time.Time
+	duration time.Duration
+	// 开头与上一段重复的音频，其中的词已属于上一轮
+	overlap time.Duration
+	// 说话人分离时每个词带有说话人标签，说话人的身份为 identity 加标签
+	identity string
+	words    []Word
+}
+
+type utteranceKey struct{}
+
+func withUtterance(ctx context.Context, request turnRequest, identity string) context.Context {
+	duration, start := request.spoken()
+	return context.WithValue(ctx, utteranceKey{}, &utterance{
+		start:    start,
+		duration: duration,
+		overlap:  time.Duration(request.overlap) * time.Second / sttSampleRate,
+		identity: identity,
+	})
+}
+
+func utteranceFrom(ctx context.Context) *utterance {
+	u, _ := ctx.Value(utteranceKey{}).(*utterance)
+	return u
+}
+
+// sessionWords 返回说话人 speaker 说的词，时间换算为相对会话开始 started。
+// 流式识别的时间相对识别会话开始而不是这段发言，按最后一个词在发言结束时结束对齐
+func (u *utterance) sessionWords(started time.Time, speaker string) []Word {
+	if len(u.words) == 0 {
+		return nil
+	}
+	shift := int64(0)
+	if end := u.words[len(u.words)-1].EndMs; end > u.duration.Milliseconds() {
+		shift = end - u.duration.Milliseconds()
+	}
+	offset := u.start.Sub(started).Milliseconds()
+	var words []Word
+	for _, word := range u.words {
+		if word.Speaker != "" && speakerIdentity(u.identity, word.Speaker) != speaker {
+			continue
+		}
+		if word.EndMs-shift <= u.overlap.Milliseconds() {
+			continue
+		}
+		word.StartMs += offset - shift
+		word.EndMs += offset - shift
+		words = append(words, word)
+	}
+	return words
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/sirupsen/logrus"
+)
+
+func TestProcessAudioBufferSavesTurn(t *testing.T) {
+	stt := &fakeSTT{result: Transcript{Text: "几点了", Confidence: 0.9, Final: true}}
+	agent, _ := newTestAgent(&AIServices{STT: stt, LLM: &fakeLLM{reply: "三点了。"}, TTS: &fakeTTS{}})
+	store := &MemoryTranscriptStore{}
+	agent.transcripts = store
+
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: make([]int16, sttSampleRate/10)}, &lksdk.RemoteParticipant{})
+
+	turns := store.Turns()
+	if len(turns) != 1 {
+		t.Fatalf("saved %d turns, want 1", len(turns))
+	}
+	turn := turns[0]
+	if turn.UserText != "几点了" || turn.AssistantText != "三点了。" || turn.Room != agent.config.LiveKit.RoomName {
+		t.Errorf("turn = %+v", turn)
+	}
+	if turn.EndedAt.Before(turn.StartedAt) || turn.StartedAt.IsZero() {
+		t.Errorf("turn timestamps %v - %v", turn.StartedAt, turn.EndedAt)
+	}
+}
+
+// blockingStore 在 release 关闭前不完成保存
+type blockingStore struct {
+	MemoryTranscriptStore
+	release chan struct{}
+}
+
+func (s *blockingStore) SaveTurn(ctx context.Context, turn Turn) error {
+	<-s.release
+	return s.MemoryTranscriptStore.SaveTurn(ctx, turn)
+}
+
+func TestAsyncTranscriptStoreDoesNotBlock(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	store := &blockingStore{release: make(chan struct{})}
+	async := newAsyncTranscriptStore(store, logger)
+
+	start := time.Now()
+	var dropped int
+	for i := 0; i < transcriptQueueSize+10; i++ {
+		if err := async.SaveTurn(context.Background(), Turn{UserText: "你好"}); errors.Is(err, errTranscriptQueueFull) {
+			dropped++
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SaveTurn blocked for %v", elapsed)
+	}
+	if dropped == 0 {
+		t.Error("turns beyond the queue size should be dropped")
+	}
+
+	close(store.release)
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if saved := len(store.Turns()); saved+dropped != transcriptQueueSize+10 {
+		t.Errorf("saved %d and dropped %d turns", saved, dropped)
+	}
+}
+
+func TestJSONLTranscriptStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "turns.jsonl")
+	store, err := NewJSONLTranscriptStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	async := newAsyncTranscriptStore(store, logger)
+
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, text := range []string{"第一句", "第二句"} {
+		async.SaveTurn(context.Background(), Turn{
+			Room: "demo", Identity: "alice", UserText: text, AssistantText: "好的",
+			StartedAt: started, EndedAt: started.Add(2 * time.Second),
+			STTLatency: 300 * time.Millisecond, LLMLatency: 800 * time.Millisecond, TTSLatency: 150 * time.Millisecond,
+		})
+	}
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	if lines[1]["user_text"] != "第二句" || lines[0]["llm_latency_ms"] != float64(800) || lines[0]["identity"] != "alice" {
+		t.Errorf("first lines = %v", lines)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/openai/openai-go/v3/option"
+	"github.com/sirupsen/logrus"
+)
+
+type AudioEncoding string
+
+const (
+	AudioEncodingPCMF32LE AudioEncoding = "pcm_f32le"
+	AudioEncodingPCMS16LE AudioEncoding = "pcm_s16le"
+)
+
+// AudioFormat 描述合成音频的格式，发布和录音时据此转换为16位PCM并重采样
+type AudioFormat struct {
+	SampleRate int
+	Channels   int
+	Encoding   AudioEncoding
+}
+
+// TextToSpeech 是语音合成服务的抽象，返回的音频流由调用方关闭
+type TextToSpeech interface {
+	Synthesize(ctx context.Context, text string) (io.ReadCloser, AudioFormat, error)
+}
+
+// SpeechOptions 是单次合成的可选参数，空字段使用服务的默认值
+type SpeechOptions struct {
+	Language string
+	Voice    string
+	// 语速，-1（最慢）到 1（最快），0 为正常语速
+	Speed float64
+	// 情绪，如 "positivity:high"、"curiosity"，服务或模型不支持时忽略
+	Emotions []string
+}
+
+// ConfigurableTextToSpeech 是支持按语言或声音合成的服务可选实现的扩展接口
+type ConfigurableTextToSpeech interface {
+	TextToSpeech
+	SynthesizeWithOptions(ctx context.Context, text string, opts SpeechOptions) (io.ReadCloser, AudioFormat, error)
+}
+
+// SpeechStream 是一次流式合成会话：文本可以边生成边发送，音频边合成边返回
+type SpeechStream interface {
+	// SendText 追加一段要合成的文本
+	SendText(chunk string) error
+	// CloseSend 表示文本已全部发送，剩余的音频返回后 Frames 关闭
+	CloseSend() error
+	// Frames 返回按顺序合成的单声道浮点采样，采样率由 Format 给出
+	Frames() <-chan []float32
+	Format() AudioFormat
+	// Err 返回会话异常结束的原因，在 Frames 关闭后调用
+	Err() error
+	Close() error
+}
+
+// StreamingTextToSpeech 是支持流式合成的服务可选实现的扩展接口
+type StreamingTextToSpeech interface {
+	TextToSpeech
+	StreamSession(ctx context.Context, opts SpeechOptions) (SpeechStream, error)
+}
+
+const (
+	ttsProviderCartesia = "cartesia"
+	ttsProviderEspeak   = "espeak"
+	ttsProviderOpenAI   = "openai"
+)
+
+// newTextToSpeech 按配置创建语音合成服务。设置了 tts_fallback 时主服务和备用服务组成备用链，
+// 依次尝试；都不可用时返回nil
+func newTextToSpeech(cfg *Config, logger *logrus.Logger) TextToSpeech {
+	var services []namedTTS
+	for _, provider := range append([]string{cfg.TTSProvider}, cfg.TTSFallback...) {
+		if provider == "" {
+			provider = ttsProviderCartesia
+		}
+		if service := newTTSProvider(provider, cfg, logger); service != nil {
+			services = append(services, namedTTS{name: provider, service: service})
+		}
+	}
+	return newTTSChain(services, logger)
+}
+
+// newTTSProvider 创建名为 provider 的语音合成服务，不可用时返回nil
+func newTTSProvider(provider string, cfg *Config, logger *logrus.Logger) TextToSpeech {
+	switch provider {
+	case ttsProviderCartesia, "":
+		if cfg.Cartesia.APIKey == "" {
+			logger.Warn("未设置CARTESIA_API_KEY环境变量，Cartesia服务将不可用")
+			return nil
+		}
+		logger.Info("Cartesia服务已初始化")
+		service := NewCartesiaServiceFromConfig(cfg.Cartesia)
+		service.setDebugger(newAPIDebugger(cfg.Log, logger, "Cartesia"))
+		return service
+	case ttsProviderEspeak:
+		service, err := NewEspeakServiceFromConfig(cfg.Espeak)
+		if err != nil {
+			logger.Errorf("初始化本地espeak服务失败: %v", err)
+			return nil
+		}
+		logger.Info("本地espeak服务已初始化")
+		return service
+	case ttsProviderOpenAI:
+		if cfg.OpenAI.APIKey == "" {
+			logger.Warn("未设置OPENAI_API_KEY环境变量，OpenAI语音合成服务将不可用")
+			return nil
+		}
+		var opts []option.RequestOption
+		if debugger := newAPIDebugger(cfg.Log, logger, "OpenAI TTS"); debugger != nil {
+			opts = append(opts, option.WithHTTPClient(debugger.httpClient()))
+		}
+		service, err := NewOpenAITTSServiceFromConfig(cfg.OpenAI, opts...)
+		if err != nil {
+			logger.Errorf("初始化OpenAI语音合成服务失败: %v", err)
+			return nil
+		}
+		logger.Info("OpenAI语音合成服务已初始化")
+		return service
+	default:
+		logger.Errorf("未知的语音合成服务: %s", provider)
+		return nil
+	}
+}
+
+// synthesizeSpeech 合成完整的一段语音，返回转换为发布轨道所需格式的浮点采样，服务不支持 opts 时忽略
+func synthesizeSpeech(ctx context.Context, tts TextToSpeech, text string, opts SpeechOptions) ([]float32, int, error) {
+	var (
+		stream io.ReadCloser
+		format AudioFormat
+		err    error
+	)
+	if configurable, ok := tts.(ConfigurableTextToSpeech); ok {
+		stream, format, err = configurable.SynthesizeWithOptions(ctx, text, opts)
+	} else {
+		stream, format, err = tts.Synthesize(ctx, text)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer stream.Close()
+
+	// 各服务输出的采样率、编码和声道数不同，统一转换后再发布和录音
+	normalized, err := transcode(stream, format, trackInputFormat)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(normalized)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取音频数据失败: %w", err)
+	}
+	return s16leToFloat32(data), trackInputFormat.SampleRate, nil
+}
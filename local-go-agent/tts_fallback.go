@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+)
+
+// namedTTS 是备用链中的一个语音合成服务，name 用于日志
+type namedTTS struct {
+	name    string
+	service TextToSpeech
+}
+
+// fallbackTTS 按顺序尝试多个语音合成服务，前一个失败时记录日志并换下一个，全部失败时返回最后的错误，
+// 由调用方改为发送文本消息
+type fallbackTTS struct {
+	services []namedTTS
+	logger   *logrus.Logger
+}
+
+func (f *fallbackTTS) Synthesize(ctx context.Context, text string) (io.ReadCloser, AudioFormat, error) {
+	return f.SynthesizeWithOptions(ctx, text, SpeechOptions{})
+}
+
+func (f *fallbackTTS) SynthesizeWithOptions(ctx context.Context, text string, opts SpeechOptions) (io.ReadCloser, AudioFormat, error) {
+	var lastErr error
+	for i, tts := range f.services {
+		var (
+			stream io.ReadCloser
+			format AudioFormat
+			err    error
+		)
+		if configurable, ok := tts.service.(ConfigurableTextToSpeech); ok {
+			stream, format, err = configurable.SynthesizeWithOptions(ctx, text, opts)
+		} else {
+			stream, format, err = tts.service.Synthesize(ctx, text)
+		}
+		if err == nil {
+			return stream, format, nil
+		}
+		// 对话被取消时不再尝试其他服务
+		if ctx.Err() != nil {
+			return nil, AudioFormat{}, err
+		}
+		lastErr = err
+		if i < len(f.services)-1 {
+			f.logger.Warnf("%s 语音合成失败，改用 %s: %v", tts.name, f.services[i+1].name, err)
+		}
+	}
+	return nil, AudioFormat{}, lastErr
+}
+
+// streamingFallbackTTS 在主服务支持流式合成时使用它的流式会话。会话打开失败时由调用方改为逐句合成，
+// 逐句合成仍按备用链依次尝试
+type streamingFallbackTTS struct {
+	*fallbackTTS
+	primary StreamingTextToSpeech
+}
+
+func (f *streamingFallbackTTS) StreamSession(ctx context.Context, opts SpeechOptions) (SpeechStream, error) {
+	return f.primary.StreamSession(ctx, opts)
+}
+
+// newTTSChain 由按顺序排列的语音合成服务组成备用链，只有一个服务时直接返回它，没有时返回 nil
+func newTTSChain(services []namedTTS, logger *logrus.Logger) TextToSpeech {
+	switch len(services) {
+	case 0:
+		return nil
+	case 1:
+		return services[0].service
+	}
+	chain := &fallbackTTS{services: services, logger: logger}
+	if streaming, ok := services[0].service.(StreamingTextToSpeech); ok {
+		return &streamingFallbackTTS{fallbackTTS: chain, primary: streaming}
+	}
+	return chain
+}
+
+// validateTTSProviders 检查语音合成服务的名称，备用链中不能重复
+func validateTTSProviders(primary string, fallback []string) error {
+	seen := map[string]bool{}
+	for _, name := range append([]string{primary}, fallback...) {
+		if name == "" {
+			name = ttsProviderCartesia
+		}
+		switch name {
+		case ttsProviderCartesia, ttsProviderEspeak, ttsProviderOpenAI:
+		default:
+			return fmt.Errorf("未知的语音合成服务: %s", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("语音合成服务 %s 重复", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+	"github.com/openai/openai-go/v3/option"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFallbackTTSTriesNextService(t *testing.T) {
+	primary := &fakeTTS{err: errors.New("cartesia down")}
+	secondary := &fakeTTS{}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	chain := newTTSChain([]namedTTS{{"cartesia", primary}, {"openai", secondary}}, logger)
+
+	agent, publisher := newTestAgent(&AIServices{LLM: &fakeLLM{reply: "你好。"}, TTS: chain})
+	agent.audioOut = &recordingOutput{}
+	participant := &lksdk.RemoteParticipant{}
+	agent.respond(context.Background(), participant, participant.Identity(), "hi", "", true)
+
+	if len(primary.Texts()) != 1 || len(secondary.Texts()) != 1 {
+		t.Errorf("primary %v, secondary %v, want each tried once", primary.Texts(), secondary.Texts())
+	}
+	if messages := publisher.Messages(); containsString(messages, "你好。") {
+		t.Errorf("fell back to text although the secondary succeeded: %v", messages)
+	}
+}
+
+func TestFallbackTTSSendsTextWhenAllFail(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	chain := newTTSChain([]namedTTS{
+		{"cartesia", &fakeTTS{err: errors.New("cartesia down")}},
+		{"openai", &fakeTTS{err: errors.New("openai down")}},
+	}, logger)
+
+	agent, publisher := newTestAgent(&AIServices{LLM: &fakeLLM{reply: "你好。"}, TTS: chain})
+	agent.audioOut = &recordingOutput{}
+	participant := &lksdk.RemoteParticipant{}
+	agent.respond(context.Background(), participant, participant.Identity(), "hi", "", true)
+
+	if !containsString(publisher.Messages(), "你好。") {
+		t.Errorf("messages = %v, want the reply as text", publisher.Messages())
+	}
+}
+
+func TestOpenAITTSRequest(t *testing.T) {
+	var request map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/audio/speech" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(make([]byte, 480))
+	}))
+	defer server.Close()
+
+	service, err := NewOpenAITTSServiceFromConfig(OpenAIConfig{APIKey: "key", TTS: OpenAITTSConfig{Voice: "nova"}}, option.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cartesia 的声音ID不是OpenAI的声音，使用配置的声音
+	pcm, sampleRate, err := synthesizeSpeech(context.Background(), service, "你好", SpeechOptions{Voice: "a0e99841-438c-4a64-b679-ae501e7d6091"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request["voice"] != "nova" || request["response_format"] != "pcm" || request["model"] != defaultOpenAITTSModel {
+		t.Errorf("request = %v", request)
+	}
+	if sampleRate != trackInputFormat.SampleRate || len(pcm) == 0 {
+		t.Errorf("got %d samples at %d Hz", len(pcm), sampleRate)
+	}
+}
+
+func TestValidateTTSProviders(t *testing.T) {
+	if err := validateTTSProviders("", []string{"openai", "espeak"}); err != nil {
+		t.Errorf("valid chain rejected: %v", err)
+	}
+	if err := validateTTSProviders("cartesia", []string{"cartesia"}); err == nil {
+		t.Error("duplicate provider accepted")
+	}
+	if err := validateTTSProviders("cartesia", []string{"polly"}); err == nil {
+		t.Error("unknown provider accepted")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	// 一轮对话（STT+LLM+TTS）的默认截止时间
+	defaultTurnDeadline     = 8 * time.Second
+	defaultTurnTimeoutReply = "让我再想想..."
+)
+
+var errTurnDeadline = errors.New("对话超过截止时间")
+
+// withTurnDeadline 给一轮对话加上截止时间。超时后 ctx 被取消，进行中的STT、LLM和TTS请求随之中止
+func (a *AIAgent) withTurnDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline := a.config.Audio.TurnDeadline
+	if deadline <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, deadline, errTurnDeadline)
+}
+
+// turnTimedOut 判断对话是否因为超过截止时间被取消，而不是断线或代理关闭
+func turnTimedOut(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errTurnDeadline)
+}
+
+// onTurnTimeout 在对话超时后回复一句简短的话，避免用户一直等不到回应。ctx 是未超时的外层上下文
+func (a *AIAgent) onTurnTimeout(ctx context.Context, participant *lksdk.RemoteParticipant) {
+	a.turnLogger(ctx).Warnf("本轮对话超过 %v，已取消", a.config.Audio.TurnDeadline)
+	a.metrics.IncError(stageTurn)
+
+	reply := a.config.Audio.TurnTimeoutReply
+	if reply == "" || ctx.Err() != nil {
+		return
+	}
+	a.say(ctx, participant, reply)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// 每个参与者最多排队等待处理的发言数，超过时丢弃最早的发言
+const defaultMaxQueueDepth = 3
+
+// turnRequest 是一次等待处理的发言，pcm、text 和 transcript 三选一，transcript 是流式识别已完成的转录结果。
+// trackSID 是语音来自的轨道，pcm 开头 overlap 个采样与同一轨道的上一段语音重复
+type turnRequest struct {
+	ctx      context.Context
+	pcm      []int16
+	overlap  int
+	stitcher *segmentStitcher
+	// 流式识别这轮发言送去识别的音频时长，用于估算费用
+	streamed time.Duration
+	// 发言进入队列的时间，也就是发言结束的时间
+	received   time.Time
+	trackSID   string
+	text       string
+	transcript *Transcript
+}
+
+// audio 返回发言是否是还未识别的语音
+func (r turnRequest) audio() bool {
+	return r.text == "" && r.transcript == nil
+}
+
+// spoken 返回发言音频的时长和开始的时间，文字消息返回0
+func (r turnRequest) spoken() (time.Duration, time.Time) {
+	duration := r.streamed
+	if r.transcript == nil {
+		duration = time.Duration(len(r.pcm)) * time.Second / sttSampleRate
+	}
+	return duration, r.received.Add(-duration)
+}
+
+// fresh 返回去掉与上一段重复的开头后的语音，与上一段拼接时使用
+func (r turnRequest) fresh() []int16 {
+	return r.pcm[min(r.overlap, len(r.pcm)):]
+}
+
+// turnQueue 保证同一个参与者同一时间只有一轮对话，回复顺序与发言顺序一致
+type turnQueue struct {
+	mu      sync.Mutex
+	pending []turnRequest
+	running bool
+	// 取消进行中的一轮对话，参与者插话时调用，没有进行中的对话时为 nil
+	cancel context.CancelFunc
+}
+
+func (a *AIAgent) turnQueue(identity string) *turnQueue {
+	a.queuesMu.Lock()
+	defer a.queuesMu.Unlock()
+
+	queue, ok := a.queues[identity]
+	if !ok {
+		queue = &turnQueue{}
+		a.queues[identity] = queue
+	}
+	return queue
+}
+
+func (a *AIAgent) forgetTurnQueue(identity string) {
+	a.queuesMu.Lock()
+	defer a.queuesMu.Unlock()
+
+	delete(a.queues, identity)
+}
+
+// enqueueTurn 把发言加入参与者的队列，没有正在进行的对话时立即开始处理
+func (a *AIAgent) enqueueTurn(participant *lksdk.RemoteParticipant, request turnRequest) {
+	identity := participant.Identity()
+	queue := a.turnQueue(identity)
+
+	maxDepth := a.config.Audio.MaxQueueDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxQueueDepth
+	}
+
+	if request.received.IsZero() {
+		request.received = time.Now()
+	}
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	if last := len(queue.pending) - 1; last >= 0 && coalesces(queue.pending[last], request) {
+		// 对话期间流式识别陆续识别出的句子合并为一次请求，不占用队列长度，也不会被丢弃
+		queue.pending[last] = mergeTranscriptRequests(queue.pending[last], request)
+		a.logger.Debugf("合并 %s 待处理的转录结果", identity)
+	} else {
+		queue.pending = append(queue.pending, request)
+	}
+	if dropped := len(queue.pending) - maxDepth; dropped > 0 {
+		a.logger.Warnf("%s 的待处理发言过多，丢弃最早的 %d 条", identity, dropped)
+		queue.pending = append(queue.pending[:0], queue.pending[dropped:]...)
+	}
+
+	if queue.running {
+		return
+	}
+	queue.running = true
+	if !a.startTurn(func() { a.runTurnQueue(queue, participant) }) {
+		queue.running = false
+		queue.pending = nil
+	}
+}
+
+// runTurnQueue 依次处理队列中的发言直到队列为空
+func (a *AIAgent) runTurnQueue(queue *turnQueue, participant *lksdk.RemoteParticipant) {
+	for {
+		queue.mu.Lock()
+		if len(queue.pending) == 0 || a.closing.Load() {
+			queue.pending = nil
+			queue.running = false
+			queue.mu.Unlock()
+			return
+		}
+		request := nextTurn(queue)
+		queue.mu.Unlock()
+		request = a.coalesceTranscripts(queue, request)
+
+		// 会话已结束（如断线）的发言直接丢弃
+		if request.ctx.Err() != nil {
+			continue
+		}
+		ctx := withTurnCost(a.withTurn(request.ctx, participant.Identity()))
+		if request.text == "" {
+			ctx = withUtterance(ctx, request, participant.Identity())
+		}
+		if err := a.limiter.acquire(ctx, a.turnLogger(ctx)); err != nil {
+			continue
+		}
+		turnCtx, cancel := a.withTurnDeadline(ctx)
+		queue.mu.Lock()
+		queue.cancel = cancel
+		queue.mu.Unlock()
+		switch {
+		case a.config.Echo.Mode != EchoModeOff:
+			a.echo(turnCtx, request, participant)
+		case request.text != "":
+			a.handleChatMessage(turnCtx, request.text, participant)
+		case request.transcript != nil:
+			a.chargeAudio(turnCtx, request.streamed)
+			a.processTranscript(turnCtx, *request.transcript, participant)
+		default:
+			a.processAudioBuffer(turnCtx, request, participant)
+		}
+		timedOut := turnTimedOut(turnCtx)
+		queue.mu.Lock()
+		queue.cancel = nil
+		queue.mu.Unlock()
+		cancel()
+		cost := a.finishTurnCost(ctx, participant.Identity())
+		if timedOut {
+			a.onTurnTimeout(ctx, participant)
+		}
+		a.emit(AgentEvent{Type: EventTurnComplete, ParticipantIdentity: participant.Identity(), Cost: cost})
+		a.limiter.release()
+	}
+}
+
+// nextTurn 取出下一轮要处理的发言。上一轮对话期间同一轨道连续到达的语音会合并为一轮，
+// 不同轨道的语音、文字消息和流式识别的结果保持独立，调用方需持有 queue.mu
+func nextTurn(queue *turnQueue) turnRequest {
+	request := queue.pending[0]
+	n := 1
+	if request.audio() {
+		for n < len(queue.pending) && queue.pending[n].audio() && queue.pending[n].trackSID == request.trackSID {
+			n++
+		}
+		merged := request.pcm
+		for _, pending := range queue.pending[1:n] {
+			merged = append(merged, pending.fresh()...)
+		}
+		// 使用最后一段语音的会话上下文
+		last := queue.pending[n-1]
+		request = turnRequest{ctx: last.ctx, pcm: merged, overlap: request.overlap, stitcher: request.stitcher, received: last.received, trackSID: request.trackSID}
+	}
+	queue.pending = queue.pending[n:]
+	return request
+}
+
+// coalesces 判断 next 能否合并到排在它前面的 pending 中：同一轨道流式识别的转录结果
+func coalesces(pending, next turnRequest) bool {
+	return pending.transcript != nil && next.transcript != nil && pending.trackSID == next.trackSID
+}
+
+// coalesceTranscripts 在把转录结果送入LLM之前等待 coalesce_window，期间同一轨道识别出的句子
+// 合并为一轮，连续快速说话（如朗读）时对话不会越落越远
+func (a *AIAgent) coalesceTranscripts(queue *turnQueue, request turnRequest) turnRequest {
+	window := a.config.Audio.CoalesceWindow
+	if request.transcript == nil || window <= 0 {
+		return request
+	}
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-request.ctx.Done():
+		return request
+	}
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	for len(queue.pending) > 0 && coalesces(request, queue.pending[0]) {
+		request = mergeTranscriptRequests(request, queue.pending[0])
+		queue.pending = queue.pending[1:]
+	}
+	return request
+}
+
+// mergeTranscriptRequests 把 next 的转录结果接在 first 后面，使用后一段的会话上下文
+func mergeTranscriptRequests(first, next turnRequest) turnRequest {
+	merged := mergeTranscripts(*first.transcript, *next.transcript)
+	next.transcript = &merged
+	next.streamed += first.streamed
+	return next
+}
+
+// mergeTranscripts 拼接两段转录结果，置信度按文字长度加权平均，语言使用后一段的结果
+func mergeTranscripts(first, next Transcript) Transcript {
+	merged := next
+	merged.Text = joinTranscriptText(first.Text, next.Text)
+	firstRunes, nextRunes := utf8.RuneCountInString(first.Text), utf8.RuneCountInString(next.Text)
+	if total := firstRunes + nextRunes; total > 0 {
+		merged.Confidence = (first.Confidence*float64(firstRunes) + next.Confidence*float64(nextRunes)) / float64(total)
+	}
+	merged.Words = append(append([]Word(nil), first.Words...), next.Words...)
+	merged.Speakers = append(append([]SpeakerTurn(nil), first.Speakers...), next.Speakers...)
+	return merged
+}
+
+// joinTranscriptText 拼接两段文字，中日韩文字之间不加空格
+func joinTranscriptText(first, next string) string {
+	first, next = strings.TrimSpace(first), strings.TrimSpace(next)
+	if first == "" || next == "" {
+		return first + next
+	}
+	last, _ := utf8.DecodeLastRuneInString(first)
+	head, _ := utf8.DecodeRuneInString(next)
+	if isCJK(last) || isCJK(head) || unicode.IsPunct(head) {
+		return first + next
+	}
+	return first + " " + next
+}
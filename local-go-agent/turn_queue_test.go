@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+func transcriptRequest(text string) turnRequest {
+	return turnRequest{
+		ctx:        context.Background(),
+		transcript: &Transcript{Text: text, Confidence: 0.9, Final: true},
+		streamed:   time.Second,
+		trackSID:   "TR_mic",
+	}
+}
+
+func TestQueuedTranscriptsCoalesce(t *testing.T) {
+	llm := &fakeLLM{reply: "好的。", block: true}
+	agent, _ := newTestAgent(&AIServices{LLM: llm, STT: &fakeSTT{}, TTS: &fakeTTS{}})
+	agent.config.Audio.MaxQueueDepth = 2
+	agent.config.Audio.TurnDeadline = 100 * time.Millisecond
+	agent.config.Audio.TurnTimeoutReply = ""
+	participant := &lksdk.RemoteParticipant{}
+
+	// 第一句进行中时又识别出四句，超过队列长度也不丢弃，合并为下一轮
+	agent.enqueueTurn(participant, transcriptRequest("第一句。"))
+	for deadline := time.Now().Add(time.Second); llm.Calls() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	for _, text := range []string{"第二句，", "第三句，", "第四句，", "第五句。"} {
+		agent.enqueueTurn(participant, transcriptRequest(text))
+	}
+	agent.turns.Wait()
+
+	want := []string{"第一句。", "第二句，第三句，第四句，第五句。"}
+	if prompts := llm.Prompts(); !reflect.DeepEqual(prompts, want) {
+		t.Errorf("llm prompts = %q, want %q", prompts, want)
+	}
+}
+
+func TestCoalesceWindow(t *testing.T) {
+	llm := &fakeLLM{reply: "好的。"}
+	agent, _ := newTestAgent(&AIServices{LLM: llm, STT: &fakeSTT{}, TTS: &fakeTTS{}})
+	agent.config.Audio.CoalesceWindow = 200 * time.Millisecond
+	participant := &lksdk.RemoteParticipant{}
+
+	// 窗口内识别出的句子与第一句一起送入LLM
+	agent.enqueueTurn(participant, transcriptRequest("I am reading"))
+	time.Sleep(20 * time.Millisecond)
+	agent.enqueueTurn(participant, transcriptRequest("a long passage."))
+	agent.turns.Wait()
+
+	if prompts := llm.Prompts(); !reflect.DeepEqual(prompts, []string{"I am reading a long passage."}) {
+		t.Errorf("llm prompts = %q, want one coalesced request", prompts)
+	}
+}
+
+func TestMergeTranscripts(t *testing.T) {
+	first := Transcript{Text: "你好", Confidence: 1, Words: []Word{{Text: "你好"}}}
+	next := Transcript{Text: "world", Confidence: 0.4, Language: "en", Words: []Word{{Text: "world"}}}
+	merged := mergeTranscripts(first, next)
+	if merged.Text != "你好world" || merged.Language != "en" || len(merged.Words) != 2 {
+		t.Errorf("merged = %+v", merged)
+	}
+	// 按文字长度加权：2个字置信度1，5个字置信度0.4
+	if want := (2*1.0 + 5*0.4) / 7; merged.Confidence != want {
+		t.Errorf("confidence = %v, want %v", merged.Confidence, want)
+	}
+	if got := joinTranscriptText("hello", "there"); got != "hello there" {
+		t.Errorf("joinTranscriptText = %q", got)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// voiceTagPattern 匹配回复中切换声音的标记：<voice name="名称"> 之后的文本用该声音朗读，</voice> 恢复默认声音
+var voiceTagPattern = regexp.MustCompile(`(?i)<voice\s+name\s*=\s*"([^"]*)"\s*>|</voice\s*>`)
+
+// VoiceRegistry 把声音名称映射为语音合成服务的声音ID，LLM 在回复中按名称选择声音，
+// 例如在讲故事时为不同的角色配音
+type VoiceRegistry struct {
+	voices map[string]string
+}
+
+// NewVoiceRegistry 按配置的 名称 -> 声音ID 创建声音表，名称不区分大小写
+func NewVoiceRegistry(voices map[string]string) *VoiceRegistry {
+	registry := &VoiceRegistry{voices: make(map[string]string, len(voices))}
+	for name, id := range voices {
+		registry.voices[strings.ToLower(strings.TrimSpace(name))] = id
+	}
+	return registry
+}
+
+// Lookup 返回名称对应的声音ID，未知的名称返回 false
+func (r *VoiceRegistry) Lookup(name string) (string, bool) {
+	id, ok := r.voices[strings.ToLower(strings.TrimSpace(name))]
+	return id, ok
+}
+
+// Names 返回按字母顺序排列的声音名称
+func (r *VoiceRegistry) Names() []string {
+	names := make([]string, 0, len(r.voices))
+	for name := range r.voices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *VoiceRegistry) Len() int {
+	return len(r.voices)
+}
+
+// instruction 返回追加在系统提示词后的说明，告诉模型可以选择哪些声音，没有配置声音时返回空字符串
+func (r *VoiceRegistry) instruction() string {
+	if r.Len() == 0 {
+		return ""
+	}
+	return fmt.Sprintf("需要用不同的声音演绎角色或旁白时，在这段话前加上 <voice name=\"名称\">，"+
+		"在结束处加上 </voice> 恢复默认声音。可用的声音：%s。", strings.Join(r.Names(), "、"))
+}
+
+func (r *VoiceRegistry) validate() error {
+	for name, id := range r.voices {
+		if name == "" || strings.ContainsAny(name, "\"<>") {
+			return fmt.Errorf("声音名称 %q 无效", name)
+		}
+		if id == "" {
+			return fmt.Errorf("声音 %s 没有设置声音ID", name)
+		}
+	}
+	return nil
+}
+
+// voiceSegment 是回复中用同一个声音朗读的一段文本，voice 是声音名称，为空时使用默认声音
+type voiceSegment struct {
+	voice string
+	text  string
+}
+
+// splitVoiceSegments 按声音标记把一句话分段，voice 是上一句结束时使用的声音，返回这句话结束时的声音。
+// 没有标记时整句作为一段；只有标记没有文本的部分被丢弃
+func splitVoiceSegments(text, voice string) ([]voiceSegment, string) {
+	matches := voiceTagPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return []voiceSegment{{voice: voice, text: text}}, voice
+	}
+
+	var segments []voiceSegment
+	add := func(part string) {
+		if strings.TrimSpace(part) != "" {
+			segments = append(segments, voiceSegment{voice: voice, text: part})
+		}
+	}
+	start := 0
+	for _, match := range matches {
+		add(text[start:match[0]])
+		voice = ""
+		if match[2] >= 0 {
+			voice = text[match[2]:match[3]]
+		}
+		start = match[1]
+	}
+	add(text[start:])
+	return segments, voice
+}
+
+// stripVoiceTags 去掉回复中的声音标记，用于发送文本消息、字幕和保存对话记录
+func stripVoiceTags(text string) string {
+	return voiceTagPattern.ReplaceAllString(text, "")
+}
+
+// synthesizeSegments 依次用各段指定的声音合成一句话并拼接，任一段失败时整句失败
+func (a *AIAgent) synthesizeSegments(ctx context.Context, participant *lksdk.RemoteParticipant, segments []voiceSegment, language string) ([]float32, int, bool) {
+	var (
+		pcm        []float32
+		sampleRate int
+	)
+	for _, segment := range segments {
+		samples, rate, ok := a.synthesizeReply(ctx, participant, segment.text, language, segment.voice)
+		if !ok {
+			return nil, 0, false
+		}
+		pcm = append(pcm, samples...)
+		sampleRate = rate
+	}
+	return pcm, sampleRate, sampleRate > 0
+}
+
+// voiceOptions 返回用名为 voice 的声音合成时的参数，名称为空或未知时使用默认声音
+func (a *AIAgent) voiceOptions(ctx context.Context, participant *lksdk.RemoteParticipant, language, voice string) SpeechOptions {
+	opts := a.speechOptions(participant, language)
+	if voice == "" {
+		return opts
+	}
+	if id, ok := a.voices.Lookup(voice); ok {
+		opts.Voice = id
+	} else {
+		a.turnLogger(ctx).Warnf("未知的声音 %s，使用默认声音", voice)
+	}
+	return opts
+}
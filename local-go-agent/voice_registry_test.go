@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// voiceTTS 记录每次合成的文本和声音
+type voiceTTS struct {
+	mu     sync.Mutex
+	voices []string
+}
+
+func (f *voiceTTS) Synthesize(ctx context.Context, text string) (io.ReadCloser, AudioFormat, error) {
+	return f.SynthesizeWithOptions(ctx, text, SpeechOptions{})
+}
+
+func (f *voiceTTS) SynthesizeWithOptions(ctx context.Context, text string, opts SpeechOptions) (io.ReadCloser, AudioFormat, error) {
+	f.mu.Lock()
+	f.voices = append(f.voices, strings.TrimSpace(text)+"="+opts.Voice)
+	f.mu.Unlock()
+
+	silence := make([]byte, 320)
+	return io.NopCloser(bytes.NewReader(silence)), AudioFormat{SampleRate: sttSampleRate, Channels: 1, Encoding: AudioEncodingPCMS16LE}, nil
+}
+
+func TestSplitVoiceSegments(t *testing.T) {
+	segments, voice := splitVoiceSegments(`他说：<voice name="dragon">我是龙</voice>然后飞走了<voice name="ghost">`, "")
+	want := []voiceSegment{{voice: "", text: "他说："}, {voice: "dragon", text: "我是龙"}, {voice: "", text: "然后飞走了"}}
+	if !reflect.DeepEqual(segments, want) || voice != "ghost" {
+		t.Errorf("segments = %+v, voice = %q", segments, voice)
+	}
+
+	segments, voice = splitVoiceSegments("没有标记。", "ghost")
+	if len(segments) != 1 || segments[0].voice != "ghost" || voice != "ghost" {
+		t.Errorf("voice should carry over to the next sentence: %+v", segments)
+	}
+}
+
+func TestReplyVoicesFollowTags(t *testing.T) {
+	tts := &voiceTTS{}
+	llm := &fakeLLM{reply: `从前有一位勇士。<voice name="Dragon">我是龙！</voice>勇士拔出了剑。<voice name="ghost">嘘。</voice>`}
+	agent, publisher := newTestAgent(&AIServices{LLM: llm, TTS: tts})
+	agent.config.Audio.TTSConcurrency = 1
+	agent.persona.Voice = "default-voice"
+	agent.voices = NewVoiceRegistry(map[string]string{"dragon": "dragon-voice", "knight": "knight-voice"})
+	agent.audioOut = &recordingOutput{}
+	participant := &lksdk.RemoteParticipant{}
+
+	if prompt := agent.systemPrompt(context.Background(), participant, "", ""); !strings.Contains(prompt, "dragon、knight") {
+		t.Errorf("system prompt does not list the voices: %q", prompt)
+	}
+
+	agent.respond(context.Background(), participant, participant.Identity(), "讲个故事", "", true)
+
+	want := []string{"从前有一位勇士。=default-voice", "我是龙！=dragon-voice", "勇士拔出了剑。=default-voice", "嘘。=default-voice"}
+	if !reflect.DeepEqual(tts.voices, want) {
+		t.Errorf("synthesized %v, want %v", tts.voices, want)
+	}
+	for _, message := range publisher.Messages() {
+		if strings.Contains(message, "<voice") {
+			t.Errorf("voice tag leaked into a message: %q", message)
+		}
+	}
+}
+
+func TestNamedVoicesValidation(t *testing.T) {
+	if err := NewVoiceRegistry(map[string]string{"dragon": ""}).validate(); err == nil {
+		t.Error("a voice without an id should be rejected")
+	}
+	if err := NewVoiceRegistry(map[string]string{`a"b`: "id"}).validate(); err == nil {
+		t.Error("a name that cannot appear in a tag should be rejected")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+const (
+	defaultWakeTimeout = 8 * time.Second
+	defaultWakeReply   = "我在。"
+)
+
+// WakeWordConfig 让代理在共享空间中只回应说了唤醒词的发言。没有唤醒时在每段发言的识别结果中查找唤醒词，
+// 不调用LLM和语音合成，也不打开流式识别会话；听到唤醒词后收听一轮对话，随后重新等待唤醒
+type WakeWordConfig struct {
+	// 唤醒词，如 ["小助手", "hey agent"]，不区分大小写，忽略其中的空格和标点；为空时不需要唤醒
+	Phrases []string `yaml:"phrases"`
+	// 只说了唤醒词时，等待参与者接着说话的时长，超时后重新等待唤醒
+	Timeout time.Duration `yaml:"timeout"`
+	// 只说了唤醒词时的回应，为空时不回应
+	Reply string `yaml:"reply"`
+}
+
+func (c WakeWordConfig) validate() error {
+	if len(c.Phrases) == 0 {
+		return nil
+	}
+	for _, phrase := range c.Phrases {
+		if normalizeCommand(phrase) == "" {
+			return fmt.Errorf("唤醒词不能为空")
+		}
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout 必须大于0")
+	}
+	return nil
+}
+
+// wakeWordPatterns 为每个唤醒词生成匹配的正则，识别结果在唤醒词的字或词之间加入的空格和标点不影响匹配
+func wakeWordPatterns(phrases []string) []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, phrase := range phrases {
+		var parts []string
+		for _, r := range phrase {
+			if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+				parts = append(parts, regexp.QuoteMeta(string(r)))
+			}
+		}
+		if len(parts) > 0 {
+			patterns = append(patterns, regexp.MustCompile(`(?i)`+strings.Join(parts, `[\s\p{P}]*`)))
+		}
+	}
+	return patterns
+}
+
+// matchWakeWord 在识别结果中查找唤醒词，找到时返回唤醒词之后的内容
+func (a *AIAgent) matchWakeWord(text string) (string, bool) {
+	for _, pattern := range a.wakeWords {
+		if loc := pattern.FindStringIndex(text); loc != nil {
+			return strings.TrimLeftFunc(text[loc[1]:], func(r rune) bool {
+				return unicode.IsSpace(r) || unicode.IsPunct(r)
+			}), true
+		}
+	}
+	return "", false
+}
+
+// wakeWordIdle 判断参与者是否在等待唤醒，唤醒后超时未说话时恢复等待
+func (a *AIAgent) wakeWordIdle(identity string) bool {
+	if len(a.wakeWords) == 0 {
+		return false
+	}
+	a.wakeMu.Lock()
+	defer a.wakeMu.Unlock()
+
+	deadline, ok := a.awake[identity]
+	return !ok || time.Now().After(deadline)
+}
+
+// setAwake 唤醒参与者，之后 timeout 内的一段发言正常回复
+func (a *AIAgent) setAwake(identity string, timeout time.Duration) {
+	a.wakeMu.Lock()
+	defer a.wakeMu.Unlock()
+
+	a.awake[identity] = time.Now().Add(timeout)
+}
+
+// forgetWake 参与者回复了一轮或离开后重新等待唤醒
+func (a *AIAgent) forgetWake(identity string) {
+	a.wakeMu.Lock()
+	defer a.wakeMu.Unlock()
+
+	delete(a.awake, identity)
+}
+
+// passWakeWord 按唤醒状态决定是否回复这段发言。唤醒后的一段发言正常回复；没有唤醒时只回复说了唤醒词的发言，
+// 回复的是唤醒词之后的内容。只说了唤醒词时唤醒参与者并回应，等待参与者接着说话
+func (a *AIAgent) passWakeWord(ctx context.Context, participant *lksdk.RemoteParticipant, transcript Transcript) (Transcript, bool) {
+	identity := participant.Identity()
+	if len(a.wakeWords) == 0 {
+		return transcript, true
+	}
+	if !a.wakeWordIdle(identity) {
+		// 噪声和语气词会在之后被过滤，不占用唤醒后的这一轮
+		if ok, _ := filterTranscript(transcript, a.config.Audio); ok {
+			a.forgetWake(identity)
+		}
+		return transcript, true
+	}
+
+	logger := a.turnLogger(ctx)
+	rest, ok := a.matchWakeWord(transcript.Text)
+	if !ok {
+		logger.Debug("未检测到唤醒词，忽略这段发言")
+		return transcript, false
+	}
+	a.emit(AgentEvent{Type: EventWakeWord, ParticipantIdentity: identity})
+	command := transcript
+	command.Text = rest
+	// 说话人分离的结果包含唤醒词之前的内容，只回复唤醒词之后的话
+	command.Speakers = nil
+	if ok, _ := filterTranscript(command, a.config.Audio); ok {
+		logger.Infof("%s 说出了唤醒词", identity)
+		return command, true
+	}
+
+	logger.Infof("%s 说出了唤醒词，等待接着说话", identity)
+	a.setAwake(identity, a.config.WakeWord.Timeout)
+	if reply := a.config.WakeWord.Reply; reply != "" {
+		a.say(ctx, participant, reply)
+	}
+	return transcript, false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go/v2"
+)
+
+// scriptedSTT 按顺序返回预设的识别结果，并记录每次识别的音频时长
+type scriptedSTT struct {
+	texts     []string
+	durations []time.Duration
+}
+
+func (s *scriptedSTT) Transcribe(ctx context.Context, pcm []byte, lang string) (Transcript, error) {
+	s.durations = append(s.durations, time.Duration(len(pcm)/2)*time.Second/sttSampleRate)
+	text := s.texts[0]
+	s.texts = s.texts[1:]
+	return Transcript{Text: text, Confidence: 0.9, Final: true}, nil
+}
+
+func newWakeWordAgent(stt *scriptedSTT) (*AIAgent, *fakeLLM, *fakePublisher) {
+	llm := &fakeLLM{reply: "好的。"}
+	agent, publisher := newTestAgent(&AIServices{STT: stt, LLM: llm})
+	agent.config.WakeWord.Phrases = []string{"小助手", "hey agent"}
+	agent.wakeWords = wakeWordPatterns(agent.config.WakeWord.Phrases)
+	return agent, llm, publisher
+}
+
+func TestWakeWordGatesUtterances(t *testing.T) {
+	stt := &scriptedSTT{texts: []string{
+		"今天天气不错",
+		"我想问一下，小助手，今天天气怎么样",
+		"Hey, Agent!",
+		"讲个笑话",
+		"再讲一个",
+	}}
+	agent, llm, publisher := newWakeWordAgent(stt)
+	participant := &lksdk.RemoteParticipant{}
+	long := make([]int16, 5*sttSampleRate)
+	short := make([]int16, sttSampleRate)
+
+	// 没有唤醒词的发言被忽略
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: long}, participant)
+	if llm.Calls() != 0 {
+		t.Fatal("responded without the wake word")
+	}
+
+	// 唤醒词可以出现在发言中间，后面的话作为这一轮的发言，不再重新识别
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: long}, participant)
+	if prompts := llm.Prompts(); len(prompts) != 1 || prompts[0] != "今天天气怎么样" {
+		t.Errorf("prompts = %v, want the command after the wake word", prompts)
+	}
+	if len(stt.durations) != 2 {
+		t.Errorf("transcribed %v, want each utterance once", stt.durations)
+	}
+
+	// 只说唤醒词时回应并收听下一段发言，之后重新等待唤醒
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: short}, participant)
+	if !containsString(publisher.Messages(), defaultWakeReply) {
+		t.Errorf("messages = %v, want the wake acknowledgement", publisher.Messages())
+	}
+	if !hasEvent(agent, EventWakeWord) {
+		t.Error("no wake word event")
+	}
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: short}, participant)
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: short}, participant)
+	if prompts := llm.Prompts(); len(prompts) != 2 || prompts[1] != "讲个笑话" {
+		t.Errorf("prompts = %v, want only the turn right after waking", prompts)
+	}
+}
+
+// serverTurnSTT 是由服务端检测发言结束的 fakeStreamingSTT
+type serverTurnSTT struct {
+	*fakeStreamingSTT
+}
+
+func (serverTurnSTT) DetectsTurns() bool { return true }
+
+func TestIdleParticipantDoesNotOpenTurnStream(t *testing.T) {
+	stt := &fakeStreamingSTT{}
+	agent, publisher := newTestAgent(&AIServices{STT: serverTurnSTT{stt}})
+	agent.config.WakeWord.Phrases = []string{"小助手"}
+	agent.wakeWords = wakeWordPatterns(agent.config.WakeWord.Phrases)
+	participant := &lksdk.RemoteParticipant{}
+	turns := agent.newTurnStream(participant, "TR_mic")
+	defer turns.Close()
+
+	if turns.Write(context.Background(), toneFrame(8000)) {
+		t.Fatal("streamed audio while waiting for the wake word")
+	}
+	if n := len(stt.Streams()); n != 0 {
+		t.Errorf("opened %d streams while idle", n)
+	}
+
+	agent.setAwake(participant.Identity(), time.Minute)
+	if !turns.Write(context.Background(), toneFrame(8000)) {
+		t.Fatal("did not stream audio after waking")
+	}
+	// 回复一轮后重新等待唤醒，之后的中间结果不发布
+	stream := stt.Streams()[0]
+	agent.forgetWake(participant.Identity())
+	if turns.Write(context.Background(), toneFrame(8000)) {
+		t.Error("kept streaming after going back to idle")
+	}
+	// 结果通道只能缓冲一条，第三条送入时第一条已经处理完
+	for range 3 {
+		stream.results <- Transcript{Text: "今天"}
+	}
+	if captions := publisher.Captions(); len(captions) != 0 {
+		t.Errorf("published captions while idle: %v", captions)
+	}
+}
+
+func TestWakeWordTimesOut(t *testing.T) {
+	stt := &scriptedSTT{texts: []string{"小助手", "讲个笑话"}}
+	agent, llm, _ := newWakeWordAgent(stt)
+	agent.config.WakeWord.Timeout = 10 * time.Millisecond
+	agent.config.WakeWord.Reply = ""
+	participant := &lksdk.RemoteParticipant{}
+	pcm := make([]int16, sttSampleRate)
+
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: pcm}, participant)
+	time.Sleep(20 * time.Millisecond)
+	agent.processAudioBuffer(context.Background(), turnRequest{pcm: pcm}, participant)
+	if llm.Calls() != 0 {
+		t.Error("responded after the wake window expired")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const wavHeaderSize = 44
+
+// writeWAVHeader 写入16位PCM的WAV头，dataSize 为音频数据字节数
+func writeWAVHeader(w *bytes.Buffer, sampleRate, channels, dataSize int) {
+	byteRate := sampleRate * channels * 2
+	blockAlign := channels * 2
+
+	w.WriteString("RIFF")
+	binary.Write(w, binary.LittleEndian, uint32(36+dataSize))
+	w.WriteString("WAVE")
+	w.WriteString("fmt ")
+	binary.Write(w, binary.LittleEndian, uint32(16))
+	binary.Write(w, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(w, binary.LittleEndian, uint16(channels))
+	binary.Write(w, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(w, binary.LittleEndian, uint32(byteRate))
+	binary.Write(w, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(w, binary.LittleEndian, uint16(16))
+	w.WriteString("data")
+	binary.Write(w, binary.LittleEndian, uint32(dataSize))
+}
+
+// encodeWAV 将单声道16位PCM封装为完整的WAV文件内容
+func encodeWAV(pcm []int16, sampleRate int) []byte {
+	var buf bytes.Buffer
+	buf.Grow(wavHeaderSize + len(pcm)*2)
+	writeWAVHeader(&buf, sampleRate, 1, len(pcm)*2)
+	binary.Write(&buf, binary.LittleEndian, pcm)
+	return buf.Bytes()
+}
+
+// wavWriter 将PCM数据流式写入WAV文件，关闭时回填头部的长度字段
+type wavWriter struct {
+	file       *os.File
+	writer     *bufio.Writer
+	sampleRate int
+	dataSize   int
+}
+
+func newWAVWriter(path string, sampleRate int) (*wavWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("创建WAV文件失败: %w", err)
+	}
+
+	w := &wavWriter{
+		file:       file,
+		writer:     bufio.NewWriter(file),
+		sampleRate: sampleRate,
+	}
+
+	// 先写入长度为0的头部占位，关闭时再更新
+	var header bytes.Buffer
+	writeWAVHeader(&header, sampleRate, 1, 0)
+	if _, err := w.writer.Write(header.Bytes()); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("写入WAV头失败: %w", err)
+	}
+	return w, nil
+}
+
+func (w *wavWriter) Write(pcm []int16) error {
+	if err := binary.Write(w.writer, binary.LittleEndian, pcm); err != nil {
+		return fmt.Errorf("写入WAV数据失败: %w", err)
+	}
+	w.dataSize += len(pcm) * 2
+	return nil
+}
+
+func (w *wavWriter) Close() error {
+	defer w.file.Close()
+
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("写入WAV数据失败: %w", err)
+	}
+
+	var header bytes.Buffer
+	writeWAVHeader(&header, w.sampleRate, 1, w.dataSize)
+	if _, err := w.file.WriteAt(header.Bytes(), 0); err != nil {
+		return fmt.Errorf("更新WAV头失败: %w", err)
+	}
+	return nil
+}
+
+// parseWAV 解析16位PCM的WAV内容，返回音频数据和格式。
+// 数据块长度超出实际内容时（如写到标准输出的流式WAV）按实际长度处理
+func parseWAV(data []byte) ([]byte, AudioFormat, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, AudioFormat{}, fmt.Errorf("不是有效的WAV数据")
+	}
+
+	var format AudioFormat
+	offset := 12
+	for offset+8 <= len(data) {
+		id := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		body := data[offset+8:]
+		if size < 0 || size > len(body) {
+			size = len(body)
+		}
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, AudioFormat{}, fmt.Errorf("WAV格式块过短")
+			}
+			if audioFormat := binary.LittleEndian.Uint16(body); audioFormat != 1 {
+				return nil, AudioFormat{}, fmt.Errorf("不支持的WAV编码: %d", audioFormat)
+			}
+			if bits := binary.LittleEndian.Uint16(body[14:]); bits != 16 {
+				return nil, AudioFormat{}, fmt.Errorf("不支持的WAV位深: %d", bits)
+			}
+			format = AudioFormat{
+				Channels:   int(binary.LittleEndian.Uint16(body[2:])),
+				SampleRate: int(binary.LittleEndian.Uint32(body[4:])),
+				Encoding:   AudioEncodingPCMS16LE,
+			}
+		case "data":
+			if format.SampleRate == 0 {
+				return nil, AudioFormat{}, fmt.Errorf("WAV数据块位于格式块之前")
+			}
+			return body[:size], format, nil
+		}
+
+		// 块按偶数字节对齐
+		offset += 8 + size + size%2
+	}
+	return nil, AudioFormat{}, fmt.Errorf("WAV中缺少数据块")
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var errWhisperNotImplemented = errors.New("本地Whisper识别尚未实现")
+
+// WhisperLocalService 是基于本地Whisper模型的语音识别服务，目前仅用于验证 SpeechToText 抽象
+type WhisperLocalService struct {
+	modelPath string
+}
+
+func NewWhisperLocalService(modelPath string) (*WhisperLocalService, error) {
+	if modelPath == "" {
+		return nil, fmt.Errorf("Whisper model path is required")
+	}
+	return &WhisperLocalService{modelPath: modelPath}, nil
+}
+
+func (s *WhisperLocalService) Transcribe(ctx context.Context, pcm []byte, lang string) (Transcript, error) {
+	return Transcript{}, errWhisperNotImplemented
+}